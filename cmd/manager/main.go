@@ -17,17 +17,22 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/config"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/logging"
 	clientmanagers "github.com/IBM/ibm-storage-odf-block-driver/pkg/managers"
 	"github.com/IBM/ibm-storage-odf-block-driver/pkg/prome"
 	"github.com/IBM/ibm-storage-odf-block-driver/pkg/rest"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/tracing"
 	operatorapi "github.com/IBM/ibm-storage-odf-operator/api/v1alpha1"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
-	log "k8s.io/klog"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 const (
@@ -40,39 +45,63 @@ func init() {
 }
 
 func main() {
-	log.InitFlags(nil)
+	logging.BindFlags(flag.CommandLine)
+	config.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	if err := logging.Init(); err != nil {
+		logging.Error(err, "Invalid log options")
+		os.Exit(1)
+	}
+	if err := config.Init(); err != nil {
+		logging.Error(err, "Load exporter config failed")
+		os.Exit(1)
+	}
+	if err := tracing.Init(config.Get().Tracing); err != nil {
+		logging.Error(err, "Initialize tracing failed")
+		os.Exit(1)
+	}
+	stopCh := make(chan struct{})
+	go config.Watch(stopCh)
 
 	namespace, err := getOperatorNamespace()
 	if err != nil {
+		logging.Error(err, "Could not get operator namespace")
 		os.Exit(1)
 	}
 
-	systems, err := clientmanagers.GetManagers(namespace, make(map[string]*rest.FSRestClient))
+	systems, err := clientmanagers.GetManagers(context.Background(), namespace, make(map[string]*rest.FSRestClient))
 	if err != nil || len(systems) == 0 {
-		log.Error("Could not create managers")
+		logging.Error(err, "Could not create managers", "systems", len(systems))
 		os.Exit(1)
 	}
 
 	// TODO: handle pod terminating signal
 	go prome.RunExporter(systems, namespace)
 	waitForSignal()
+	close(stopCh)
 
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tracing.Shutdown(ctx); err != nil {
+		logging.Error(err, "Flush traces failed")
+	}
 }
 
 func waitForSignal() {
 	sigs := make(chan os.Signal, 1)
 	done := make(chan bool, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
-	log.Info("Awaiting signal to exit")
+	logging.Info("Awaiting signal to exit")
 	go func() {
 		sig := <-sigs
-		log.Infof("Received signal: %+v, clean up...", sig)
+		logging.Info("Received signal, clean up", "signal", sig.String())
 		done <- true
 	}()
 
 	// exiting
 	<-done
-	log.Info("Exiting")
+	logging.Info("Exiting")
 }
 
 func getOperatorNamespace() (string, error) {
@@ -0,0 +1,315 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collectors
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/logging"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/rest"
+)
+
+const (
+	// Metric name shown outside
+	ArrayInfoMetric            = "flashsystem_array_info"
+	ArrayRedundancy            = "flashsystem_array_redundancy"
+	ArrayRedundancyDegraded    = "flashsystem_array_redundancy_degraded"
+	ArrayRebuildAreasAvailable = "flashsystem_array_rebuild_areas_available"
+	ArrayRebuildAreasUsed      = "flashsystem_array_rebuild_areas_used"
+	ArrayRebuildAreasGoal      = "flashsystem_array_rebuild_areas_goal"
+	ArrayMemberStatus          = "flashsystem_array_member_status"
+	ArrayMemberTasks           = "flashsystem_array_member_tasks"
+
+	// Interested keys of lsarray
+	ArrayIdKey                = "mdisk_id"
+	ArrayNameKey              = "mdisk_name"
+	ArrayPoolNameKey          = "mdisk_grp_name"
+	ArrayRaidLevelKey         = "raid_level"
+	ArrayRaidStatusKey        = "raid_status"
+	ArrayRedundancyKey        = "redundancy"
+	ArrayDistributedKey       = "distributed"
+	ArrayTierKey              = "tier"
+	ArrayRebuildAreasTotalKey = "rebuild_areas_total"
+	ArrayRebuildAreasFreeKey  = "rebuild_areas_available"
+	ArrayRebuildAreasGoalKey  = "rebuild_areas_goal"
+
+	// Interested keys of lsarraymember and lsdrive
+	ArrayMemberIdKey      = "member_id"
+	ArrayMemberDriveIdKey = "drive_id"
+	DriveIdKey            = "id"
+	DriveStatusKey        = "status"
+
+	ArrayRaidStatusDegraded = "degraded"
+	DriveStatusOnline       = "online"
+	DriveStatusDegraded     = "degraded"
+)
+
+var (
+	arrayLabel       = []string{"subsystem_name", "pool_name", "array_name"}
+	arrayInfoLabel   = append(append([]string{}, arrayLabel...), "raid_level", "distributed", "tier", "raid_status")
+	arrayMemberLabel = append(append([]string{}, arrayLabel...), "member_id", "drive_id")
+	arrayTaskLabel   = append(append([]string{}, arrayLabel...), "task")
+
+	arrayMetricsMap = map[string]MetricLabel{
+		ArrayInfoMetric:            {"RAID array of the pool, raid_status is the array status of lsarray", arrayInfoLabel},
+		ArrayRedundancy:            {"Number of member drives the array can still lose without losing data", arrayLabel},
+		ArrayRedundancyDegraded:    {"Whether the array has less redundancy than its RAID level provides, 1 = degraded", arrayLabel},
+		ArrayRebuildAreasAvailable: {"Rebuild areas of the distributed array which are available", arrayLabel},
+		ArrayRebuildAreasUsed:      {"Rebuild areas of the distributed array which hold rebuilt data", arrayLabel},
+		ArrayRebuildAreasGoal:      {"Rebuild areas the distributed array should have available", arrayLabel},
+		ArrayMemberStatus:          {"Status of the member drive of the array, 0 = online, 1 = degraded, 2 = offline or missing", arrayMemberLabel},
+		ArrayMemberTasks:           {"Number of members of the array with a task in progress, such as rebuild or copyback", arrayTaskLabel},
+	}
+)
+
+// ArrayInfo is a RAID array of a pool. The rebuild areas are only known for
+// distributed arrays.
+type ArrayInfo struct {
+	Id                    string
+	Name                  string
+	PoolName              string
+	RaidLevel             string
+	RaidStatus            string
+	Distributed           bool
+	Tier                  string
+	Redundancy            int
+	RebuildAreasTotal     int
+	RebuildAreasAvailable int
+	RebuildAreasGoal      int
+	HasRebuildAreas       bool
+	Members               []ArrayMember
+}
+
+// ArrayMember is a member of an array, DriveStatus is empty if the drive
+// status isn't known. The drive of a missing member is empty.
+type ArrayMember struct {
+	Id          string
+	DriveId     string
+	DriveStatus string
+}
+
+func (f *PerfCollector) initArrayDescs() {
+	for metricName, metricLabel := range arrayMetricsMap {
+		f.poolDescriptors[metricName] = prometheus.NewDesc(
+			metricName,
+			metricLabel.Name, metricLabel.Labels, nil,
+		)
+	}
+}
+
+// raidLevelRedundancy returns the number of drives an array of the RAID level
+// can lose when all its members are online.
+func raidLevelRedundancy(raidLevel string) int {
+	switch raidLevel {
+	case "raid0":
+		return 0
+	case "raid6":
+		return 2
+	}
+	return 1
+}
+
+func (a ArrayInfo) redundancyDegraded() bool {
+	if a.RaidStatus == ArrayRaidStatusDegraded || a.Redundancy < raidLevelRedundancy(a.RaidLevel) {
+		return true
+	}
+	for _, member := range a.Members {
+		if member.DriveId == "" || (member.DriveStatus != "" && member.DriveStatus != DriveStatusOnline) {
+			return true
+		}
+	}
+	return false
+}
+
+func memberStatusValue(member ArrayMember) (float64, bool) {
+	switch {
+	case member.DriveId == "":
+		return HealthError, true
+	case member.DriveStatus == "":
+		return 0, false
+	}
+	return driveStatusValue(member.DriveStatus), true
+}
+
+// poolRedundancyDegraded returns whether an array of the pool, or of its
+// parent pool for a child pool, has degraded redundancy.
+func poolRedundancyDegraded(pool *PoolInfo) bool {
+	arrays := pool.Arrays
+	if pool.ParentPool != nil {
+		arrays = pool.ParentPool.Arrays
+	}
+	for _, array := range arrays {
+		if array.redundancyDegraded() {
+			return true
+		}
+	}
+	return false
+}
+
+func atoiOrZero(value string) int {
+	number, _ := strconv.Atoi(value)
+	return number
+}
+
+// getArrays returns the arrays of lsarray with their members. The rebuild
+// areas are read from the cached detailed view of the distributed arrays, and
+// the drive status from drives, which may be nil.
+func getArrays(ctx context.Context, fsRestClient *rest.FSRestClient, details *detailCache, arrays rest.Arrays, members rest.ArrayMembers,
+	drives rest.Drives) []ArrayInfo {
+	logger := logging.WithSystem(fsRestClient.DriverManager.GetSubsystemName())
+	driveStatus := map[string]string{}
+	for _, drive := range drives {
+		driveStatus[drive[DriveIdKey]] = drive[DriveStatusKey]
+	}
+	arrayMembers := map[string][]ArrayMember{}
+	for _, member := range members {
+		arrayMembers[member[ArrayIdKey]] = append(arrayMembers[member[ArrayIdKey]], ArrayMember{
+			Id:          member[ArrayMemberIdKey],
+			DriveId:     member[ArrayMemberDriveIdKey],
+			DriveStatus: driveStatus[member[ArrayMemberDriveIdKey]],
+		})
+	}
+
+	var result []ArrayInfo
+	for _, array := range arrays {
+		info := ArrayInfo{
+			Id:          array[ArrayIdKey],
+			Name:        array[ArrayNameKey],
+			PoolName:    array[ArrayPoolNameKey],
+			RaidLevel:   array[ArrayRaidLevelKey],
+			RaidStatus:  array[ArrayRaidStatusKey],
+			Distributed: array[ArrayDistributedKey] == "yes",
+			Tier:        array[ArrayTierKey],
+			Redundancy:  atoiOrZero(array[ArrayRedundancyKey]),
+			Members:     arrayMembers[array[ArrayIdKey]],
+		}
+		if info.Distributed && fsRestClient.Capabilities().Has(rest.FeatureDistributedRAID) {
+			detail, err := details.get("array/"+info.Id, info.RaidStatus, func() (map[string]string, error) {
+				return fsRestClient.LsSingleArray(ctx, info.Id)
+			})
+			if err != nil {
+				logger.Error(err, "get array detail failed", "array", info.Name)
+			} else if detail[ArrayRebuildAreasTotalKey] != "" {
+				info.RebuildAreasTotal = atoiOrZero(detail[ArrayRebuildAreasTotalKey])
+				info.RebuildAreasAvailable = atoiOrZero(detail[ArrayRebuildAreasFreeKey])
+				info.RebuildAreasGoal = atoiOrZero(detail[ArrayRebuildAreasGoalKey])
+				info.HasRebuildAreas = true
+			}
+		}
+		result = append(result, info)
+	}
+	return result
+}
+
+// setPoolArrays reads the RAID arrays of the system into their pools, and
+// returns the drives of the system. The pools keep no arrays if lsarray fails,
+// the members if lsarraymember fails.
+func setPoolArrays(ctx context.Context, fsRestClient *rest.FSRestClient, details *detailCache, poolsInfoList []PoolInfo,
+	skipped skippedMetrics) rest.Drives {
+	caps := fsRestClient.Capabilities()
+	if len(poolsInfoList) == 0 || !caps.Has(rest.CommandLsarray) {
+		return nil
+	}
+	logger := logging.WithSystem(fsRestClient.DriverManager.GetSubsystemName())
+
+	arrays, err := fsRestClient.Lsarray(ctx)
+	if err != nil {
+		if !skipped.permissionDenied(err) {
+			logger.Error(err, "get arrays failed")
+		}
+		return nil
+	}
+	if len(arrays) == 0 {
+		return nil
+	}
+
+	var members rest.ArrayMembers
+	if caps.Has(rest.CommandLsarraymember) {
+		if members, err = fsRestClient.Lsarraymember(ctx); err != nil && !skipped.permissionDenied(err) {
+			logger.Error(err, "get array members failed")
+		}
+	}
+	var drives rest.Drives
+	if caps.Has(rest.CommandLsdrive) {
+		if drives, err = fsRestClient.Lsdrive(ctx); err != nil && !skipped.permissionDenied(err) {
+			logger.Error(err, "get drives failed")
+		}
+	}
+
+	poolArrays := map[string][]ArrayInfo{}
+	details.expire()
+	for _, array := range getArrays(ctx, fsRestClient, details, arrays, members, drives) {
+		poolArrays[array.PoolName] = append(poolArrays[array.PoolName], array)
+	}
+	for i := range poolsInfoList {
+		poolsInfoList[i].Arrays = poolArrays[poolsInfoList[i].PoolName]
+	}
+	return drives
+}
+
+// collectArrayMetrics reports the RAID arrays of the pools, memberTasks are the
+// array member tasks of lsarraymemberprogress.
+func (f *PerfCollector) collectArrayMetrics(ch chan<- prometheus.Metric, systemName string, poolsInfoList []PoolInfo,
+	memberTasks rest.Operations) {
+	tasks := map[string]map[string]int{}
+	for _, task := range memberTasks {
+		if task[OperationMemberTaskKey] == "" {
+			continue
+		}
+		if tasks[task[OperationArrayIdKey]] == nil {
+			tasks[task[OperationArrayIdKey]] = map[string]int{}
+		}
+		tasks[task[OperationArrayIdKey]][task[OperationMemberTaskKey]]++
+	}
+
+	for _, pool := range poolsInfoList {
+		for _, array := range pool.Arrays {
+			labels := []string{systemName, pool.PoolName, array.Name}
+			ch <- prometheus.MustNewConstMetric(f.poolDescriptors[ArrayInfoMetric], prometheus.GaugeValue, 1,
+				append(labels, array.RaidLevel, strconv.FormatBool(array.Distributed), array.Tier, array.RaidStatus)...)
+			ch <- prometheus.MustNewConstMetric(f.poolDescriptors[ArrayRedundancy], prometheus.GaugeValue, float64(array.Redundancy), labels...)
+			degraded := 0.0
+			if array.redundancyDegraded() {
+				degraded = 1
+			}
+			ch <- prometheus.MustNewConstMetric(f.poolDescriptors[ArrayRedundancyDegraded], prometheus.GaugeValue, degraded, labels...)
+
+			if array.HasRebuildAreas {
+				ch <- prometheus.MustNewConstMetric(f.poolDescriptors[ArrayRebuildAreasAvailable], prometheus.GaugeValue,
+					float64(array.RebuildAreasAvailable), labels...)
+				ch <- prometheus.MustNewConstMetric(f.poolDescriptors[ArrayRebuildAreasUsed], prometheus.GaugeValue,
+					float64(array.RebuildAreasTotal-array.RebuildAreasAvailable), labels...)
+				ch <- prometheus.MustNewConstMetric(f.poolDescriptors[ArrayRebuildAreasGoal], prometheus.GaugeValue,
+					float64(array.RebuildAreasGoal), labels...)
+			}
+
+			for _, member := range array.Members {
+				if status, ok := memberStatusValue(member); ok {
+					ch <- prometheus.MustNewConstMetric(f.poolDescriptors[ArrayMemberStatus], prometheus.GaugeValue, status,
+						append(labels, member.Id, member.DriveId)...)
+				}
+			}
+			for task, count := range tasks[array.Id] {
+				ch <- prometheus.MustNewConstMetric(f.poolDescriptors[ArrayMemberTasks], prometheus.GaugeValue, float64(count),
+					append(labels, task)...)
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collectors
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/rest"
+)
+
+const (
+	// Metric name shown outside
+	SystemCapability = "flashsystem_subsystem_capability"
+)
+
+var (
+	capabilityLabel = []string{"subsystem_name", "capability", "kind", "min_version"}
+
+	capabilityMetricsMap = map[string]MetricLabel{
+		SystemCapability: {"Capability available at the system code level, 1 = available", capabilityLabel},
+	}
+
+	// Metric families which can't be collected without the capability
+	metricCapabilities = map[string]string{
+		SystemPhysicalTotalCapacity: rest.FieldSystemPhysicalCapacity,
+		SystemPhysicalFreeCapacity:  rest.FieldSystemPhysicalCapacity,
+		SystemPhysicalUsedCapacity:  rest.FieldSystemPhysicalCapacity,
+		PoolCapacityUsable:          rest.FieldPoolPhysicalCapacity,
+		PoolCapacityUsed:            rest.FieldPoolPhysicalCapacity,
+		PoolPhysicalCapacity:        rest.FieldPoolPhysicalCapacity,
+		QuorumStatus:                rest.CommandLsquorum,
+		HyperSwapRelationshipState:  rest.FeatureHyperSwap,
+		ArrayRebuildAreasAvailable:  rest.FeatureDistributedRAID,
+		ArrayRebuildAreasUsed:       rest.FeatureDistributedRAID,
+		ArrayRebuildAreasGoal:       rest.FeatureDistributedRAID,
+		DrivePhysicalCapacity:       rest.FeatureFCMCompression,
+		DrivePhysicalUsedCapacity:   rest.FeatureFCMCompression,
+		DriveEffectiveUsedCapacity:  rest.FeatureFCMCompression,
+		DriveCompressionRatio:       rest.FeatureFCMCompression,
+	}
+)
+
+func (f *PerfCollector) initCapabilityDescs() {
+	f.capabilityDescriptors = make(map[string]*prometheus.Desc)
+
+	for metricName, metricLabel := range capabilityMetricsMap {
+		f.capabilityDescriptors[metricName] = prometheus.NewDesc(
+			metricName,
+			metricLabel.Name, metricLabel.Labels, nil,
+		)
+	}
+}
+
+func (f *PerfCollector) collectCapabilityMetrics(ch chan<- prometheus.Metric, systemName string, caps rest.Capabilities) {
+	if !caps.Known() {
+		return
+	}
+
+	for _, capability := range rest.CapabilityMatrix {
+		value := 0.0
+		if caps.Has(capability.Name) {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(
+			f.capabilityDescriptors[SystemCapability],
+			prometheus.GaugeValue,
+			value,
+			systemName,
+			capability.Name,
+			string(capability.Kind),
+			capability.MinVersion,
+		)
+	}
+}
+
+// isMetricSupported returns whether the metric family can be collected at the system code level.
+func isMetricSupported(caps rest.Capabilities, metricName string) bool {
+	capability, ok := metricCapabilities[metricName]
+	return !ok || caps.Has(capability)
+}
@@ -0,0 +1,81 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collectors
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/driver"
+	clientmanagers "github.com/IBM/ibm-storage-odf-block-driver/pkg/managers"
+)
+
+// clusterResources holds the cluster wide resources of a collection cycle. The
+// systems share them, they are listed by the first system which needs them.
+// A failed list isn't retried before the next cycle.
+type clusterResources struct {
+	pvsListed bool
+	pvs       []corev1.PersistentVolume
+	pvsErr    error
+
+	contentsListed bool
+	contents       []unstructured.Unstructured
+	contentsErr    error
+
+	storageClasses map[string]storageClassResult
+}
+
+// storageClassResult is the StorageClass, or why it couldn't be read.
+type storageClassResult struct {
+	storageClass *storagev1.StorageClass
+	err          error
+}
+
+func newClusterResources() *clusterResources {
+	return &clusterResources{storageClasses: map[string]storageClassResult{}}
+}
+
+// persistentVolumes returns the PersistentVolumes of the cluster.
+func (c *clusterResources) persistentVolumes(ctx context.Context, manager *driver.DriverManager) ([]corev1.PersistentVolume, error) {
+	if !c.pvsListed {
+		c.pvs, c.pvsErr = clientmanagers.ListPersistentVolumes(ctx, manager)
+		c.pvsListed = true
+	}
+	return c.pvs, c.pvsErr
+}
+
+// volumeSnapshotContents returns the VolumeSnapshotContents of the cluster.
+func (c *clusterResources) volumeSnapshotContents(ctx context.Context, manager *driver.DriverManager) ([]unstructured.Unstructured, error) {
+	if !c.contentsListed {
+		c.contents, c.contentsErr = clientmanagers.ListVolumeSnapshotContents(ctx, manager)
+		c.contentsListed = true
+	}
+	return c.contents, c.contentsErr
+}
+
+// storageClass returns the StorageClass named name.
+func (c *clusterResources) storageClass(ctx context.Context, manager *driver.DriverManager, name string) (*storagev1.StorageClass, error) {
+	result, ok := c.storageClasses[name]
+	if !ok {
+		result.storageClass, result.err = clientmanagers.GetStorageClass(ctx, manager, name)
+		c.storageClasses[name] = result
+	}
+	return result.storageClass, result.err
+}
@@ -0,0 +1,92 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collectors
+
+import (
+	"sync"
+	"time"
+)
+
+// DetailRefreshInterval is how long the detailed view of a drive or an array
+// is kept. The detailed views cost a command per object and change slowly.
+const DetailRefreshInterval = time.Minute * 10
+
+type cachedDetail struct {
+	detail  map[string]string
+	status  string
+	fetched time.Time
+}
+
+// detailCache keeps the detailed views of the drives and arrays of a system
+// between scrapes. A view is fetched again after DetailRefreshInterval, or
+// once the status of the object in the list view changed.
+type detailCache struct {
+	lock    sync.Mutex
+	details map[string]cachedDetail
+}
+
+// get returns the cached view of the object, or the view of fetch. Failures
+// aren't cached.
+func (c *detailCache) get(key string, status string, fetch func() (map[string]string, error)) (map[string]string, error) {
+	c.lock.Lock()
+	cached, ok := c.details[key]
+	c.lock.Unlock()
+	if ok && cached.status == status && time.Since(cached.fetched) < DetailRefreshInterval {
+		return cached.detail, nil
+	}
+
+	detail, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.details == nil {
+		c.details = map[string]cachedDetail{}
+	}
+	c.details[key] = cachedDetail{detail: detail, status: status, fetched: time.Now()}
+	return detail, nil
+}
+
+// expire drops the views which are too old, such as the views of removed drives.
+func (c *detailCache) expire() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for key, cached := range c.details {
+		if time.Since(cached.fetched) >= DetailRefreshInterval {
+			delete(c.details, key)
+		}
+	}
+}
+
+// systemDetails returns the detailed views of the system, kept between scrapes.
+func (f *PerfCollector) systemDetails(systemName string) *detailCache {
+	f.detailsLock.Lock()
+	defer f.detailsLock.Unlock()
+
+	if f.details == nil {
+		f.details = map[string]*detailCache{}
+	}
+	details, ok := f.details[systemName]
+	if !ok {
+		details = &detailCache{}
+		f.details[systemName] = details
+	}
+	return details
+}
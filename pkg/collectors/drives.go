@@ -0,0 +1,166 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collectors
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/logging"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/rest"
+)
+
+const (
+	// Metric name shown outside
+	DriveInfoMetric            = "flashsystem_drive_info"
+	DriveStatus                = "flashsystem_drive_status"
+	DriveCapacity              = "flashsystem_drive_capacity_bytes"
+	DriveWriteEnduranceUsed    = "flashsystem_drive_write_endurance_used_ratio"
+	DriveReplacementTime       = "flashsystem_drive_replacement_timestamp_seconds"
+	DrivePhysicalCapacity      = "flashsystem_drive_physical_capacity_bytes"
+	DrivePhysicalUsedCapacity  = "flashsystem_drive_physical_used_capacity_bytes"
+	DriveEffectiveUsedCapacity = "flashsystem_drive_effective_used_capacity_bytes"
+	DriveCompressionRatio      = "flashsystem_drive_compression_ratio"
+
+	// Interested keys of lsdrive
+	DriveUseKey                = "use"
+	DriveTechTypeKey           = "tech_type"
+	DriveCapacityKey           = "capacity"
+	DriveArrayIdKey            = "mdisk_id"
+	DriveArrayNameKey          = "mdisk_name"
+	DriveMemberIdKey           = "member_id"
+	DriveFirmwareKey           = "firmware_level"
+	DriveEnduranceUsedKey      = "write_endurance_used"
+	DriveEnduranceRateKey      = "write_endurance_usage_rate"
+	DriveReplacementDateKey    = "replacement_date"
+	DrivePhysicalCapacityKey   = "physical_capacity"
+	DrivePhysicalUsedKey       = "physical_used_capacity"
+	DriveEffectiveUsedKey      = "effective_used_capacity"
+	DriveReplacementDateFormat = "060102"
+)
+
+var (
+	driveLabel     = []string{"subsystem_name", "pool_name", "array_name", "drive_id"}
+	driveInfoLabel = append(append([]string{}, driveLabel...), "member_id", "use", "tech_type", "firmware_level", "write_endurance_usage_rate")
+
+	driveMetricsMap = map[string]MetricLabel{
+		DriveInfoMetric:            {"Drive of the system, use is member, spare, candidate, failed or unused", driveInfoLabel},
+		DriveStatus:                {"Drive status, 0 = online, 1 = degraded, 2 = offline", driveLabel},
+		DriveCapacity:              {"Capacity of the drive (byte)", driveLabel},
+		DriveWriteEnduranceUsed:    {"Write endurance of the flash drive which is used, 0 to 1", driveLabel},
+		DriveReplacementTime:       {"Predicted date the flash drive wears out and should be replaced (unix timestamp)", driveLabel},
+		DrivePhysicalCapacity:      {"Physical capacity of the FlashCore Module (byte)", driveLabel},
+		DrivePhysicalUsedCapacity:  {"Physical capacity of the FlashCore Module used after compression (byte)", driveLabel},
+		DriveEffectiveUsedCapacity: {"Capacity written to the FlashCore Module before compression (byte)", driveLabel},
+		DriveCompressionRatio:      {"Compression ratio of the FlashCore Module, effective used capacity to physical used capacity", driveLabel},
+	}
+)
+
+func (f *PerfCollector) initDriveDescs() {
+	for metricName, metricLabel := range driveMetricsMap {
+		f.poolDescriptors[metricName] = prometheus.NewDesc(
+			metricName,
+			metricLabel.Name, metricLabel.Labels, nil,
+		)
+	}
+}
+
+func driveStatusValue(status string) float64 {
+	switch status {
+	case DriveStatusOnline:
+		return HealthOK
+	case DriveStatusDegraded:
+		return HealthWarning
+	}
+	return HealthError
+}
+
+// newDriveMetric reports the value of a drive field, if the field is set.
+func (f *PerfCollector) newDriveMetric(ch chan<- prometheus.Metric, metricName string, drive map[string]string, key string,
+	scale float64, labels []string) {
+	value, err := strconv.ParseFloat(drive[key], 64)
+	if err != nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(f.poolDescriptors[metricName], prometheus.GaugeValue, value*scale, labels...)
+}
+
+// collectDriveMetrics reports the drives of the arrays of the pools, and the
+// drives which aren't array members, such as spares and failed drives. The
+// drives of the arrays of other pools aren't reported. The endurance and the
+// FlashCore Module capacity are read from the cached detailed view of each drive.
+func (f *PerfCollector) collectDriveMetrics(ctx context.Context, ch chan<- prometheus.Metric, fsRestClient *rest.FSRestClient, details *detailCache,
+	poolsInfoList []PoolInfo, drives rest.Drives) {
+	systemName := fsRestClient.DriverManager.GetSubsystemName()
+	logger := logging.WithSystem(systemName)
+	location := fsRestClient.Location()
+
+	arrayPools := map[string]string{}
+	for _, pool := range poolsInfoList {
+		for _, array := range pool.Arrays {
+			arrayPools[array.Id] = pool.PoolName
+		}
+	}
+
+	for _, drive := range drives {
+		pool, ok := arrayPools[drive[DriveArrayIdKey]]
+		if !ok && drive[DriveArrayIdKey] != "" {
+			continue
+		}
+
+		detail, err := details.get("drive/"+drive[DriveIdKey], drive[DriveStatusKey]+"/"+drive[DriveUseKey], func() (map[string]string, error) {
+			return fsRestClient.LsSingleDrive(ctx, drive[DriveIdKey])
+		})
+		if err != nil {
+			logger.Error(err, "get drive detail failed", "drive", drive[DriveIdKey])
+			detail = drive
+		}
+
+		labels := []string{systemName, pool, drive[DriveArrayNameKey], drive[DriveIdKey]}
+		ch <- prometheus.MustNewConstMetric(f.poolDescriptors[DriveInfoMetric], prometheus.GaugeValue, 1,
+			append(labels, drive[DriveMemberIdKey], drive[DriveUseKey], drive[DriveTechTypeKey], detail[DriveFirmwareKey],
+				detail[DriveEnduranceRateKey])...)
+		ch <- prometheus.MustNewConstMetric(f.poolDescriptors[DriveStatus], prometheus.GaugeValue, driveStatusValue(drive[DriveStatusKey]), labels...)
+		f.newDriveMetric(ch, DriveCapacity, drive, DriveCapacityKey, 1, labels)
+
+		f.newDriveMetric(ch, DriveWriteEnduranceUsed, detail, DriveEnduranceUsedKey, 0.01, labels)
+		if date := detail[DriveReplacementDateKey]; date != "" {
+			if replacement, err := time.ParseInLocation(DriveReplacementDateFormat, date, location); err == nil {
+				ch <- prometheus.MustNewConstMetric(f.poolDescriptors[DriveReplacementTime], prometheus.GaugeValue,
+					float64(replacement.Unix()), labels...)
+			}
+		}
+
+		if !fsRestClient.Capabilities().Has(rest.FeatureFCMCompression) {
+			continue
+		}
+		f.newDriveMetric(ch, DrivePhysicalCapacity, detail, DrivePhysicalCapacityKey, 1, labels)
+		f.newDriveMetric(ch, DrivePhysicalUsedCapacity, detail, DrivePhysicalUsedKey, 1, labels)
+		f.newDriveMetric(ch, DriveEffectiveUsedCapacity, detail, DriveEffectiveUsedKey, 1, labels)
+		physicalUsed, err := strconv.ParseFloat(detail[DrivePhysicalUsedKey], 64)
+		if err != nil || physicalUsed == 0 {
+			continue
+		}
+		if effectiveUsed, err := strconv.ParseFloat(detail[DriveEffectiveUsedKey], 64); err == nil {
+			ch <- prometheus.MustNewConstMetric(f.poolDescriptors[DriveCompressionRatio], prometheus.GaugeValue,
+				effectiveUsed/physicalUsed, labels...)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collectors
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/config"
+)
+
+const (
+	// Metric name shown outside
+	ExporterConfigInfo = "flashsystem_exporter_config_info"
+)
+
+var (
+	exporterConfigLabel = []string{
+		"port",
+		"rest_port",
+		"http_timeout",
+		"failed_event_threshold",
+		"retry_count",
+		"minimum_version",
+		"inventory_mode",
+		"volume_stats_enabled",
+		"volume_stats_top_n",
+		"volume_stats_pool_top_n",
+		"tracing_exporter",
+	}
+
+	exporterMetricsMap = map[string]MetricLabel{
+		ExporterConfigInfo: {"Effective exporter configuration", exporterConfigLabel},
+	}
+)
+
+func (f *PerfCollector) initExporterDescs() {
+	f.exporterDescriptors = make(map[string]*prometheus.Desc)
+
+	for metricName, metricLabel := range exporterMetricsMap {
+		f.exporterDescriptors[metricName] = prometheus.NewDesc(
+			metricName,
+			metricLabel.Name, metricLabel.Labels, nil,
+		)
+	}
+}
+
+func (f *PerfCollector) collectExporterMetrics(ch chan<- prometheus.Metric) {
+	cfg := config.Get()
+	ch <- prometheus.MustNewConstMetric(
+		f.exporterDescriptors[ExporterConfigInfo],
+		prometheus.GaugeValue,
+		1,
+		strconv.Itoa(cfg.Port),
+		strconv.Itoa(cfg.RestPort),
+		cfg.HTTPTimeout.Duration.String(),
+		cfg.FailedEventThreshold.Duration.String(),
+		strconv.Itoa(cfg.RetryCount),
+		cfg.MinimumVersion,
+		strconv.FormatBool(cfg.InventoryMode),
+		strconv.FormatBool(cfg.VolumeStats.Enabled),
+		strconv.Itoa(cfg.VolumeStats.TopN),
+		strconv.Itoa(cfg.VolumeStats.PoolTopN),
+		cfg.Tracing.Exporter,
+	)
+}
@@ -17,11 +17,18 @@
 package collectors
 
 import (
+	"context"
+	"fmt"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/iostats"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/logging"
 	clientmanagers "github.com/IBM/ibm-storage-odf-block-driver/pkg/managers"
 	"github.com/IBM/ibm-storage-odf-block-driver/pkg/rest"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/tracing"
 	"github.com/prometheus/client_golang/prometheus"
-	log "k8s.io/klog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"strconv"
+	"sync"
 )
 
 type PerfCollector struct {
@@ -33,6 +40,27 @@ type PerfCollector struct {
 	sysCapacityDescriptors map[string]*prometheus.Desc
 	poolDescriptors        map[string]*prometheus.Desc
 	volumeDescriptors      map[string]*prometheus.Desc
+	exporterDescriptors    map[string]*prometheus.Desc
+	capabilityDescriptors  map[string]*prometheus.Desc
+	skippedDescriptors     map[string]*prometheus.Desc
+	nodeDescriptors        map[string]*prometheus.Desc
+	topologyDescriptors    map[string]*prometheus.Desc
+	operationDescriptors   map[string]*prometheus.Desc
+
+	// Volume statistics files of each system, kept between scrapes
+	volumeStatsLock sync.Mutex
+	volumeStats     map[string]*iostats.Tracker
+
+	// Detailed views of the drives and arrays of each system, kept between scrapes
+	detailsLock sync.Mutex
+	details     map[string]*detailCache
+
+	// Latest reports of each system, served by the http server
+	noisyNeighbors systemReports[SystemNoisyNeighbors]
+	orphans        systemReports[SystemOrphans]
+
+	// Orphans found by the previous collection of each system
+	orphanCandidates systemReports[map[string]bool]
 
 	// totalScrapes   prometheus.Counter
 	// failedScrapes  prometheus.Counter
@@ -65,6 +93,21 @@ func NewPerfCollector(systems map[string]*rest.FSRestClient, namespace string) (
 
 	f.initSubsystemDescs()
 	f.initPoolDescs()
+	f.initInventoryDescs()
+	f.initArrayDescs()
+	f.initDriveDescs()
+	f.initPoolPerfDescs()
+	f.initNoisyNeighborDescs()
+	f.initOrphanDescs()
+	f.initValidatorDescs()
+	f.initExporterDescs()
+	f.initCapabilityDescs()
+	f.initSkippedDescs()
+	f.initNodeDescs()
+	f.initTopologyDescs()
+	f.initOperationDescs()
+	f.initVolumeDescs()
+	f.initSnapshotDescs()
 
 	return f, nil
 }
@@ -91,6 +134,30 @@ func (f *PerfCollector) Describe(ch chan<- *prometheus.Desc) {
 		ch <- v
 	}
 
+	for _, v := range f.exporterDescriptors {
+		ch <- v
+	}
+
+	for _, v := range f.capabilityDescriptors {
+		ch <- v
+	}
+
+	for _, v := range f.skippedDescriptors {
+		ch <- v
+	}
+
+	for _, v := range f.nodeDescriptors {
+		ch <- v
+	}
+
+	for _, v := range f.topologyDescriptors {
+		ch <- v
+	}
+
+	for _, v := range f.operationDescriptors {
+		ch <- v
+	}
+
 	// ch <- f.totalScrapes.Desc()
 	// ch <- f.failedScrapes.Desc()
 	// ch <- f.scrapeDuration.Desc()
@@ -98,76 +165,148 @@ func (f *PerfCollector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 func (f *PerfCollector) Collect(ch chan<- prometheus.Metric) {
-	updatedSystems, err := clientmanagers.GetManagers(f.namespace, f.systems)
+	ctx, span := tracing.Start(context.Background(), "Collect")
+	defer span.End()
+
+	f.collectExporterMetrics(ch)
+
+	updatedSystems, err := clientmanagers.GetManagers(ctx, f.namespace, f.systems)
 	if err != nil {
+		tracing.RecordError(span, err)
 		return
 	}
 	f.systems = updatedSystems
+	f.noisyNeighbors.prune(f.systems)
+	f.orphans.prune(f.systems)
+	f.orphanCandidates.prune(f.systems)
 
+	// The systems share the cluster resources of the cycle
+	cluster := newClusterResources()
 	for systemName, fsRestClient := range f.systems {
-		var poolsInfoList []PoolInfo
-		pools, mDisksList, err := getSystemPoolsAndMDisks(fsRestClient)
-		if err != nil {
-			log.Errorf("get pools or mdisks failed: %v", err)
+		if err = f.collectSystem(ctx, ch, cluster, systemName, fsRestClient); err != nil {
 			return
 		}
-		for _, pool := range pools {
-			poolInfo := PoolInfo{}
-			poolInfo.PoolName = pool[MdiskNameKey].(string)
-			poolInfo.PoolMDisksList, err = getPoolMDisks(fsRestClient, poolInfo.PoolName, mDisksList)
-			if err != nil {
-				log.Errorf("get mdisks for pool failed: %v", err)
-				return
+	}
+	// ch <- f.scrapeDuration
+	// ch <- f.totalScrapes
+	// ch <- f.failedScrapes
+}
+
+func (f *PerfCollector) collectSystem(ctx context.Context, ch chan<- prometheus.Metric, cluster *clusterResources, systemName string, fsRestClient *rest.FSRestClient) (err error) {
+	ctx, span := tracing.Start(ctx, "CollectSystem", trace.WithAttributes(attribute.String(tracing.SystemKey, systemName)))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	// The capabilities of the code level decide what is collected
+	valid, _ := fsRestClient.CheckVersion(ctx)
+	caps := fsRestClient.Capabilities()
+	f.collectCapabilityMetrics(ch, systemName, caps)
+
+	skipped := skippedMetrics{}
+	skipped.notSupported(caps)
+	defer f.collectSkippedMetrics(ch, systemName, skipped)
+
+	var poolsInfoList []PoolInfo
+	logger := logging.WithSystem(systemName)
+	pools, mDisksList, err := getSystemPoolsAndMDisks(ctx, fsRestClient)
+	if err != nil {
+		if !skipped.permissionDenied(err) {
+			logger.Error(err, "get pools or mdisks failed")
+			return err
+		}
+		// Without the pools only the system metrics are collected
+		pools = nil
+		err = nil
+	}
+	for _, pool := range pools {
+		poolInfo := PoolInfo{}
+		poolInfo.SystemName = systemName
+		poolInfo.Capabilities = caps
+		poolInfo.PoolName = pool[MdiskNameKey].(string)
+		poolInfo.PoolMDisksList, err = getPoolMDisks(ctx, fsRestClient, poolInfo.PoolName, mDisksList)
+		if err != nil {
+			if skipped.permissionDenied(err) {
+				poolsInfoList = nil
+				break
 			}
-			poolInfo.IsInternalStorage = IsPoolFromInternalStorage(poolInfo)
-			poolInfo.IsCompressionEnabled = IsCompressionEnabled(poolInfo)
-			poolInfo.IsArrayMode = IsPoolArrayMode(poolInfo)
-			poolInfo.PoolId, _ = strconv.Atoi(pool[MdiskIdKey].(string))
-			poolInfo.PoolMDiskGrpInfo = pool
-			poolsInfoList = append(poolsInfoList, poolInfo)
+			poolLogger(poolInfo).Error(err, "get mdisks for pool failed")
+			return err
 		}
+		poolInfo.IsInternalStorage = IsPoolFromInternalStorage(poolInfo)
+		poolInfo.IsCompressionEnabled = IsCompressionEnabled(poolInfo)
+		poolInfo.IsArrayMode = IsPoolArrayMode(poolInfo)
+		poolInfo.PoolId, _ = strconv.Atoi(pool[MdiskIdKey].(string))
+		poolInfo.PoolMDiskGrpInfo = pool
+		poolsInfoList = append(poolsInfoList, poolInfo)
+	}
+	linkChildPools(poolsInfoList)
 
-		log.Info("Collect metrics for ", systemName)
-		f.collectSystemMetrics(ch, fsRestClient, poolsInfoList)
+	nodes, nodesErr := fsRestClient.Lsnode(ctx)
+	if nodesErr != nil && !skipped.permissionDenied(nodesErr) {
+		logger.Error(nodesErr, "get nodes failed")
+	}
 
-		valid, _ := fsRestClient.CheckVersion()
-		if valid && len(fsRestClient.DriverManager.GetPoolNames()) > 0 {
-			// Skip unsupported version when generate pool metrics
-			f.collectPoolMetrics(ch, fsRestClient, poolsInfoList)
-		}
+	logger.V(logging.ScrapeLevel).Info("Collect metrics")
+	f.collectSystemMetrics(ctx, ch, fsRestClient, poolsInfoList, nodes, skipped)
+	if nodesErr == nil {
+		f.collectNodeStatusMetrics(ch, systemName, nodes)
+	}
+	f.collectTopologyMetrics(ctx, ch, fsRestClient, nodes, nodesErr, skipped)
+	// The node list only labels the node stats, they are collected without it
+	f.collectNodeMetrics(ctx, ch, fsRestClient, nodes, skipped)
 
+	var perfPools []PoolInfo
+	var drives rest.Drives
+	hasPools := len(fsRestClient.DriverManager.GetPoolNames()) > 0 || InventoryMode()
+	if valid && hasPools && !skipped.has(PoolMetadata) {
+		// The pool health needs the arrays
+		drives = setPoolArrays(ctx, fsRestClient, f.systemDetails(systemName), poolsInfoList, skipped)
+		// Skip unsupported version when generate pool metrics
+		f.collectPoolMetrics(ctx, ch, cluster, fsRestClient, poolsInfoList)
+		perfPools = exportedPools(fsRestClient.DriverManager, poolsInfoList)
+	} else if err := clientmanagers.UpdatePoolCondition(ctx, fsRestClient.DriverManager, nil); err != nil {
+		// Pools which aren't collected aren't reported missing
+		logger.Error(err, "update pool condition failed")
 	}
-	// ch <- f.scrapeDuration
-	// ch <- f.totalScrapes
-	// ch <- f.failedScrapes
+	var volumes rest.Volumes
+	var fcmaps rest.FCMaps
+	if valid {
+		volumes, fcmaps = f.collectVolumeMetrics(ctx, ch, cluster, fsRestClient, perfPools, skipped)
+	}
+	if len(perfPools) > 0 {
+		memberTasks := listOperations(ctx, fsRestClient, rest.CommandLsarraymemberprogress, fsRestClient.Lsarraymemberprogress, skipped)
+		f.collectArrayMetrics(ch, systemName, perfPools, memberTasks)
+		f.collectDriveMetrics(ctx, ch, fsRestClient, f.systemDetails(systemName), perfPools, drives)
+		f.collectOperationMetrics(ctx, ch, fsRestClient, perfPools, volumes, fcmaps, memberTasks, skipped)
+	}
+	return nil
 }
 
-func getSystemPoolsAndMDisks(fsRestClient *rest.FSRestClient) (rest.PoolList, rest.MDisksList, error) {
+func getSystemPoolsAndMDisks(ctx context.Context, fsRestClient *rest.FSRestClient) (rest.PoolList, rest.MDisksList, error) {
 	var pools rest.PoolList
 	var mDisksList rest.MDisksList
-	pools, err := fsRestClient.Lsmdiskgrp()
+	pools, err := fsRestClient.Lsmdiskgrp(ctx)
 	if err != nil {
-		log.Errorf("get pool list error: %v", err)
-		return pools, mDisksList, err
+		return pools, mDisksList, fmt.Errorf("get pool list error: %w", err)
 	}
 
-	mDisksList, err = fsRestClient.LsAllMDisk()
+	mDisksList, err = fsRestClient.LsAllMDisk(ctx)
 	if err != nil {
-		log.Errorf("get disk list error: %v", err)
-		return pools, mDisksList, err
+		return pools, mDisksList, fmt.Errorf("get disk list error: %w", err)
 	}
 	return pools, mDisksList, nil
 }
 
-func getPoolMDisks(fsRestClient *rest.FSRestClient, poolName string, mDisksList rest.MDisksList) ([]rest.SingleMDiskInfo, error) {
+func getPoolMDisks(ctx context.Context, fsRestClient *rest.FSRestClient, poolName string, mDisksList rest.MDisksList) ([]rest.SingleMDiskInfo, error) {
 	var mDisksInPool []rest.SingleMDiskInfo
 	for _, mDisk := range mDisksList {
 		if poolName == mDisk[MdiskGroupNameKey].(string) {
 			mDiskId, _ := strconv.Atoi(mDisk[MdiskIdKey].(string))
-			mDiskInfo, err := fsRestClient.LsSingleMDisk(mDiskId)
+			mDiskInfo, err := fsRestClient.LsSingleMDisk(ctx, mDiskId)
 			if err != nil {
-				log.Errorf("get single mdisk info error: %v", err)
-				return mDisksInPool, err
+				return mDisksInPool, fmt.Errorf("get single mdisk %d info error: %w", mDiskId, err)
 			}
 			mDisksInPool = append(mDisksInPool, mDiskInfo)
 		}
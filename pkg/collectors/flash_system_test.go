@@ -17,18 +17,31 @@
 package collectors
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/config"
 	drivermanager "github.com/IBM/ibm-storage-odf-block-driver/pkg/driver"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/iostats"
 	clientmanagers "github.com/IBM/ibm-storage-odf-block-driver/pkg/managers"
+	"math"
 
 	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus/testutil"
 
 	"github.com/IBM/ibm-storage-odf-block-driver/pkg/rest"
 	operutil "github.com/IBM/ibm-storage-odf-operator/controllers/util"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 func poster(req *http.Request, c *rest.FSRestClient) ([]byte, int, error) {
@@ -80,6 +93,24 @@ func poster(req *http.Request, c *rest.FSRestClient) ([]byte, int, error) {
 				"stat_current": "1",
 				"stat_peak": "690",
 				"stat_peak_time": "210604161807"
+			},
+			{
+				"stat_name": "cpu_pc",
+				"stat_current": "12",
+				"stat_peak": "35",
+				"stat_peak_time": "210604161807"
+			},
+			{
+				"stat_name": "fc_mb",
+				"stat_current": "2",
+				"stat_peak": "4",
+				"stat_peak_time": "210604161807"
+			},
+			{
+				"stat_name": "temp_f",
+				"stat_current": "77",
+				"stat_peak": "77",
+				"stat_peak_time": "210604161807"
 			}
 		]`
 	case "/lsnode":
@@ -87,6 +118,13 @@ func poster(req *http.Request, c *rest.FSRestClient) ([]byte, int, error) {
 			{"name":"node1","id":"1","status":"online","IO_group_name":"io_grp0"},
 			{"name":"node2","id":"2","status":"online","IO_group_name":"io_grp0"}
 		]`
+	case "/lsnodestats":
+		body = `[
+			{"node_id":"1","node_name":"node1","stat_name":"cpu_pc","stat_current":"8","stat_peak":"20","stat_peak_time":"210604161807"},
+			{"node_id":"1","node_name":"node1","stat_name":"vdisk_w_ms","stat_current":"2","stat_peak":"3","stat_peak_time":"210604161807"},
+			{"node_id":"2","node_name":"node2","stat_name":"cpu_pc","stat_current":"75","stat_peak":"90","stat_peak_time":"210604161807"},
+			{"node_id":"2","node_name":"node2","stat_name":"vdisk_w_ms","stat_current":"40","stat_peak":"52","stat_peak_time":"210604161807"}
+		]`
 	case "/lsmdiskgrp":
 		body = `[
 			{
@@ -246,6 +284,8 @@ func poster(req *http.Request, c *rest.FSRestClient) ([]byte, int, error) {
 				"auto_expand_max_capacity": "0"
 			}
 		]`
+	case "/lsvdisk", "/lsdumps", "/lsfcmap", "/lsmigrate", "/lsvdisksyncprogress", "/lsarraysyncprogress", "/lsarraymemberprogress", "/lsarray":
+		body = `[]`
 	case "/lscurrentuser":
 		body = `[{"name": "superuser", "role": "SecurityAdmin"}]`
 	case "/lsmdisk":
@@ -537,6 +577,8 @@ func posterSecondSystem(req *http.Request, c *rest.FSRestClient) ([]byte, int, e
 				"auto_expand_max_capacity": "0"
 			}
 		]`
+	case "/lsvdisk", "/lsdumps", "/lsfcmap", "/lsmigrate", "/lsvdisksyncprogress", "/lsarraysyncprogress", "/lsarraymemberprogress", "/lsarray":
+		body = `[]`
 	case "/lscurrentuser":
 		body = `[{"name": "superuser", "role": "Administrator"}]`
 	case "/lsmdisk":
@@ -685,18 +727,115 @@ var client2 = &rest.FSRestClient{PostRequester: rest.NewRequester(posterSecondSy
 var testCollector, _ = NewPerfCollector(map[string]*rest.FSRestClient{"FS-system-name": client1,
 	"FS-system-name-second": client2}, "FS-ns")
 
+// mockConditions replaces the FlashSystemCluster, StorageClass and PersistentVolume
+// calls, the storage classes are thin provisioned and there's no persistent volume
+// restoreMocks puts back the package mocks when the test ends.
+func restoreMocks(t *testing.T) {
+	checkRestClientState := clientmanagers.CheckRestClientState
+	getStorageCredentials := clientmanagers.GetStorageCredentials
+	getFscMap := clientmanagers.GetFscMap
+	listPersistentVolumes := clientmanagers.ListPersistentVolumes
+	listVolumeSnapshotContents := clientmanagers.ListVolumeSnapshotContents
+	updatePoolCondition := clientmanagers.UpdatePoolCondition
+	updateSiteCondition := clientmanagers.UpdateSiteCondition
+	updateStorageClassCondition := clientmanagers.UpdateStorageClassCondition
+	getStorageClass := clientmanagers.GetStorageClass
+	inventoryMode := InventoryMode
+	volumeStats := VolumeStats
+	t.Cleanup(func() {
+		clientmanagers.CheckRestClientState = checkRestClientState
+		clientmanagers.GetStorageCredentials = getStorageCredentials
+		clientmanagers.GetFscMap = getFscMap
+		clientmanagers.ListPersistentVolumes = listPersistentVolumes
+		clientmanagers.ListVolumeSnapshotContents = listVolumeSnapshotContents
+		clientmanagers.UpdatePoolCondition = updatePoolCondition
+		clientmanagers.UpdateSiteCondition = updateSiteCondition
+		clientmanagers.UpdateStorageClassCondition = updateStorageClassCondition
+		clientmanagers.GetStorageClass = getStorageClass
+		InventoryMode = inventoryMode
+		VolumeStats = volumeStats
+	})
+}
+
+// mockConditions mocks the cluster resources and the conditions, until the test ends.
+func mockConditions(t *testing.T) {
+	restoreMocks(t)
+	clientmanagers.CheckRestClientState = func(ctx context.Context, restClient *rest.FSRestClient, mgr drivermanager.DriverManager, err error) error {
+		return nil
+	}
+	clientmanagers.ListPersistentVolumes = func(ctx context.Context, mgr *drivermanager.DriverManager) ([]corev1.PersistentVolume, error) {
+		return nil, nil
+	}
+	clientmanagers.ListVolumeSnapshotContents = func(ctx context.Context, mgr *drivermanager.DriverManager) ([]unstructured.Unstructured, error) {
+		return nil, nil
+	}
+	clientmanagers.UpdatePoolCondition = func(ctx context.Context, mgr *drivermanager.DriverManager, missingPools map[string][]string) error {
+		return nil
+	}
+	clientmanagers.UpdateSiteCondition = func(ctx context.Context, mgr *drivermanager.DriverManager, lostSites []string) error {
+		return nil
+	}
+	clientmanagers.UpdateStorageClassCondition = func(ctx context.Context, mgr *drivermanager.DriverManager, mismatches map[string][]string) error {
+		return nil
+	}
+	clientmanagers.GetStorageClass = func(ctx context.Context, mgr *drivermanager.DriverManager, name string) (*storagev1.StorageClass, error) {
+		return &storagev1.StorageClass{Provisioner: drivermanager.CSIProvisioner, Parameters: map[string]string{"SpaceEfficiency": "thin"}}, nil
+	}
+}
+
+// mockSystem mocks a system with the credentials and the storage classes
+// fs-sc-1, fs-sc-2... of the pools, until the test ends.
+func mockSystem(t *testing.T, systemName string, restConfig rest.Config, poolNames ...string) {
+	mockConditions(t)
+	clientmanagers.GetStorageCredentials = func(ctx context.Context, client *drivermanager.DriverManager) (rest.Config, error) {
+		return restConfig, nil
+	}
+	scPools := map[string]string{}
+	for i, poolName := range poolNames {
+		scPools[fmt.Sprintf("fs-sc-%d", i+1)] = poolName
+	}
+	clientmanagers.GetFscMap = func() (map[string]operutil.FlashSystemClusterMapContent, error) {
+		return map[string]operutil.FlashSystemClusterMapContent{systemName: {ScPoolMap: scPools}}, nil
+	}
+}
+
 func TestMetrics(t *testing.T) {
 	// Mock the dependency
-	clientmanagers.GetStorageCredentials = func(client *drivermanager.DriverManager) (rest.Config, error) {
+	mockConditions(t)
+	clientmanagers.GetStorageCredentials = func(ctx context.Context, client *drivermanager.DriverManager) (rest.Config, error) {
 		if client.SystemName == "FS-system-name" {
 			return restConfig1, nil
 		}
 		return restConfig2, nil
 	}
 
-	clientmanagers.CheckRestClientState = func(restClient *rest.FSRestClient, mgr drivermanager.DriverManager, err error) error {
+	var missing map[string][]string
+	clientmanagers.UpdatePoolCondition = func(ctx context.Context, mgr *drivermanager.DriverManager, missingPools map[string][]string) error {
+		if mgr.SystemName == "FS-system-name" {
+			missing = missingPools
+		}
 		return nil
 	}
+	var mismatches map[string][]string
+	clientmanagers.UpdateStorageClassCondition = func(ctx context.Context, mgr *drivermanager.DriverManager, storageClassMismatches map[string][]string) error {
+		if mgr.SystemName == "FS-system-name" {
+			mismatches = storageClassMismatches
+		}
+		return nil
+	}
+	storageClassGets := map[string]int{}
+	clientmanagers.GetStorageClass = func(ctx context.Context, mgr *drivermanager.DriverManager, name string) (*storagev1.StorageClass, error) {
+		storageClassGets[name]++
+		params := map[string]string{"SpaceEfficiency": "thin"}
+		if name == "fs-sc-2" {
+			params = map[string]string{"SpaceEfficiency": "dedup_thin", "pool": "Pool0"}
+		}
+		provisioner := drivermanager.CSIProvisioner
+		if name == "fs-sc-4" {
+			provisioner = "example.com/block"
+		}
+		return &storagev1.StorageClass{Provisioner: provisioner, Parameters: params}, nil
+	}
 
 	clientmanagers.GetFscMap = func() (map[string]operutil.FlashSystemClusterMapContent, error) {
 		fscScSecretMap := operutil.FlashSystemClusterMapContent{ScPoolMap: map[string]string{}, Secret: "FC-secret"}
@@ -705,6 +844,7 @@ func TestMetrics(t *testing.T) {
 		fscScSecretMap.ScPoolMap["fs-sc-2"] = "Pool1"
 		fscScSecretMap.ScPoolMap["fs-sc-3"] = "Pool1"
 		fscScSecretMap.ScPoolMap["fs-sc-4"] = "Pool2"
+		fscScSecretMap.ScPoolMap["fs-sc-5"] = "Pool9"
 
 		fscScSecretMapSecond := operutil.FlashSystemClusterMapContent{ScPoolMap: map[string]string{}, Secret: "FC-secret-second"}
 		fscScSecretMapSecond.ScPoolMap["fs-second-sc-1"] = "Pool5"
@@ -713,6 +853,17 @@ func TestMetrics(t *testing.T) {
 		return map[string]operutil.FlashSystemClusterMapContent{"FS-system-name": fscScSecretMap, "FS-system-name-second": fscScSecretMapSecond}, nil
 	}
 
+	// The systems share the cluster resources of the cycle
+	pvLists, contentLists := 0, 0
+	clientmanagers.ListPersistentVolumes = func(ctx context.Context, mgr *drivermanager.DriverManager) ([]corev1.PersistentVolume, error) {
+		pvLists++
+		return nil, nil
+	}
+	clientmanagers.ListVolumeSnapshotContents = func(ctx context.Context, mgr *drivermanager.DriverManager) ([]unstructured.Unstructured, error) {
+		contentLists++
+		return nil, nil
+	}
+
 	testCollector.systems["FS-system-name"].DriverManager.Ready()
 	testCollector.systems["FS-system-name-second"].DriverManager.Ready()
 
@@ -748,7 +899,6 @@ func TestMetrics(t *testing.T) {
 	flashsystem_pool_capacity_usable_bytes{pool_name="Pool1",subsystem_name="FS-system-name"} 1.0798621523968e+13
 	flashsystem_pool_capacity_usable_bytes{pool_name="Pool2",subsystem_name="FS-system-name"} 1.0798621523968e+13
 	flashsystem_pool_capacity_usable_bytes{pool_name="Pool5",subsystem_name="FS-system-name-second"} 1.594291860315e+12
-	flashsystem_pool_capacity_usable_bytes{pool_name="Pool6",subsystem_name="FS-system-name-second"} -1
 
 	# HELP flashsystem_pool_capacity_used_bytes Pool used capacity (byte)
 	# TYPE flashsystem_pool_capacity_used_bytes gauge
@@ -756,7 +906,6 @@ func TestMetrics(t *testing.T) {
 	flashsystem_pool_capacity_used_bytes{pool_name="Pool1",subsystem_name="FS-system-name"} 1.073741824e+09
 	flashsystem_pool_capacity_used_bytes{pool_name="Pool2",subsystem_name="FS-system-name"} 1.073741824e+09
 	flashsystem_pool_capacity_used_bytes{pool_name="Pool5",subsystem_name="FS-system-name-second"} 5.4975581349e+10
-	flashsystem_pool_capacity_used_bytes{pool_name="Pool6",subsystem_name="FS-system-name-second"} -1
 
 	# HELP flashsystem_pool_capacity_bytes Pool total capacity (bytes)
 	# TYPE flashsystem_pool_capacity_bytes gauge
@@ -764,7 +913,6 @@ func TestMetrics(t *testing.T) {
 	flashsystem_pool_capacity_bytes{pool_name="Pool1",subsystem_name="FS-system-name"} 1.0799695265792e+13
 	flashsystem_pool_capacity_bytes{pool_name="Pool2",subsystem_name="FS-system-name"} 1.0799695265792e+13
 	flashsystem_pool_capacity_bytes{pool_name="Pool5",subsystem_name="FS-system-name-second"} 1.649267441664e+12
-	flashsystem_pool_capacity_bytes{pool_name="Pool6",subsystem_name="FS-system-name-second"} -1
 
 	# HELP flashsystem_capacity_warning_threshold Pool capacity warning threshold
 	# TYPE flashsystem_capacity_warning_threshold gauge
@@ -774,7 +922,7 @@ func TestMetrics(t *testing.T) {
 	flashsystem_capacity_warning_threshold{pool_name="Pool5",subsystem_name="FS-system-name-second"} 80
 	flashsystem_capacity_warning_threshold{pool_name="Pool6",subsystem_name="FS-system-name-second"} 80
 
-	# HELP flashsystem_pool_health Pool health status
+	# HELP flashsystem_pool_health Pool health status, 0 = online, 1 = degraded or an array with degraded redundancy, 2 = offline
 	# TYPE flashsystem_pool_health gauge
 	flashsystem_pool_health{pool_name="Pool0",subsystem_name="FS-system-name"} 0
 	flashsystem_pool_health{pool_name="Pool1",subsystem_name="FS-system-name"} 2
@@ -790,13 +938,90 @@ func TestMetrics(t *testing.T) {
 	flashsystem_pool_savings_bytes{pool_name="Pool5",subsystem_name="FS-system-name-second"} 0
 	flashsystem_pool_savings_bytes{pool_name="Pool6",subsystem_name="FS-system-name-second"} 1.0505892864e+10
 
+	# HELP flashsystem_pool_savings_thin_bytes thin provisioning savings
+	# TYPE flashsystem_pool_savings_thin_bytes gauge
+	flashsystem_pool_savings_thin_bytes{pool_name="Pool0",subsystem_name="FS-system-name"} 2.064998802432e+12
+	flashsystem_pool_savings_thin_bytes{pool_name="Pool1",subsystem_name="FS-system-name"} 1.0505892864e+10
+	flashsystem_pool_savings_thin_bytes{pool_name="Pool2",subsystem_name="FS-system-name"} 0
+	flashsystem_pool_savings_thin_bytes{pool_name="Pool5",subsystem_name="FS-system-name-second"} 0
+	flashsystem_pool_savings_thin_bytes{pool_name="Pool6",subsystem_name="FS-system-name-second"} 1.0505892864e+10
+
+	# HELP flashsystem_pool_savings_dedup_bytes dedupe savings
+	# TYPE flashsystem_pool_savings_dedup_bytes gauge
+	flashsystem_pool_savings_dedup_bytes{pool_name="Pool0",subsystem_name="FS-system-name"} 0
+	flashsystem_pool_savings_dedup_bytes{pool_name="Pool1",subsystem_name="FS-system-name"} 0
+	flashsystem_pool_savings_dedup_bytes{pool_name="Pool2",subsystem_name="FS-system-name"} 0
+	flashsystem_pool_savings_dedup_bytes{pool_name="Pool5",subsystem_name="FS-system-name-second"} 0
+	flashsystem_pool_savings_dedup_bytes{pool_name="Pool6",subsystem_name="FS-system-name-second"} 0
+
+	# HELP flashsystem_pool_savings_compression_bytes compression savings
+	# TYPE flashsystem_pool_savings_compression_bytes gauge
+	flashsystem_pool_savings_compression_bytes{pool_name="Pool0",subsystem_name="FS-system-name"} 0
+	flashsystem_pool_savings_compression_bytes{pool_name="Pool1",subsystem_name="FS-system-name"} 0
+	flashsystem_pool_savings_compression_bytes{pool_name="Pool2",subsystem_name="FS-system-name"} 0
+	flashsystem_pool_savings_compression_bytes{pool_name="Pool5",subsystem_name="FS-system-name-second"} 0
+	flashsystem_pool_savings_compression_bytes{pool_name="Pool6",subsystem_name="FS-system-name-second"} 0
+
+	# HELP flashsystem_pool_data_reduction_ratio Pool data reduction ratio, written capacity to stored capacity without thin provisioning
+	# TYPE flashsystem_pool_data_reduction_ratio gauge
+	flashsystem_pool_data_reduction_ratio{pool_name="Pool0",subsystem_name="FS-system-name"} 1
+	flashsystem_pool_data_reduction_ratio{pool_name="Pool1",subsystem_name="FS-system-name"} 1
+	flashsystem_pool_data_reduction_ratio{pool_name="Pool2",subsystem_name="FS-system-name"} 1
+	flashsystem_pool_data_reduction_ratio{pool_name="Pool5",subsystem_name="FS-system-name-second"} 1
+	flashsystem_pool_data_reduction_ratio{pool_name="Pool6",subsystem_name="FS-system-name-second"} 1
+
+	# HELP flashsystem_subsystem_savings_bytes System dedupe, thin provisioning, and compression savings of all pools
+	# TYPE flashsystem_subsystem_savings_bytes gauge
+	flashsystem_subsystem_savings_bytes{subsystem_name="FS-system-name"} 2.075504695296e+12
+	flashsystem_subsystem_savings_bytes{subsystem_name="FS-system-name-second"} 0
+
+	# HELP flashsystem_subsystem_savings_thin_bytes System thin provisioning savings of all pools
+	# TYPE flashsystem_subsystem_savings_thin_bytes gauge
+	flashsystem_subsystem_savings_thin_bytes{subsystem_name="FS-system-name"} 2.075504695296e+12
+	flashsystem_subsystem_savings_thin_bytes{subsystem_name="FS-system-name-second"} 0
+
+	# HELP flashsystem_subsystem_savings_dedup_bytes System dedupe savings of all pools
+	# TYPE flashsystem_subsystem_savings_dedup_bytes gauge
+	flashsystem_subsystem_savings_dedup_bytes{subsystem_name="FS-system-name"} 0
+	flashsystem_subsystem_savings_dedup_bytes{subsystem_name="FS-system-name-second"} 0
+
+	# HELP flashsystem_subsystem_savings_compression_bytes System compression savings of all pools
+	# TYPE flashsystem_subsystem_savings_compression_bytes gauge
+	flashsystem_subsystem_savings_compression_bytes{subsystem_name="FS-system-name"} 0
+	flashsystem_subsystem_savings_compression_bytes{subsystem_name="FS-system-name-second"} 0
+
+	# HELP flashsystem_subsystem_data_reduction_ratio System data reduction ratio, written capacity to stored capacity without thin provisioning
+	# TYPE flashsystem_subsystem_data_reduction_ratio gauge
+	flashsystem_subsystem_data_reduction_ratio{subsystem_name="FS-system-name"} 1
+	flashsystem_subsystem_data_reduction_ratio{subsystem_name="FS-system-name-second"} 1
+
+	# HELP flashsystem_storageclass_info Storage class to pool mapping
+	# TYPE flashsystem_storageclass_info gauge
+	flashsystem_storageclass_info{pool_name="Pool0",provisioner="block.csi.ibm.com",storageclass="fs-sc-default",subsystem_name="FS-system-name"} 1
+	flashsystem_storageclass_info{pool_name="Pool0",provisioner="block.csi.ibm.com",storageclass="fs-sc-1",subsystem_name="FS-system-name"} 1
+	flashsystem_storageclass_info{pool_name="Pool1",provisioner="block.csi.ibm.com",storageclass="fs-sc-2",subsystem_name="FS-system-name"} 1
+	flashsystem_storageclass_info{pool_name="Pool1",provisioner="block.csi.ibm.com",storageclass="fs-sc-3",subsystem_name="FS-system-name"} 1
+	flashsystem_storageclass_info{pool_name="Pool2",provisioner="example.com/block",storageclass="fs-sc-4",subsystem_name="FS-system-name"} 1
+	flashsystem_storageclass_info{pool_name="Pool9",provisioner="block.csi.ibm.com",storageclass="fs-sc-5",subsystem_name="FS-system-name"} 1
+	flashsystem_storageclass_info{pool_name="Pool5",provisioner="block.csi.ibm.com",storageclass="fs-second-sc-1",subsystem_name="FS-system-name-second"} 1
+	flashsystem_storageclass_info{pool_name="Pool6",provisioner="block.csi.ibm.com",storageclass="fs-second-sc-2",subsystem_name="FS-system-name-second"} 1
+
+	# HELP flashsystem_pool_not_found Pool used by the storage class isn't found on the system
+	# TYPE flashsystem_pool_not_found gauge
+	flashsystem_pool_not_found{pool_name="Pool9",storageclass="fs-sc-5",subsystem_name="FS-system-name"} 1
+
+	# HELP flashsystem_storageclass_parameter_mismatch Storage class parameter which the pool can't provide
+	# TYPE flashsystem_storageclass_parameter_mismatch gauge
+	flashsystem_storageclass_parameter_mismatch{pool_name="Pool1",reason="deduplication_not_supported",storageclass="fs-sc-2",subsystem_name="FS-system-name"} 1
+	flashsystem_storageclass_parameter_mismatch{pool_name="Pool1",reason="pool_mismatch",storageclass="fs-sc-2",subsystem_name="FS-system-name"} 1
+
 	# HELP flashsystem_pool_metadata Pool metadata
 	# TYPE flashsystem_pool_metadata gauge
-	flashsystem_pool_metadata{is_internal_storage="0",pool_id="0",pool_name="Pool0",storageclass="fs-sc-1,fs-sc-default",subsystem_name="FS-system-name"} 0
-	flashsystem_pool_metadata{is_internal_storage="1",pool_id="1",pool_name="Pool1",storageclass="fs-sc-2,fs-sc-3",subsystem_name="FS-system-name"} 0
-	flashsystem_pool_metadata{is_internal_storage="1",pool_id="2",pool_name="Pool2",storageclass="fs-sc-4",subsystem_name="FS-system-name"} 0
-	flashsystem_pool_metadata{is_internal_storage="1",pool_id="5",pool_name="Pool5",storageclass="fs-second-sc-1",subsystem_name="FS-system-name-second"} 0
-	flashsystem_pool_metadata{is_internal_storage="1",pool_id="6",pool_name="Pool6",storageclass="fs-second-sc-2",subsystem_name="FS-system-name-second"} 0
+	flashsystem_pool_metadata{is_internal_storage="0",parent_pool="",pool_id="0",pool_name="Pool0",storageclass="fs-sc-1,fs-sc-default",subsystem_name="FS-system-name"} 0
+	flashsystem_pool_metadata{is_internal_storage="1",parent_pool="",pool_id="1",pool_name="Pool1",storageclass="fs-sc-2,fs-sc-3",subsystem_name="FS-system-name"} 0
+	flashsystem_pool_metadata{is_internal_storage="1",parent_pool="",pool_id="2",pool_name="Pool2",storageclass="fs-sc-4",subsystem_name="FS-system-name"} 0
+	flashsystem_pool_metadata{is_internal_storage="1",parent_pool="",pool_id="5",pool_name="Pool5",storageclass="fs-second-sc-1",subsystem_name="FS-system-name-second"} 0
+	flashsystem_pool_metadata{is_internal_storage="1",parent_pool="Pool1",pool_id="6",pool_name="Pool6",storageclass="fs-second-sc-2",subsystem_name="FS-system-name-second"} 0
 
 	# HELP flashsystem_subsystem_metadata System information
 	# TYPE flashsystem_subsystem_metadata gauge
@@ -848,6 +1073,69 @@ func TestMetrics(t *testing.T) {
 	flashsystem_subsystem_wr_iops{subsystem_name="FS-system-name"} 11
 	flashsystem_subsystem_wr_iops{subsystem_name="FS-system-name-second"} 13
 
+	# HELP flashsystem_subsystem_wr_latency_seconds_peak overall performance - write latency seconds, peak of the last 5 minutes
+	# TYPE flashsystem_subsystem_wr_latency_seconds_peak gauge
+	flashsystem_subsystem_wr_latency_seconds_peak{subsystem_name="FS-system-name"} 0.6900000000000001
+	flashsystem_subsystem_wr_latency_seconds_peak{subsystem_name="FS-system-name-second"} 0.6900000000000001
+
+	# HELP flashsystem_subsystem_wr_latency_seconds_peak_timestamp_seconds overall performance - write latency seconds, time of the peak
+	# TYPE flashsystem_subsystem_wr_latency_seconds_peak_timestamp_seconds gauge
+	flashsystem_subsystem_wr_latency_seconds_peak_timestamp_seconds{subsystem_name="FS-system-name"} 1.622823487e+09
+	flashsystem_subsystem_wr_latency_seconds_peak_timestamp_seconds{subsystem_name="FS-system-name-second"} 1.622823487e+09
+
+	# HELP flashsystem_subsystem_cpu_utilization_ratio overall performance - CPU utilization ratio
+	# TYPE flashsystem_subsystem_cpu_utilization_ratio gauge
+	flashsystem_subsystem_cpu_utilization_ratio{subsystem_name="FS-system-name"} 0.12
+
+	# HELP flashsystem_subsystem_cpu_utilization_ratio_peak overall performance - CPU utilization ratio, peak of the last 5 minutes
+	# TYPE flashsystem_subsystem_cpu_utilization_ratio_peak gauge
+	flashsystem_subsystem_cpu_utilization_ratio_peak{subsystem_name="FS-system-name"} 0.35000000000000003
+
+	# HELP flashsystem_subsystem_fc_bytes overall performance - fibre channel throughput bytes/s
+	# TYPE flashsystem_subsystem_fc_bytes gauge
+	flashsystem_subsystem_fc_bytes{subsystem_name="FS-system-name"} 2.097152e+06
+
+	# HELP flashsystem_subsystem_stat overall performance - statistic without a dedicated metric, in the unit of lssystemstats
+	# TYPE flashsystem_subsystem_stat gauge
+	flashsystem_subsystem_stat{stat="temp_f",subsystem_name="FS-system-name"} 77
+
+	# HELP flashsystem_node_cpu_utilization_ratio node performance - CPU utilization ratio
+	# TYPE flashsystem_node_cpu_utilization_ratio gauge
+	flashsystem_node_cpu_utilization_ratio{io_group="io_grp0",node_name="node1",site="",subsystem_name="FS-system-name"} 0.08
+	flashsystem_node_cpu_utilization_ratio{io_group="io_grp0",node_name="node2",site="",subsystem_name="FS-system-name"} 0.75
+
+	# HELP flashsystem_node_wr_latency_seconds node performance - write latency seconds
+	# TYPE flashsystem_node_wr_latency_seconds gauge
+	flashsystem_node_wr_latency_seconds{io_group="io_grp0",node_name="node1",site="",subsystem_name="FS-system-name"} 0.002
+	flashsystem_node_wr_latency_seconds{io_group="io_grp0",node_name="node2",site="",subsystem_name="FS-system-name"} 0.04
+
+	# HELP flashsystem_node_status Node status, 0 = online, 1 = not serving IO, 2 = offline
+	# TYPE flashsystem_node_status gauge
+	flashsystem_node_status{io_group="io_grp0",node_name="node1",site="",subsystem_name="FS-system-name"} 0
+	flashsystem_node_status{io_group="io_grp0",node_name="node2",site="",subsystem_name="FS-system-name"} 0
+	flashsystem_node_status{io_group="io_grp0",node_name="node1",site="",subsystem_name="FS-system-name-second"} 0
+	flashsystem_node_status{io_group="io_grp0",node_name="node2",site="",subsystem_name="FS-system-name-second"} 0
+
+	# HELP flashsystem_iogroup_node_count Number of nodes in the IO group
+	# TYPE flashsystem_iogroup_node_count gauge
+	flashsystem_iogroup_node_count{io_group="io_grp0",subsystem_name="FS-system-name"} 2
+	flashsystem_iogroup_node_count{io_group="io_grp0",subsystem_name="FS-system-name-second"} 2
+
+	# HELP flashsystem_iogroup_online_node_count Number of healthy nodes in the IO group
+	# TYPE flashsystem_iogroup_online_node_count gauge
+	flashsystem_iogroup_online_node_count{io_group="io_grp0",subsystem_name="FS-system-name"} 2
+	flashsystem_iogroup_online_node_count{io_group="io_grp0",subsystem_name="FS-system-name-second"} 2
+
+	# HELP flashsystem_iogroup_ha_state IO group high availability, 0 = redundant, 1 = no redundancy, 2 = offline
+	# TYPE flashsystem_iogroup_ha_state gauge
+	flashsystem_iogroup_ha_state{io_group="io_grp0",subsystem_name="FS-system-name"} 0
+	flashsystem_iogroup_ha_state{io_group="io_grp0",subsystem_name="FS-system-name-second"} 0
+
+	# HELP flashsystem_subsystem_topology System topology, standard, stretched or hyperswap
+	# TYPE flashsystem_subsystem_topology gauge
+	flashsystem_subsystem_topology{subsystem_name="FS-system-name",topology="standard"} 1
+	flashsystem_subsystem_topology{subsystem_name="FS-system-name-second",topology="standard"} 1
+
 	# HELP flashsystem_subsystem_physical_free_capacity_bytes System physical free capacity (byte)
 	# TYPE flashsystem_subsystem_physical_free_capacity_bytes gauge
 	flashsystem_subsystem_physical_free_capacity_bytes{subsystem_name="FS-system-name"} 3.741645275136e+13
@@ -866,12 +1154,1460 @@ func TestMetrics(t *testing.T) {
 
 	err := testutil.CollectAndCompare(testCollector, strings.NewReader(expected),
 		SystemReadIOPS, SystemWriteIOPS, SystemReadBytes, SystemWriteBytes, SystemLatency, SystemReadLatency,
-		SystemWriteLatency, SystemMetadata, SystemHealth, SystemResponse, SystemPhysicalTotalCapacity,
+		SystemWriteLatency, SystemWriteLatency+peakSuffix, SystemWriteLatency+peakTimeSuffix,
+		SystemMetricPrefix+"cpu_utilization_ratio", SystemMetricPrefix+"cpu_utilization_ratio"+peakSuffix, SystemMetricPrefix+"fc_bytes", SystemStat,
+		NodeMetricPrefix+"cpu_utilization_ratio", NodeMetricPrefix+"wr_latency_seconds",
+		NodeStatus, IOGroupNodeCount, IOGroupOnlineNodeCount, IOGroupHAState, SystemTopology,
+		SystemMetadata, SystemHealth, SystemResponse, SystemPhysicalTotalCapacity,
 		SystemPhysicalUsedCapacity, SystemPhysicalFreeCapacity,
-		PoolMetadata, PoolHealth, PoolWarningThreshold, PoolLogicalCapacity, PoolCapacityUsable, PoolPhysicalCapacity, PoolCapacityUsed, PoolEfficiencySavings,
-		PoolLogicalCapacityUsable, PoolLogicalCapacityUsed)
+		PoolMetadata, StorageClassInfo, PoolNotFound, StorageClassMismatch, PoolHealth, PoolWarningThreshold, PoolLogicalCapacity, PoolCapacityUsable, PoolPhysicalCapacity, PoolCapacityUsed, PoolEfficiencySavings,
+		PoolLogicalCapacityUsable, PoolLogicalCapacityUsed,
+		PoolEfficiencySavingsThin, PoolEfficiencySavingsDedup, PoolEfficiencySavingsCompression, PoolDataReductionRatio,
+		SystemEfficiencySavings, SystemEfficiencySavingsThin, SystemEfficiencySavingsDedup, SystemEfficiencySavingsCompression,
+		SystemDataReductionRatio)
+
+	if err != nil {
+		t.Errorf("unexpected metrics:\n %s", err)
+	}
+	if scNames := missing["Pool9"]; len(missing) != 1 || len(scNames) != 1 || scNames[0] != "fs-sc-5" {
+		t.Errorf("Pool9 of fs-sc-5 should be missing, got %v", missing)
+	}
+	if reasons := mismatches["fs-sc-2"]; len(mismatches) != 1 || len(reasons) != 2 {
+		t.Errorf("fs-sc-2 should mismatch Pool1, got %v", mismatches)
+	}
+	if pvLists != 1 || contentLists != 1 {
+		t.Errorf("the persistent volumes and snapshot contents should be listed once, got %d and %d lists", pvLists, contentLists)
+	}
+	for name, gets := range storageClassGets {
+		if gets != 1 {
+			t.Errorf("storage class %s should be read once, got %d reads", name, gets)
+		}
+	}
+	if len(storageClassGets) != 8 {
+		t.Errorf("the 8 storage classes should be read, got %v", storageClassGets)
+	}
+}
+
+func TestCapabilityFormulas(t *testing.T) {
+	mDisk := rest.SingleMDiskInfo{
+		"physical_capacity":       "1099511627776",
+		"physical_free_capacity":  "777389080576",
+		"effective_used_capacity": "1099511627776",
+	}
+	oldLevel := rest.CapabilitiesForCodeLevel("8.2.0.0")
+	newLevel := rest.CapabilitiesForCodeLevel("8.4.0.2")
+
+	t.Run("Effective used capacity before FCM", func(t *testing.T) {
+		_, EU, _, err := calcSingleMDiskCapacity(mDisk, oldLevel)
+		if err != nil || EU != 322122547200 {
+			t.Errorf("effective used capacity should be physical used capacity, got %v", EU)
+		}
+	})
+
+	t.Run("Effective used capacity with FCM", func(t *testing.T) {
+		_, EU, _, err := calcSingleMDiskCapacity(mDisk, newLevel)
+		if err != nil || EU != 1099511627776 {
+			t.Errorf("effective used capacity should be reported value, got %v", EU)
+		}
+	})
+
+	t.Run("Compression disabled before FCM", func(t *testing.T) {
+		pool := PoolInfo{PoolMDisksList: []rest.SingleMDiskInfo{mDisk}, Capabilities: oldLevel}
+		if IsCompressionEnabled(pool) {
+			t.Errorf("compression shouldn't be enabled before FCM support")
+		}
+		pool.Capabilities = newLevel
+		if !IsCompressionEnabled(pool) {
+			t.Errorf("compression should be enabled")
+		}
+	})
+
+	t.Run("Physical capacity metrics need the code level", func(t *testing.T) {
+		if isMetricSupported(oldLevel, PoolPhysicalCapacity) || !isMetricSupported(newLevel, PoolPhysicalCapacity) {
+			t.Errorf("pool physical capacity should be gated by the code level")
+		}
+	})
+}
+
+func TestValidateStorageClass(t *testing.T) {
+	caps := rest.CapabilitiesForCodeLevel("8.4.0.2")
+	drp := PoolInfo{PoolName: "drp", Capabilities: caps, PoolMDiskGrpInfo: Pool{"data_reduction": "yes"}}
+	standard := PoolInfo{PoolName: "standard", Capabilities: caps, PoolMDiskGrpInfo: Pool{"data_reduction": "no"}}
+
+	tests := []struct {
+		name   string
+		params map[string]string
+		pool   PoolInfo
+		want   []string
+	}{
+		{"Thin on standard pool", map[string]string{"SpaceEfficiency": "thin", "pool": "standard"}, standard, nil},
+		{"Compressed on data reduction pool", map[string]string{"SpaceEfficiency": "Compressed"}, drp, nil},
+		{"Compressed on standard pool", map[string]string{"SpaceEfficiency": "compressed"}, standard, []string{MismatchCompression}},
+		{"Dedup on standard pool", map[string]string{"SpaceEfficiency": "dedup_compressed"}, standard, []string{MismatchDeduplication}},
+		{"Other pool", map[string]string{"pool": "drp"}, standard, []string{MismatchPool}},
+		{"Pool per system", map[string]string{"pool": "drp", "by_system_id": `{"system1": "drp"}`}, standard, nil},
+		{"Unknown space efficiency", map[string]string{"SpaceEfficiency": "sparse"}, drp, []string{MismatchInvalidEfficiency}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validateStorageClass(tt.params, tt.pool); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateStorageClass() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChildPoolCapacity(t *testing.T) {
+	parent := PoolInfo{PoolName: "Parent", Capabilities: rest.CapabilitiesForCodeLevel("8.4.0.2"), PoolMDiskGrpInfo: Pool{
+		"id":                     "0",
+		"parent_mdisk_grp_id":    "0",
+		"capacity":               "1000",
+		"free_capacity":          "300",
+		"physical_capacity":      "2000",
+		"physical_free_capacity": "1500",
+		"reclaimable_capacity":   "0",
+	}}
+	child := PoolInfo{PoolName: "Child", PoolMDiskGrpInfo: Pool{
+		"id":                    "1",
+		"parent_mdisk_grp_id":   "0",
+		"parent_mdisk_grp_name": "Parent",
+		"capacity":              "400",
+		"free_capacity":         "100",
+	}}
+	pools := []PoolInfo{parent, child}
+	linkChildPools(pools)
+
+	t.Run("Child pool share of the parent", func(t *testing.T) {
+		usable, used, total, err := calcChildPoolCapacity(pools[1])
+		if err != nil || usable != 200 || used != 600 || total != 800 {
+			t.Errorf("calcChildPoolCapacity() = %v, %v, %v, %v", usable, used, total, err)
+		}
+		if name := parentPoolName(pools[1]); name != "Parent" {
+			t.Errorf("parent pool name = %q, want Parent", name)
+		}
+	})
+
+	t.Run("Child free capacity isn't used in the parent", func(t *testing.T) {
+		childFree, err := getChildPoolsFreeCapacity(pools[0])
+		if err != nil || childFree != 100 {
+			t.Errorf("getChildPoolsFreeCapacity() = %v, %v", childFree, err)
+		}
+	})
+
+	t.Run("Missing parent pool", func(t *testing.T) {
+		if _, _, total, err := calcChildPoolCapacity(child); err == nil || total != InvalidVal {
+			t.Errorf("child pool without parent should be invalid, got %v, %v", total, err)
+		}
+	})
+
+	t.Run("Parent pool without physical capacity", func(t *testing.T) {
+		oldParent := PoolInfo{PoolName: "Parent", PoolMDiskGrpInfo: Pool{"id": "0", "parent_mdisk_grp_id": "0", "capacity": "1000"}}
+		orphan := child
+		orphan.ParentPool = &oldParent
+		if _, _, total, err := calcChildPoolCapacity(orphan); err == nil || total != InvalidVal {
+			t.Errorf("parent pool without physical capacity should be invalid, got %v, %v", total, err)
+		}
+	})
+}
+
+func TestPoolSavings(t *testing.T) {
+	caps := rest.CapabilitiesForCodeLevel("8.4.0.2")
+	drp := PoolInfo{Capabilities: caps, PoolMDiskGrpInfo: Pool{
+		"id":                                "0",
+		"parent_mdisk_grp_id":               "0",
+		"data_reduction":                    "yes",
+		"compression_active":                "yes",
+		"virtual_capacity":                  "1000",
+		"real_capacity":                     "900",
+		"physical_capacity":                 "1000",
+		"physical_free_capacity":            "800",
+		"used_capacity_before_reduction":    "500",
+		"used_capacity_after_reduction":     "200",
+		"reclaimable_capacity":              "0",
+		"deduplication_capacity_saving":     "100",
+		"compression_uncompressed_capacity": "0",
+		"compression_compressed_capacity":   "0",
+	}}
+	legacy := PoolInfo{Capabilities: caps, PoolMDiskGrpInfo: Pool{
+		"id":                                "1",
+		"parent_mdisk_grp_id":               "1",
+		"data_reduction":                    "no",
+		"compression_active":                "yes",
+		"virtual_capacity":                  "1000",
+		"real_capacity":                     "400",
+		"compression_uncompressed_capacity": "300",
+		"compression_compressed_capacity":   "100",
+	}}
+
+	t.Run("Data reduction pool", func(t *testing.T) {
+		savings, err := calcPoolSavings(drp)
+		want := PoolSavings{Total: 800, Thin: 500, Dedup: 100, Compression: 200, Stored: 200}
+		if err != nil || savings != want {
+			t.Errorf("calcPoolSavings() = %+v, %v, want %+v", savings, err, want)
+		}
+		if ratio := savings.DataReductionRatio(); ratio != 2.5 {
+			t.Errorf("data reduction ratio = %v, want 2.5", ratio)
+		}
+	})
+
+	t.Run("Legacy compression pool", func(t *testing.T) {
+		savings, err := calcPoolSavings(legacy)
+		want := PoolSavings{Total: 600, Thin: 400, Compression: 200, Stored: 400}
+		if err != nil || savings != want {
+			t.Errorf("calcPoolSavings() = %+v, %v, want %+v", savings, err, want)
+		}
+	})
+
+	t.Run("Data reduction pool before physical capacity", func(t *testing.T) {
+		old := drp
+		old.Capabilities = rest.CapabilitiesForCodeLevel("8.1.3.0")
+		savings, err := calcPoolSavings(old)
+		if err != nil || savings.Stored != 900 || savings.Total != 100 {
+			t.Errorf("real capacity should fall back to real_capacity, got %+v, %v", savings, err)
+		}
+	})
+}
+
+func TestSystemHealth(t *testing.T) {
+	tests := []struct {
+		name  string
+		nodes rest.Nodes
+		want  float64
+	}{
+		{"All nodes online", rest.Nodes{
+			{"name": "node1", "status": "online", "IO_group_name": "io_grp0"},
+			{"name": "node2", "status": "online", "IO_group_name": "io_grp0"},
+		}, HealthOK},
+		{"One node offline", rest.Nodes{
+			{"name": "node1", "status": "online", "IO_group_name": "io_grp0"},
+			{"name": "node2", "status": "offline", "IO_group_name": "io_grp0"},
+		}, HealthWarning},
+		{"Single node IO group", rest.Nodes{
+			{"name": "node1", "status": "online", "IO_group_name": "io_grp0"},
+		}, HealthWarning},
+		{"IO group offline", rest.Nodes{
+			{"name": "node1", "status": "online", "IO_group_name": "io_grp0"},
+			{"name": "node2", "status": "online", "IO_group_name": "io_grp0"},
+			{"name": "node3", "status": "offline", "IO_group_name": "io_grp1"},
+			{"name": "node4", "status": "service", "IO_group_name": "io_grp1"},
+		}, HealthError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := systemHealth(tt.nodes); got != tt.want {
+				t.Errorf("systemHealth() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPermissionDeniedMetrics(t *testing.T) {
+	monitorPoster := func(req *http.Request, c *rest.FSRestClient) ([]byte, int, error) {
+		if fmt.Sprintf("%v", req.URL) == "/lsnode" {
+			return []byte(`CMMVC7205E The command failed because it is not supported.`), http.StatusForbidden, nil
+		}
+		return poster(req, c)
+	}
+	manager := drivermanager.DriverManager{SystemName: "FS-system-monitor"}
+	client := &rest.FSRestClient{PostRequester: rest.NewRequester(monitorPoster), DriverManager: &manager, RestConfig: restConfig1}
+	collector, _ := NewPerfCollector(map[string]*rest.FSRestClient{"FS-system-monitor": client}, "FS-ns")
+
+	mockSystem(t, "FS-system-monitor", restConfig1, "Pool0")
+
+	expected := `
+	# HELP flashsystem_metrics_skipped Metric family skipped for the system, requirement is the command or capability it needs, operation is set when only the series of the operation are skipped
+	# TYPE flashsystem_metrics_skipped gauge
+	flashsystem_metrics_skipped{metric="flashsystem_iogroup_ha_state",operation="",reason="permission_denied",requirement="lsnode",subsystem_name="FS-system-monitor"} 1
+	flashsystem_metrics_skipped{metric="flashsystem_iogroup_node_count",operation="",reason="permission_denied",requirement="lsnode",subsystem_name="FS-system-monitor"} 1
+	flashsystem_metrics_skipped{metric="flashsystem_iogroup_online_node_count",operation="",reason="permission_denied",requirement="lsnode",subsystem_name="FS-system-monitor"} 1
+	flashsystem_metrics_skipped{metric="flashsystem_node_info",operation="",reason="permission_denied",requirement="lsnode",subsystem_name="FS-system-monitor"} 1
+	flashsystem_metrics_skipped{metric="flashsystem_node_status",operation="",reason="permission_denied",requirement="lsnode",subsystem_name="FS-system-monitor"} 1
+	flashsystem_metrics_skipped{metric="flashsystem_subsystem_health",operation="",reason="permission_denied",requirement="lsnode",subsystem_name="FS-system-monitor"} 1
+
+	# HELP flashsystem_subsystem_wr_iops overall performance - write IOPS
+	# TYPE flashsystem_subsystem_wr_iops gauge
+	flashsystem_subsystem_wr_iops{subsystem_name="FS-system-monitor"} 11
+	`
+
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected), MetricsSkipped, SystemWriteIOPS, SystemHealth)
+	if err != nil {
+		t.Errorf("unexpected metrics:\n %s", err)
+	}
+	if denied := client.DeniedCommands(); len(denied) != 1 || denied[0] != "lsnode" {
+		t.Errorf("lsnode should be denied, got %v", denied)
+	}
+}
+
+func TestStatPeakTimeZone(t *testing.T) {
+	londonPoster := func(req *http.Request, c *rest.FSRestClient) ([]byte, int, error) {
+		if fmt.Sprintf("%v", req.URL) == "/lssystem" {
+			return []byte(`{"code_level": "8.4.0.2 (build 152.23.2102111856000)","product_name":"IBM SAN Volume Controller", "physical_capacity":"70727768211456", "physical_free_capacity":"37416452751360", "total_reclaimable_capacity":"32564", "time_zone":"415 Europe/London"}`), 200, nil
+		}
+		return poster(req, c)
+	}
+	manager := drivermanager.DriverManager{SystemName: "FS-system-london"}
+	client := &rest.FSRestClient{PostRequester: rest.NewRequester(londonPoster), DriverManager: &manager, RestConfig: restConfig1}
+	collector, _ := NewPerfCollector(map[string]*rest.FSRestClient{"FS-system-london": client}, "FS-ns")
+
+	mockSystem(t, "FS-system-london", restConfig1, "Pool0")
+
+	// The peaks at 16:18:07 British Summer Time are at 15:18:07 UTC
+	expected := `
+	# HELP flashsystem_node_cpu_utilization_ratio_peak_timestamp_seconds node performance - CPU utilization ratio, time of the peak
+	# TYPE flashsystem_node_cpu_utilization_ratio_peak_timestamp_seconds gauge
+	flashsystem_node_cpu_utilization_ratio_peak_timestamp_seconds{io_group="io_grp0",node_name="node1",site="",subsystem_name="FS-system-london"} 1.622819887e+09
+	flashsystem_node_cpu_utilization_ratio_peak_timestamp_seconds{io_group="io_grp0",node_name="node2",site="",subsystem_name="FS-system-london"} 1.622819887e+09
+
+	# HELP flashsystem_subsystem_wr_latency_seconds_peak_timestamp_seconds overall performance - write latency seconds, time of the peak
+	# TYPE flashsystem_subsystem_wr_latency_seconds_peak_timestamp_seconds gauge
+	flashsystem_subsystem_wr_latency_seconds_peak_timestamp_seconds{subsystem_name="FS-system-london"} 1.622819887e+09
+	`
+
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected),
+		NodeMetricPrefix+"cpu_utilization_ratio"+peakTimeSuffix, SystemMetricPrefix+"wr_latency_seconds"+peakTimeSuffix)
+	if err != nil {
+		t.Errorf("unexpected metrics:\n %s", err)
+	}
+}
+
+func TestPoolConditionWithoutPools(t *testing.T) {
+	deniedPoster := func(req *http.Request, c *rest.FSRestClient) ([]byte, int, error) {
+		if fmt.Sprintf("%v", req.URL) == "/lsmdiskgrp" {
+			return []byte(`CMMVC7205E The command failed because it is not supported.`), http.StatusForbidden, nil
+		}
+		return poster(req, c)
+	}
+	manager := drivermanager.DriverManager{SystemName: "FS-system-denied"}
+	client := &rest.FSRestClient{PostRequester: rest.NewRequester(deniedPoster), DriverManager: &manager, RestConfig: restConfig1}
+	collector, _ := NewPerfCollector(map[string]*rest.FSRestClient{"FS-system-denied": client}, "FS-ns")
+
+	mockSystem(t, "FS-system-denied", restConfig1, "Pool0")
+	updated := false
+	var missing map[string][]string
+	clientmanagers.UpdatePoolCondition = func(ctx context.Context, mgr *drivermanager.DriverManager, missingPools map[string][]string) error {
+		updated, missing = true, missingPools
+		return nil
+	}
+
+	// The pool of the storage class can't be looked up, it isn't reported missing
+	testutil.CollectAndCount(collector, PoolNotFound)
+	if !updated || len(missing) != 0 {
+		t.Errorf("expected the pool condition to be cleared, got %v %v", updated, missing)
+	}
+}
+
+func TestStorageClassInfoProvisioner(t *testing.T) {
+	manager := drivermanager.DriverManager{SystemName: "FS-system-sc"}
+	client := &rest.FSRestClient{PostRequester: rest.NewRequester(poster), DriverManager: &manager, RestConfig: restConfig1}
+	collector, _ := NewPerfCollector(map[string]*rest.FSRestClient{"FS-system-sc": client}, "FS-ns")
+
+	mockSystem(t, "FS-system-sc", restConfig1, "Pool0", "Pool1")
+	clientmanagers.GetStorageClass = func(ctx context.Context, mgr *drivermanager.DriverManager, name string) (*storagev1.StorageClass, error) {
+		if name == "fs-sc-2" {
+			return nil, fmt.Errorf("storage class %s not found", name)
+		}
+		return &storagev1.StorageClass{Provisioner: "example.com/block"}, nil
+	}
+
+	// The StorageClass which can't be read gets the provisioner of the CSI driver
+	expected := `
+	# HELP flashsystem_storageclass_info Storage class to pool mapping
+	# TYPE flashsystem_storageclass_info gauge
+	flashsystem_storageclass_info{pool_name="Pool0",provisioner="example.com/block",storageclass="fs-sc-1",subsystem_name="FS-system-sc"} 1
+	flashsystem_storageclass_info{pool_name="Pool1",provisioner="block.csi.ibm.com",storageclass="fs-sc-2",subsystem_name="FS-system-sc"} 1
+	`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected), StorageClassInfo); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestExporterConfigInfo(t *testing.T) {
+	manager := drivermanager.DriverManager{SystemName: "FS-system-config"}
+	client := &rest.FSRestClient{PostRequester: rest.NewRequester(poster), DriverManager: &manager, RestConfig: restConfig1}
+	collector, _ := NewPerfCollector(map[string]*rest.FSRestClient{"FS-system-config": client}, "FS-ns")
+	mockSystem(t, "FS-system-config", restConfig1, "Pool0")
+
+	// The configuration is the default one before it's loaded
+	expected := `
+	# HELP flashsystem_exporter_config_info Effective exporter configuration
+	# TYPE flashsystem_exporter_config_info gauge
+	flashsystem_exporter_config_info{failed_event_threshold="2m0s",http_timeout="15s",inventory_mode="false",minimum_version="8.3.1",port="9100",rest_port="7443",retry_count="2",tracing_exporter="none",volume_stats_enabled="false",volume_stats_pool_top_n="5",volume_stats_top_n="100"} 1
+	`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected), ExporterConfigInfo); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestTopologyMetrics(t *testing.T) {
+	hyperSwapPoster := func(req *http.Request, c *rest.FSRestClient) ([]byte, int, error) {
+		switch fmt.Sprintf("%v", req.URL) {
+		case "/lssystem":
+			return []byte(`{"code_level": "8.5.2.0 (build 161.15.2208121040000)","product_name":"IBM FlashSystem 9200", "topology":"hyperswap",
+				"physical_capacity":"76427768211456", "physical_free_capacity":"28416452751360"}`), 200, nil
+		case "/lsnode":
+			return []byte(`[
+				{"name":"node1","id":"1","status":"online","IO_group_name":"io_grp0","site_id":"1","site_name":"siteA"},
+				{"name":"node2","id":"2","status":"online","IO_group_name":"io_grp0","site_id":"1","site_name":"siteA"},
+				{"name":"node3","id":"3","status":"offline","IO_group_name":"io_grp1","site_id":"2","site_name":"siteB"},
+				{"name":"node4","id":"4","status":"offline","IO_group_name":"io_grp1","site_id":"2","site_name":"siteB"}
+			]`), 200, nil
+		case "/lsquorum":
+			return []byte(`[
+				{"quorum_index":"0","status":"online","name":"mdisk0","object_type":"mdisk","active":"no","site_id":"1","site_name":"siteA"},
+				{"quorum_index":"1","status":"offline","name":"mdisk1","object_type":"mdisk","active":"no","site_id":"2","site_name":"siteB"},
+				{"quorum_index":"2","status":"online","name":"ip_quorum","object_type":"device","active":"yes","site_id":"3","site_name":"siteC"}
+			]`), 200, nil
+		case "/lsrcrelationship":
+			return []byte(`[
+				{"name":"rcrel0","copy_type":"activeactive","state":"consistent_copying","primary":"master","consistency_group_name":""},
+				{"name":"rcrel1","copy_type":"metro","state":"consistent_synchronized","primary":"master","consistency_group_name":""}
+			]`), 200, nil
+		}
+		return posterSecondSystem(req, c)
+	}
+	manager := drivermanager.DriverManager{SystemName: "FS-system-hyperswap"}
+	client := &rest.FSRestClient{PostRequester: rest.NewRequester(hyperSwapPoster), DriverManager: &manager, RestConfig: restConfig2}
+	collector, _ := NewPerfCollector(map[string]*rest.FSRestClient{"FS-system-hyperswap": client}, "FS-ns")
+
+	mockSystem(t, "FS-system-hyperswap", restConfig2, "Pool5")
+	var lost []string
+	clientmanagers.UpdateSiteCondition = func(ctx context.Context, mgr *drivermanager.DriverManager, lostSites []string) error {
+		lost = lostSites
+		return nil
+	}
+
+	expected := `
+	# HELP flashsystem_subsystem_topology System topology, standard, stretched or hyperswap
+	# TYPE flashsystem_subsystem_topology gauge
+	flashsystem_subsystem_topology{subsystem_name="FS-system-hyperswap",topology="hyperswap"} 1
+
+	# HELP flashsystem_site_online_node_count Number of online nodes in the site
+	# TYPE flashsystem_site_online_node_count gauge
+	flashsystem_site_online_node_count{site_id="1",site_name="siteA",subsystem_name="FS-system-hyperswap"} 2
+	flashsystem_site_online_node_count{site_id="2",site_name="siteB",subsystem_name="FS-system-hyperswap"} 0
+
+	# HELP flashsystem_site_health Site health, 0 = all nodes online, 1 = some nodes offline, 2 = site lost
+	# TYPE flashsystem_site_health gauge
+	flashsystem_site_health{site_id="1",site_name="siteA",subsystem_name="FS-system-hyperswap"} 0
+	flashsystem_site_health{site_id="2",site_name="siteB",subsystem_name="FS-system-hyperswap"} 2
+
+	# HELP flashsystem_quorum_status Quorum device status, 0 = online, 1 = excluded, 2 = offline
+	# TYPE flashsystem_quorum_status gauge
+	flashsystem_quorum_status{active="no",object_name="mdisk0",object_type="mdisk",quorum_index="0",site_name="siteA",subsystem_name="FS-system-hyperswap"} 0
+	flashsystem_quorum_status{active="no",object_name="mdisk1",object_type="mdisk",quorum_index="1",site_name="siteB",subsystem_name="FS-system-hyperswap"} 2
+	flashsystem_quorum_status{active="yes",object_name="ip_quorum",object_type="device",quorum_index="2",site_name="siteC",subsystem_name="FS-system-hyperswap"} 0
+
+	# HELP flashsystem_hyperswap_relationship_state HyperSwap relationship state, 0 = synchronized, 1 = not synchronized, 2 = inconsistent
+	# TYPE flashsystem_hyperswap_relationship_state gauge
+	flashsystem_hyperswap_relationship_state{consistency_group="",primary="master",relationship_name="rcrel0",state="consistent_copying",subsystem_name="FS-system-hyperswap"} 1
+
+	# HELP flashsystem_subsystem_health System health
+	# TYPE flashsystem_subsystem_health gauge
+	flashsystem_subsystem_health{subsystem_name="FS-system-hyperswap"} 2
+	`
+
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected), SystemTopology, SiteOnlineNodeCount, SiteHealth,
+		QuorumStatus, HyperSwapRelationshipState, SystemHealth)
+	if err != nil {
+		t.Errorf("unexpected metrics:\n %s", err)
+	}
+	if len(lost) != 1 || lost[0] != "siteB" {
+		t.Errorf("siteB should be lost, got %v", lost)
+	}
+
+	// The condition is cleared once the system is standard again
+	standardManager := drivermanager.DriverManager{SystemName: "FS-system-hyperswap"}
+	standardClient := &rest.FSRestClient{PostRequester: rest.NewRequester(poster), DriverManager: &standardManager, RestConfig: restConfig2}
+	collector, _ = NewPerfCollector(map[string]*rest.FSRestClient{"FS-system-hyperswap": standardClient}, "FS-ns")
+	testutil.CollectAndCount(collector, SystemTopology)
+	if lost != nil {
+		t.Errorf("no site should be lost on a standard system, got %v", lost)
+	}
+}
+
+func TestInventoryMode(t *testing.T) {
+	tierPoster := func(req *http.Request, c *rest.FSRestClient) ([]byte, int, error) {
+		body, status, err := poster(req, c)
+		if strings.HasPrefix(fmt.Sprintf("%v", req.URL), "/lsmdisk/") {
+			body = []byte(strings.Replace(string(body), "{", `{"tier": "tier0_flash",`, 1))
+		}
+		return body, status, err
+	}
+	manager := drivermanager.DriverManager{SystemName: "FS-system-inventory"}
+	client := &rest.FSRestClient{PostRequester: rest.NewRequester(tierPoster), DriverManager: &manager, RestConfig: restConfig1}
+	collector, _ := NewPerfCollector(map[string]*rest.FSRestClient{"FS-system-inventory": client}, "FS-ns")
+
+	mockSystem(t, "FS-system-inventory", restConfig1, "Pool0")
+	InventoryMode = func() bool { return true }
+
+	expected := `
+	# HELP flashsystem_pool_inventory_info Pool configuration, managed_by_odf is true when an ODF storage class uses the pool
+	# TYPE flashsystem_pool_inventory_info gauge
+	flashsystem_pool_inventory_info{data_reduction="no",easy_tier="auto",easy_tier_status="balanced",encrypted="no",managed_by_odf="true",pool_name="Pool0",subsystem_name="FS-system-inventory"} 1
+	flashsystem_pool_inventory_info{data_reduction="no",easy_tier="auto",easy_tier_status="balanced",encrypted="no",managed_by_odf="false",pool_name="Pool1",subsystem_name="FS-system-inventory"} 1
+	flashsystem_pool_inventory_info{data_reduction="no",easy_tier="auto",easy_tier_status="balanced",encrypted="no",managed_by_odf="false",pool_name="Pool2",subsystem_name="FS-system-inventory"} 1
+
+	# HELP flashsystem_pool_volume_count Number of volumes in the pool
+	# TYPE flashsystem_pool_volume_count gauge
+	flashsystem_pool_volume_count{pool_name="Pool0",subsystem_name="FS-system-inventory"} 14
+	flashsystem_pool_volume_count{pool_name="Pool1",subsystem_name="FS-system-inventory"} 2
+	flashsystem_pool_volume_count{pool_name="Pool2",subsystem_name="FS-system-inventory"} 0
+
+	# HELP flashsystem_pool_overallocation_ratio Pool virtual capacity to pool capacity ratio
+	# TYPE flashsystem_pool_overallocation_ratio gauge
+	flashsystem_pool_overallocation_ratio{pool_name="Pool0",subsystem_name="FS-system-inventory"} 0.45
+	flashsystem_pool_overallocation_ratio{pool_name="Pool1",subsystem_name="FS-system-inventory"} 0.95
+	flashsystem_pool_overallocation_ratio{pool_name="Pool2",subsystem_name="FS-system-inventory"} 0
+
+	# HELP flashsystem_pool_tier_capacity_bytes Pool capacity of the MDisks in each tier (byte)
+	# TYPE flashsystem_pool_tier_capacity_bytes gauge
+	flashsystem_pool_tier_capacity_bytes{pool_name="Pool0",subsystem_name="FS-system-inventory",tier="tier0_flash"} 1.099511627776e+12
+	flashsystem_pool_tier_capacity_bytes{pool_name="Pool1",subsystem_name="FS-system-inventory",tier="tier0_flash"} 1.090009511627776e+15
+	flashsystem_pool_tier_capacity_bytes{pool_name="Pool2",subsystem_name="FS-system-inventory",tier="tier0_flash"} 2.180019023255552e+15
+	`
+
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected), PoolInventoryInfo, PoolVolumeCount,
+		PoolOverallocation, PoolTierCapacity)
+	if err != nil {
+		t.Errorf("unexpected metrics:\n %s", err)
+	}
+}
+
+func newCSIPersistentVolume(name string, handle string, namespace string, claim string, storageClass string) corev1.PersistentVolume {
+	pv := corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: corev1.PersistentVolumeSpec{
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{Driver: drivermanager.CSIProvisioner, VolumeHandle: handle},
+			},
+			StorageClassName: storageClass,
+		},
+	}
+	if claim != "" {
+		pv.Spec.ClaimRef = &corev1.ObjectReference{Namespace: namespace, Name: claim}
+	}
+	return pv
+}
+
+func TestVolumeMetrics(t *testing.T) {
+	volumePoster := func(req *http.Request, c *rest.FSRestClient) ([]byte, int, error) {
+		switch fmt.Sprintf("%v", req.URL) {
+		case "/lsvdisk":
+			return []byte(`[
+				{"id":"0","name":"pvc-0","mdisk_grp_name":"Pool0","capacity":"10737418240","vdisk_UID":"60050768108101C7C000000000000000"},
+				{"id":"1","name":"pvc-1","mdisk_grp_name":"Pool0","capacity":"21474836480","vdisk_UID":"60050768108101C7C000000000000001"},
+				{"id":"2","name":"pvc-2","mdisk_grp_name":"Pool1","capacity":"5368709120","vdisk_UID":"60050768108101C7C000000000000002"},
+				{"id":"3","name":"pvc-3","mdisk_grp_name":"Pool1","capacity":"1073741824","vdisk_UID":"60050768108101C7C000000000000003"},
+				{"id":"4","name":"host-vol","mdisk_grp_name":"Pool1","capacity":"1073741824","vdisk_UID":"60050768108101C7C000000000000004"}
+			]`), 200, nil
+		case "/lssevdiskcopy":
+			return []byte(`[
+				{"vdisk_id":"0","copy_id":"0","used_capacity":"1073741824","uncompressed_used_capacity":"","used_capacity_before_reduction":""},
+				{"vdisk_id":"1","copy_id":"0","used_capacity":"2147483648","uncompressed_used_capacity":"","used_capacity_before_reduction":"4294967296"},
+				{"vdisk_id":"3","copy_id":"0","used_capacity":"268435456","uncompressed_used_capacity":"536870912","used_capacity_before_reduction":""}
+			]`), 200, nil
+		case "/lsdumps":
+			return []byte(`[]`), 200, nil
+		}
+		return poster(req, c)
+	}
+	manager := drivermanager.DriverManager{SystemName: "FS-system-volume"}
+	client := &rest.FSRestClient{PostRequester: rest.NewRequester(volumePoster), DriverManager: &manager, RestConfig: restConfig1}
+	collector, _ := NewPerfCollector(map[string]*rest.FSRestClient{"FS-system-volume": client}, "FS-ns")
+
+	mockSystem(t, "FS-system-volume", restConfig1, "Pool0")
+	clientmanagers.ListPersistentVolumes = func(ctx context.Context, mgr *drivermanager.DriverManager) ([]corev1.PersistentVolume, error) {
+		nfs := corev1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "pv-nfs"}}
+		other := newCSIPersistentVolume("pv-other", "SVC:5;60050768108101C7C000000000000004", "app", "other", "fs-sc-1")
+		other.Spec.CSI.Driver = "other.csi.example.com"
+		return []corev1.PersistentVolume{
+			newCSIPersistentVolume("pv-0", "SVC:0;60050768108101c7c000000000000000", "app", "data-0", "fs-sc-1"),
+			newCSIPersistentVolume("pv-1", "SVC:0000020420A00052:1;60050768108101C7C000000000000001", "app", "data-1", "fs-sc-1"),
+			newCSIPersistentVolume("pv-2", "SVC:60050768108101C7C000000000000002", "db", "data-2", "fs-sc-2"),
+			newCSIPersistentVolume("pv-3", "SVC:3;60050768108101C7C000000000000003", "", "", "fs-sc-2"),
+			newCSIPersistentVolume("pv-missing", "SVC:9;60050768108101C7C000000000000009", "db", "data-9", "fs-sc-2"),
+			nfs,
+			other,
+		}, nil
+	}
+
+	expected := `
+	# HELP flashsystem_pvc_capacity_bytes Provisioned capacity of the volume of the persistent volume (byte)
+	# TYPE flashsystem_pvc_capacity_bytes gauge
+	flashsystem_pvc_capacity_bytes{namespace="",persistentvolume="pv-3",persistentvolumeclaim="",pool_name="Pool1",storageclass="fs-sc-2",subsystem_name="FS-system-volume",volume_name="pvc-3"} 1.073741824e+09
+	flashsystem_pvc_capacity_bytes{namespace="app",persistentvolume="pv-0",persistentvolumeclaim="data-0",pool_name="Pool0",storageclass="fs-sc-1",subsystem_name="FS-system-volume",volume_name="pvc-0"} 1.073741824e+10
+	flashsystem_pvc_capacity_bytes{namespace="app",persistentvolume="pv-1",persistentvolumeclaim="data-1",pool_name="Pool0",storageclass="fs-sc-1",subsystem_name="FS-system-volume",volume_name="pvc-1"} 2.147483648e+10
+	flashsystem_pvc_capacity_bytes{namespace="db",persistentvolume="pv-2",persistentvolumeclaim="data-2",pool_name="Pool1",storageclass="fs-sc-2",subsystem_name="FS-system-volume",volume_name="pvc-2"} 5.36870912e+09
+
+	# HELP flashsystem_pvc_used_capacity_bytes Capacity written to the volume of the persistent volume (byte)
+	# TYPE flashsystem_pvc_used_capacity_bytes gauge
+	flashsystem_pvc_used_capacity_bytes{namespace="",persistentvolume="pv-3",persistentvolumeclaim="",pool_name="Pool1",storageclass="fs-sc-2",subsystem_name="FS-system-volume",volume_name="pvc-3"} 5.36870912e+08
+	flashsystem_pvc_used_capacity_bytes{namespace="app",persistentvolume="pv-0",persistentvolumeclaim="data-0",pool_name="Pool0",storageclass="fs-sc-1",subsystem_name="FS-system-volume",volume_name="pvc-0"} 1.073741824e+09
+	flashsystem_pvc_used_capacity_bytes{namespace="app",persistentvolume="pv-1",persistentvolumeclaim="data-1",pool_name="Pool0",storageclass="fs-sc-1",subsystem_name="FS-system-volume",volume_name="pvc-1"} 4.294967296e+09
+	flashsystem_pvc_used_capacity_bytes{namespace="db",persistentvolume="pv-2",persistentvolumeclaim="data-2",pool_name="Pool1",storageclass="fs-sc-2",subsystem_name="FS-system-volume",volume_name="pvc-2"} 5.36870912e+09
+
+	# HELP flashsystem_pvc_stored_capacity_bytes Capacity the volume of the persistent volume takes in the pool after data reduction (byte)
+	# TYPE flashsystem_pvc_stored_capacity_bytes gauge
+	flashsystem_pvc_stored_capacity_bytes{namespace="",persistentvolume="pv-3",persistentvolumeclaim="",pool_name="Pool1",storageclass="fs-sc-2",subsystem_name="FS-system-volume",volume_name="pvc-3"} 2.68435456e+08
+	flashsystem_pvc_stored_capacity_bytes{namespace="app",persistentvolume="pv-0",persistentvolumeclaim="data-0",pool_name="Pool0",storageclass="fs-sc-1",subsystem_name="FS-system-volume",volume_name="pvc-0"} 1.073741824e+09
+	flashsystem_pvc_stored_capacity_bytes{namespace="app",persistentvolume="pv-1",persistentvolumeclaim="data-1",pool_name="Pool0",storageclass="fs-sc-1",subsystem_name="FS-system-volume",volume_name="pvc-1"} 2.147483648e+09
+	flashsystem_pvc_stored_capacity_bytes{namespace="db",persistentvolume="pv-2",persistentvolumeclaim="data-2",pool_name="Pool1",storageclass="fs-sc-2",subsystem_name="FS-system-volume",volume_name="pvc-2"} 5.36870912e+09
+
+	# HELP flashsystem_storageclass_capacity_bytes Provisioned capacity of the persistent volumes of the storage class (byte)
+	# TYPE flashsystem_storageclass_capacity_bytes gauge
+	flashsystem_storageclass_capacity_bytes{storageclass="fs-sc-1",subsystem_name="FS-system-volume"} 3.221225472e+10
+	flashsystem_storageclass_capacity_bytes{storageclass="fs-sc-2",subsystem_name="FS-system-volume"} 6.442450944e+09
+
+	# HELP flashsystem_storageclass_used_capacity_bytes Capacity written to the persistent volumes of the storage class (byte)
+	# TYPE flashsystem_storageclass_used_capacity_bytes gauge
+	flashsystem_storageclass_used_capacity_bytes{storageclass="fs-sc-1",subsystem_name="FS-system-volume"} 5.36870912e+09
+	flashsystem_storageclass_used_capacity_bytes{storageclass="fs-sc-2",subsystem_name="FS-system-volume"} 5.905580032e+09
+
+	# HELP flashsystem_storageclass_stored_capacity_bytes Capacity the persistent volumes of the storage class take after data reduction (byte)
+	# TYPE flashsystem_storageclass_stored_capacity_bytes gauge
+	flashsystem_storageclass_stored_capacity_bytes{storageclass="fs-sc-1",subsystem_name="FS-system-volume"} 3.221225472e+09
+	flashsystem_storageclass_stored_capacity_bytes{storageclass="fs-sc-2",subsystem_name="FS-system-volume"} 5.637144576e+09
+
+	# HELP flashsystem_namespace_capacity_bytes Provisioned capacity of the persistent volume claims of the namespace (byte)
+	# TYPE flashsystem_namespace_capacity_bytes gauge
+	flashsystem_namespace_capacity_bytes{namespace="app",subsystem_name="FS-system-volume"} 3.221225472e+10
+	flashsystem_namespace_capacity_bytes{namespace="db",subsystem_name="FS-system-volume"} 5.36870912e+09
+
+	# HELP flashsystem_namespace_stored_capacity_bytes Capacity the persistent volume claims of the namespace take after data reduction (byte)
+	# TYPE flashsystem_namespace_stored_capacity_bytes gauge
+	flashsystem_namespace_stored_capacity_bytes{namespace="app",subsystem_name="FS-system-volume"} 3.221225472e+09
+	flashsystem_namespace_stored_capacity_bytes{namespace="db",subsystem_name="FS-system-volume"} 5.36870912e+09
+	`
+
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected), PVCCapacity, PVCUsedCapacity, PVCStoredCapacity,
+		StorageClassCapacity, StorageClassUsedCapacity, StorageClassStoredCapacity, NamespaceCapacity, NamespaceStoredCapacity)
+	if err != nil {
+		t.Errorf("unexpected metrics:\n %s", err)
+	}
+}
+
+func volumeStatsFile(node string, timestamp string, ops float64) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="utf-8" ?>
+<diskStatsColl scope="node" id="%s" timestamp="%s" contains="virtualDiskStats" sizeUnits="512B" timeUnits="msec">
+<vdsk idx="0" id="pvc-0" ro="%v" wo="%v" rb="%v" wb="0" rl="%v" wl="0"/>
+<vdsk idx="1" id="pvc-1" ro="%v" wo="0" rb="0" wb="0" rl="0" wl="0"/>
+<vdsk idx="2" id="pvc-2" ro="%v" wo="0" rb="0" wb="0" rl="0" wl="0"/>
+<vdsk idx="4" id="host-vol" ro="%v" wo="0" rb="0" wb="0" rl="0" wl="0"/>
+</diskStatsColl>`, node, timestamp, ops, ops, ops*8, ops*2, ops, ops*3, ops*10)
+}
+
+func TestVolumePerfMetrics(t *testing.T) {
+	files := map[string]string{
+		"Nv_stats_node1_210604_160000": volumeStatsFile("node1", "2021-06-04 16:00:00", 0),
+		"Nv_stats_node2_210604_160000": volumeStatsFile("node2", "2021-06-04 16:00:00", 0),
+	}
+	downloads := 0
+	statsPoster := func(req *http.Request, c *rest.FSRestClient) ([]byte, int, error) {
+		switch fmt.Sprintf("%v", req.URL) {
+		case "/lsvdisk":
+			return []byte(`[
+				{"id":"0","name":"pvc-0","mdisk_grp_name":"Pool0","capacity":"10737418240","vdisk_UID":"60050768108101C7C000000000000000"},
+				{"id":"1","name":"pvc-1","mdisk_grp_name":"Pool0","capacity":"10737418240","vdisk_UID":"60050768108101C7C000000000000001"},
+				{"id":"2","name":"pvc-2","mdisk_grp_name":"Pool1","capacity":"10737418240","vdisk_UID":"60050768108101C7C000000000000002"},
+				{"id":"4","name":"host-vol","mdisk_grp_name":"Pool1","capacity":"10737418240","vdisk_UID":"60050768108101C7C000000000000004"}
+			]`), 200, nil
+		case "/lssevdiskcopy":
+			return []byte(`[]`), 200, nil
+		case "/lsdumps":
+			var dumps []string
+			for name := range files {
+				dumps = append(dumps, fmt.Sprintf(`{"id":"%d","filename":"%s"}`, len(dumps), name))
+			}
+			return []byte("[" + strings.Join(dumps, ",") + "]"), 200, nil
+		case "/download":
+			var request map[string]string
+			if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+				return nil, 500, err
+			}
+			downloads++
+			return []byte(files[request["filename"]]), 200, nil
+		}
+		return poster(req, c)
+	}
+	manager := drivermanager.DriverManager{SystemName: "FS-system-perf"}
+	client := &rest.FSRestClient{PostRequester: rest.NewRequester(statsPoster), DriverManager: &manager, RestConfig: restConfig1}
+	collector, _ := NewPerfCollector(map[string]*rest.FSRestClient{"FS-system-perf": client}, "FS-ns")
+
+	mockSystem(t, "FS-system-perf", restConfig1, "Pool0")
+	clientmanagers.ListPersistentVolumes = func(ctx context.Context, mgr *drivermanager.DriverManager) ([]corev1.PersistentVolume, error) {
+		return []corev1.PersistentVolume{
+			newCSIPersistentVolume("pv-0", "SVC:0;60050768108101C7C000000000000000", "app", "data-0", "fs-sc-1"),
+			newCSIPersistentVolume("pv-1", "SVC:1;60050768108101C7C000000000000001", "app", "data-1", "fs-sc-1"),
+			newCSIPersistentVolume("pv-2", "SVC:2;60050768108101C7C000000000000002", "db", "data-2", "fs-sc-1"),
+		}, nil
+	}
+	VolumeStats = func() config.VolumeStatsConfig {
+		return config.VolumeStatsConfig{Enabled: true, Namespaces: []string{"app"}, TopN: 1, PoolTopN: 2}
+	}
+
+	// The first files give no interval
+	if count := testutil.CollectAndCount(collector, PVCReadIOPS, PoolReadIOPS); count != 0 {
+		t.Errorf("no volume performance expected before the second files, got %d", count)
+	}
+
+	files = map[string]string{
+		"Nv_stats_node1_210604_160100": volumeStatsFile("node1", "2021-06-04 16:01:00", 600),
+		"Nv_stats_node2_210604_160100": volumeStatsFile("node2", "2021-06-04 16:01:00", 60),
+	}
+
+	// pvc-2 is in another namespace and pvc-1 isn't in the top 1, host-vol has no persistent volume
+	expected := `
+	# HELP flashsystem_pvc_rd_iops volume performance - read IOPS
+	# TYPE flashsystem_pvc_rd_iops gauge
+	flashsystem_pvc_rd_iops{namespace="app",persistentvolume="pv-0",persistentvolumeclaim="data-0",pool_name="Pool0",storageclass="fs-sc-1",subsystem_name="FS-system-perf",volume_name="pvc-0"} 11
+
+	# HELP flashsystem_pvc_wr_iops volume performance - write IOPS
+	# TYPE flashsystem_pvc_wr_iops gauge
+	flashsystem_pvc_wr_iops{namespace="app",persistentvolume="pv-0",persistentvolumeclaim="data-0",pool_name="Pool0",storageclass="fs-sc-1",subsystem_name="FS-system-perf",volume_name="pvc-0"} 11
+
+	# HELP flashsystem_pvc_rd_bytes volume performance - read throughput bytes/s
+	# TYPE flashsystem_pvc_rd_bytes gauge
+	flashsystem_pvc_rd_bytes{namespace="app",persistentvolume="pv-0",persistentvolumeclaim="data-0",pool_name="Pool0",storageclass="fs-sc-1",subsystem_name="FS-system-perf",volume_name="pvc-0"} 45056
+
+	# HELP flashsystem_pvc_rd_latency_seconds volume performance - read latency seconds
+	# TYPE flashsystem_pvc_rd_latency_seconds gauge
+	flashsystem_pvc_rd_latency_seconds{namespace="app",persistentvolume="pv-0",persistentvolumeclaim="data-0",pool_name="Pool0",storageclass="fs-sc-1",subsystem_name="FS-system-perf",volume_name="pvc-0"} 0.002
+
+	# HELP flashsystem_pool_rd_iops pool performance - read IOPS
+	# TYPE flashsystem_pool_rd_iops gauge
+	flashsystem_pool_rd_iops{pool_name="Pool0",subsystem_name="FS-system-perf"} 22
+
+	# HELP flashsystem_pool_wr_iops pool performance - write IOPS
+	# TYPE flashsystem_pool_wr_iops gauge
+	flashsystem_pool_wr_iops{pool_name="Pool0",subsystem_name="FS-system-perf"} 11
+
+	# HELP flashsystem_pool_rd_bytes pool performance - read throughput bytes/s
+	# TYPE flashsystem_pool_rd_bytes gauge
+	flashsystem_pool_rd_bytes{pool_name="Pool0",subsystem_name="FS-system-perf"} 45056
+
+	# HELP flashsystem_pool_rd_latency_seconds pool performance - read latency seconds
+	# TYPE flashsystem_pool_rd_latency_seconds gauge
+	flashsystem_pool_rd_latency_seconds{pool_name="Pool0",subsystem_name="FS-system-perf"} 0.001
+
+	# HELP flashsystem_pool_top_volume_iops noisy neighbors - IOPS of the busiest volumes of the pool
+	# TYPE flashsystem_pool_top_volume_iops gauge
+	flashsystem_pool_top_volume_iops{namespace="app",persistentvolume="pv-0",persistentvolumeclaim="data-0",pool_name="Pool0",storageclass="fs-sc-1",subsystem_name="FS-system-perf",volume_name="pvc-0"} 22
+	flashsystem_pool_top_volume_iops{namespace="app",persistentvolume="pv-1",persistentvolumeclaim="data-1",pool_name="Pool0",storageclass="fs-sc-1",subsystem_name="FS-system-perf",volume_name="pvc-1"} 11
+
+	# HELP flashsystem_pool_top_volume_bytes noisy neighbors - throughput bytes/s of the busiest volumes of the pool
+	# TYPE flashsystem_pool_top_volume_bytes gauge
+	flashsystem_pool_top_volume_bytes{namespace="app",persistentvolume="pv-0",persistentvolumeclaim="data-0",pool_name="Pool0",storageclass="fs-sc-1",subsystem_name="FS-system-perf",volume_name="pvc-0"} 45056
+
+	# HELP flashsystem_pool_top_volume_latency_contribution noisy neighbors - share of the pool IO time spent on the volume, 0 to 1
+	# TYPE flashsystem_pool_top_volume_latency_contribution gauge
+	flashsystem_pool_top_volume_latency_contribution{namespace="app",persistentvolume="pv-0",persistentvolumeclaim="data-0",pool_name="Pool0",storageclass="fs-sc-1",subsystem_name="FS-system-perf",volume_name="pvc-0"} 1
+	`
+
+	// The noisy neighbors count every volume of the pool, pvc-1 has no throughput and no latency
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected), PVCReadIOPS, PVCWriteIOPS, PVCReadBytes, PVCReadLatency,
+		PoolReadIOPS, PoolWriteIOPS, PoolReadBytes, PoolReadLatency, PoolTopVolumeIOPS, PoolTopVolumeBytes, PoolTopVolumeLatencyContribution)
+	if err != nil {
+		t.Errorf("unexpected metrics:\n %s", err)
+	}
 
+	recorder := httptest.NewRecorder()
+	collector.ServeNoisyNeighbors(recorder, httptest.NewRequest(http.MethodGet, NoisyNeighborsPath, nil))
+	var report NoisyNeighborReport
+	if err := json.NewDecoder(recorder.Body).Decode(&report); err != nil {
+		t.Fatalf("decode noisy neighbor report failed: %v", err)
+	}
+	if len(report.Systems) != 1 || len(report.Systems[0].Pools) != 1 {
+		t.Fatalf("expected the report of Pool0, got %+v", report)
+	}
+	pool := report.Systems[0].Pools[0]
+	if pool.Pool != "Pool0" || len(pool.TopIOPS) != 2 || pool.TopIOPS[0].PersistentVolumeClaim != "data-0" || len(pool.TopLatency) != 1 {
+		t.Errorf("unexpected noisy neighbors of Pool0 %+v", pool)
+	}
+	// Only the new files are downloaded
+	if downloads != 4 {
+		t.Errorf("expected 4 downloads, got %d", downloads)
+	}
+}
+
+func TestPoolsPerf(t *testing.T) {
+	volumes := rest.Volumes{
+		{"id": "0", "mdisk_grp_name": "Pool0", "parent_mdisk_grp_name": "Pool0"},
+		{"id": "1", "mdisk_grp_name": "Child0", "parent_mdisk_grp_name": "Pool0"},
+		{"id": "2", "mdisk_grp_name": "many", "parent_mdisk_grp_name": "many"},
+		{"id": "3", "mdisk_grp_name": "Pool1", "parent_mdisk_grp_name": "Pool1"},
+	}
+	volumesPerf := map[string]*iostats.IOPerf{
+		"0": {ReadIOPS: 100, WriteIOPS: 10, ReadLatency: 0.001, WriteLatency: 0.004},
+		"1": {ReadIOPS: 300, WriteIOPS: 30, ReadLatency: 0.003, WriteLatency: 0.002},
+		"2": {ReadIOPS: 1000, WriteIOPS: 1000},
+	}
+
+	pools := getPoolsPerf(volumes, volumesPerf, nil)
+	if len(pools) != 2 {
+		t.Fatalf("expected Pool0 and Child0, got %d pools", len(pools))
+	}
+	pool0 := pools["Pool0"]
+	if pool0.ReadIOPS != 400 || pool0.WriteIOPS != 40 {
+		t.Errorf("Pool0 should count its child pool, got %+v", pool0)
+	}
+	if math.Abs(pool0.ReadLatency()-0.0025) > 1e-12 || math.Abs(pool0.WriteLatency()-0.0025) > 1e-12 {
+		t.Errorf("Pool0 latency should be weighted by IOPS, got %v %v", pool0.ReadLatency(), pool0.WriteLatency())
+	}
+	if child := pools["Child0"]; child.ReadIOPS != 300 || child.ReadLatency() != 0.003 {
+		t.Errorf("unexpected Child0 performance %+v", child)
+	}
+
+	// The mirrored volume writes to both pools and reads from its primary copy
+	copies := copyPools{"2": {
+		{"vdisk_id": "2", "copy_id": "0", "mdisk_grp_name": "Pool1", "parent_mdisk_grp_name": "Pool1", "primary": "no"},
+		{"vdisk_id": "2", "copy_id": "1", "mdisk_grp_name": "Pool0", "parent_mdisk_grp_name": "Pool0", "primary": "yes"},
+	}}
+	pools = getPoolsPerf(volumes, volumesPerf, copies)
+	if pool0 := pools["Pool0"]; pool0.ReadIOPS != 1400 || pool0.WriteIOPS != 1040 {
+		t.Errorf("Pool0 should count the primary copy, got %+v", pool0)
+	}
+	if pool1 := pools["Pool1"]; pool1 == nil || pool1.ReadIOPS != 0 || pool1.WriteIOPS != 1000 {
+		t.Errorf("Pool1 should count the writes of the secondary copy, got %+v", pool1)
+	}
+}
+
+func TestNoisyNeighbors(t *testing.T) {
+	volumes := rest.Volumes{
+		{"id": "0", "name": "vol-0", "mdisk_grp_name": "Pool0", "parent_mdisk_grp_name": "Pool0"},
+		{"id": "1", "name": "vol-1", "mdisk_grp_name": "Child0", "parent_mdisk_grp_name": "Pool0"},
+		{"id": "2", "name": "vol-2", "mdisk_grp_name": "Pool0", "parent_mdisk_grp_name": "Pool0"},
+	}
+	volumesPerf := map[string]*iostats.IOPerf{
+		"0": {ReadIOPS: 100, ReadBytes: 4096, ReadLatency: 0.001},
+		"1": {ReadIOPS: 50, ReadBytes: 65536, ReadLatency: 0.006},
+		"2": {ReadIOPS: 200, ReadBytes: 1024, ReadLatency: 0.0005},
+	}
+	volumeInfos := map[string]VolumeInfo{
+		"1": {Name: "vol-1", PoolName: "Child0", PV: PVInfo{Name: "pv-1", Namespace: "app", Claim: "data-1"}},
+	}
+
+	pools := getNoisyNeighbors("FS", volumes, volumesPerf, nil, volumeInfos, []PoolInfo{{PoolName: "Pool0"}}, 2)
+	if len(pools) != 1 {
+		t.Fatalf("expected Pool0, got %+v", pools)
+	}
+	pool := pools[0]
+	names := func(volumes []NoisyVolume) []string {
+		var names []string
+		for _, volume := range volumes {
+			names = append(names, volume.Volume)
+		}
+		return names
+	}
+	if got := names(pool.TopIOPS); !reflect.DeepEqual(got, []string{"vol-2", "vol-0"}) {
+		t.Errorf("unexpected top IOPS volumes %v", got)
+	}
+	// The volume of the child pool counts for the parent pool
+	if got := names(pool.TopThroughput); !reflect.DeepEqual(got, []string{"vol-1", "vol-0"}) {
+		t.Errorf("unexpected top throughput volumes %v", got)
+	}
+	if got := names(pool.TopLatency); !reflect.DeepEqual(got, []string{"vol-1", "vol-0"}) {
+		t.Errorf("unexpected top latency volumes %v", got)
+	}
+	if top := pool.TopLatency[0]; top.PersistentVolumeClaim != "data-1" || math.Abs(top.LatencyContribution-0.6) > 1e-12 {
+		t.Errorf("unexpected latency contribution of vol-1 %+v", top)
+	}
+
+	// The pool of the secondary copy of the mirrored volume only serves its writes
+	volumes = append(volumes, map[string]string{"id": "3", "name": "vol-3", "mdisk_grp_name": "many"})
+	volumesPerf["3"] = &iostats.IOPerf{ReadIOPS: 1000, ReadBytes: 1 << 20, ReadLatency: 0.001, WriteIOPS: 10, WriteBytes: 4096, WriteLatency: 0.002}
+	copies := copyPools{"3": {
+		{"vdisk_id": "3", "copy_id": "0", "mdisk_grp_name": "Pool0", "parent_mdisk_grp_name": "Pool0", "primary": "yes"},
+		{"vdisk_id": "3", "copy_id": "1", "mdisk_grp_name": "Pool1", "parent_mdisk_grp_name": "Pool1", "primary": "no"},
+	}}
+	pools = getNoisyNeighbors("FS", volumes, volumesPerf, copies, volumeInfos, []PoolInfo{{PoolName: "Pool0"}, {PoolName: "Pool1"}}, 2)
+	if top := pools[0].TopIOPS[0]; top.Volume != "vol-3" || top.ReadIOPS != 1000 {
+		t.Errorf("vol-3 should be the busiest volume of Pool0 with its reads, got %+v", top)
+	}
+	pool1 := pools[1]
+	if len(pool1.TopIOPS) != 1 || pool1.TopIOPS[0].ReadIOPS != 0 || pool1.TopIOPS[0].WriteIOPS != 10 {
+		t.Errorf("Pool1 should only see the writes of vol-3, got %+v", pool1.TopIOPS)
+	}
+	if top := pool1.TopLatency[0]; math.Abs(top.LatencyContribution-1) > 1e-12 || pool1.TopThroughput[0].ReadBytes != 0 {
+		t.Errorf("vol-3 should have all the IO time of Pool1, got %+v", top)
+	}
+}
+
+func newVolumeSnapshotContent(name string, csiDriver string, namespace string, snapshot string) unstructured.Unstructured {
+	content := unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"driver":            csiDriver,
+			"volumeSnapshotRef": map[string]interface{}{"namespace": namespace, "name": snapshot},
+		},
+	}}
+	content.SetName(name)
+	return content
+}
+
+func TestOrphanMetrics(t *testing.T) {
+	orphanPoster := func(req *http.Request, c *rest.FSRestClient) ([]byte, int, error) {
+		switch fmt.Sprintf("%v", req.URL) {
+		case "/lssystem":
+			return []byte(`{"code_level": "8.5.2.0 (build 161.15.2208121040000)","product_name":"IBM FlashSystem 9200", "physical_capacity":"76427768211456", "physical_free_capacity":"28416452751360", "total_reclaimable_capacity":"40564"}`), 200, nil
+		case "/lsvdisk":
+			return []byte(`[
+				{"id":"0","name":"pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000000","mdisk_grp_name":"Pool0","capacity":"1073741824","vdisk_UID":"60050768108101C7C000000000000000"},
+				{"id":"1","name":"pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000001","mdisk_grp_name":"Pool0","capacity":"2147483648","vdisk_UID":"60050768108101C7C000000000000001"},
+				{"id":"2","name":"app_pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000002","mdisk_grp_name":"Pool0","capacity":"1073741824","vdisk_UID":"60050768108101C7C000000000000002"},
+				{"id":"3","name":"snapshot-0d3c1a52-1b7e-4c1e-9f0e-000000000003","mdisk_grp_name":"Pool0","capacity":"1073741824","vdisk_UID":"60050768108101C7C000000000000003"},
+				{"id":"4","name":"snapshot-0d3c1a52-1b7e-4c1e-9f0e-000000000004","mdisk_grp_name":"Pool0","capacity":"4294967296","vdisk_UID":"60050768108101C7C000000000000004"},
+				{"id":"5","name":"host-vol","mdisk_grp_name":"Pool0","capacity":"1073741824","vdisk_UID":"60050768108101C7C000000000000005"},
+				{"id":"6","name":"pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000006","mdisk_grp_name":"Pool1","capacity":"1073741824","vdisk_UID":"60050768108101C7C000000000000006"},
+				{"id":"8","name":"other_pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000008","mdisk_grp_name":"Pool0","capacity":"1073741824","vdisk_UID":"60050768108101C7C000000000000008"},
+				{"id":"9","name":"snapshot-0d3c1a52-1b7e-4c1e-9f0e-000000000009","mdisk_grp_name":"Pool0","capacity":"1073741824","vdisk_UID":"60050768108101C7C000000000000009"}
+			]`), 200, nil
+		case "/lsfcmap":
+			return []byte(`[
+				{"id":"0","source_vdisk_id":"0","target_vdisk_id":"3","status":"copying","progress":"50"},
+				{"id":"1","source_vdisk_id":"1","target_vdisk_id":"4","status":"copying","progress":"50"},
+				{"id":"2","source_vdisk_id":"8","target_vdisk_id":"9","status":"copying","progress":"50"}
+			]`), 200, nil
+		case "/lssevdiskcopy", "/lsdumps":
+			return []byte(`[]`), 200, nil
+		case "/lsvolumesnapshot":
+			return []byte(`[
+				{"snapshot_id":"0","snapshot_name":"snapshot-0d3c1a52-1b7e-4c1e-9f0e-000000000007","volume_id":"0","volume_name":"pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000000"},
+				{"snapshot_id":"1","snapshot_name":"daily","volume_id":"5","volume_name":"host-vol"},
+				{"snapshot_id":"2","snapshot_name":"snapshot-0d3c1a52-1b7e-4c1e-9f0e-000000000010","volume_id":"8","volume_name":"other_pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000008"}
+			]`), 200, nil
+		}
+		return poster(req, c)
+	}
+	manager := drivermanager.DriverManager{SystemName: "FS-system-orphan"}
+	client := &rest.FSRestClient{PostRequester: rest.NewRequester(orphanPoster), DriverManager: &manager, RestConfig: restConfig1}
+	collector, _ := NewPerfCollector(map[string]*rest.FSRestClient{"FS-system-orphan": client}, "FS-ns")
+
+	mockSystem(t, "FS-system-orphan", restConfig1, "Pool0")
+	clientmanagers.ListPersistentVolumes = func(ctx context.Context, mgr *drivermanager.DriverManager) ([]corev1.PersistentVolume, error) {
+		return []corev1.PersistentVolume{
+			// Matched by the volume UID
+			newCSIPersistentVolume("pv-0", "SVC:0;60050768108101C7C000000000000000", "app", "data-0", "fs-sc-1"),
+			// Matched by the name, the array volume has the name prefix of the storage class
+			newCSIPersistentVolume("pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000002", "SVC:2;6005076810810100000000000000FFFF", "app", "data-2", "fs-sc-1"),
+		}, nil
+	}
+	clientmanagers.ListVolumeSnapshotContents = func(ctx context.Context, mgr *drivermanager.DriverManager) ([]unstructured.Unstructured, error) {
+		return []unstructured.Unstructured{
+			newVolumeSnapshotContent("snapcontent-0d3c1a52-1b7e-4c1e-9f0e-000000000003", drivermanager.CSIProvisioner, "app", "snap-3"),
+			// The content of another driver doesn't count
+			newVolumeSnapshotContent("snapcontent-0d3c1a52-1b7e-4c1e-9f0e-000000000007", "other.csi.example.com", "app", "snap-7"),
+		}, nil
+	}
+
+	// A new orphan waits for the next collection, its persistent volume may not be created yet
+	if count := testutil.CollectAndCount(collector, OrphanedVolumeCapacity); count != 0 {
+		t.Errorf("no orphan expected in the first collection, got %d", count)
+	}
+
+	expected := `
+	# HELP flashsystem_orphaned_volume_capacity_bytes Provisioned capacity of the CSI volume or snapshot without a PersistentVolume or VolumeSnapshotContent (byte)
+	# TYPE flashsystem_orphaned_volume_capacity_bytes gauge
+	flashsystem_orphaned_volume_capacity_bytes{kind="snapshot",pool_name="Pool0",subsystem_name="FS-system-orphan",volume_name="snapshot-0d3c1a52-1b7e-4c1e-9f0e-000000000004"} 4.294967296e+09
+	flashsystem_orphaned_volume_capacity_bytes{kind="snapshot",pool_name="Pool0",subsystem_name="FS-system-orphan",volume_name="snapshot-0d3c1a52-1b7e-4c1e-9f0e-000000000007"} 1.073741824e+09
+	flashsystem_orphaned_volume_capacity_bytes{kind="volume",pool_name="Pool0",subsystem_name="FS-system-orphan",volume_name="pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000001"} 2.147483648e+09
+
+	# HELP flashsystem_pool_orphaned_volumes Number of CSI volumes or snapshots of the pool without a PersistentVolume or VolumeSnapshotContent
+	# TYPE flashsystem_pool_orphaned_volumes gauge
+	flashsystem_pool_orphaned_volumes{kind="snapshot",pool_name="Pool0",subsystem_name="FS-system-orphan"} 2
+	flashsystem_pool_orphaned_volumes{kind="volume",pool_name="Pool0",subsystem_name="FS-system-orphan"} 1
+
+	# HELP flashsystem_pool_orphaned_capacity_bytes Provisioned capacity of the CSI volumes or snapshots of the pool without a PersistentVolume or VolumeSnapshotContent (byte)
+	# TYPE flashsystem_pool_orphaned_capacity_bytes gauge
+	flashsystem_pool_orphaned_capacity_bytes{kind="snapshot",pool_name="Pool0",subsystem_name="FS-system-orphan"} 5.36870912e+09
+	flashsystem_pool_orphaned_capacity_bytes{kind="volume",pool_name="Pool0",subsystem_name="FS-system-orphan"} 2.147483648e+09
+	`
+
+	// host-vol isn't a CSI volume and Pool1 has no storage class. The volume
+	// with the other name prefix and its snapshots belong to another cluster
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected), OrphanedVolumeCapacity, PoolOrphanedVolumes, PoolOrphanedCapacity)
 	if err != nil {
 		t.Errorf("unexpected metrics:\n %s", err)
 	}
+
+	recorder := httptest.NewRecorder()
+	collector.ServeOrphans(recorder, httptest.NewRequest(http.MethodGet, OrphansPath, nil))
+	var report OrphanReport
+	if err := json.NewDecoder(recorder.Body).Decode(&report); err != nil {
+		t.Fatalf("decode orphan report failed: %v", err)
+	}
+	if len(report.Systems) != 1 || len(report.Systems[0].Orphans) != 3 {
+		t.Fatalf("expected 3 orphans, got %+v", report)
+	}
+	if orphan := report.Systems[0].Orphans[0]; orphan.Kind != OrphanKindVolume || orphan.Id != "1" || orphan.UID != "60050768108101C7C000000000000001" {
+		t.Errorf("unexpected orphan %+v", orphan)
+	}
+
+	pvs := getCSIVolumes(nil, map[string]bool{"other": true})
+	if !pvs.owns("other_pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000008", "") || pvs.owns("pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000001", "") {
+		t.Errorf("only the volumes with the name prefix of a storage class should be owned")
+	}
+}
+
+func TestSnapshotMetrics(t *testing.T) {
+	snapshotPoster := func(req *http.Request, c *rest.FSRestClient) ([]byte, int, error) {
+		switch fmt.Sprintf("%v", req.URL) {
+		case "/lssystem":
+			return []byte(`{"code_level": "8.5.2.0 (build 161.15.2208121040000)","product_name":"IBM FlashSystem 9200", "physical_capacity":"76427768211456", "physical_free_capacity":"28416452751360", "total_reclaimable_capacity":"40564"}`), 200, nil
+		case "/lsvdisk":
+			return []byte(`[
+				{"id":"0","name":"pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000000","mdisk_grp_name":"Pool0","capacity":"10737418240","vdisk_UID":"60050768108101C7C000000000000000"},
+				{"id":"1","name":"snapshot-0d3c1a52-1b7e-4c1e-9f0e-000000000001","mdisk_grp_name":"Pool0","capacity":"10737418240","vdisk_UID":"60050768108101C7C000000000000001"},
+				{"id":"2","name":"backup","mdisk_grp_name":"Pool1","capacity":"10737418240","vdisk_UID":"60050768108101C7C000000000000002"}
+			]`), 200, nil
+		case "/lssevdiskcopy":
+			return []byte(`[{"vdisk_id":"1","copy_id":"0","used_capacity":"1073741824"}]`), 200, nil
+		case "/lsfcmap":
+			return []byte(`[
+				{"id":"0","source_vdisk_id":"0","source_vdisk_name":"pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000000","target_vdisk_id":"1","status":"copying","progress":"40"},
+				{"id":"1","source_vdisk_id":"0","source_vdisk_name":"pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000000","target_vdisk_id":"2","status":"idle_or_copied","progress":"100"}
+			]`), 200, nil
+		case "/lsvolumesnapshot":
+			return []byte(`[
+				{"snapshot_id":"0","snapshot_name":"snapshot-0d3c1a52-1b7e-4c1e-9f0e-000000000003","volume_id":"0","state":"active","protection_written_capacity":"536870912"},
+				{"snapshot_id":"1","snapshot_name":"daily","volume_id":"0","state":"active","protection_written_capacity":"536870912"}
+			]`), 200, nil
+		case "/lsdumps":
+			return []byte(`[]`), 200, nil
+		}
+		return poster(req, c)
+	}
+	manager := drivermanager.DriverManager{SystemName: "FS-system-snapshot"}
+	client := &rest.FSRestClient{PostRequester: rest.NewRequester(snapshotPoster), DriverManager: &manager, RestConfig: restConfig1}
+	collector, _ := NewPerfCollector(map[string]*rest.FSRestClient{"FS-system-snapshot": client}, "FS-ns")
+
+	mockSystem(t, "FS-system-snapshot", restConfig1, "Pool0")
+	clientmanagers.ListPersistentVolumes = func(ctx context.Context, mgr *drivermanager.DriverManager) ([]corev1.PersistentVolume, error) {
+		return []corev1.PersistentVolume{
+			newCSIPersistentVolume("pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000000", "SVC:0;60050768108101C7C000000000000000", "app", "data-0", "fs-sc-1"),
+		}, nil
+	}
+	clientmanagers.ListVolumeSnapshotContents = func(ctx context.Context, mgr *drivermanager.DriverManager) ([]unstructured.Unstructured, error) {
+		// A pre-provisioned content of a fully allocated FlashCopy target, found by the handle
+		imported := newVolumeSnapshotContent("imported", drivermanager.CSIProvisioner, "db", "snap-2")
+		_ = unstructured.SetNestedField(imported.Object, "SVC:2;60050768108101C7C000000000000002", "spec", "source", "snapshotHandle")
+		return []unstructured.Unstructured{
+			newVolumeSnapshotContent("snapcontent-0d3c1a52-1b7e-4c1e-9f0e-000000000001", drivermanager.CSIProvisioner, "app", "snap-1"),
+			imported,
+			newVolumeSnapshotContent("snapcontent-0d3c1a52-1b7e-4c1e-9f0e-000000000003", drivermanager.CSIProvisioner, "app", "snap-3"),
+		}, nil
+	}
+
+	expected := `
+	# HELP flashsystem_snapshot_capacity_bytes Provisioned capacity of the array snapshot of the VolumeSnapshot (byte)
+	# TYPE flashsystem_snapshot_capacity_bytes gauge
+	flashsystem_snapshot_capacity_bytes{namespace="app",pool_name="Pool0",snapshot_name="snapshot-0d3c1a52-1b7e-4c1e-9f0e-000000000001",source_volume_name="pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000000",subsystem_name="FS-system-snapshot",volumesnapshot="snap-1",volumesnapshotcontent="snapcontent-0d3c1a52-1b7e-4c1e-9f0e-000000000001"} 1.073741824e+10
+	flashsystem_snapshot_capacity_bytes{namespace="app",pool_name="Pool0",snapshot_name="snapshot-0d3c1a52-1b7e-4c1e-9f0e-000000000003",source_volume_name="pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000000",subsystem_name="FS-system-snapshot",volumesnapshot="snap-3",volumesnapshotcontent="snapcontent-0d3c1a52-1b7e-4c1e-9f0e-000000000003"} 1.073741824e+10
+	flashsystem_snapshot_capacity_bytes{namespace="db",pool_name="Pool1",snapshot_name="backup",source_volume_name="pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000000",subsystem_name="FS-system-snapshot",volumesnapshot="snap-2",volumesnapshotcontent="imported"} 1.073741824e+10
+
+	# HELP flashsystem_snapshot_used_capacity_bytes Capacity the array snapshot of the VolumeSnapshot takes in the pool (byte)
+	# TYPE flashsystem_snapshot_used_capacity_bytes gauge
+	flashsystem_snapshot_used_capacity_bytes{namespace="app",pool_name="Pool0",snapshot_name="snapshot-0d3c1a52-1b7e-4c1e-9f0e-000000000001",source_volume_name="pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000000",subsystem_name="FS-system-snapshot",volumesnapshot="snap-1",volumesnapshotcontent="snapcontent-0d3c1a52-1b7e-4c1e-9f0e-000000000001"} 1.073741824e+09
+	flashsystem_snapshot_used_capacity_bytes{namespace="app",pool_name="Pool0",snapshot_name="snapshot-0d3c1a52-1b7e-4c1e-9f0e-000000000003",source_volume_name="pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000000",subsystem_name="FS-system-snapshot",volumesnapshot="snap-3",volumesnapshotcontent="snapcontent-0d3c1a52-1b7e-4c1e-9f0e-000000000003"} 5.36870912e+08
+	flashsystem_snapshot_used_capacity_bytes{namespace="db",pool_name="Pool1",snapshot_name="backup",source_volume_name="pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000000",subsystem_name="FS-system-snapshot",volumesnapshot="snap-2",volumesnapshotcontent="imported"} 1.073741824e+10
+
+	# HELP flashsystem_snapshot_copy_progress_ratio Background copy progress of the FlashCopy mapping of the VolumeSnapshot, 0 to 1
+	# TYPE flashsystem_snapshot_copy_progress_ratio gauge
+	flashsystem_snapshot_copy_progress_ratio{namespace="app",pool_name="Pool0",snapshot_name="snapshot-0d3c1a52-1b7e-4c1e-9f0e-000000000001",source_volume_name="pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000000",subsystem_name="FS-system-snapshot",volumesnapshot="snap-1",volumesnapshotcontent="snapcontent-0d3c1a52-1b7e-4c1e-9f0e-000000000001"} 0.4
+	flashsystem_snapshot_copy_progress_ratio{namespace="db",pool_name="Pool1",snapshot_name="backup",source_volume_name="pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000000",subsystem_name="FS-system-snapshot",volumesnapshot="snap-2",volumesnapshotcontent="imported"} 1
+
+	# HELP flashsystem_snapshot_dependent Whether the array snapshot of the VolumeSnapshot still shares data with its source volume, 1 = dependent
+	# TYPE flashsystem_snapshot_dependent gauge
+	flashsystem_snapshot_dependent{namespace="app",pool_name="Pool0",snapshot_name="snapshot-0d3c1a52-1b7e-4c1e-9f0e-000000000001",source_volume_name="pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000000",subsystem_name="FS-system-snapshot",volumesnapshot="snap-1",volumesnapshotcontent="snapcontent-0d3c1a52-1b7e-4c1e-9f0e-000000000001"} 1
+	flashsystem_snapshot_dependent{namespace="app",pool_name="Pool0",snapshot_name="snapshot-0d3c1a52-1b7e-4c1e-9f0e-000000000003",source_volume_name="pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000000",subsystem_name="FS-system-snapshot",volumesnapshot="snap-3",volumesnapshotcontent="snapcontent-0d3c1a52-1b7e-4c1e-9f0e-000000000003"} 1
+	flashsystem_snapshot_dependent{namespace="db",pool_name="Pool1",snapshot_name="backup",source_volume_name="pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000000",subsystem_name="FS-system-snapshot",volumesnapshot="snap-2",volumesnapshotcontent="imported"} 0
+
+	# HELP flashsystem_snapshot_info Array snapshot of the VolumeSnapshot, type is flashcopy or snapshot and state its array status
+	# TYPE flashsystem_snapshot_info gauge
+	flashsystem_snapshot_info{namespace="app",pool_name="Pool0",snapshot_name="snapshot-0d3c1a52-1b7e-4c1e-9f0e-000000000001",source_volume_name="pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000000",state="copying",subsystem_name="FS-system-snapshot",type="flashcopy",volumesnapshot="snap-1",volumesnapshotcontent="snapcontent-0d3c1a52-1b7e-4c1e-9f0e-000000000001"} 1
+	flashsystem_snapshot_info{namespace="app",pool_name="Pool0",snapshot_name="snapshot-0d3c1a52-1b7e-4c1e-9f0e-000000000003",source_volume_name="pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000000",state="active",subsystem_name="FS-system-snapshot",type="snapshot",volumesnapshot="snap-3",volumesnapshotcontent="snapcontent-0d3c1a52-1b7e-4c1e-9f0e-000000000003"} 1
+	flashsystem_snapshot_info{namespace="db",pool_name="Pool1",snapshot_name="backup",source_volume_name="pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000000",state="idle_or_copied",subsystem_name="FS-system-snapshot",type="flashcopy",volumesnapshot="snap-2",volumesnapshotcontent="imported"} 1
+
+	# HELP flashsystem_namespace_snapshots Number of VolumeSnapshots of the namespace with an array snapshot
+	# TYPE flashsystem_namespace_snapshots gauge
+	flashsystem_namespace_snapshots{namespace="app",subsystem_name="FS-system-snapshot"} 2
+	flashsystem_namespace_snapshots{namespace="db",subsystem_name="FS-system-snapshot"} 1
+
+	# HELP flashsystem_namespace_snapshot_capacity_bytes Provisioned capacity of the array snapshots of the VolumeSnapshots of the namespace (byte)
+	# TYPE flashsystem_namespace_snapshot_capacity_bytes gauge
+	flashsystem_namespace_snapshot_capacity_bytes{namespace="app",subsystem_name="FS-system-snapshot"} 2.147483648e+10
+	flashsystem_namespace_snapshot_capacity_bytes{namespace="db",subsystem_name="FS-system-snapshot"} 1.073741824e+10
+
+	# HELP flashsystem_namespace_snapshot_used_capacity_bytes Capacity the array snapshots of the VolumeSnapshots of the namespace take in the pools (byte)
+	# TYPE flashsystem_namespace_snapshot_used_capacity_bytes gauge
+	flashsystem_namespace_snapshot_used_capacity_bytes{namespace="app",subsystem_name="FS-system-snapshot"} 1.610612736e+09
+	flashsystem_namespace_snapshot_used_capacity_bytes{namespace="db",subsystem_name="FS-system-snapshot"} 1.073741824e+10
+	`
+
+	// The daily snapshot has no VolumeSnapshotContent
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected), SnapshotCapacity, SnapshotUsedCapacity, SnapshotCopyProgress,
+		SnapshotDependent, SnapshotInfo, NamespaceSnapshots, NamespaceSnapshotCapacity, NamespaceSnapshotUsedCapacity)
+	if err != nil {
+		t.Errorf("unexpected metrics:\n %s", err)
+	}
+}
+
+func TestUnparsableSnapshotCapacity(t *testing.T) {
+	volumes := rest.Volumes{
+		{"id": "0", "name": "pvc-0d3c1a52-1b7e-4c1e-9f0e-000000000000", "mdisk_grp_name": "Pool0", "capacity": "10.00GB"},
+	}
+	snapshots := rest.VolumeSnapshots{
+		{"snapshot_id": "0", "snapshot_name": "snapshot-0d3c1a52-1b7e-4c1e-9f0e-000000000001", "volume_id": "0",
+			"protection_provisioned_capacity": "10.00GB"},
+	}
+	contents := newSnapshotContents([]unstructured.Unstructured{
+		newVolumeSnapshotContent("snapcontent-0d3c1a52-1b7e-4c1e-9f0e-000000000001", drivermanager.CSIProvisioner, "app", "snap-1"),
+	})
+
+	for _, snapshot := range getSnapshots(volumes, snapshots, nil, contents, nil) {
+		if snapshot.hasCapacity {
+			t.Errorf("expected no capacity for %s, got %v", snapshot.name, snapshot.capacity)
+		}
+	}
+	orphans := findOrphans(volumes, snapshots, nil, map[string]int{"Pool0": 0}, getCSIVolumes(nil, map[string]bool{"": true}), newSnapshotContents(nil))
+	if len(orphans) != 2 {
+		t.Fatalf("expected 2 orphans, got %+v", orphans)
+	}
+	for _, orphan := range orphans {
+		if orphan.hasCapacity {
+			t.Errorf("expected no capacity for %s, got %v", orphan.Name, orphan.Capacity)
+		}
+	}
+}
+
+func TestOperationMetrics(t *testing.T) {
+	operationPoster := func(req *http.Request, c *rest.FSRestClient) ([]byte, int, error) {
+		switch fmt.Sprintf("%v", req.URL) {
+		case "/lssystem":
+			return []byte(`{"code_level": "8.5.2.0 (build 161.15.2208121040000)","product_name":"IBM FlashSystem 9200", "physical_capacity":"76427768211456", "physical_free_capacity":"28416452751360", "total_reclaimable_capacity":"40564", "time_zone":"522 UTC"}`), 200, nil
+		case "/lsvdisk":
+			return []byte(`[
+				{"id":"0","name":"vol0","mdisk_grp_name":"Pool1","capacity":"1073741824"},
+				{"id":"1","name":"vol1","mdisk_grp_name":"many","capacity":"1073741824"},
+				{"id":"2","name":"vol2","mdisk_grp_name":"Pool0","capacity":"1073741824"},
+				{"id":"3","name":"vol3","mdisk_grp_name":"Pool0","capacity":"1073741824"}
+			]`), 200, nil
+		case "/lsmigrate":
+			return []byte(`[
+				{"migrate_type":"MDisk_Group_Migration","progress":"25","migrate_source_vdisk_index":"0","migrate_target_mdisk_grp":"0","migrate_source_vdisk_copy_id":"0"},
+				{"migrate_type":"MDisk_Group_Migration","progress":"5","migrate_source_vdisk_index":"3","migrate_target_mdisk_grp":"2","migrate_source_vdisk_copy_id":"0"}
+			]`), 200, nil
+		case "/lsvdisksyncprogress":
+			return []byte(`[{"vdisk_id":"1","vdisk_name":"vol1","copy_id":"1","progress":"50","estimated_completion_time":"261019143000"}]`), 200, nil
+		case "/lsvdiskcopy":
+			return []byte(`[
+				{"vdisk_id":"1","vdisk_name":"vol1","copy_id":"0","mdisk_grp_name":"Pool1"},
+				{"vdisk_id":"1","vdisk_name":"vol1","copy_id":"1","mdisk_grp_name":"Pool0"}
+			]`), 200, nil
+		case "/lsfcmap":
+			return []byte(`[
+				{"id":"0","name":"fcmap0","source_vdisk_id":"0","target_vdisk_id":"2","status":"copying","progress":"40","copy_rate":"50"},
+				{"id":"1","name":"fcmap1","source_vdisk_id":"0","target_vdisk_id":"3","status":"copying","progress":"0","copy_rate":"0"}
+			]`), 200, nil
+		case "/lsarraysyncprogress":
+			return []byte(`[{"mdisk_id":"0","mdisk_name":"mdisk0","progress":"90","estimated_completion_time":""}]`), 200, nil
+		case "/lsarraymemberprogress":
+			return []byte(`[
+				{"mdisk_id":"1","mdisk_name":"mdisk1","member_id":"3","drive_id":"7","task":"rebuild","progress":"10","estimated_completion_time":"261020020000"},
+				{"mdisk_id":"2","mdisk_name":"mdisk2","member_id":"0","drive_id":"8","task":"copyback","progress":"60","estimated_completion_time":""}
+			]`), 200, nil
+		}
+		return poster(req, c)
+	}
+	manager := drivermanager.DriverManager{SystemName: "FS-system-operation"}
+	client := &rest.FSRestClient{PostRequester: rest.NewRequester(operationPoster), DriverManager: &manager, RestConfig: restConfig1}
+	collector, _ := NewPerfCollector(map[string]*rest.FSRestClient{"FS-system-operation": client}, "FS-ns")
+
+	mockSystem(t, "FS-system-operation", restConfig1, "Pool0", "Pool1")
+
+	// The migration to Pool2 and the copyback of its array aren't reported,
+	// and fcmap1 has no background copy
+	expected := `
+	# HELP flashsystem_operation_progress_ratio Progress of the in-flight operation, 0 to 1
+	# TYPE flashsystem_operation_progress_ratio gauge
+	flashsystem_operation_progress_ratio{array_name="",object_id="0",operation="migration",pool_name="Pool0",subsystem_name="FS-system-operation",volume_name="vol0"} 0.25
+	flashsystem_operation_progress_ratio{array_name="",object_id="1",operation="volume_copy_sync",pool_name="Pool0",subsystem_name="FS-system-operation",volume_name="vol1"} 0.5
+	flashsystem_operation_progress_ratio{array_name="",object_id="fcmap0",operation="flashcopy",pool_name="Pool0",subsystem_name="FS-system-operation",volume_name="vol2"} 0.4
+	flashsystem_operation_progress_ratio{array_name="mdisk0",object_id="",operation="array_sync",pool_name="Pool0",subsystem_name="FS-system-operation",volume_name=""} 0.9
+	flashsystem_operation_progress_ratio{array_name="mdisk1",object_id="3",operation="array_rebuild",pool_name="Pool1",subsystem_name="FS-system-operation",volume_name=""} 0.1
+
+	# HELP flashsystem_operation_estimated_completion_timestamp_seconds Estimated completion time of the in-flight operation (unix timestamp)
+	# TYPE flashsystem_operation_estimated_completion_timestamp_seconds gauge
+	flashsystem_operation_estimated_completion_timestamp_seconds{array_name="",object_id="1",operation="volume_copy_sync",pool_name="Pool0",subsystem_name="FS-system-operation",volume_name="vol1"} 1.7924202e+09
+	flashsystem_operation_estimated_completion_timestamp_seconds{array_name="mdisk1",object_id="3",operation="array_rebuild",pool_name="Pool1",subsystem_name="FS-system-operation",volume_name=""} 1.7924616e+09
+
+	# HELP flashsystem_pool_operations Number of in-flight operations writing to the pool
+	# TYPE flashsystem_pool_operations gauge
+	flashsystem_pool_operations{operation="array_rebuild",pool_name="Pool1",subsystem_name="FS-system-operation"} 1
+	flashsystem_pool_operations{operation="array_sync",pool_name="Pool0",subsystem_name="FS-system-operation"} 1
+	flashsystem_pool_operations{operation="flashcopy",pool_name="Pool0",subsystem_name="FS-system-operation"} 1
+	flashsystem_pool_operations{operation="migration",pool_name="Pool0",subsystem_name="FS-system-operation"} 1
+	flashsystem_pool_operations{operation="volume_copy_sync",pool_name="Pool0",subsystem_name="FS-system-operation"} 1
+	`
+
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected), OperationProgress, OperationEstimatedCompletion, PoolOperations)
+	if err != nil {
+		t.Errorf("unexpected metrics:\n %s", err)
+	}
+
+	t.Run("Denied command skips its operations only", func(t *testing.T) {
+		deniedPoster := func(req *http.Request, c *rest.FSRestClient) ([]byte, int, error) {
+			if fmt.Sprintf("%v", req.URL) == "/lsmigrate" {
+				return []byte(`CMMVC7205E The command failed because it is not supported.`), http.StatusForbidden, nil
+			}
+			return operationPoster(req, c)
+		}
+		manager := drivermanager.DriverManager{SystemName: "FS-system-operation"}
+		client := &rest.FSRestClient{PostRequester: rest.NewRequester(deniedPoster), DriverManager: &manager, RestConfig: restConfig1}
+		collector, _ := NewPerfCollector(map[string]*rest.FSRestClient{"FS-system-operation": client}, "FS-ns")
+
+		expected := `
+	# HELP flashsystem_metrics_skipped Metric family skipped for the system, requirement is the command or capability it needs, operation is set when only the series of the operation are skipped
+	# TYPE flashsystem_metrics_skipped gauge
+	flashsystem_metrics_skipped{metric="flashsystem_operation_estimated_completion_timestamp_seconds",operation="migration",reason="permission_denied",requirement="lsmigrate",subsystem_name="FS-system-operation"} 1
+	flashsystem_metrics_skipped{metric="flashsystem_operation_progress_ratio",operation="migration",reason="permission_denied",requirement="lsmigrate",subsystem_name="FS-system-operation"} 1
+	flashsystem_metrics_skipped{metric="flashsystem_pool_operations",operation="migration",reason="permission_denied",requirement="lsmigrate",subsystem_name="FS-system-operation"} 1
+
+	# HELP flashsystem_pool_operations Number of in-flight operations writing to the pool
+	# TYPE flashsystem_pool_operations gauge
+	flashsystem_pool_operations{operation="array_rebuild",pool_name="Pool1",subsystem_name="FS-system-operation"} 1
+	flashsystem_pool_operations{operation="array_sync",pool_name="Pool0",subsystem_name="FS-system-operation"} 1
+	flashsystem_pool_operations{operation="flashcopy",pool_name="Pool0",subsystem_name="FS-system-operation"} 1
+	flashsystem_pool_operations{operation="volume_copy_sync",pool_name="Pool0",subsystem_name="FS-system-operation"} 1
+	`
+		err := testutil.CollectAndCompare(collector, strings.NewReader(expected), MetricsSkipped, PoolOperations)
+		if err != nil {
+			t.Errorf("unexpected metrics:\n %s", err)
+		}
+	})
+}
+
+func TestArrayMetrics(t *testing.T) {
+	arrayPoster := func(req *http.Request, c *rest.FSRestClient) ([]byte, int, error) {
+		switch fmt.Sprintf("%v", req.URL) {
+		case "/lssystem":
+			return []byte(`{"code_level": "8.5.2.0 (build 161.15.2208121040000)","product_name":"IBM FlashSystem 9200", "physical_capacity":"76427768211456", "physical_free_capacity":"28416452751360", "total_reclaimable_capacity":"40564"}`), 200, nil
+		case "/lsarray":
+			return []byte(`[
+				{"mdisk_id":"0","mdisk_name":"mdisk0","status":"online","mdisk_grp_name":"Pool0","raid_status":"online","raid_level":"raid6","redundancy":"1","tier":"tier0_flash","distributed":"yes"},
+				{"mdisk_id":"1","mdisk_name":"mdisk1","status":"online","mdisk_grp_name":"Pool1","raid_status":"online","raid_level":"raid10","redundancy":"1","tier":"enterprise","distributed":"no"}
+			]`), 200, nil
+		case "/lsarray/0":
+			return []byte(`{"mdisk_id":"0","mdisk_name":"mdisk0","distributed":"yes","rebuild_areas_total":"2","rebuild_areas_available":"1","rebuild_areas_goal":"2"}`), 200, nil
+		case "/lsarraymember":
+			return []byte(`[
+				{"mdisk_id":"0","mdisk_name":"mdisk0","member_id":"0","drive_id":"0"},
+				{"mdisk_id":"0","mdisk_name":"mdisk0","member_id":"1","drive_id":"1"},
+				{"mdisk_id":"0","mdisk_name":"mdisk0","member_id":"2","drive_id":""},
+				{"mdisk_id":"1","mdisk_name":"mdisk1","member_id":"0","drive_id":"5"},
+				{"mdisk_id":"1","mdisk_name":"mdisk1","member_id":"1","drive_id":"6"}
+			]`), 200, nil
+		case "/lsdrive":
+			return []byte(`[
+				{"id":"0","status":"online","use":"member","mdisk_id":"0","member_id":"0"},
+				{"id":"1","status":"degraded","use":"member","mdisk_id":"0","member_id":"1"},
+				{"id":"5","status":"online","use":"member","mdisk_id":"1","member_id":"0"},
+				{"id":"6","status":"online","use":"member","mdisk_id":"1","member_id":"1"}
+			]`), 200, nil
+		case "/lsarraymemberprogress":
+			return []byte(`[{"mdisk_id":"0","mdisk_name":"mdisk0","member_id":"2","drive_id":"","task":"rebuild","progress":"30","estimated_completion_time":""}]`), 200, nil
+		}
+		return poster(req, c)
+	}
+	manager := drivermanager.DriverManager{SystemName: "FS-system-array"}
+	client := &rest.FSRestClient{PostRequester: rest.NewRequester(arrayPoster), DriverManager: &manager, RestConfig: restConfig1}
+	collector, _ := NewPerfCollector(map[string]*rest.FSRestClient{"FS-system-array": client}, "FS-ns")
+
+	mockSystem(t, "FS-system-array", restConfig1, "Pool0", "Pool1")
+
+	// Pool0 is online, but its array lost a member and is rebuilding
+	expected := `
+	# HELP flashsystem_array_info RAID array of the pool, raid_status is the array status of lsarray
+	# TYPE flashsystem_array_info gauge
+	flashsystem_array_info{array_name="mdisk0",distributed="true",pool_name="Pool0",raid_level="raid6",raid_status="online",subsystem_name="FS-system-array",tier="tier0_flash"} 1
+	flashsystem_array_info{array_name="mdisk1",distributed="false",pool_name="Pool1",raid_level="raid10",raid_status="online",subsystem_name="FS-system-array",tier="enterprise"} 1
+
+	# HELP flashsystem_array_redundancy Number of member drives the array can still lose without losing data
+	# TYPE flashsystem_array_redundancy gauge
+	flashsystem_array_redundancy{array_name="mdisk0",pool_name="Pool0",subsystem_name="FS-system-array"} 1
+	flashsystem_array_redundancy{array_name="mdisk1",pool_name="Pool1",subsystem_name="FS-system-array"} 1
+
+	# HELP flashsystem_array_redundancy_degraded Whether the array has less redundancy than its RAID level provides, 1 = degraded
+	# TYPE flashsystem_array_redundancy_degraded gauge
+	flashsystem_array_redundancy_degraded{array_name="mdisk0",pool_name="Pool0",subsystem_name="FS-system-array"} 1
+	flashsystem_array_redundancy_degraded{array_name="mdisk1",pool_name="Pool1",subsystem_name="FS-system-array"} 0
+
+	# HELP flashsystem_array_rebuild_areas_available Rebuild areas of the distributed array which are available
+	# TYPE flashsystem_array_rebuild_areas_available gauge
+	flashsystem_array_rebuild_areas_available{array_name="mdisk0",pool_name="Pool0",subsystem_name="FS-system-array"} 1
+
+	# HELP flashsystem_array_rebuild_areas_used Rebuild areas of the distributed array which hold rebuilt data
+	# TYPE flashsystem_array_rebuild_areas_used gauge
+	flashsystem_array_rebuild_areas_used{array_name="mdisk0",pool_name="Pool0",subsystem_name="FS-system-array"} 1
+
+	# HELP flashsystem_array_rebuild_areas_goal Rebuild areas the distributed array should have available
+	# TYPE flashsystem_array_rebuild_areas_goal gauge
+	flashsystem_array_rebuild_areas_goal{array_name="mdisk0",pool_name="Pool0",subsystem_name="FS-system-array"} 2
+
+	# HELP flashsystem_array_member_status Status of the member drive of the array, 0 = online, 1 = degraded, 2 = offline or missing
+	# TYPE flashsystem_array_member_status gauge
+	flashsystem_array_member_status{array_name="mdisk0",drive_id="",member_id="2",pool_name="Pool0",subsystem_name="FS-system-array"} 2
+	flashsystem_array_member_status{array_name="mdisk0",drive_id="0",member_id="0",pool_name="Pool0",subsystem_name="FS-system-array"} 0
+	flashsystem_array_member_status{array_name="mdisk0",drive_id="1",member_id="1",pool_name="Pool0",subsystem_name="FS-system-array"} 1
+	flashsystem_array_member_status{array_name="mdisk1",drive_id="5",member_id="0",pool_name="Pool1",subsystem_name="FS-system-array"} 0
+	flashsystem_array_member_status{array_name="mdisk1",drive_id="6",member_id="1",pool_name="Pool1",subsystem_name="FS-system-array"} 0
+
+	# HELP flashsystem_array_member_tasks Number of members of the array with a task in progress, such as rebuild or copyback
+	# TYPE flashsystem_array_member_tasks gauge
+	flashsystem_array_member_tasks{array_name="mdisk0",pool_name="Pool0",subsystem_name="FS-system-array",task="rebuild"} 1
+
+	# HELP flashsystem_pool_health Pool health status, 0 = online, 1 = degraded or an array with degraded redundancy, 2 = offline
+	# TYPE flashsystem_pool_health gauge
+	flashsystem_pool_health{pool_name="Pool0",subsystem_name="FS-system-array"} 1
+	flashsystem_pool_health{pool_name="Pool1",subsystem_name="FS-system-array"} 2
+	`
+
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected), ArrayInfoMetric, ArrayRedundancy, ArrayRedundancyDegraded,
+		ArrayRebuildAreasAvailable, ArrayRebuildAreasUsed, ArrayRebuildAreasGoal, ArrayMemberStatus, ArrayMemberTasks, PoolHealth)
+	if err != nil {
+		t.Errorf("unexpected metrics:\n %s", err)
+	}
+}
+
+func TestDriveMetrics(t *testing.T) {
+	detailRequests := 0
+	drivePoster := func(req *http.Request, c *rest.FSRestClient) ([]byte, int, error) {
+		if strings.HasPrefix(fmt.Sprintf("%v", req.URL), "/lsdrive/") {
+			detailRequests++
+		}
+		switch fmt.Sprintf("%v", req.URL) {
+		case "/lssystem":
+			return []byte(`{"code_level": "8.5.2.0 (build 161.15.2208121040000)","product_name":"IBM FlashSystem 9200", "physical_capacity":"76427768211456", "physical_free_capacity":"28416452751360", "total_reclaimable_capacity":"40564"}`), 200, nil
+		case "/lsarray":
+			return []byte(`[
+				{"mdisk_id":"0","mdisk_name":"mdisk0","mdisk_grp_name":"Pool0","raid_status":"online","raid_level":"raid6","redundancy":"2","distributed":"no"},
+				{"mdisk_id":"3","mdisk_name":"mdisk3","mdisk_grp_name":"Pool2","raid_status":"online","raid_level":"raid6","redundancy":"2","distributed":"no"}
+			]`), 200, nil
+		case "/lsarraymember":
+			return []byte(`[]`), 200, nil
+		case "/lsdrive":
+			return []byte(`[
+				{"id":"0","status":"online","use":"member","tech_type":"tier0_flash","capacity":"4398046511104","mdisk_id":"0","mdisk_name":"mdisk0","member_id":"0"},
+				{"id":"1","status":"online","use":"member","tech_type":"tier0_flash","capacity":"4398046511104","mdisk_id":"3","mdisk_name":"mdisk3","member_id":"0"},
+				{"id":"2","status":"online","use":"spare","tech_type":"tier_enterprise","capacity":"1099511627776","mdisk_id":"","mdisk_name":"","member_id":""},
+				{"id":"3","status":"offline","use":"failed","tech_type":"tier0_flash","capacity":"4398046511104","mdisk_id":"","mdisk_name":"","member_id":""}
+			]`), 200, nil
+		case "/lsdrive/0":
+			return []byte(`{"id":"0","firmware_level":"4.1.2","write_endurance_used":"12","write_endurance_usage_rate":"low","replacement_date":"310101",
+				"physical_capacity":"4398046511104","physical_used_capacity":"1099511627776","effective_used_capacity":"2748779069440"}`), 200, nil
+		case "/lsdrive/2":
+			return []byte(`{"id":"2","firmware_level":"B010","write_endurance_used":"","write_endurance_usage_rate":"","replacement_date":""}`), 200, nil
+		case "/lsdrive/3":
+			return []byte(`{"id":"3","firmware_level":"4.1.2","write_endurance_used":"100","write_endurance_usage_rate":"high","replacement_date":""}`), 200, nil
+		}
+		return poster(req, c)
+	}
+	manager := drivermanager.DriverManager{SystemName: "FS-system-drive"}
+	client := &rest.FSRestClient{PostRequester: rest.NewRequester(drivePoster), DriverManager: &manager, RestConfig: restConfig1}
+	collector, _ := NewPerfCollector(map[string]*rest.FSRestClient{"FS-system-drive": client}, "FS-ns")
+
+	mockSystem(t, "FS-system-drive", restConfig1, "Pool0")
+
+	// Drive 1 is a member of the array of Pool2, which no storage class uses
+	expected := `
+	# HELP flashsystem_drive_info Drive of the system, use is member, spare, candidate, failed or unused
+	# TYPE flashsystem_drive_info gauge
+	flashsystem_drive_info{array_name="",drive_id="2",firmware_level="B010",member_id="",pool_name="",subsystem_name="FS-system-drive",tech_type="tier_enterprise",use="spare",write_endurance_usage_rate=""} 1
+	flashsystem_drive_info{array_name="",drive_id="3",firmware_level="4.1.2",member_id="",pool_name="",subsystem_name="FS-system-drive",tech_type="tier0_flash",use="failed",write_endurance_usage_rate="high"} 1
+	flashsystem_drive_info{array_name="mdisk0",drive_id="0",firmware_level="4.1.2",member_id="0",pool_name="Pool0",subsystem_name="FS-system-drive",tech_type="tier0_flash",use="member",write_endurance_usage_rate="low"} 1
+
+	# HELP flashsystem_drive_status Drive status, 0 = online, 1 = degraded, 2 = offline
+	# TYPE flashsystem_drive_status gauge
+	flashsystem_drive_status{array_name="",drive_id="2",pool_name="",subsystem_name="FS-system-drive"} 0
+	flashsystem_drive_status{array_name="",drive_id="3",pool_name="",subsystem_name="FS-system-drive"} 2
+	flashsystem_drive_status{array_name="mdisk0",drive_id="0",pool_name="Pool0",subsystem_name="FS-system-drive"} 0
+
+	# HELP flashsystem_drive_capacity_bytes Capacity of the drive (byte)
+	# TYPE flashsystem_drive_capacity_bytes gauge
+	flashsystem_drive_capacity_bytes{array_name="",drive_id="2",pool_name="",subsystem_name="FS-system-drive"} 1.099511627776e+12
+	flashsystem_drive_capacity_bytes{array_name="",drive_id="3",pool_name="",subsystem_name="FS-system-drive"} 4.398046511104e+12
+	flashsystem_drive_capacity_bytes{array_name="mdisk0",drive_id="0",pool_name="Pool0",subsystem_name="FS-system-drive"} 4.398046511104e+12
+
+	# HELP flashsystem_drive_write_endurance_used_ratio Write endurance of the flash drive which is used, 0 to 1
+	# TYPE flashsystem_drive_write_endurance_used_ratio gauge
+	flashsystem_drive_write_endurance_used_ratio{array_name="",drive_id="3",pool_name="",subsystem_name="FS-system-drive"} 1
+	flashsystem_drive_write_endurance_used_ratio{array_name="mdisk0",drive_id="0",pool_name="Pool0",subsystem_name="FS-system-drive"} 0.12
+
+	# HELP flashsystem_drive_replacement_timestamp_seconds Predicted date the flash drive wears out and should be replaced (unix timestamp)
+	# TYPE flashsystem_drive_replacement_timestamp_seconds gauge
+	flashsystem_drive_replacement_timestamp_seconds{array_name="mdisk0",drive_id="0",pool_name="Pool0",subsystem_name="FS-system-drive"} 1.924992e+09
+
+	# HELP flashsystem_drive_physical_capacity_bytes Physical capacity of the FlashCore Module (byte)
+	# TYPE flashsystem_drive_physical_capacity_bytes gauge
+	flashsystem_drive_physical_capacity_bytes{array_name="mdisk0",drive_id="0",pool_name="Pool0",subsystem_name="FS-system-drive"} 4.398046511104e+12
+
+	# HELP flashsystem_drive_physical_used_capacity_bytes Physical capacity of the FlashCore Module used after compression (byte)
+	# TYPE flashsystem_drive_physical_used_capacity_bytes gauge
+	flashsystem_drive_physical_used_capacity_bytes{array_name="mdisk0",drive_id="0",pool_name="Pool0",subsystem_name="FS-system-drive"} 1.099511627776e+12
+
+	# HELP flashsystem_drive_effective_used_capacity_bytes Capacity written to the FlashCore Module before compression (byte)
+	# TYPE flashsystem_drive_effective_used_capacity_bytes gauge
+	flashsystem_drive_effective_used_capacity_bytes{array_name="mdisk0",drive_id="0",pool_name="Pool0",subsystem_name="FS-system-drive"} 2.74877906944e+12
+
+	# HELP flashsystem_drive_compression_ratio Compression ratio of the FlashCore Module, effective used capacity to physical used capacity
+	# TYPE flashsystem_drive_compression_ratio gauge
+	flashsystem_drive_compression_ratio{array_name="mdisk0",drive_id="0",pool_name="Pool0",subsystem_name="FS-system-drive"} 2.5
+	`
+
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected), DriveInfoMetric, DriveStatus, DriveCapacity,
+		DriveWriteEnduranceUsed, DriveReplacementTime, DrivePhysicalCapacity, DrivePhysicalUsedCapacity, DriveEffectiveUsedCapacity,
+		DriveCompressionRatio)
+	if err != nil {
+		t.Errorf("unexpected metrics:\n %s", err)
+	}
+
+	// The detailed views are kept for the next scrapes
+	testutil.CollectAndCount(collector, DriveInfoMetric)
+	if detailRequests != 3 {
+		t.Errorf("expected the drive details to be fetched once, got %d requests", detailRequests)
+	}
+}
+
+func TestDetailCache(t *testing.T) {
+	fetches := 0
+	fetch := func() (map[string]string, error) {
+		fetches++
+		return map[string]string{"fetch": strconv.Itoa(fetches)}, nil
+	}
+	failed := func() (map[string]string, error) {
+		return nil, fmt.Errorf("failed")
+	}
+
+	details := &detailCache{}
+	for _, status := range []string{"online", "online", "degraded"} {
+		if _, err := details.get("array/0", status, fetch); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if fetches != 2 {
+		t.Errorf("expected a fetch for the new status only, got %d fetches", fetches)
+	}
+	if _, err := details.get("array/1", "online", failed); err == nil || len(details.details) != 1 {
+		t.Errorf("failures shouldn't be cached, got %v %v", err, details.details)
+	}
+
+	details.details["array/0"] = cachedDetail{status: "degraded", fetched: time.Now().Add(-DetailRefreshInterval)}
+	if detail, _ := details.get("array/0", "degraded", fetch); detail["fetch"] != "3" {
+		t.Errorf("expected an old view to be fetched again, got %v", detail)
+	}
+	details.details["array/2"] = cachedDetail{fetched: time.Now().Add(-DetailRefreshInterval)}
+	details.expire()
+	if _, ok := details.details["array/2"]; ok || len(details.details) != 1 {
+		t.Errorf("expected the old views to expire, got %v", details.details)
+	}
 }
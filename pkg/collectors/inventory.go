@@ -0,0 +1,152 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collectors
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/config"
+)
+
+const (
+	// Metric name shown outside
+	PoolInventoryInfo  = "flashsystem_pool_inventory_info"
+	PoolVolumeCount    = "flashsystem_pool_volume_count"
+	PoolOverallocation = "flashsystem_pool_overallocation_ratio"
+	PoolTierCapacity   = "flashsystem_pool_tier_capacity_bytes"
+
+	// Interested keys of lsmdiskgrp and lsmdisk
+	EasyTierKey       = "easy_tier"
+	EasyTierStatusKey = "easy_tier_status"
+	EncryptKey        = "encrypt"
+	VolumeCountKey    = "vdisk_count"
+	OverallocationKey = "overallocation"
+	TierKey           = "tier"
+)
+
+var (
+	poolInventoryLabel = []string{
+		"subsystem_name",
+		"pool_name",
+		"easy_tier",
+		"easy_tier_status",
+		"encrypted",
+		"data_reduction",
+		"managed_by_odf",
+	}
+
+	poolTierLabel = []string{
+		"subsystem_name",
+		"pool_name",
+		"tier",
+	}
+
+	inventoryMetricsMap = map[string]MetricLabel{
+		PoolInventoryInfo:  {"Pool configuration, managed_by_odf is true when an ODF storage class uses the pool", poolInventoryLabel},
+		PoolVolumeCount:    {"Number of volumes in the pool", poolLabelCommon},
+		PoolOverallocation: {"Pool virtual capacity to pool capacity ratio", poolLabelCommon},
+		PoolTierCapacity:   {"Pool capacity of the MDisks in each tier (byte)", poolTierLabel},
+	}
+)
+
+// InventoryMode exports all pools of the system, for easy mock
+var InventoryMode = func() bool {
+	return config.Get().InventoryMode
+}
+
+func (f *PerfCollector) initInventoryDescs() {
+	for metricName, metricLabel := range inventoryMetricsMap {
+		f.poolDescriptors[metricName] = prometheus.NewDesc(
+			metricName,
+			metricLabel.Name, metricLabel.Labels, nil,
+		)
+	}
+}
+
+func poolString(pool PoolInfo, key string) string {
+	value, _ := pool.PoolMDiskGrpInfo[key].(string)
+	return value
+}
+
+// getPoolTierCapacities sums the MDisk capacities of the pool per tier,
+// MDisks without a tier are left out.
+func getPoolTierCapacities(pool PoolInfo) (map[string]float64, error) {
+	tiers := map[string]float64{}
+	for _, mDisk := range pool.PoolMDisksList {
+		tier, _ := mDisk[TierKey].(string)
+		if tier == "" {
+			continue
+		}
+		capacity, err := strconv.ParseFloat(mDisk[CapacityKey].(string), 64)
+		if err != nil {
+			return nil, err
+		}
+		tiers[tier] += capacity
+	}
+	return tiers, nil
+}
+
+func (f *PerfCollector) createInventoryPoolMetrics(ch chan<- prometheus.Metric, poolInfo PoolInfo) {
+	logger := poolLogger(poolInfo)
+	dataReduction := poolString(poolInfo, DataReductionKey)
+	if dataReduction == "" {
+		dataReduction = "no"
+	}
+	ch <- prometheus.MustNewConstMetric(
+		f.poolDescriptors[PoolInventoryInfo],
+		prometheus.GaugeValue,
+		1,
+		poolInfo.SystemName,
+		poolInfo.PoolName,
+		poolString(poolInfo, EasyTierKey),
+		poolString(poolInfo, EasyTierStatusKey),
+		poolString(poolInfo, EncryptKey),
+		dataReduction,
+		strconv.FormatBool(poolInfo.ManagedByODF),
+	)
+
+	if volumes, err := strconv.ParseFloat(poolString(poolInfo, VolumeCountKey), 64); err == nil {
+		newPoolCapacityMetrics(ch, f.poolDescriptors[PoolVolumeCount], volumes, &poolInfo)
+	} else {
+		logger.Error(err, "get volume count failed")
+	}
+
+	// overallocation is the percentage of the virtual capacity to the capacity
+	if overallocation, err := strconv.ParseFloat(poolString(poolInfo, OverallocationKey), 64); err == nil {
+		newPoolCapacityMetrics(ch, f.poolDescriptors[PoolOverallocation], overallocation/100, &poolInfo)
+	} else {
+		logger.Error(err, "get overallocation failed")
+	}
+
+	tiers, err := getPoolTierCapacities(poolInfo)
+	if err != nil {
+		logger.Error(err, "get tier capacities failed")
+		return
+	}
+	for tier, capacity := range tiers {
+		ch <- prometheus.MustNewConstMetric(
+			f.poolDescriptors[PoolTierCapacity],
+			prometheus.GaugeValue,
+			capacity,
+			poolInfo.SystemName,
+			poolInfo.PoolName,
+			tier,
+		)
+	}
+}
@@ -0,0 +1,263 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collectors
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/logging"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/rest"
+)
+
+const (
+	NodeMetricPrefix = "flashsystem_node_"
+
+	// Metric name shown outside
+	NodeInfoMetric         = "flashsystem_node_info"
+	NodeStatus             = "flashsystem_node_status"
+	IOGroupNodeCount       = "flashsystem_iogroup_node_count"
+	IOGroupOnlineNodeCount = "flashsystem_iogroup_online_node_count"
+	IOGroupHAState         = "flashsystem_iogroup_ha_state"
+
+	// Interested keys of lsnode and lsnodestats
+	NodeIdKey       = "id"
+	NodeNameKey     = "name"
+	NodeStatusKey   = "status"
+	NodeStatNameKey = "node_name"
+	IOGroupNameKey  = "IO_group_name"
+	SiteNameKey     = "site_name"
+	ConfigNodeKey   = "config_node"
+	HardwareKey     = "hardware"
+	PanelNameKey    = "panel_name"
+
+	// Node and IO group states, 0 = OK, 1 = warning, 2 = error
+	HealthOK      = 0.0
+	HealthWarning = 1.0
+	HealthError   = 2.0
+)
+
+var (
+	nodeLabel     = []string{"subsystem_name", "node_name", "io_group", "site"}
+	nodeInfoLabel = []string{"subsystem_name", "node_name", "io_group", "site", "node_id", "config_node", "hardware", "panel_name", "status"}
+	iogroupLabel  = []string{"subsystem_name", "io_group"}
+
+	nodeStatusMetricsMap = map[string]MetricLabel{
+		NodeInfoMetric:         {"Node information", nodeInfoLabel},
+		NodeStatus:             {"Node status, 0 = online, 1 = not serving IO, 2 = offline", nodeLabel},
+		IOGroupNodeCount:       {"Number of nodes in the IO group", iogroupLabel},
+		IOGroupOnlineNodeCount: {"Number of healthy nodes in the IO group", iogroupLabel},
+		IOGroupHAState:         {"IO group high availability, 0 = redundant, 1 = no redundancy, 2 = offline", iogroupLabel},
+	}
+
+	// Metrics of the stats table per node
+	nodeMetricsMap = statsMetricsMap(NodeMetricPrefix, "node performance - ", nodeLabel)
+)
+
+type NodeInfo struct {
+	SystemName string
+	Name       string
+	IOGroup    string
+	Site       string
+}
+
+type ioGroupState struct {
+	nodeCount   int
+	onlineCount int
+}
+
+func (f *PerfCollector) initNodeDescs() {
+	f.nodeDescriptors = make(map[string]*prometheus.Desc)
+
+	for metricName, metricLabel := range nodeMetricsMap {
+		f.nodeDescriptors[metricName] = prometheus.NewDesc(
+			metricName,
+			metricLabel.Name, metricLabel.Labels, nil,
+		)
+	}
+
+	for metricName, metricLabel := range nodeStatusMetricsMap {
+		f.nodeDescriptors[metricName] = prometheus.NewDesc(
+			metricName,
+			metricLabel.Name, metricLabel.Labels, nil,
+		)
+	}
+}
+
+func nodeStatusValue(status string) float64 {
+	switch {
+	case status == "offline":
+		return HealthError
+	case rest.IsNodeHealthy(status):
+		return HealthOK
+	}
+	return HealthWarning
+}
+
+func ioGroupHAState(state ioGroupState) float64 {
+	switch {
+	case state.onlineCount == 0:
+		return HealthError
+	case state.onlineCount < 2:
+		return HealthWarning
+	}
+	return HealthOK
+}
+
+func getIOGroupStates(nodes rest.Nodes) map[string]ioGroupState {
+	ioGroups := map[string]ioGroupState{}
+	for _, node := range nodes {
+		state := ioGroups[node[IOGroupNameKey]]
+		state.nodeCount++
+		if rest.IsNodeHealthy(node[NodeStatusKey]) {
+			state.onlineCount++
+		}
+		ioGroups[node[IOGroupNameKey]] = state
+	}
+	return ioGroups
+}
+
+// systemHealth is an error when an IO group has no healthy node, and a warning
+// when a node is unhealthy or an IO group has no redundancy.
+func systemHealth(nodes rest.Nodes) float64 {
+	health := HealthOK
+	for _, state := range getIOGroupStates(nodes) {
+		if state.onlineCount == 0 {
+			return HealthError
+		}
+		if state.onlineCount < state.nodeCount || state.nodeCount == 1 {
+			health = HealthWarning
+		}
+	}
+	return health
+}
+
+func (f *PerfCollector) collectNodeStatusMetrics(ch chan<- prometheus.Metric, systemName string, nodes rest.Nodes) {
+	for _, node := range nodes {
+		nodeInfo := NodeInfo{
+			SystemName: systemName,
+			Name:       node[NodeNameKey],
+			IOGroup:    node[IOGroupNameKey],
+			Site:       node[SiteNameKey],
+		}
+		ch <- prometheus.MustNewConstMetric(
+			f.nodeDescriptors[NodeInfoMetric],
+			prometheus.GaugeValue,
+			1,
+			nodeInfo.SystemName,
+			nodeInfo.Name,
+			nodeInfo.IOGroup,
+			nodeInfo.Site,
+			node[NodeIdKey],
+			node[ConfigNodeKey],
+			node[HardwareKey],
+			node[PanelNameKey],
+			node[NodeStatusKey],
+		)
+		newNodeMetrics(ch, f.nodeDescriptors[NodeStatus], nodeStatusValue(node[NodeStatusKey]), &nodeInfo)
+	}
+
+	for ioGroup, state := range getIOGroupStates(nodes) {
+		newIOGroupMetrics(ch, f.nodeDescriptors[IOGroupNodeCount], float64(state.nodeCount), systemName, ioGroup)
+		newIOGroupMetrics(ch, f.nodeDescriptors[IOGroupOnlineNodeCount], float64(state.onlineCount), systemName, ioGroup)
+		newIOGroupMetrics(ch, f.nodeDescriptors[IOGroupHAState], ioGroupHAState(state), systemName, ioGroup)
+	}
+}
+
+// getNodeStats runs lsnodestats, and lsnodecanisterstats on the systems which
+// only know the canister command.
+func getNodeStats(ctx context.Context, fsRestClient *rest.FSRestClient) (rest.NodeStats, error) {
+	stats, err := fsRestClient.Lsnodestats(ctx)
+	if err != nil && !rest.IsPermissionDenied(err) {
+		stats, err = fsRestClient.Lsnodecanisterstats(ctx)
+	}
+	return stats, err
+}
+
+func (f *PerfCollector) collectNodeMetrics(ctx context.Context, ch chan<- prometheus.Metric, fsRestClient *rest.FSRestClient, nodes rest.Nodes,
+	skipped skippedMetrics) {
+	systemName := fsRestClient.DriverManager.GetSubsystemName()
+	logger := logging.WithSystem(systemName)
+
+	stats, err := getNodeStats(ctx, fsRestClient)
+	if err != nil {
+		if !skipped.permissionDenied(err) {
+			logger.Error(err, "get node stats failed")
+		}
+		return
+	}
+
+	nodeInfos := map[string]NodeInfo{}
+	for _, node := range nodes {
+		nodeInfos[node[NodeNameKey]] = NodeInfo{
+			SystemName: systemName,
+			Name:       node[NodeNameKey],
+			IOGroup:    node[IOGroupNameKey],
+			Site:       node[SiteNameKey],
+		}
+	}
+
+	location := fsRestClient.Location()
+	for _, m := range stats {
+		def, ok := statsTable[m[StatNameKey]]
+		if !ok {
+			continue
+		}
+
+		nodeInfo, ok := nodeInfos[m[NodeStatNameKey]]
+		if !ok {
+			nodeInfo = NodeInfo{SystemName: systemName, Name: m[NodeStatNameKey]}
+		}
+
+		value, err := parseStat(def, m, location)
+		if err != nil {
+			logger.Error(err, "fail to convert node metric to float", "node", nodeInfo.Name, "stat", m[StatNameKey], "value", m[StatCurrentKey])
+			continue
+		}
+
+		metricName := NodeMetricPrefix + def.Metric
+		newNodeMetrics(ch, f.nodeDescriptors[metricName], value.Current, &nodeInfo)
+		if value.HasPeak {
+			newNodeMetrics(ch, f.nodeDescriptors[metricName+peakSuffix], value.Peak, &nodeInfo)
+		}
+		if value.PeakTime > 0 {
+			newNodeMetrics(ch, f.nodeDescriptors[metricName+peakTimeSuffix], value.PeakTime, &nodeInfo)
+		}
+	}
+}
+
+func newNodeMetrics(ch chan<- prometheus.Metric, desc *prometheus.Desc, value float64, info *NodeInfo) {
+	ch <- prometheus.MustNewConstMetric(
+		desc,
+		prometheus.GaugeValue,
+		value,
+		info.SystemName,
+		info.Name,
+		info.IOGroup,
+		info.Site,
+	)
+}
+
+func newIOGroupMetrics(ch chan<- prometheus.Metric, desc *prometheus.Desc, value float64, systemName string, ioGroup string) {
+	ch <- prometheus.MustNewConstMetric(
+		desc,
+		prometheus.GaugeValue,
+		value,
+		systemName,
+		ioGroup,
+	)
+}
@@ -0,0 +1,280 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collectors
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/iostats"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/rest"
+)
+
+const (
+	// Metric name shown outside
+	PoolTopVolumeIOPS                = "flashsystem_pool_top_volume_iops"
+	PoolTopVolumeBytes               = "flashsystem_pool_top_volume_bytes"
+	PoolTopVolumeLatencyContribution = "flashsystem_pool_top_volume_latency_contribution"
+
+	// Path of the noisy neighbor report on the exporter http server
+	NoisyNeighborsPath = "/noisyneighbors"
+)
+
+var (
+	poolTopVolumeLabel = []string{
+		"subsystem_name",
+		"pool_name",
+		"volume_name",
+		"namespace",
+		"persistentvolumeclaim",
+		"persistentvolume",
+		"storageclass",
+	}
+
+	noisyNeighborMetricsMap = map[string]MetricLabel{
+		PoolTopVolumeIOPS:                {"noisy neighbors - IOPS of the busiest volumes of the pool", poolTopVolumeLabel},
+		PoolTopVolumeBytes:               {"noisy neighbors - throughput bytes/s of the busiest volumes of the pool", poolTopVolumeLabel},
+		PoolTopVolumeLatencyContribution: {"noisy neighbors - share of the pool IO time spent on the volume, 0 to 1", poolTopVolumeLabel},
+	}
+)
+
+// NoisyVolume is a volume of the noisy neighbor report. The persistent volume
+// fields are empty for the volumes without a persistent volume. The latency
+// contribution is the IOPS times the latency of the volume, over the sum of
+// all volumes of the pool.
+type NoisyVolume struct {
+	Volume                string  `json:"volume"`
+	Namespace             string  `json:"namespace,omitempty"`
+	PersistentVolumeClaim string  `json:"persistentVolumeClaim,omitempty"`
+	PersistentVolume      string  `json:"persistentVolume,omitempty"`
+	StorageClass          string  `json:"storageClass,omitempty"`
+	ReadIOPS              float64 `json:"readIOPS"`
+	WriteIOPS             float64 `json:"writeIOPS"`
+	ReadBytes             float64 `json:"readBytes"`
+	WriteBytes            float64 `json:"writeBytes"`
+	ReadLatency           float64 `json:"readLatencySeconds"`
+	WriteLatency          float64 `json:"writeLatencySeconds"`
+	LatencyContribution   float64 `json:"latencyContribution"`
+}
+
+// PoolNoisyNeighbors is the performance of a pool and its busiest volumes by
+// IOPS, throughput and latency contribution.
+type PoolNoisyNeighbors struct {
+	Pool          string        `json:"pool"`
+	ReadIOPS      float64       `json:"readIOPS"`
+	WriteIOPS     float64       `json:"writeIOPS"`
+	ReadBytes     float64       `json:"readBytes"`
+	WriteBytes    float64       `json:"writeBytes"`
+	ReadLatency   float64       `json:"readLatencySeconds"`
+	WriteLatency  float64       `json:"writeLatencySeconds"`
+	TopIOPS       []NoisyVolume `json:"topIOPS"`
+	TopThroughput []NoisyVolume `json:"topThroughput"`
+	TopLatency    []NoisyVolume `json:"topLatencyContribution"`
+}
+
+// SystemNoisyNeighbors is the noisy neighbor report of a system, Time is when
+// it was computed.
+type SystemNoisyNeighbors struct {
+	System string               `json:"system"`
+	Time   time.Time            `json:"time"`
+	Pools  []PoolNoisyNeighbors `json:"pools"`
+}
+
+type NoisyNeighborReport struct {
+	Systems []SystemNoisyNeighbors `json:"systems"`
+}
+
+type noisyVolume struct {
+	info VolumeInfo
+	perf *iostats.IOPerf
+}
+
+func (f *PerfCollector) initNoisyNeighborDescs() {
+	for metricName, metricLabel := range noisyNeighborMetricsMap {
+		f.poolDescriptors[metricName] = prometheus.NewDesc(
+			metricName,
+			metricLabel.Name, metricLabel.Labels, nil,
+		)
+	}
+}
+
+// ioTime is the IO time per second of a volume, the sum of its latencies
+// weighted by its IOPS.
+func ioTime(perf *iostats.IOPerf) float64 {
+	return perf.ReadLatency*perf.ReadIOPS + perf.WriteLatency*perf.WriteIOPS
+}
+
+// topNoisyVolumes returns the topN volumes with the largest value, the volumes
+// without any are left out.
+func topNoisyVolumes(volumes []noisyVolume, topN int, poolIOTime float64, value func(perf *iostats.IOPerf) float64) []NoisyVolume {
+	sorted := make([]noisyVolume, 0, len(volumes))
+	for _, volume := range volumes {
+		if value(volume.perf) > 0 {
+			sorted = append(sorted, volume)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := value(sorted[i].perf), value(sorted[j].perf)
+		if a != b {
+			return a > b
+		}
+		return sorted[i].info.Name < sorted[j].info.Name
+	})
+	if len(sorted) > topN {
+		sorted = sorted[:topN]
+	}
+
+	top := []NoisyVolume{}
+	for _, volume := range sorted {
+		noisy := NoisyVolume{
+			Volume:                volume.info.Name,
+			Namespace:             volume.info.PV.Namespace,
+			PersistentVolumeClaim: volume.info.PV.Claim,
+			PersistentVolume:      volume.info.PV.Name,
+			StorageClass:          volume.info.PV.StorageClass,
+			ReadIOPS:              volume.perf.ReadIOPS,
+			WriteIOPS:             volume.perf.WriteIOPS,
+			ReadBytes:             volume.perf.ReadBytes,
+			WriteBytes:            volume.perf.WriteBytes,
+			ReadLatency:           volume.perf.ReadLatency,
+			WriteLatency:          volume.perf.WriteLatency,
+		}
+		if poolIOTime > 0 {
+			noisy.LatencyContribution = ioTime(volume.perf) / poolIOTime
+		}
+		top = append(top, noisy)
+	}
+	return top
+}
+
+// writesOnly returns the performance of a volume without its reads, as seen
+// by the pool of a copy which isn't the primary copy.
+func writesOnly(perf *iostats.IOPerf) *iostats.IOPerf {
+	writes := *perf
+	writes.ReadIOPS, writes.ReadBytes, writes.ReadLatency = 0, 0, 0
+	return &writes
+}
+
+// getNoisyNeighbors returns the busiest volumes of each pool of poolsInfoList.
+// The volumes of a child pool count for the parent pool too, and the volumes
+// with copies in several pools for the pools of their copies, like in the pool
+// performance: the pools of the other copies only see their writes.
+func getNoisyNeighbors(systemName string, volumes rest.Volumes, volumesPerf map[string]*iostats.IOPerf, copies copyPools,
+	volumeInfos map[string]VolumeInfo, poolsInfoList []PoolInfo, topN int) []PoolNoisyNeighbors {
+	poolVolumes := map[string][]noisyVolume{}
+	for _, volume := range volumes {
+		perf, ok := volumesPerf[volume[VolumeIdKey]]
+		if !ok {
+			continue
+		}
+		info, ok := volumeInfos[volume[VolumeIdKey]]
+		if !ok {
+			info = VolumeInfo{SystemName: systemName, Name: volume[VolumeNameKey], PoolName: volume[MdiskGroupNameKey]}
+		}
+		readPools, writePools := volumeIOPools(volume, copies)
+		reads := map[string]bool{}
+		for _, poolName := range readPools {
+			reads[poolName] = true
+		}
+		for _, poolName := range writePools {
+			poolPerf := perf
+			if !reads[poolName] {
+				poolPerf = writesOnly(perf)
+			}
+			poolVolumes[poolName] = append(poolVolumes[poolName], noisyVolume{info: info, perf: poolPerf})
+		}
+	}
+
+	poolsPerf := getPoolsPerf(volumes, volumesPerf, copies)
+	var pools []PoolNoisyNeighbors
+	for _, pool := range poolsInfoList {
+		perf, ok := poolsPerf[pool.PoolName]
+		if !ok {
+			perf = &PoolPerf{}
+		}
+		poolIOTime := perf.readLatency + perf.writeLatency
+		candidates := poolVolumes[pool.PoolName]
+		pools = append(pools, PoolNoisyNeighbors{
+			Pool:          pool.PoolName,
+			ReadIOPS:      perf.ReadIOPS,
+			WriteIOPS:     perf.WriteIOPS,
+			ReadBytes:     perf.ReadBytes,
+			WriteBytes:    perf.WriteBytes,
+			ReadLatency:   perf.ReadLatency(),
+			WriteLatency:  perf.WriteLatency(),
+			TopIOPS:       topNoisyVolumes(candidates, topN, poolIOTime, (*iostats.IOPerf).TotalIOPS),
+			TopThroughput: topNoisyVolumes(candidates, topN, poolIOTime, (*iostats.IOPerf).TotalBytes),
+			TopLatency:    topNoisyVolumes(candidates, topN, poolIOTime, ioTime),
+		})
+	}
+	return pools
+}
+
+// createNoisyNeighborMetrics reports the busiest volumes of the exported pools,
+// and keeps the report for the http server.
+func (f *PerfCollector) createNoisyNeighborMetrics(ch chan<- prometheus.Metric, systemName string, volumes rest.Volumes,
+	volumesPerf map[string]*iostats.IOPerf, copies copyPools, volumeInfos map[string]VolumeInfo, poolsInfoList []PoolInfo) {
+	topN := VolumeStats().PoolTopN
+	// No rates before the second statistics files
+	if topN == 0 || len(volumesPerf) == 0 || len(poolsInfoList) == 0 {
+		f.noisyNeighbors.set(systemName, nil)
+		return
+	}
+
+	pools := getNoisyNeighbors(systemName, volumes, volumesPerf, copies, volumeInfos, poolsInfoList, topN)
+	for _, pool := range pools {
+		for _, volume := range pool.TopIOPS {
+			newPoolTopVolumeMetrics(ch, f.poolDescriptors[PoolTopVolumeIOPS], volume.ReadIOPS+volume.WriteIOPS, systemName, pool.Pool, &volume)
+		}
+		for _, volume := range pool.TopThroughput {
+			newPoolTopVolumeMetrics(ch, f.poolDescriptors[PoolTopVolumeBytes], volume.ReadBytes+volume.WriteBytes, systemName, pool.Pool, &volume)
+		}
+		for _, volume := range pool.TopLatency {
+			newPoolTopVolumeMetrics(ch, f.poolDescriptors[PoolTopVolumeLatencyContribution], volume.LatencyContribution, systemName, pool.Pool, &volume)
+		}
+	}
+	f.noisyNeighbors.set(systemName, &SystemNoisyNeighbors{System: systemName, Time: time.Now(), Pools: pools})
+}
+
+func newPoolTopVolumeMetrics(ch chan<- prometheus.Metric, desc *prometheus.Desc, value float64, systemName string, poolName string,
+	volume *NoisyVolume) {
+	ch <- prometheus.MustNewConstMetric(
+		desc,
+		prometheus.GaugeValue,
+		value,
+		systemName,
+		poolName,
+		volume.Volume,
+		volume.Namespace,
+		volume.PersistentVolumeClaim,
+		volume.PersistentVolume,
+		volume.StorageClass,
+	)
+}
+
+// NoisyNeighbors returns the latest noisy neighbor report of each system.
+func (f *PerfCollector) NoisyNeighbors() NoisyNeighborReport {
+	return NoisyNeighborReport{Systems: f.noisyNeighbors.list()}
+}
+
+// ServeNoisyNeighbors serves the noisy neighbor report as JSON.
+func (f *PerfCollector) ServeNoisyNeighbors(w http.ResponseWriter, r *http.Request) {
+	serveJSON(w, f.NoisyNeighbors())
+}
@@ -0,0 +1,321 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collectors
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/logging"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/rest"
+)
+
+const (
+	// Metric name shown outside
+	OperationProgress            = "flashsystem_operation_progress_ratio"
+	OperationEstimatedCompletion = "flashsystem_operation_estimated_completion_timestamp_seconds"
+	PoolOperations               = "flashsystem_pool_operations"
+
+	// Operations reported, the array member tasks are reported as array_<task>
+	OperationMigration      = "migration"
+	OperationVolumeCopySync = "volume_copy_sync"
+	OperationFlashCopy      = "flashcopy"
+	OperationArraySync      = "array_sync"
+	OperationArrayPrefix    = "array_"
+
+	// Operation of the skip series when the array member tasks, such as array_rebuild, can't be listed
+	OperationArrayMemberTasks = "array_member_tasks"
+
+	// Interested keys of lsmigrate
+	MigrateVolumeIdKey   = "migrate_source_vdisk_index"
+	MigrateCopyIdKey     = "migrate_source_vdisk_copy_id"
+	MigrateTargetPoolKey = "migrate_target_mdisk_grp"
+
+	// Interested keys of lsvdisksyncprogress, lsvdiskcopy, lsarraysyncprogress and lsarraymemberprogress
+	OperationProgressKey      = "progress"
+	OperationCompletionKey    = "estimated_completion_time"
+	OperationCopyIdKey        = "copy_id"
+	CopyVolumeNameKey         = "vdisk_name"
+	OperationArrayIdKey       = "mdisk_id"
+	OperationArrayNameKey     = "mdisk_name"
+	OperationMemberIdKey      = "member_id"
+	OperationMemberTaskKey    = "task"
+	FCMapNameKey              = "name"
+	FCMapCopyRateKey          = "copy_rate"
+	FCMapStatusCopying        = "copying"
+	OperationCompletionFormat = "060102150405"
+)
+
+var (
+	operationLabel     = []string{"subsystem_name", "operation", "pool_name", "volume_name", "array_name", "object_id"}
+	poolOperationLabel = []string{"subsystem_name", "pool_name", "operation"}
+
+	operationMetricsMap = map[string]MetricLabel{
+		OperationProgress:            {"Progress of the in-flight operation, 0 to 1", operationLabel},
+		OperationEstimatedCompletion: {"Estimated completion time of the in-flight operation (unix timestamp)", operationLabel},
+		PoolOperations:               {"Number of in-flight operations writing to the pool", poolOperationLabel},
+	}
+)
+
+// operation is a background operation of the system, volume and array are the
+// names of the volume or array it works on, and pool the pool it writes to.
+// objectId tells apart several operations of an object, such as the volume
+// copy or the array member.
+type operation struct {
+	kind          string
+	pool          string
+	volume        string
+	array         string
+	objectId      string
+	progress      float64
+	completion    time.Time
+	hasCompletion bool
+}
+
+func (f *PerfCollector) initOperationDescs() {
+	f.operationDescriptors = make(map[string]*prometheus.Desc)
+
+	for metricName, metricLabel := range operationMetricsMap {
+		f.operationDescriptors[metricName] = prometheus.NewDesc(
+			metricName,
+			metricLabel.Name, metricLabel.Labels, nil,
+		)
+	}
+}
+
+// parseProgress returns the percentage progress of an operation as a ratio.
+func parseProgress(progress string) (float64, bool) {
+	value, err := strconv.ParseFloat(progress, 64)
+	if err != nil {
+		return 0, false
+	}
+	return value / 100, true
+}
+
+// newOperation returns the operation of a progress entry, the estimated
+// completion time is in the time zone of the system.
+func newOperation(kind string, entry map[string]string, location *time.Location) (operation, bool) {
+	progress, ok := parseProgress(entry[OperationProgressKey])
+	if !ok {
+		return operation{}, false
+	}
+	op := operation{kind: kind, progress: progress}
+	if completion := entry[OperationCompletionKey]; completion != "" {
+		if t, err := time.ParseInLocation(OperationCompletionFormat, completion, location); err == nil {
+			op.completion, op.hasCompletion = t, true
+		}
+	}
+	return op, true
+}
+
+// getMigrations returns the volume migrations, which write to the target pool,
+// empty if it isn't in poolsById. The migrations to an image mode volume have
+// no target pool, they take the pool of the volume.
+func getMigrations(migrations rest.Operations, volumesById map[string]map[string]string, poolsById map[string]string) []operation {
+	var operations []operation
+	for _, migration := range migrations {
+		volume, ok := volumesById[migration[MigrateVolumeIdKey]]
+		if !ok {
+			continue
+		}
+		op, ok := newOperation(OperationMigration, migration, time.UTC)
+		if !ok {
+			continue
+		}
+		op.volume = volume[VolumeNameKey]
+		op.objectId = migration[MigrateCopyIdKey]
+		op.pool = volume[MdiskGroupNameKey]
+		if targetPool := migration[MigrateTargetPoolKey]; targetPool != "" {
+			op.pool = poolsById[targetPool]
+		}
+		operations = append(operations, op)
+	}
+	return operations
+}
+
+// getVolumeCopySyncs returns the volume copies being synchronized, which write
+// to the pool of the copy.
+func getVolumeCopySyncs(syncs rest.Operations, copies rest.VolumeCopies, location *time.Location) []operation {
+	copyPools := map[string]map[string]string{}
+	for _, volumeCopy := range copies {
+		copyPools[volumeCopy[CopyVolumeIdKey]+":"+volumeCopy[OperationCopyIdKey]] = volumeCopy
+	}
+
+	var operations []operation
+	for _, sync := range syncs {
+		volumeCopy, ok := copyPools[sync[CopyVolumeIdKey]+":"+sync[OperationCopyIdKey]]
+		if !ok {
+			continue
+		}
+		op, ok := newOperation(OperationVolumeCopySync, sync, location)
+		if !ok {
+			continue
+		}
+		op.volume = sync[CopyVolumeNameKey]
+		op.pool = volumeCopy[MdiskGroupNameKey]
+		op.objectId = sync[OperationCopyIdKey]
+		operations = append(operations, op)
+	}
+	return operations
+}
+
+func isBackgroundCopy(fcmap map[string]string) bool {
+	return fcmap[FCMapStatusKey] == FCMapStatusCopying && fcmap[FCMapCopyRateKey] != "0"
+}
+
+// getFlashCopies returns the FlashCopy mappings copying in the background,
+// which write to the pool of the target volume. The mappings without
+// background copy never complete and aren't reported.
+func getFlashCopies(fcmaps rest.FCMaps, volumesById map[string]map[string]string) []operation {
+	var operations []operation
+	for _, fcmap := range fcmaps {
+		if !isBackgroundCopy(fcmap) {
+			continue
+		}
+		target, ok := volumesById[fcmap[FCMapTargetIdKey]]
+		if !ok {
+			continue
+		}
+		op, ok := newOperation(OperationFlashCopy, fcmap, time.UTC)
+		if !ok {
+			continue
+		}
+		op.volume = target[VolumeNameKey]
+		op.pool = target[MdiskGroupNameKey]
+		op.objectId = fcmap[FCMapNameKey]
+		operations = append(operations, op)
+	}
+	return operations
+}
+
+// getArrayOperations returns the array synchronizations and the member tasks,
+// such as rebuild and copyback, which write to the pool of the array.
+func getArrayOperations(syncs rest.Operations, members rest.Operations, arrayPools map[string]string,
+	location *time.Location) []operation {
+	var operations []operation
+	add := func(kind string, entry map[string]string, objectId string) {
+		pool, ok := arrayPools[entry[OperationArrayIdKey]]
+		if !ok {
+			return
+		}
+		op, ok := newOperation(kind, entry, location)
+		if !ok {
+			return
+		}
+		op.pool = pool
+		op.array = entry[OperationArrayNameKey]
+		op.objectId = objectId
+		operations = append(operations, op)
+	}
+
+	for _, sync := range syncs {
+		add(OperationArraySync, sync, "")
+	}
+	for _, member := range members {
+		if member[OperationMemberTaskKey] == "" {
+			continue
+		}
+		add(OperationArrayPrefix+member[OperationMemberTaskKey], member, member[OperationMemberIdKey])
+	}
+	return operations
+}
+
+// listOperations runs a progress command if the code level has it, a
+// permission error is recorded in skipped.
+func listOperations(ctx context.Context, fsRestClient *rest.FSRestClient, command string, list func(context.Context) (rest.Operations, error),
+	skipped skippedMetrics) rest.Operations {
+	if !fsRestClient.Capabilities().Has(command) {
+		return nil
+	}
+	operations, err := list(ctx)
+	if err != nil && !skipped.permissionDenied(err) {
+		logging.WithSystem(fsRestClient.DriverManager.GetSubsystemName()).Error(err, "get operations failed", logging.CommandKey, command)
+	}
+	return operations
+}
+
+// collectOperationMetrics reports the in-flight volume migrations, volume copy
+// synchronizations, FlashCopy background copies and array rebuilds of the
+// pools. volumes and fcmaps are the volumes and FlashCopy mappings of the
+// cycle, and memberTasks the array member tasks of lsarraymemberprogress. The
+// operations writing to other pools aren't reported.
+func (f *PerfCollector) collectOperationMetrics(ctx context.Context, ch chan<- prometheus.Metric, fsRestClient *rest.FSRestClient, poolsInfoList []PoolInfo,
+	volumes rest.Volumes, fcmaps rest.FCMaps, memberTasks rest.Operations, skipped skippedMetrics) {
+	if len(poolsInfoList) == 0 {
+		return
+	}
+	systemName := fsRestClient.DriverManager.GetSubsystemName()
+	logger := logging.WithSystem(systemName)
+	location := fsRestClient.Location()
+
+	poolNames := map[string]bool{}
+	poolsById := map[string]string{}
+	arrayPools := map[string]string{}
+	for _, pool := range poolsInfoList {
+		poolNames[pool.PoolName] = true
+		poolsById[strconv.Itoa(pool.PoolId)] = pool.PoolName
+		for _, mDisk := range pool.PoolMDisksList {
+			if id, ok := mDisk[MdiskIdKey].(string); ok {
+				arrayPools[id] = pool.PoolName
+			}
+		}
+	}
+
+	migrations := listOperations(ctx, fsRestClient, rest.CommandLsmigrate, fsRestClient.Lsmigrate, skipped)
+	syncs := listOperations(ctx, fsRestClient, rest.CommandLsvdisksyncprogress, fsRestClient.Lsvdisksyncprogress, skipped)
+	arraySyncs := listOperations(ctx, fsRestClient, rest.CommandLsarraysyncprogress, fsRestClient.Lsarraysyncprogress, skipped)
+
+	volumesById := map[string]map[string]string{}
+	for _, volume := range volumes {
+		volumesById[volume[VolumeIdKey]] = volume
+	}
+	var copies rest.VolumeCopies
+	if len(syncs) > 0 && fsRestClient.Capabilities().Has(rest.CommandLsvdiskcopy) {
+		var err error
+		if copies, err = fsRestClient.Lsvdiskcopy(ctx); err != nil && !skipped.permissionDenied(err) {
+			logger.Error(err, "get volume copies failed")
+		}
+	}
+
+	operations := getMigrations(migrations, volumesById, poolsById)
+	operations = append(operations, getVolumeCopySyncs(syncs, copies, location)...)
+	operations = append(operations, getFlashCopies(fcmaps, volumesById)...)
+	operations = append(operations, getArrayOperations(arraySyncs, memberTasks, arrayPools, location)...)
+
+	poolOperations := map[[2]string]int{}
+	for _, op := range operations {
+		if !poolNames[op.pool] {
+			continue
+		}
+		poolOperations[[2]string{op.pool, op.kind}]++
+
+		labels := []string{systemName, op.kind, op.pool, op.volume, op.array, op.objectId}
+		ch <- prometheus.MustNewConstMetric(f.operationDescriptors[OperationProgress], prometheus.GaugeValue, op.progress, labels...)
+		if op.hasCompletion {
+			ch <- prometheus.MustNewConstMetric(f.operationDescriptors[OperationEstimatedCompletion], prometheus.GaugeValue,
+				float64(op.completion.Unix()), labels...)
+		}
+	}
+
+	for key, count := range poolOperations {
+		ch <- prometheus.MustNewConstMetric(f.operationDescriptors[PoolOperations], prometheus.GaugeValue,
+			float64(count), systemName, key[0], key[1])
+	}
+}
@@ -0,0 +1,373 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collectors
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/driver"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/logging"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/rest"
+)
+
+const (
+	// Metric name shown outside
+	OrphanedVolumeCapacity = "flashsystem_orphaned_volume_capacity_bytes"
+	PoolOrphanedVolumes    = "flashsystem_pool_orphaned_volumes"
+	PoolOrphanedCapacity   = "flashsystem_pool_orphaned_capacity_bytes"
+
+	// Kinds of orphans
+	OrphanKindVolume   = "volume"
+	OrphanKindSnapshot = "snapshot"
+
+	// Path of the orphan report on the exporter http server
+	OrphansPath = "/orphans"
+
+	// Name prefixes of the CSI sidecars, followed by the UID of the claim or the VolumeSnapshot
+	PVNamePrefix              = "pvc-"
+	SnapshotNamePrefix        = "snapshot-"
+	SnapshotContentNamePrefix = "snapcontent-"
+
+	// Parameter of the storage class prepended to the array volume names
+	VolumeNamePrefixParameter = "volume_name_prefix"
+)
+
+var (
+	orphanedVolumeLabel = []string{"subsystem_name", "pool_name", "volume_name", "kind"}
+	poolOrphanLabel     = []string{"subsystem_name", "pool_name", "kind"}
+
+	orphanMetricsMap = map[string]MetricLabel{
+		OrphanedVolumeCapacity: {"Provisioned capacity of the CSI volume or snapshot without a PersistentVolume or VolumeSnapshotContent (byte)", orphanedVolumeLabel},
+		PoolOrphanedVolumes:    {"Number of CSI volumes or snapshots of the pool without a PersistentVolume or VolumeSnapshotContent", poolOrphanLabel},
+		PoolOrphanedCapacity:   {"Provisioned capacity of the CSI volumes or snapshots of the pool without a PersistentVolume or VolumeSnapshotContent (byte)", poolOrphanLabel},
+	}
+
+	// Array names of the CSI volumes and snapshots, with an optional name prefix of the storage or snapshot class
+	uidPattern             = `([0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})$`
+	csiVolumeNamePattern   = regexp.MustCompile(`(?i)(^|_)` + PVNamePrefix + uidPattern)
+	csiSnapshotNamePattern = regexp.MustCompile(`(?i)(^|_)` + SnapshotNamePrefix + uidPattern)
+)
+
+// Orphan is a CSI volume or snapshot of the array which is left without its
+// PersistentVolume or VolumeSnapshotContent.
+type Orphan struct {
+	Kind     string  `json:"kind"`
+	Id       string  `json:"id"`
+	Name     string  `json:"name"`
+	UID      string  `json:"uid,omitempty"`
+	Pool     string  `json:"pool"`
+	Capacity float64 `json:"capacityBytes"`
+
+	hasCapacity bool
+}
+
+// SystemOrphans is the orphan report of a system, Time is when it was computed.
+type SystemOrphans struct {
+	System  string    `json:"system"`
+	Time    time.Time `json:"time"`
+	Orphans []Orphan  `json:"orphans"`
+}
+
+type OrphanReport struct {
+	Systems []SystemOrphans `json:"systems"`
+}
+
+// csiVolumes are the names and handles of the PersistentVolumes of the block
+// CSI driver, and the volume name prefixes of the storage classes.
+type csiVolumes struct {
+	// UIDs of the claims from the PersistentVolume names
+	uids map[string]bool
+	// Array volume UIDs of the handles
+	handles map[string]bool
+	// Name prefixes of the storage classes, empty for no prefix
+	prefixes map[string]bool
+}
+
+// has tells if an array volume named name with the volume UID volumeUID
+// belongs to one of the PersistentVolumes.
+func (v csiVolumes) has(name string, volumeUID string) bool {
+	if v.handles[strings.ToUpper(volumeUID)] {
+		return true
+	}
+	match := csiVolumeNamePattern.FindStringSubmatch(name)
+	return match != nil && v.uids[strings.ToLower(match[2])]
+}
+
+// owns tells if an array volume was created for this cluster, it belongs to
+// one of the PersistentVolumes or has the name prefix of a storage class. The
+// volumes of other clusters sharing the pool have other name prefixes.
+func (v csiVolumes) owns(name string, volumeUID string) bool {
+	if v.has(name, volumeUID) {
+		return true
+	}
+	match := csiVolumeNamePattern.FindStringIndex(name)
+	return match != nil && v.prefixes[name[:match[0]]]
+}
+
+func (f *PerfCollector) initOrphanDescs() {
+	for metricName, metricLabel := range orphanMetricsMap {
+		f.poolDescriptors[metricName] = prometheus.NewDesc(
+			metricName,
+			metricLabel.Name, metricLabel.Labels, nil,
+		)
+	}
+}
+
+func getCSIVolumes(pvs map[string]PVInfo, prefixes map[string]bool) csiVolumes {
+	volumes := csiVolumes{uids: map[string]bool{}, handles: map[string]bool{}, prefixes: prefixes}
+	for handleUID, pv := range pvs {
+		volumes.handles[handleUID] = true
+		if strings.HasPrefix(pv.Name, PVNamePrefix) {
+			volumes.uids[strings.ToLower(strings.TrimPrefix(pv.Name, PVNamePrefix))] = true
+		}
+	}
+	return volumes
+}
+
+// getVolumeNamePrefixes returns the volume name prefixes of the storage classes
+// of the system, the empty prefix for the storage classes without one.
+func getVolumeNamePrefixes(ctx context.Context, cluster *clusterResources, manager *driver.DriverManager) (map[string]bool, error) {
+	prefixes := map[string]bool{}
+	for sc := range manager.GetSCPoolMap() {
+		storageClass, err := cluster.storageClass(ctx, manager, sc)
+		if err != nil {
+			return nil, err
+		}
+		prefixes[storageClass.Parameters[VolumeNamePrefixParameter]] = true
+	}
+	return prefixes, nil
+}
+
+// storageClassPool returns the storage class pool of the volume, empty if it
+// is in another pool.
+func storageClassPool(volume map[string]string, poolNames map[string]int) string {
+	for _, poolName := range volumePools(volume) {
+		if _, ok := poolNames[poolName]; ok {
+			return poolName
+		}
+	}
+	return ""
+}
+
+// findOrphans returns the CSI volumes and snapshots of the storage class pools
+// which don't belong to a PersistentVolume or VolumeSnapshotContent. Snapshots
+// are only checked if contents isn't nil. The snapshots of lsvolumesnapshot
+// take the pool and capacity of their source volume. Only the volumes this
+// cluster owns are checked, and the snapshots of its volumes, found with the
+// FlashCopy mappings for the FlashCopy target volumes.
+func findOrphans(volumes rest.Volumes, snapshots rest.VolumeSnapshots, fcmaps rest.FCMaps, poolNames map[string]int,
+	pvs csiVolumes, contents *snapshotContents) []Orphan {
+	volumesById := map[string]map[string]string{}
+	for _, volume := range volumes {
+		volumesById[volume[VolumeIdKey]] = volume
+	}
+	ownedSource := func(sourceId string) bool {
+		source, ok := volumesById[sourceId]
+		return ok && pvs.owns(source[VolumeNameKey], source[VolumeUIDKey])
+	}
+	targetSources := map[string]string{}
+	for _, fcmap := range fcmaps {
+		targetSources[fcmap[FCMapTargetIdKey]] = fcmap[FCMapSourceIdKey]
+	}
+
+	var orphans []Orphan
+	for _, volume := range volumes {
+		poolName := storageClassPool(volume, poolNames)
+		if poolName == "" {
+			continue
+		}
+
+		name := volume[VolumeNameKey]
+		orphan := Orphan{Id: volume[VolumeIdKey], Name: name, UID: volume[VolumeUIDKey], Pool: poolName}
+		switch {
+		case csiVolumeNamePattern.MatchString(name):
+			if pvs.has(name, orphan.UID) || !pvs.owns(name, orphan.UID) {
+				continue
+			}
+			orphan.Kind = OrphanKindVolume
+		case csiSnapshotNamePattern.MatchString(name) && contents != nil:
+			// A FlashCopy target volume
+			if _, ok := contents.find(name, orphan.UID); ok {
+				continue
+			}
+			if sourceId, ok := targetSources[orphan.Id]; !ok || !ownedSource(sourceId) {
+				continue
+			}
+			orphan.Kind = OrphanKindSnapshot
+		default:
+			continue
+		}
+		orphan.setCapacity(volume)
+		orphans = append(orphans, orphan)
+	}
+
+	if contents == nil {
+		return orphans
+	}
+	for _, snapshot := range snapshots {
+		name := snapshot[SnapshotNameKey]
+		if !csiSnapshotNamePattern.MatchString(name) {
+			continue
+		}
+		if _, ok := contents.find(name, ""); ok {
+			continue
+		}
+		if !ownedSource(snapshot[SnapshotVolumeIdKey]) {
+			continue
+		}
+		source := volumesById[snapshot[SnapshotVolumeIdKey]]
+		poolName := storageClassPool(source, poolNames)
+		if poolName == "" {
+			continue
+		}
+		orphan := Orphan{Kind: OrphanKindSnapshot, Id: snapshot[SnapshotIdKey], Name: name, Pool: poolName}
+		orphan.setCapacity(source)
+		orphans = append(orphans, orphan)
+	}
+	return orphans
+}
+
+// setCapacity takes the provisioned capacity of volume, the orphan is left
+// without one if it can't be parsed.
+func (o *Orphan) setCapacity(volume map[string]string) {
+	if capacity, err := volumeCapacityValue(volume, CapacityKey); err == nil {
+		o.Capacity, o.hasCapacity = capacity, true
+	}
+}
+
+func orphanKey(orphan Orphan) string {
+	return orphan.Kind + "/" + orphan.Id + "/" + orphan.Name
+}
+
+// confirmOrphans keeps the orphans already found by the previous collection.
+// The CSI driver creates the array volume before its PersistentVolume or
+// VolumeSnapshotContent, so a new volume isn't an orphan yet.
+func (f *PerfCollector) confirmOrphans(systemName string, orphans []Orphan) []Orphan {
+	previous, _ := f.orphanCandidates.get(systemName)
+	candidates := map[string]bool{}
+	var confirmed []Orphan
+	for _, orphan := range orphans {
+		key := orphanKey(orphan)
+		candidates[key] = true
+		if previous[key] {
+			confirmed = append(confirmed, orphan)
+		}
+	}
+	f.orphanCandidates.set(systemName, &candidates)
+	return confirmed
+}
+
+// collectOrphanMetrics reports the orphaned CSI volumes and snapshots of the
+// storage class pools. contents is nil if the VolumeSnapshotContents can't be
+// listed, then no snapshot is reported. The orphans are only reported, never
+// removed.
+func (f *PerfCollector) collectOrphanMetrics(ctx context.Context, ch chan<- prometheus.Metric, cluster *clusterResources, fsRestClient *rest.FSRestClient,
+	volumes rest.Volumes, snapshots rest.VolumeSnapshots, fcmaps rest.FCMaps, pvs map[string]PVInfo, contents *snapshotContents,
+	poolsInfoList []PoolInfo) {
+	manager := fsRestClient.DriverManager
+	systemName := manager.GetSubsystemName()
+	logger := logging.WithSystem(systemName)
+
+	// The storage class pools found on the system
+	scPools := manager.GetPoolNames()
+	poolNames := map[string]int{}
+	for _, pool := range poolsInfoList {
+		if id, ok := scPools[pool.PoolName]; ok {
+			poolNames[pool.PoolName] = id
+		}
+	}
+	if len(poolNames) == 0 {
+		f.orphans.set(systemName, nil)
+		return
+	}
+
+	// Without the name prefixes the volumes of other clusters can't be told apart
+	prefixes, err := getVolumeNamePrefixes(ctx, cluster, manager)
+	if err != nil {
+		logger.Error(err, "get storage classes failed, skip the orphans")
+		f.orphans.set(systemName, nil)
+		return
+	}
+
+	orphans := f.confirmOrphans(systemName, findOrphans(volumes, snapshots, fcmaps, poolNames, getCSIVolumes(pvs, prefixes), contents))
+	sort.Slice(orphans, func(i, j int) bool {
+		if orphans[i].Pool != orphans[j].Pool {
+			return orphans[i].Pool < orphans[j].Pool
+		}
+		return orphans[i].Name < orphans[j].Name
+	})
+
+	type poolOrphans struct {
+		count       float64
+		capacity    float64
+		hasCapacity bool
+	}
+	pools := map[string]map[string]*poolOrphans{}
+	for poolName := range poolNames {
+		pools[poolName] = map[string]*poolOrphans{OrphanKindVolume: {hasCapacity: true}, OrphanKindSnapshot: {hasCapacity: true}}
+	}
+	for _, orphan := range orphans {
+		pools[orphan.Pool][orphan.Kind].count++
+		if !orphan.hasCapacity {
+			pools[orphan.Pool][orphan.Kind].hasCapacity = false
+			continue
+		}
+		pools[orphan.Pool][orphan.Kind].capacity += orphan.Capacity
+		ch <- prometheus.MustNewConstMetric(f.poolDescriptors[OrphanedVolumeCapacity], prometheus.GaugeValue, orphan.Capacity,
+			systemName, orphan.Pool, orphan.Name, orphan.Kind)
+	}
+	if len(orphans) > 0 {
+		logger.V(logging.ScrapeLevel).Info("Found orphaned CSI volumes", "count", len(orphans))
+	}
+
+	for poolName, kinds := range pools {
+		for kind, total := range kinds {
+			if kind == OrphanKindSnapshot && contents == nil {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(f.poolDescriptors[PoolOrphanedVolumes], prometheus.GaugeValue, total.count,
+				systemName, poolName, kind)
+			// The sum would be short without the capacity of each orphan
+			if total.hasCapacity {
+				ch <- prometheus.MustNewConstMetric(f.poolDescriptors[PoolOrphanedCapacity], prometheus.GaugeValue, total.capacity,
+					systemName, poolName, kind)
+			}
+		}
+	}
+
+	if orphans == nil {
+		orphans = []Orphan{}
+	}
+	f.orphans.set(systemName, &SystemOrphans{System: systemName, Time: time.Now(), Orphans: orphans})
+}
+
+// Orphans returns the latest orphan report of each system.
+func (f *PerfCollector) Orphans() OrphanReport {
+	return OrphanReport{Systems: f.orphans.list()}
+}
+
+// ServeOrphans serves the orphan report as JSON.
+func (f *PerfCollector) ServeOrphans(w http.ResponseWriter, r *http.Request) {
+	serveJSON(w, f.Orphans())
+}
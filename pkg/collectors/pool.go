@@ -17,6 +17,7 @@
 package collectors
 
 import (
+	"context"
 	"fmt"
 	"github.com/IBM/ibm-storage-odf-block-driver/pkg/rest"
 	"math"
@@ -24,29 +25,34 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/go-logr/logr"
 	"github.com/prometheus/client_golang/prometheus"
-	log "k8s.io/klog"
 
 	"github.com/IBM/ibm-storage-odf-block-driver/pkg/driver"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/logging"
+	clientmanagers "github.com/IBM/ibm-storage-odf-block-driver/pkg/managers"
 )
 
 type Pool map[string]interface{}
 
 const (
 	// Metric name defines
-	PoolMetadata              = "flashsystem_pool_metadata"
-	PoolHealth                = "flashsystem_pool_health"
-	PoolWarningThreshold      = "flashsystem_capacity_warning_threshold"
-	PoolCapacityUsable        = "flashsystem_pool_capacity_usable_bytes"
-	PoolCapacityUsed          = "flashsystem_pool_capacity_used_bytes"
-	PoolPhysicalCapacity      = "flashsystem_pool_capacity_bytes"
-	PoolLogicalCapacityUsable = "flashsystem_pool_logical_capacity_usable_bytes"
-	PoolLogicalCapacity       = "flashsystem_pool_logical_capacity_bytes"
-	PoolLogicalCapacityUsed   = "flashsystem_pool_logical_capacity_used_bytes"
-	PoolEfficiencySavings     = "flashsystem_pool_savings_bytes"
-	// PoolEfficiencySavingsThin        = "flashsystem_pool_savings_thin_bytes"
-	// PoolEfficiencySavingsDedup       = "flashsystem_pool_savings_dedup_bytes"
-	// PoolEfficiencySavingsCompression = "flashsystem_pool_savings_compression_bytes"
+	PoolMetadata                     = "flashsystem_pool_metadata"
+	PoolHealth                       = "flashsystem_pool_health"
+	PoolWarningThreshold             = "flashsystem_capacity_warning_threshold"
+	PoolCapacityUsable               = "flashsystem_pool_capacity_usable_bytes"
+	PoolCapacityUsed                 = "flashsystem_pool_capacity_used_bytes"
+	PoolPhysicalCapacity             = "flashsystem_pool_capacity_bytes"
+	PoolLogicalCapacityUsable        = "flashsystem_pool_logical_capacity_usable_bytes"
+	PoolLogicalCapacity              = "flashsystem_pool_logical_capacity_bytes"
+	PoolLogicalCapacityUsed          = "flashsystem_pool_logical_capacity_used_bytes"
+	PoolEfficiencySavings            = "flashsystem_pool_savings_bytes"
+	PoolEfficiencySavingsThin        = "flashsystem_pool_savings_thin_bytes"
+	PoolEfficiencySavingsDedup       = "flashsystem_pool_savings_dedup_bytes"
+	PoolEfficiencySavingsCompression = "flashsystem_pool_savings_compression_bytes"
+	PoolDataReductionRatio           = "flashsystem_pool_data_reduction_ratio"
+	StorageClassInfo                 = "flashsystem_storageclass_info"
+	PoolNotFound                     = "flashsystem_pool_not_found"
 
 	// Pool state
 	StateOnline   = "online"
@@ -65,6 +71,7 @@ const (
 	MdiskIdKey                 = "id"
 	MdiskEffectiveUsedCapacity = "effective_used_capacity"
 	ParentMdiskIdKey           = "parent_mdisk_grp_id"
+	ParentMdiskNameKey         = "parent_mdisk_grp_name"
 	MdiskGroupNameKey          = "mdisk_grp_name"
 	MdiskNameKey               = "name"
 	PoolStatusKey              = "status"
@@ -96,6 +103,22 @@ var (
 		"pool_name",
 		"storageclass",
 		"is_internal_storage",
+		"parent_pool",
+	}
+
+	// Storage class label, one series per storage class
+	storageClassLabel = []string{
+		"subsystem_name",
+		"storageclass",
+		"pool_name",
+		"provisioner",
+	}
+
+	// Not found pool label, one series per storage class
+	poolNotFoundLabel = []string{
+		"subsystem_name",
+		"storageclass",
+		"pool_name",
 	}
 
 	// Other metrics label
@@ -106,19 +129,22 @@ var (
 
 	// Metric define mapping
 	poolMetricsMap = map[string]MetricLabel{
-		PoolMetadata:              {"Pool metadata", poolMetadataLabel},
-		PoolHealth:                {"Pool health status", poolLabelCommon},
-		PoolWarningThreshold:      {"Pool capacity warning threshold", poolLabelCommon},
-		PoolCapacityUsable:        {"Pool usable capacity (byte)", poolLabelCommon},
-		PoolCapacityUsed:          {"Pool used capacity (byte)", poolLabelCommon},
-		PoolPhysicalCapacity:      {"Pool total capacity (bytes)", poolLabelCommon},
-		PoolLogicalCapacity:       {"Pool total logical capacity (byte)", poolLabelCommon},
-		PoolLogicalCapacityUsable: {"Pool logical usable capacity (byte)", poolLabelCommon},
-		PoolLogicalCapacityUsed:   {"Pool logical used capacity (byte)", poolLabelCommon},
-		PoolEfficiencySavings:     {"dedupe, thin provisioning, and compression savings", poolLabelCommon},
-		// PoolEfficiencySavingsThin:        {"thin provisioning savings", poolLabelCommon},
-		// PoolEfficiencySavingsDedup:       {"dedeup savings", poolLabelCommon},
-		// PoolEfficiencySavingsCompression: {"compression savings", poolLabelCommon},
+		PoolMetadata:                     {"Pool metadata", poolMetadataLabel},
+		StorageClassInfo:                 {"Storage class to pool mapping", storageClassLabel},
+		PoolNotFound:                     {"Pool used by the storage class isn't found on the system", poolNotFoundLabel},
+		PoolHealth:                       {"Pool health status, 0 = online, 1 = degraded or an array with degraded redundancy, 2 = offline", poolLabelCommon},
+		PoolWarningThreshold:             {"Pool capacity warning threshold", poolLabelCommon},
+		PoolCapacityUsable:               {"Pool usable capacity (byte)", poolLabelCommon},
+		PoolCapacityUsed:                 {"Pool used capacity (byte)", poolLabelCommon},
+		PoolPhysicalCapacity:             {"Pool total capacity (bytes)", poolLabelCommon},
+		PoolLogicalCapacity:              {"Pool total logical capacity (byte)", poolLabelCommon},
+		PoolLogicalCapacityUsable:        {"Pool logical usable capacity (byte)", poolLabelCommon},
+		PoolLogicalCapacityUsed:          {"Pool logical used capacity (byte)", poolLabelCommon},
+		PoolEfficiencySavings:            {"dedupe, thin provisioning, and compression savings", poolLabelCommon},
+		PoolEfficiencySavingsThin:        {"thin provisioning savings", poolLabelCommon},
+		PoolEfficiencySavingsDedup:       {"dedupe savings", poolLabelCommon},
+		PoolEfficiencySavingsCompression: {"compression savings", poolLabelCommon},
+		PoolDataReductionRatio:           {"Pool data reduction ratio, written capacity to stored capacity without thin provisioning", poolLabelCommon},
 	}
 )
 
@@ -134,6 +160,11 @@ type PoolInfo struct {
 	PoolMDiskGrpInfo         Pool
 	IsCompressionEnabled     bool
 	PoolMDisksList           []rest.SingleMDiskInfo
+	Capabilities             rest.Capabilities
+	ManagedByODF             bool
+	ParentPool               *PoolInfo
+	ChildPools               []*PoolInfo
+	Arrays                   []ArrayInfo
 }
 
 func (f *PerfCollector) initPoolDescs() {
@@ -147,6 +178,10 @@ func (f *PerfCollector) initPoolDescs() {
 	}
 }
 
+func poolLogger(info PoolInfo) logr.Logger {
+	return logging.WithSystem(info.SystemName).WithValues(logging.PoolKey, info.PoolName)
+}
+
 func IsPoolFromInternalStorage(info PoolInfo) bool {
 	for _, mDiskInfo := range info.PoolMDisksList {
 		if mDiskInfo[ControllerNameKey].(string) != "" {
@@ -157,6 +192,9 @@ func IsPoolFromInternalStorage(info PoolInfo) bool {
 }
 
 func IsCompressionEnabled(info PoolInfo) bool {
+	if !info.Capabilities.Has(rest.FeatureFCMCompression) {
+		return false
+	}
 	for _, mDiskInfo := range info.PoolMDisksList {
 		if mDiskInfo[MdiskEffectiveUsedCapacity].(string) == "" {
 			return false
@@ -174,19 +212,29 @@ func IsPoolArrayMode(info PoolInfo) bool {
 	return true
 }
 
+// getPoolReclaimable returns the reclaimable_capacity of the pool, 0 before the
+// code level which introduced it.
+func getPoolReclaimable(pool PoolInfo) (float64, error) {
+	if !pool.Capabilities.Has(rest.FieldPoolReclaimableCapacity) {
+		return 0, nil
+	}
+	return strconv.ParseFloat(pool.PoolMDiskGrpInfo[ReclaimableKey].(string), 64)
+}
+
 func calcPoolReducedReclaimableCapacity(pool PoolInfo) (float64, error) {
 	var totalDisksCapacities float64
 	var midSum float64
-	reclaimable, err := strconv.ParseFloat(pool.PoolMDiskGrpInfo[ReclaimableKey].(string), 64)
+	logger := poolLogger(pool)
+	reclaimable, err := getPoolReclaimable(pool)
 	if err != nil {
-		log.Errorf("get pool reclaimable capacity failed: %s", err)
+		logger.Error(err, "get pool reclaimable capacity failed")
 		return InvalidVal, err
 	}
 
 	for _, mDisk := range pool.PoolMDisksList {
-		PC, EU, physicalFree, err := calcSingleMDiskCapacity(mDisk)
+		PC, EU, physicalFree, err := calcSingleMDiskCapacity(mDisk, pool.Capabilities)
 		if err != nil {
-			log.Errorf("get single disk capacity failed: %s", err)
+			logger.Error(err, "get single disk capacity failed", "mdisk", mDisk[MdiskIdKey])
 			return InvalidVal, err
 		}
 		PU := math.Max(0, PC-physicalFree)
@@ -195,9 +243,9 @@ func calcPoolReducedReclaimableCapacity(pool PoolInfo) (float64, error) {
 		totalDisksCapacities += PC
 		midSum += diskRatio
 
-		log.Infof("Calculating reduced reclaimable capacity for Disk ID: %d related to pool %v, "+
-			"PhysicalCapacity PC: %f, MdiskEffectiveUsedCapacity EU: %f, PU: %f, diskRatio: %f, totalDisksCapacities: %f, midSum: %f",
-			mDisk[MdiskIdKey], pool.PoolMDiskGrpInfo[MdiskNameKey].(string), PC, EU, PU, diskRatio, totalDisksCapacities, midSum)
+		logger.V(logging.DetailLevel).Info("Calculating reduced reclaimable capacity", "mdisk", mDisk[MdiskIdKey],
+			"physicalCapacity", PC, "effectiveUsedCapacity", EU, "physicalUsed", PU, "diskRatio", diskRatio,
+			"totalDisksCapacities", totalDisksCapacities, "midSum", midSum)
 	}
 
 	if totalDisksCapacities == 0 || midSum == 0 {
@@ -207,16 +255,19 @@ func calcPoolReducedReclaimableCapacity(pool PoolInfo) (float64, error) {
 	}
 }
 
-func calcSingleMDiskCapacity(mDiskInfo rest.SingleMDiskInfo) (float64, float64, float64, error) {
+func calcSingleMDiskCapacity(mDiskInfo rest.SingleMDiskInfo, caps rest.Capabilities) (float64, float64, float64, error) {
 	PC, err := strconv.ParseFloat(mDiskInfo[PhysicalCapacityKey].(string), 64)
 	if err != nil {
-		log.Errorf("get disk physical capacity failed: %s", err)
-		return InvalidVal, InvalidVal, InvalidVal, err
+		return InvalidVal, InvalidVal, InvalidVal, fmt.Errorf("get disk physical capacity failed: %w", err)
 	}
 	physicalFree, err := strconv.ParseFloat(mDiskInfo[PhysicalFreeKey].(string), 64)
 	if err != nil {
-		log.Errorf("get disk physical free capacity failed: %s", err)
-		return InvalidVal, InvalidVal, InvalidVal, err
+		return InvalidVal, InvalidVal, InvalidVal, fmt.Errorf("get disk physical free capacity failed: %w", err)
+	}
+
+	// The effective used capacity is only reported by code levels supporting FCM
+	if !caps.Has(rest.FieldMDiskEffectiveUsedCapacity) {
+		return PC, PC - physicalFree, physicalFree, nil
 	}
 
 	EU, err := strconv.ParseFloat(mDiskInfo[MdiskEffectiveUsedCapacity].(string), 64)
@@ -224,19 +275,18 @@ func calcSingleMDiskCapacity(mDiskInfo rest.SingleMDiskInfo) (float64, float64,
 		if mDiskInfo[MdiskEffectiveUsedCapacity].(string) == "" { // can happen only on drives without compression
 			EU = PC - physicalFree
 		} else {
-			log.Errorf("get disk physical effective used capacity failed: %s", err)
-			return InvalidVal, InvalidVal, InvalidVal, err
+			return InvalidVal, InvalidVal, InvalidVal, fmt.Errorf("get disk physical effective used capacity failed: %w", err)
 		}
 	}
 
 	return PC, EU, physicalFree, nil
 }
 
-func (f *PerfCollector) collectPoolMetrics(ch chan<- prometheus.Metric, fsRestClient *rest.FSRestClient, poolsInfoList []PoolInfo) bool {
+func (f *PerfCollector) collectPoolMetrics(ctx context.Context, ch chan<- prometheus.Metric, cluster *clusterResources, fsRestClient *rest.FSRestClient, poolsInfoList []PoolInfo) bool {
 	// Get pool names
 	manager := fsRestClient.DriverManager
 	poolNames := manager.GetPoolNames()
-	// log.Infof("pool count: %d, pools: %v", len(poolNames), poolNames)
+	inventoryMode := InventoryMode()
 
 	// Pool metrics
 	for _, pool := range poolsInfoList {
@@ -244,7 +294,8 @@ func (f *PerfCollector) collectPoolMetrics(ch chan<- prometheus.Metric, fsRestCl
 		pool.PoolName = pool.PoolMDiskGrpInfo[MdiskNameKey].(string)
 		if _, bHas := poolNames[pool.PoolName]; bHas {
 			poolNames[pool.PoolName] = pool.PoolId
-		} else {
+			pool.ManagedByODF = true
+		} else if !inventoryMode {
 			continue // Skip. Not used in StorageClass
 		}
 
@@ -262,14 +313,13 @@ func (f *PerfCollector) collectPoolMetrics(ch chan<- prometheus.Metric, fsRestCl
 
 		// metadata metrics
 		poolMetaMetricDesc := f.poolDescriptors[PoolMetadata]
-		log.Infof("subsystem: %s, pool id: %d, name: %s, state: %s, sc: %s, warning: %s, interalStorage: %t",
-			pool.SystemName,
-			pool.PoolId,
-			pool.PoolName,
-			pool.State,
-			pool.StorageClass,
-			pool.CapacityWarningThreshold,
-			pool.IsInternalStorage,
+		logger := poolLogger(pool)
+		logger.V(logging.ScrapeLevel).Info("Collect pool metrics",
+			"poolId", pool.PoolId,
+			"state", pool.State,
+			"storageClass", pool.StorageClass,
+			"warningThreshold", pool.CapacityWarningThreshold,
+			"internalStorage", pool.IsInternalStorage,
 		)
 
 		currentPoolInfo := pool
@@ -277,115 +327,45 @@ func (f *PerfCollector) collectPoolMetrics(ch chan<- prometheus.Metric, fsRestCl
 		f.newPoolWarningThreshold(ch, &currentPoolInfo)
 		f.newPoolHealthMetrics(ch, &currentPoolInfo)
 
-		log.Infof("pool id: %d, physical_free_capacity: %v, reclaimable_capacity: %v, data_reduction: %v, "+
-			"physical_capacity: %v, virtual_capacity: %v, real_capacity: %v, logical_capacity: %v, logical_free_capacity: %v",
-			pool.PoolId, pool.PoolMDiskGrpInfo[PhysicalFreeKey], pool.PoolMDiskGrpInfo[ReclaimableKey],
-			pool.PoolMDiskGrpInfo[DataReductionKey], pool.PoolMDiskGrpInfo[PhysicalCapacityKey],
-			pool.PoolMDiskGrpInfo[VirtualCapacityKey], pool.PoolMDiskGrpInfo[RealCapacityKey],
-			pool.PoolMDiskGrpInfo[CapacityKey], pool.PoolMDiskGrpInfo[FreeCapacityKey])
+		logger.V(logging.DetailLevel).Info("Pool capacity",
+			PhysicalFreeKey, pool.PoolMDiskGrpInfo[PhysicalFreeKey],
+			ReclaimableKey, pool.PoolMDiskGrpInfo[ReclaimableKey],
+			DataReductionKey, pool.PoolMDiskGrpInfo[DataReductionKey],
+			PhysicalCapacityKey, pool.PoolMDiskGrpInfo[PhysicalCapacityKey],
+			VirtualCapacityKey, pool.PoolMDiskGrpInfo[VirtualCapacityKey],
+			RealCapacityKey, pool.PoolMDiskGrpInfo[RealCapacityKey],
+			CapacityKey, pool.PoolMDiskGrpInfo[CapacityKey],
+			FreeCapacityKey, pool.PoolMDiskGrpInfo[FreeCapacityKey])
 
 		createPhysicalCapacityPoolMetrics(ch, f, pool)
 		createLogicalCapacityPoolMetrics(ch, f, pool)
-		createTotalSavingPoolMetrics(ch, f, pool)
-
-		// pool_efficiency_savings_thin
-		// drpSavings = Math.max(0, [lsmdiskgrp]:used_capacity_before_reduction – [lsmdiskgrp]:used_capacity_after_reduction + [lsmdiskgrp]:reclaimable_capacity – [lsmdiskgrp]:deduplication_capacity_saving)
-		// drpCompressionSavings (for DRP) = drpSavings
-		// For non-DRP, drpCompressionSavings = 0
-		// Thin Provisioning Savings = Math.max(0, [lsmdiskgrp]:virtual_capacity – realCap – drpCompressionSavings – Math.max([lsmdiskgrp]:compression_uncompressed_capacity - [lsmdiskgrp]:compression_compressed_capacity, 0))
-		// var drpCompressionSavings float64
-		// usedBefore, err := strconv.ParseFloat(pool[UsedBeforeDedupKey].(string), 64)
-		// if err != nil {
-		// 	log.Errorf("get used_capacity_before_reduction failed: %s", err)
-		// }
-		// usedAfter, err := strconv.ParseFloat(pool[UsedAfterDedupKey].(string), 64)
-		// if err != nil {
-		// 	log.Errorf("get used_capacity_before_reduction failed: %s", err)
-		// }
-		// dedupSaving, err := strconv.ParseFloat(pool[DedupSavingsKey].(string), 64)
-		// if err != nil {
-		// 	log.Errorf("get deduplication_capacity_saving failed: %s", err)
-		// }
-		// tempValue := usedBefore - usedAfter + reclaimable - dedupSaving
-		// drpSavings := math.Max(0, tempValue)
-
-		// if drpool {
-		// 	drpCompressionSavings = drpSavings
-		// } else {
-		// 	drpCompressionSavings = 0
-		// }
-
-		// uncompressed, err := strconv.ParseFloat(pool[UncompressedKey].(string), 64)
-		// if err != nil {
-		// 	log.Errorf("get compression_uncompressed_capacity failed: %s", err)
-		// }
-		// compressed, err := strconv.ParseFloat(pool[CompressedKey].(string), 64)
-		// if err != nil {
-		// 	log.Errorf("get compression_compressed_capacity failed: %s", err)
-		// }
-		// comressDiff := uncompressed - compressed
-		// tempValue = virtual - realCapacity - drpCompressionSavings - math.Max(0, comressDiff)
-		// thinSavings := math.Max(0, tempValue)
-
-		// log.Infof("pool: %d, thin saving: %f", poolInfo.PoolId, thinSavings)
-		// newPoolCapacityMetrics(ch, f.poolDescriptors[PoolEfficiencySavingsThin], thinSavings, &poolInfo)
-
-		// pool_efficiency_savings_dedup
-		// [lsmdiskgrp]:deduplication_capacity_saving
-		// dedupSavings, err := strconv.ParseFloat(pool[DedupSavingsKey].(string), 64)
-		// if err != nil {
-		// 	log.Errorf("get deduplication_capacity_saving failed: %s", err)
-		// }
-		// log.Infof("pool: %d, dedup saving: %f", poolInfo.PoolId, dedupSavings)
-		// newPoolCapacityMetrics(ch, f.poolDescriptors[PoolEfficiencySavingsDedup], dedupSavings, &poolInfo)
-
-		// pool_efficiency_savings_compression
-		// If pool is not compressed, Compression Savings = 0
-		// For new compression (drp pool),
-		// Compression Savings = Math.max(0, drpTotalWrittenCapacity – (drpTotalWrittenCapacity – drpSavings))
-		//					   = drpSavings
-		// For old compression (non-drp pool),
-		// Compression Savings = Math.max(0, ([lsmdiskgrp]:compression_uncompressed_capacity – [lsmdiskgrp]:compression_compressed_capacity)
-		// compressSavings := 0.0
-		// if "yes" == pool[CompressionActiveKey].(string) {
-		// 	if drpool {
-		// 		compressSavings = drpSavings
-		// 	} else {
-		// 		compressSavings = math.Max(0, comressDiff)
-		// 	}
-		// }
-		// log.Infof("pool: %d, compression saving: %f", poolInfo.PoolId, compressSavings)
-		// newPoolCapacityMetrics(ch, f.poolDescriptors[PoolEfficiencySavingsCompression], compressSavings, &poolInfo)
+		f.createSavingsPoolMetrics(ch, pool)
+		f.createInventoryPoolMetrics(ch, pool)
 	}
 
+	f.newStorageClassInfoMetrics(ctx, ch, cluster, manager)
+	f.validateStorageClasses(ctx, ch, cluster, manager, poolsInfoList)
+
 	// Not found pool metrics
+	missingPools := map[string][]string{}
 	for poolName, poolId := range poolNames {
 		if driver.INIT_POOL_ID == poolId {
 			scnames := manager.GetSCNameByPoolName(poolName)
-			poolInfo := PoolInfo{
-				SystemName:               fsRestClient.DriverManager.GetSubsystemName(),
-				PoolId:                   poolId,
-				PoolName:                 poolName,
-				State:                    "NotFound",
-				CapacityWarningThreshold: "100",
-				StorageClass:             strings.Join(scnames, ","),
-				IsInternalStorage:        true,
+			manager.Logger().V(logging.ScrapeLevel).Info("Pool used in StorageClass isn't found",
+				logging.PoolKey, poolName, "storageClasses", scnames)
+			for _, sc := range scnames {
+				ch <- prometheus.MustNewConstMetric(f.poolDescriptors[PoolNotFound], prometheus.GaugeValue, 1,
+					manager.GetSubsystemName(), sc, poolName)
 			}
-
-			log.Infof("subsystem: %s, pool id: %d, name: %s, state: %s, sc: %s, warning: %s, internalStorage: %t",
-				poolInfo.SystemName,
-				poolInfo.PoolId,
-				poolInfo.PoolName,
-				poolInfo.State,
-				poolInfo.StorageClass,
-				poolInfo.CapacityWarningThreshold,
-				poolInfo.IsInternalStorage,
-			)
-			// poolMetaMetricDesc := f.poolDescriptors[PoolMetadata]
-			// newPoolMetadataMetrics(ch, poolMetaMetricDesc, 0, &poolInfo)
+			missingPools[poolName] = scnames
 		}
 	}
 
+	// The condition is cleared once all pools are found again
+	if err := clientmanagers.UpdatePoolCondition(ctx, manager, missingPools); err != nil {
+		manager.Logger().Error(err, "update pool condition failed")
+	}
+
 	return true
 }
 
@@ -393,26 +373,119 @@ func isParentPool(pool Pool) bool {
 	return pool[MdiskIdKey] == pool[ParentMdiskIdKey]
 }
 
+// linkChildPools connects the child pools of the system with their parent pool.
+func linkChildPools(poolsInfoList []PoolInfo) {
+	parents := map[interface{}]*PoolInfo{}
+	for i := range poolsInfoList {
+		if isParentPool(poolsInfoList[i].PoolMDiskGrpInfo) {
+			parents[poolsInfoList[i].PoolMDiskGrpInfo[MdiskIdKey]] = &poolsInfoList[i]
+		}
+	}
+	for i := range poolsInfoList {
+		child := &poolsInfoList[i]
+		if isParentPool(child.PoolMDiskGrpInfo) {
+			continue
+		}
+		if parent, ok := parents[child.PoolMDiskGrpInfo[ParentMdiskIdKey]]; ok {
+			child.ParentPool = parent
+			parent.ChildPools = append(parent.ChildPools, child)
+		}
+	}
+}
+
+// parentPoolName is empty for parent pools.
+func parentPoolName(pool PoolInfo) string {
+	if pool.PoolMDiskGrpInfo == nil || isParentPool(pool.PoolMDiskGrpInfo) {
+		return ""
+	}
+	name, _ := pool.PoolMDiskGrpInfo[ParentMdiskNameKey].(string)
+	return name
+}
+
+// getChildPoolsFreeCapacity returns the free capacity reserved for the child
+// pools, which the parent free_capacity doesn't include.
+func getChildPoolsFreeCapacity(pool PoolInfo) (float64, error) {
+	var childFree float64
+	for _, child := range pool.ChildPools {
+		free, err := strconv.ParseFloat(child.PoolMDiskGrpInfo[FreeCapacityKey].(string), 64)
+		if err != nil {
+			return InvalidVal, fmt.Errorf("get free capacity of child pool %s failed: %w", child.PoolName, err)
+		}
+		childFree += free
+	}
+	return childFree, nil
+}
+
+// calcChildPoolCapacity gives the child pool its share of the parent physical
+// capacity, in the ratio of the child capacity to the parent capacity. The
+// usable capacity is limited by what is still usable in the parent.
+func calcChildPoolCapacity(child PoolInfo) (float64, float64, float64, error) {
+	parent := child.ParentPool
+	if parent == nil {
+		return InvalidVal, InvalidVal, InvalidVal, fmt.Errorf("parent pool %s isn't found", parentPoolName(child))
+	}
+
+	values := map[string]float64{}
+	for _, key := range []string{CapacityKey, PhysicalCapacityKey, PhysicalFreeKey} {
+		value, err := strconv.ParseFloat(poolString(*parent, key), 64)
+		if err != nil {
+			return InvalidVal, InvalidVal, InvalidVal, fmt.Errorf("get parent pool %s failed: %w", key, err)
+		}
+		values[key] = value
+	}
+	parentReclaimable, err := getPoolReclaimable(*parent)
+	if err != nil {
+		return InvalidVal, InvalidVal, InvalidVal, fmt.Errorf("get parent pool reclaimable failed: %w", err)
+	}
+
+	capacity, err := strconv.ParseFloat(poolString(child, CapacityKey), 64)
+	if err != nil {
+		return InvalidVal, InvalidVal, InvalidVal, fmt.Errorf("get capacity failed: %w", err)
+	}
+	free, err := strconv.ParseFloat(poolString(child, FreeCapacityKey), 64)
+	if err != nil {
+		return InvalidVal, InvalidVal, InvalidVal, fmt.Errorf("get free capacity failed: %w", err)
+	}
+
+	ratio := 1.0
+	if values[CapacityKey] > 0 {
+		ratio = values[PhysicalCapacityKey] / values[CapacityKey]
+	}
+	total := capacity * ratio
+	used := math.Max(0, capacity-free) * ratio
+	usable := math.Min(math.Max(0, total-used), values[PhysicalFreeKey]+parentReclaimable)
+	return usable, used, total, nil
+}
+
 func createLogicalCapacityPoolMetrics(ch chan<- prometheus.Metric, f *PerfCollector, poolInfo PoolInfo) {
+	logger := poolLogger(poolInfo)
 	totalLogicalCapacity, err := strconv.ParseFloat(poolInfo.PoolMDiskGrpInfo[CapacityKey].(string), 64)
 	if err != nil {
-		log.Errorf("get logical capacity failed: %s", err)
+		logger.Error(err, "get logical capacity failed")
 		return
 	}
 	logicalFreeCapacity, err := strconv.ParseFloat(poolInfo.PoolMDiskGrpInfo[FreeCapacityKey].(string), 64)
 	if err != nil {
-		log.Errorf("get logical free capacity failed: %s", err)
+		logger.Error(err, "get logical free capacity failed")
 		return
 	}
 
-	reclaimable, err := strconv.ParseFloat(poolInfo.PoolMDiskGrpInfo[ReclaimableKey].(string), 64)
+	reclaimable, err := getPoolReclaimable(poolInfo)
 	if err != nil {
-		log.Errorf("get reclaimable failed: %s", err)
+		logger.Error(err, "get reclaimable failed")
+		return
+	}
+
+	// The parent free capacity excludes the whole child pool capacity, only
+	// the used part of the child pools counts as used
+	childFree, err := getChildPoolsFreeCapacity(poolInfo)
+	if err != nil {
+		logger.Error(err, "get child pools free capacity failed")
 		return
 	}
 
 	logicalUsableCapacity := logicalFreeCapacity + reclaimable
-	logicalUsedCapacity := totalLogicalCapacity - logicalUsableCapacity
+	logicalUsedCapacity := totalLogicalCapacity - logicalUsableCapacity - childFree
 
 	newPoolCapacityMetrics(ch, f.poolDescriptors[PoolLogicalCapacityUsable], logicalUsableCapacity, &poolInfo)
 	newPoolCapacityMetrics(ch, f.poolDescriptors[PoolLogicalCapacityUsed], logicalUsedCapacity, &poolInfo)
@@ -420,27 +493,32 @@ func createLogicalCapacityPoolMetrics(ch chan<- prometheus.Metric, f *PerfCollec
 }
 
 func createPhysicalCapacityPoolMetrics(ch chan<- prometheus.Metric, f *PerfCollector, poolInfo PoolInfo) {
+	if !isMetricSupported(poolInfo.Capabilities, PoolPhysicalCapacity) {
+		poolLogger(poolInfo).V(logging.DetailLevel).Info("Skip pool physical capacity, not supported by the code level")
+		return
+	}
 	if isParentPool(poolInfo.PoolMDiskGrpInfo) {
 		var reclaimableCalculatedCapacity float64
+		logger := poolLogger(poolInfo)
 		physicalFree, err := strconv.ParseFloat(poolInfo.PoolMDiskGrpInfo[PhysicalFreeKey].(string), 64)
 		if err != nil {
-			log.Errorf("get physical free failed: %s", err)
+			logger.Error(err, "get physical free failed")
 			return
 		}
 		physical, err := strconv.ParseFloat(poolInfo.PoolMDiskGrpInfo[PhysicalCapacityKey].(string), 64)
 		if err != nil {
-			log.Errorf("get physical capacity failed: %s", err)
+			logger.Error(err, "get physical capacity failed")
 			return
 		}
-		poolOrigReclaimable, err := strconv.ParseFloat(poolInfo.PoolMDiskGrpInfo[ReclaimableKey].(string), 64)
+		poolOrigReclaimable, err := getPoolReclaimable(poolInfo)
 		if err != nil {
-			log.Errorf("get reclaimable failed: %s", err)
+			logger.Error(err, "get reclaimable failed")
 			return
 		}
 		if poolOrigReclaimable != 0 {
 			reclaimableCalculatedCapacity, err = GetPoolReclaimablePhysicalCapacity(poolInfo)
 			if err != nil {
-				log.Errorf("get reduced reclaimable capacity failed: %s", err)
+				logger.Error(err, "get reduced reclaimable capacity failed")
 				return
 			}
 		} else {
@@ -454,27 +532,32 @@ func createPhysicalCapacityPoolMetrics(ch chan<- prometheus.Metric, f *PerfColle
 		newPoolCapacityMetrics(ch, f.poolDescriptors[PoolCapacityUsed], used, &poolInfo)
 		newPoolCapacityMetrics(ch, f.poolDescriptors[PoolPhysicalCapacity], physical, &poolInfo)
 	} else {
-		newPoolCapacityMetrics(ch, f.poolDescriptors[PoolCapacityUsable], InvalidVal, &poolInfo)
-		newPoolCapacityMetrics(ch, f.poolDescriptors[PoolCapacityUsed], InvalidVal, &poolInfo)
-		newPoolCapacityMetrics(ch, f.poolDescriptors[PoolPhysicalCapacity], InvalidVal, &poolInfo)
+		usable, used, physical, err := calcChildPoolCapacity(poolInfo)
+		if err != nil {
+			poolLogger(poolInfo).Error(err, "get child pool capacity failed")
+			return
+		}
+		newPoolCapacityMetrics(ch, f.poolDescriptors[PoolCapacityUsable], usable, &poolInfo)
+		newPoolCapacityMetrics(ch, f.poolDescriptors[PoolCapacityUsed], used, &poolInfo)
+		newPoolCapacityMetrics(ch, f.poolDescriptors[PoolPhysicalCapacity], physical, &poolInfo)
 	}
 }
 
 func GetPoolReclaimablePhysicalCapacity(pool PoolInfo) (float64, error) {
 	var reclaimable float64
 	var err error
-	isDataReduction := pool.PoolMDiskGrpInfo[DataReductionKey].(string) == "yes"
+	isDataReduction := pool.Capabilities.Has(rest.FeatureDataReductionPool) && pool.PoolMDiskGrpInfo[DataReductionKey].(string) == "yes"
 
 	if pool.IsCompressionEnabled && isDataReduction && pool.IsInternalStorage && pool.IsArrayMode {
 		reclaimable, err = calcPoolReducedReclaimableCapacity(pool)
 		if err != nil {
-			log.Errorf("get reduced reclaimable capacity for pool failed")
+			poolLogger(pool).Error(err, "get reduced reclaimable capacity for pool failed")
 			return InvalidVal, err
 		}
 	} else {
-		poolOrigReclaimable, err := strconv.ParseFloat(pool.PoolMDiskGrpInfo[ReclaimableKey].(string), 64)
+		poolOrigReclaimable, err := getPoolReclaimable(pool)
 		if err != nil {
-			log.Errorf("get reclaimable failed: %s", err)
+			poolLogger(pool).Error(err, "get reclaimable failed")
 			return InvalidVal, err
 		}
 		reclaimable = poolOrigReclaimable
@@ -482,43 +565,6 @@ func GetPoolReclaimablePhysicalCapacity(pool PoolInfo) (float64, error) {
 	return reclaimable, nil
 }
 
-func createTotalSavingPoolMetrics(ch chan<- prometheus.Metric, f *PerfCollector, poolInfo PoolInfo) {
-	// TODO:ticket #42 - expose total saving per system
-
-	drpool := poolInfo.PoolMDiskGrpInfo[DataReductionKey].(string) == "yes"
-
-	physicalFree := float64(0)
-	physical := float64(0)
-
-	// pool_efficiency_savings
-	// virtualCap = [lsmdiskgrp]:virtual_capacity
-	// realCap = [lsmdiskgrp]:physical_capacity – [lsmdiskgrp]:physical_free_capacity … for DRP
-	//         = [lsmdiskgrp]:real_capacity … for non-DRP
-	// Total Savings = Math.max(0, virtualCap – realCap)
-
-	var totalSaving float64
-	var realCapacity float64
-
-	virtual, err := strconv.ParseFloat(poolInfo.PoolMDiskGrpInfo[VirtualCapacityKey].(string), 64)
-	if err != nil {
-		log.Errorf("get virtual capacity failed: %s", err)
-	}
-
-	realCap, err := strconv.ParseFloat(poolInfo.PoolMDiskGrpInfo[RealCapacityKey].(string), 64)
-	if err != nil {
-		log.Errorf("get real capacity failed: %s", err)
-	}
-
-	if drpool {
-		realCapacity = physical - physicalFree
-	} else {
-		realCapacity = realCap
-	}
-
-	totalSaving = math.Max(0, virtual-realCapacity)
-	newPoolCapacityMetrics(ch, f.poolDescriptors[PoolEfficiencySavings], totalSaving, &poolInfo)
-}
-
 func newPoolCapacityMetrics(ch chan<- prometheus.Metric, desc *prometheus.Desc, value float64, info *PoolInfo) {
 	ch <- prometheus.MustNewConstMetric(
 		desc,
@@ -544,9 +590,35 @@ func newPoolMetadataMetrics(ch chan<- prometheus.Metric, desc *prometheus.Desc,
 		info.PoolName,
 		info.StorageClass,
 		fmt.Sprintf("%d", internalStorage),
+		parentPoolName(*info),
 	)
 }
 
+// newStorageClassInfoMetrics exports each storage class to pool mapping, the
+// storage class label can be joined with the kube-state-metrics series. The
+// provisioner is the one of the StorageClass, the CSI driver if it can't be read.
+func (f *PerfCollector) newStorageClassInfoMetrics(ctx context.Context, ch chan<- prometheus.Metric, cluster *clusterResources, manager *driver.DriverManager) {
+	for sc, pool := range manager.GetSCPoolMap() {
+		provisioner := driver.CSIProvisioner
+		storageClass, err := cluster.storageClass(ctx, manager, sc)
+		if err != nil {
+			manager.Logger().Error(err, "get storage class failed, use the default provisioner", "storageClass", sc)
+		} else {
+			provisioner = storageClass.Provisioner
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			f.poolDescriptors[StorageClassInfo],
+			prometheus.GaugeValue,
+			1,
+			manager.GetSubsystemName(),
+			sc,
+			pool,
+			provisioner,
+		)
+	}
+}
+
 func (f *PerfCollector) newPoolWarningThreshold(ch chan<- prometheus.Metric, info *PoolInfo) {
 	desc := f.poolDescriptors[PoolWarningThreshold]
 	val, err := strconv.Atoi(info.CapacityWarningThreshold)
@@ -575,7 +647,11 @@ func (f *PerfCollector) newPoolHealthMetrics(ch chan<- prometheus.Metric, info *
 		val = 2.0
 	}
 	if "online" != info.State {
-		log.Infof("pool: %d state: %s", info.PoolId, info.State)
+		poolLogger(*info).V(logging.ScrapeLevel).Info("pool isn't online", "poolId", info.PoolId, "state", info.State)
+	} else if poolRedundancyDegraded(info) {
+		// The pool still serves IO, but another drive failure may take it offline
+		val = 1.0
+		poolLogger(*info).V(logging.ScrapeLevel).Info("pool has degraded redundancy", "poolId", info.PoolId)
 	}
 	ch <- prometheus.MustNewConstMetric(
 		desc,
@@ -0,0 +1,231 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collectors
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/driver"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/iostats"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/logging"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/rest"
+)
+
+const (
+	// Metric name shown outside
+	PoolReadIOPS     = "flashsystem_pool_rd_iops"
+	PoolWriteIOPS    = "flashsystem_pool_wr_iops"
+	PoolReadBytes    = "flashsystem_pool_rd_bytes"
+	PoolWriteBytes   = "flashsystem_pool_wr_bytes"
+	PoolReadLatency  = "flashsystem_pool_rd_latency_seconds"
+	PoolWriteLatency = "flashsystem_pool_wr_latency_seconds"
+
+	// Pool of the volumes with copies in several pools
+	ManyPoolsName = "many"
+
+	// Interested keys of lsvdiskcopy
+	CopyPrimaryKey = "primary"
+	CopyPrimaryYes = "yes"
+)
+
+var (
+	poolPerfMetricsMap = map[string]MetricLabel{
+		PoolReadIOPS:     {"pool performance - read IOPS", poolLabelCommon},
+		PoolWriteIOPS:    {"pool performance - write IOPS", poolLabelCommon},
+		PoolReadBytes:    {"pool performance - read throughput bytes/s", poolLabelCommon},
+		PoolWriteBytes:   {"pool performance - write throughput bytes/s", poolLabelCommon},
+		PoolReadLatency:  {"pool performance - read latency seconds", poolLabelCommon},
+		PoolWriteLatency: {"pool performance - write latency seconds", poolLabelCommon},
+	}
+)
+
+// PoolPerf sums the performance of the volumes of a pool, the latencies are
+// weighted by the IOPS of the volumes.
+type PoolPerf struct {
+	ReadIOPS     float64
+	WriteIOPS    float64
+	ReadBytes    float64
+	WriteBytes   float64
+	readLatency  float64
+	writeLatency float64
+}
+
+func (p *PoolPerf) addReads(volume *iostats.IOPerf) {
+	p.ReadIOPS += volume.ReadIOPS
+	p.ReadBytes += volume.ReadBytes
+	p.readLatency += volume.ReadLatency * volume.ReadIOPS
+}
+
+func (p *PoolPerf) addWrites(volume *iostats.IOPerf) {
+	p.WriteIOPS += volume.WriteIOPS
+	p.WriteBytes += volume.WriteBytes
+	p.writeLatency += volume.WriteLatency * volume.WriteIOPS
+}
+
+func (p PoolPerf) ReadLatency() float64 {
+	if p.ReadIOPS == 0 {
+		return 0
+	}
+	return p.readLatency / p.ReadIOPS
+}
+
+func (p PoolPerf) WriteLatency() float64 {
+	if p.WriteIOPS == 0 {
+		return 0
+	}
+	return p.writeLatency / p.WriteIOPS
+}
+
+func (f *PerfCollector) initPoolPerfDescs() {
+	for metricName, metricLabel := range poolPerfMetricsMap {
+		f.poolDescriptors[metricName] = prometheus.NewDesc(
+			metricName,
+			metricLabel.Name, metricLabel.Labels, nil,
+		)
+	}
+}
+
+// exportedPools returns the pools used by the storage classes, all pools in inventory mode.
+func exportedPools(manager *driver.DriverManager, poolsInfoList []PoolInfo) []PoolInfo {
+	if InventoryMode() {
+		return poolsInfoList
+	}
+	poolNames := manager.GetPoolNames()
+	var pools []PoolInfo
+	for _, pool := range poolsInfoList {
+		if _, ok := poolNames[pool.PoolName]; ok {
+			pools = append(pools, pool)
+		}
+	}
+	return pools
+}
+
+// volumePools returns the pools the performance of a volume counts for, its
+// pool and the parent pool of a child pool. The volumes with copies in several
+// pools count for none, see volumeIOPools.
+func volumePools(volume map[string]string) []string {
+	poolName := volume[MdiskGroupNameKey]
+	if poolName == "" || poolName == ManyPoolsName {
+		return nil
+	}
+	if parent := volume[ParentMdiskNameKey]; parent != "" && parent != poolName {
+		return []string{poolName, parent}
+	}
+	return []string{poolName}
+}
+
+// copyPools maps the volumes with copies in several pools to their copies.
+type copyPools map[string][]map[string]string
+
+// getCopyPools returns the copies of the volumes in several pools, nil if
+// there are none or lsvdiskcopy can't be run.
+func getCopyPools(ctx context.Context, fsRestClient *rest.FSRestClient, volumes rest.Volumes, skipped skippedMetrics) copyPools {
+	many := false
+	for _, volume := range volumes {
+		if volume[MdiskGroupNameKey] == ManyPoolsName {
+			many = true
+			break
+		}
+	}
+	if !many || !fsRestClient.Capabilities().Has(rest.CommandLsvdiskcopy) {
+		return nil
+	}
+
+	copies, err := fsRestClient.Lsvdiskcopy(ctx)
+	if err != nil {
+		if !skipped.permissionDenied(err) {
+			logging.WithSystem(fsRestClient.DriverManager.GetSubsystemName()).Error(err, "get volume copies failed")
+		}
+		return nil
+	}
+	pools := copyPools{}
+	for _, volumeCopy := range copies {
+		pools[volumeCopy[CopyVolumeIdKey]] = append(pools[volumeCopy[CopyVolumeIdKey]], volumeCopy)
+	}
+	return pools
+}
+
+// volumeIOPools returns the pools the reads and the writes of a volume count
+// for. A volume with copies in several pools writes to the pools of all its
+// copies, and reads from the pools of its primary copy.
+func volumeIOPools(volume map[string]string, copies copyPools) (readPools []string, writePools []string) {
+	if volume[MdiskGroupNameKey] != ManyPoolsName {
+		pools := volumePools(volume)
+		return pools, pools
+	}
+	for _, volumeCopy := range copies[volume[VolumeIdKey]] {
+		pools := volumePools(volumeCopy)
+		writePools = append(writePools, pools...)
+		if volumeCopy[CopyPrimaryKey] == CopyPrimaryYes {
+			readPools = append(readPools, pools...)
+		}
+	}
+	return readPools, writePools
+}
+
+// getPoolsPerf sums the performance of the volumes per pool.
+func getPoolsPerf(volumes rest.Volumes, volumesPerf map[string]*iostats.IOPerf, copies copyPools) map[string]*PoolPerf {
+	pools := map[string]*PoolPerf{}
+	pool := func(poolName string) *PoolPerf {
+		perf, ok := pools[poolName]
+		if !ok {
+			perf = &PoolPerf{}
+			pools[poolName] = perf
+		}
+		return perf
+	}
+	for _, volume := range volumes {
+		perf, ok := volumesPerf[volume[VolumeIdKey]]
+		if !ok {
+			continue
+		}
+		readPools, writePools := volumeIOPools(volume, copies)
+		for _, poolName := range readPools {
+			pool(poolName).addReads(perf)
+		}
+		for _, poolName := range writePools {
+			pool(poolName).addWrites(perf)
+		}
+	}
+	return pools
+}
+
+// createPoolPerfMetrics reports the performance of the pools of poolsInfoList,
+// which only has the exported pools.
+func (f *PerfCollector) createPoolPerfMetrics(ch chan<- prometheus.Metric, systemName string, volumes rest.Volumes,
+	volumesPerf map[string]*iostats.IOPerf, copies copyPools, poolsInfoList []PoolInfo) {
+	// No rates before the second statistics files
+	if len(volumesPerf) == 0 {
+		return
+	}
+	poolsPerf := getPoolsPerf(volumes, volumesPerf, copies)
+	for _, pool := range poolsInfoList {
+		poolInfo := PoolInfo{SystemName: systemName, PoolName: pool.PoolName}
+		perf, ok := poolsPerf[pool.PoolName]
+		if !ok {
+			perf = &PoolPerf{}
+		}
+		newPoolCapacityMetrics(ch, f.poolDescriptors[PoolReadIOPS], perf.ReadIOPS, &poolInfo)
+		newPoolCapacityMetrics(ch, f.poolDescriptors[PoolWriteIOPS], perf.WriteIOPS, &poolInfo)
+		newPoolCapacityMetrics(ch, f.poolDescriptors[PoolReadBytes], perf.ReadBytes, &poolInfo)
+		newPoolCapacityMetrics(ch, f.poolDescriptors[PoolWriteBytes], perf.WriteBytes, &poolInfo)
+		newPoolCapacityMetrics(ch, f.poolDescriptors[PoolReadLatency], perf.ReadLatency(), &poolInfo)
+		newPoolCapacityMetrics(ch, f.poolDescriptors[PoolWriteLatency], perf.WriteLatency(), &poolInfo)
+	}
+}
@@ -0,0 +1,94 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collectors
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/logging"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/rest"
+)
+
+// systemReports keeps the latest report of each system, computed by the
+// collection and read by the http server.
+type systemReports[T any] struct {
+	lock    sync.Mutex
+	reports map[string]T
+}
+
+// set keeps the report of a system, nil removes it.
+func (r *systemReports[T]) set(systemName string, report *T) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if report == nil {
+		delete(r.reports, systemName)
+		return
+	}
+	if r.reports == nil {
+		r.reports = map[string]T{}
+	}
+	r.reports[systemName] = *report
+}
+
+func (r *systemReports[T]) get(systemName string) (T, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	report, ok := r.reports[systemName]
+	return report, ok
+}
+
+// prune drops the reports of the systems which are gone.
+func (r *systemReports[T]) prune(systems map[string]*rest.FSRestClient) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for systemName := range r.reports {
+		if _, ok := systems[systemName]; !ok {
+			delete(r.reports, systemName)
+		}
+	}
+}
+
+// list returns the reports sorted by the system name, never nil.
+func (r *systemReports[T]) list() []T {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var names []string
+	for systemName := range r.reports {
+		names = append(names, systemName)
+	}
+	sort.Strings(names)
+
+	reports := []T{}
+	for _, systemName := range names {
+		reports = append(reports, r.reports[systemName])
+	}
+	return reports
+}
+
+func serveJSON(w http.ResponseWriter, report interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		logging.Error(err, "write report failed")
+	}
+}
@@ -0,0 +1,220 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collectors
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/logging"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/rest"
+)
+
+const (
+	// Metric name shown outside
+	SystemEfficiencySavings            = "flashsystem_subsystem_savings_bytes"
+	SystemEfficiencySavingsThin        = "flashsystem_subsystem_savings_thin_bytes"
+	SystemEfficiencySavingsDedup       = "flashsystem_subsystem_savings_dedup_bytes"
+	SystemEfficiencySavingsCompression = "flashsystem_subsystem_savings_compression_bytes"
+	SystemDataReductionRatio           = "flashsystem_subsystem_data_reduction_ratio"
+)
+
+var (
+	systemSavingsMetricsMap = map[string]MetricLabel{
+		SystemEfficiencySavings:            {"System dedupe, thin provisioning, and compression savings of all pools", subsystemCommonLabel},
+		SystemEfficiencySavingsThin:        {"System thin provisioning savings of all pools", subsystemCommonLabel},
+		SystemEfficiencySavingsDedup:       {"System dedupe savings of all pools", subsystemCommonLabel},
+		SystemEfficiencySavingsCompression: {"System compression savings of all pools", subsystemCommonLabel},
+		SystemDataReductionRatio:           {"System data reduction ratio, written capacity to stored capacity without thin provisioning", subsystemCommonLabel},
+	}
+)
+
+// PoolSavings is the capacity saved by thin provisioning, deduplication and
+// compression of a pool. Stored is the capacity really allocated for the volumes.
+type PoolSavings struct {
+	Total       float64
+	Thin        float64
+	Dedup       float64
+	Compression float64
+	Stored      float64
+}
+
+func (s *PoolSavings) add(other PoolSavings) {
+	s.Total += other.Total
+	s.Thin += other.Thin
+	s.Dedup += other.Dedup
+	s.Compression += other.Compression
+	s.Stored += other.Stored
+}
+
+// DataReductionRatio is the written capacity, stored plus the dedupe and
+// compression savings, to the stored capacity. It is 1 without stored data.
+func (s PoolSavings) DataReductionRatio() float64 {
+	if s.Stored <= 0 {
+		return 1
+	}
+	return (s.Stored + s.Dedup + s.Compression) / s.Stored
+}
+
+func (f *PerfCollector) initSavingsDescs() {
+	for metricName, metricLabel := range systemSavingsMetricsMap {
+		f.sysCapacityDescriptors[metricName] = prometheus.NewDesc(
+			metricName,
+			metricLabel.Name, metricLabel.Labels, nil,
+		)
+	}
+}
+
+// getPoolCapacity parses a capacity field of lsmdiskgrp. Fields which the code
+// level doesn't report are taken as 0.
+func getPoolCapacity(pool PoolInfo, key string) (float64, error) {
+	value, ok := pool.PoolMDiskGrpInfo[key].(string)
+	if !ok || value == "" {
+		return 0, nil
+	}
+	capacity, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return InvalidVal, fmt.Errorf("get %s failed: %w", key, err)
+	}
+	return capacity, nil
+}
+
+func isDataReductionPool(pool PoolInfo) bool {
+	return pool.Capabilities.Has(rest.FeatureDataReductionPool) && pool.PoolMDiskGrpInfo[DataReductionKey] == "yes"
+}
+
+// calcPoolSavings splits the savings of the pool:
+//
+//	realCap = physical_capacity - physical_free_capacity ... for DRP
+//	        = real_capacity ... for non-DRP
+//	drpCompression = max(0, used_capacity_before_reduction - used_capacity_after_reduction
+//	                 + reclaimable_capacity - deduplication_capacity_saving) ... for DRP
+//	legacyCompression = max(0, compression_uncompressed_capacity - compression_compressed_capacity)
+//	Total = max(0, virtual_capacity - realCap)
+//	Dedup = deduplication_capacity_saving
+//	Compression = drpCompression for DRP, legacyCompression otherwise, 0 when compression isn't active
+//	Thin = max(0, Total - Dedup - drpCompression - legacyCompression)
+func calcPoolSavings(pool PoolInfo) (PoolSavings, error) {
+	var savings PoolSavings
+	keys := []string{VirtualCapacityKey, RealCapacityKey, UncompressedKey, CompressedKey}
+	values := map[string]float64{}
+	for _, key := range keys {
+		value, err := getPoolCapacity(pool, key)
+		if err != nil {
+			return savings, err
+		}
+		values[key] = value
+	}
+
+	dedup := 0.0
+	if pool.Capabilities.Has(rest.FieldPoolDedupSaving) {
+		value, err := getPoolCapacity(pool, DedupSavingsKey)
+		if err != nil {
+			return savings, err
+		}
+		dedup = value
+	}
+
+	realCapacity := values[RealCapacityKey]
+	drpCompression := 0.0
+	drpool := isDataReductionPool(pool)
+	if drpool {
+		if pool.Capabilities.Has(rest.FieldPoolPhysicalCapacity) {
+			physical, err := getPoolCapacity(pool, PhysicalCapacityKey)
+			if err != nil {
+				return savings, err
+			}
+			physicalFree, err := getPoolCapacity(pool, PhysicalFreeKey)
+			if err != nil {
+				return savings, err
+			}
+			realCapacity = math.Max(0, physical-physicalFree)
+		}
+
+		if pool.Capabilities.Has(rest.FieldPoolUsedBeforeReduction) {
+			usedBefore, err := getPoolCapacity(pool, UsedBeforeDedupKey)
+			if err != nil {
+				return savings, err
+			}
+			usedAfter, err := getPoolCapacity(pool, UsedAfterDedupKey)
+			if err != nil {
+				return savings, err
+			}
+			reclaimable, err := getPoolReclaimable(pool)
+			if err != nil {
+				return savings, err
+			}
+			drpCompression = math.Max(0, usedBefore-usedAfter+reclaimable-dedup)
+		}
+	}
+	legacyCompression := math.Max(0, values[UncompressedKey]-values[CompressedKey])
+
+	savings.Stored = realCapacity
+	savings.Total = math.Max(0, values[VirtualCapacityKey]-realCapacity)
+	savings.Dedup = dedup
+	if pool.PoolMDiskGrpInfo[CompressionEnabledKey] == "yes" || drpool {
+		if drpool {
+			savings.Compression = drpCompression
+		} else {
+			savings.Compression = legacyCompression
+		}
+	}
+	savings.Thin = math.Max(0, savings.Total-dedup-drpCompression-legacyCompression)
+	return savings, nil
+}
+
+func (f *PerfCollector) createSavingsPoolMetrics(ch chan<- prometheus.Metric, poolInfo PoolInfo) {
+	savings, err := calcPoolSavings(poolInfo)
+	if err != nil {
+		poolLogger(poolInfo).Error(err, "get pool savings failed")
+		return
+	}
+	poolLogger(poolInfo).V(logging.DetailLevel).Info("Pool savings", "total", savings.Total, "thin", savings.Thin,
+		"dedup", savings.Dedup, "compression", savings.Compression, "stored", savings.Stored)
+
+	newPoolCapacityMetrics(ch, f.poolDescriptors[PoolEfficiencySavings], savings.Total, &poolInfo)
+	newPoolCapacityMetrics(ch, f.poolDescriptors[PoolEfficiencySavingsThin], savings.Thin, &poolInfo)
+	newPoolCapacityMetrics(ch, f.poolDescriptors[PoolEfficiencySavingsDedup], savings.Dedup, &poolInfo)
+	newPoolCapacityMetrics(ch, f.poolDescriptors[PoolEfficiencySavingsCompression], savings.Compression, &poolInfo)
+	newPoolCapacityMetrics(ch, f.poolDescriptors[PoolDataReductionRatio], savings.DataReductionRatio(), &poolInfo)
+}
+
+// createSystemSavingsMetrics rolls up the savings of the parent pools, the
+// capacity of child pools is part of their parent pool.
+func (f *PerfCollector) createSystemSavingsMetrics(ch chan<- prometheus.Metric, systemName SystemName, poolsInfoList []PoolInfo) {
+	var total PoolSavings
+	for _, pool := range poolsInfoList {
+		if !isParentPool(pool.PoolMDiskGrpInfo) {
+			continue
+		}
+		savings, err := calcPoolSavings(pool)
+		if err != nil {
+			poolLogger(pool).Error(err, "get pool savings failed, skip the system savings")
+			return
+		}
+		total.add(savings)
+	}
+
+	newSystemCapacityMetrics(ch, f.sysCapacityDescriptors[SystemEfficiencySavings], total.Total, &systemName)
+	newSystemCapacityMetrics(ch, f.sysCapacityDescriptors[SystemEfficiencySavingsThin], total.Thin, &systemName)
+	newSystemCapacityMetrics(ch, f.sysCapacityDescriptors[SystemEfficiencySavingsDedup], total.Dedup, &systemName)
+	newSystemCapacityMetrics(ch, f.sysCapacityDescriptors[SystemEfficiencySavingsCompression], total.Compression, &systemName)
+	newSystemCapacityMetrics(ch, f.sysCapacityDescriptors[SystemDataReductionRatio], total.DataReductionRatio(), &systemName)
+}
@@ -0,0 +1,192 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collectors
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/rest"
+)
+
+const (
+	// Metric name shown outside
+	MetricsSkipped = "flashsystem_metrics_skipped"
+
+	// Why a metric family is skipped
+	SkipReasonPermissionDenied = "permission_denied"
+	SkipReasonNotSupported     = "not_supported"
+)
+
+var (
+	metricsSkippedLabel = []string{"subsystem_name", "metric", "operation", "reason", "requirement"}
+
+	skippedMetricsMap = map[string]MetricLabel{
+		MetricsSkipped: {"Metric family skipped for the system, requirement is the command or capability it needs, operation is set when only the series of the operation are skipped", metricsSkippedLabel},
+	}
+
+	systemPhysicalCapacityMetrics = []string{SystemPhysicalTotalCapacity, SystemPhysicalFreeCapacity, SystemPhysicalUsedCapacity}
+
+	// Metric families which can't be collected without the command
+	commandMetrics = map[string][]string{
+		"lssystemstats":                   append(statsMetricNames(SystemMetricPrefix), SystemStat),
+		"lsnode":                          append(metricNames(nodeStatusMetricsMap), SystemHealth),
+		"lsmdiskgrp":                      poolCommandMetrics(),
+		"lsmdisk":                         poolCommandMetrics(),
+		rest.CommandLsnodestats:           statsMetricNames(NodeMetricPrefix),
+		rest.CommandLsnodecanisterstats:   statsMetricNames(NodeMetricPrefix),
+		rest.CommandLsquorum:              {QuorumStatus},
+		rest.CommandLsrcrelationship:      {HyperSwapRelationshipState},
+		rest.CommandLsvdisk:               volumeCommandMetrics(),
+		rest.CommandLsdumps:               volumeStatsMetricNames(),
+		rest.CommandDownload:              volumeStatsMetricNames(),
+		rest.CommandLssevdiskcopy:         append(metricNames(volumeMetricsMap), SnapshotUsedCapacity, NamespaceSnapshotUsedCapacity),
+		rest.CommandLsfcmap:               {SnapshotCopyProgress},
+		rest.CommandLsarraymemberprogress: {ArrayMemberTasks},
+		rest.CommandLsarray:               append(metricNames(arrayMetricsMap), metricNames(driveMetricsMap)...),
+		rest.CommandLsarraymember:         {ArrayMemberStatus},
+		rest.CommandLsdrive:               append(metricNames(driveMetricsMap), ArrayMemberStatus),
+	}
+
+	// Operations of the operation metric families which can't be reported
+	// without the command, the other operations are still reported
+	commandOperations = map[string][]string{
+		rest.CommandLsvdisk:               {OperationMigration, OperationFlashCopy},
+		rest.CommandLsfcmap:               {OperationFlashCopy},
+		rest.CommandLsmigrate:             {OperationMigration},
+		rest.CommandLsvdiskcopy:           {OperationVolumeCopySync},
+		rest.CommandLsvdisksyncprogress:   {OperationVolumeCopySync},
+		rest.CommandLsarraysyncprogress:   {OperationArraySync},
+		rest.CommandLsarraymemberprogress: {OperationArrayMemberTasks},
+	}
+)
+
+func poolCommandMetrics() []string {
+	names := append(metricNames(poolMetricsMap), metricNames(inventoryMetricsMap)...)
+	names = append(names, metricNames(validatorMetricsMap)...)
+	names = append(names, metricNames(poolPerfMetricsMap)...)
+	names = append(names, metricNames(noisyNeighborMetricsMap)...)
+	names = append(names, metricNames(orphanMetricsMap)...)
+	names = append(names, metricNames(operationMetricsMap)...)
+	names = append(names, metricNames(arrayMetricsMap)...)
+	names = append(names, metricNames(driveMetricsMap)...)
+	names = append(names, systemPhysicalCapacityMetrics...)
+	return append(names, metricNames(systemSavingsMetricsMap)...)
+}
+
+func volumeCommandMetrics() []string {
+	names := append(metricNames(volumeMetricsMap), metricNames(orphanMetricsMap)...)
+	names = append(names, metricNames(snapshotMetricsMap)...)
+	return append(names, volumeStatsMetricNames()...)
+}
+
+// volumeStatsMetricNames returns the metric families of the volume statistics files.
+func volumeStatsMetricNames() []string {
+	names := append(metricNames(volumePerfMetricsMap), metricNames(poolPerfMetricsMap)...)
+	return append(names, metricNames(noisyNeighborMetricsMap)...)
+}
+
+type skipInfo struct {
+	reason      string
+	requirement string
+}
+
+// skippedMetric is a skipped metric family, or the series of a single
+// operation of an operation metric family.
+type skippedMetric struct {
+	metric    string
+	operation string
+}
+
+// skippedMetrics records the metric families skipped in a collection cycle of a system.
+type skippedMetrics map[skippedMetric]skipInfo
+
+func metricNames(metricsMap map[string]MetricLabel) []string {
+	var names []string
+	for name := range metricsMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (f *PerfCollector) initSkippedDescs() {
+	f.skippedDescriptors = make(map[string]*prometheus.Desc)
+
+	for metricName, metricLabel := range skippedMetricsMap {
+		f.skippedDescriptors[metricName] = prometheus.NewDesc(
+			metricName,
+			metricLabel.Name, metricLabel.Labels, nil,
+		)
+	}
+}
+
+// permissionDenied records the metric families of the command if err is a permission error.
+func (s skippedMetrics) permissionDenied(err error) bool {
+	var permissionErr *rest.PermissionError
+	if !errors.As(err, &permissionErr) {
+		return false
+	}
+	info := skipInfo{SkipReasonPermissionDenied, permissionErr.Command}
+	for _, metricName := range commandMetrics[permissionErr.Command] {
+		s.add(skippedMetric{metric: metricName}, info)
+	}
+	for _, operation := range commandOperations[permissionErr.Command] {
+		for _, metricName := range metricNames(operationMetricsMap) {
+			s.add(skippedMetric{metric: metricName, operation: operation}, info)
+		}
+	}
+	return true
+}
+
+// notSupported records the metric families the code level doesn't support.
+func (s skippedMetrics) notSupported(caps rest.Capabilities) {
+	for metricName, capability := range metricCapabilities {
+		if !caps.Has(capability) {
+			s[skippedMetric{metric: metricName}] = skipInfo{SkipReasonNotSupported, capability}
+		}
+	}
+}
+
+// add records the first reason the metric is skipped for.
+func (s skippedMetrics) add(metric skippedMetric, info skipInfo) {
+	if _, skipped := s[metric]; !skipped {
+		s[metric] = info
+	}
+}
+
+func (s skippedMetrics) has(metricName string) bool {
+	_, skipped := s[skippedMetric{metric: metricName}]
+	return skipped
+}
+
+func (f *PerfCollector) collectSkippedMetrics(ch chan<- prometheus.Metric, systemName string, skipped skippedMetrics) {
+	for metric, info := range skipped {
+		ch <- prometheus.MustNewConstMetric(
+			f.skippedDescriptors[MetricsSkipped],
+			prometheus.GaugeValue,
+			1,
+			systemName,
+			metric.metric,
+			metric.operation,
+			info.reason,
+			info.requirement,
+		)
+	}
+}
@@ -0,0 +1,367 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collectors
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/driver"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/logging"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/rest"
+)
+
+const (
+	// Metric name shown outside
+	SnapshotCapacity              = "flashsystem_snapshot_capacity_bytes"
+	SnapshotUsedCapacity          = "flashsystem_snapshot_used_capacity_bytes"
+	SnapshotCopyProgress          = "flashsystem_snapshot_copy_progress_ratio"
+	SnapshotDependent             = "flashsystem_snapshot_dependent"
+	SnapshotInfo                  = "flashsystem_snapshot_info"
+	NamespaceSnapshots            = "flashsystem_namespace_snapshots"
+	NamespaceSnapshotCapacity     = "flashsystem_namespace_snapshot_capacity_bytes"
+	NamespaceSnapshotUsedCapacity = "flashsystem_namespace_snapshot_used_capacity_bytes"
+
+	// Types of the array snapshots
+	SnapshotTypeFlashCopy = "flashcopy"
+	SnapshotTypeSnapshot  = "snapshot"
+
+	// Interested keys of lsvolumesnapshot
+	SnapshotIdKey          = "snapshot_id"
+	SnapshotNameKey        = "snapshot_name"
+	SnapshotVolumeIdKey    = "volume_id"
+	SnapshotStateKey       = "state"
+	SnapshotProvisionedKey = "protection_provisioned_capacity"
+	SnapshotWrittenKey     = "protection_written_capacity"
+
+	// Interested keys of lsfcmap
+	FCMapSourceIdKey   = "source_vdisk_id"
+	FCMapSourceNameKey = "source_vdisk_name"
+	FCMapTargetIdKey   = "target_vdisk_id"
+	FCMapStatusKey     = "status"
+	FCMapProgressKey   = "progress"
+)
+
+var (
+	snapshotLabel = []string{
+		"subsystem_name",
+		"namespace",
+		"volumesnapshot",
+		"volumesnapshotcontent",
+		"snapshot_name",
+		"source_volume_name",
+		"pool_name",
+	}
+	snapshotInfoLabel = append(append([]string{}, snapshotLabel...), "type", "state")
+
+	snapshotMetricsMap = map[string]MetricLabel{
+		SnapshotCapacity:              {"Provisioned capacity of the array snapshot of the VolumeSnapshot (byte)", snapshotLabel},
+		SnapshotUsedCapacity:          {"Capacity the array snapshot of the VolumeSnapshot takes in the pool (byte)", snapshotLabel},
+		SnapshotCopyProgress:          {"Background copy progress of the FlashCopy mapping of the VolumeSnapshot, 0 to 1", snapshotLabel},
+		SnapshotDependent:             {"Whether the array snapshot of the VolumeSnapshot still shares data with its source volume, 1 = dependent", snapshotLabel},
+		SnapshotInfo:                  {"Array snapshot of the VolumeSnapshot, type is flashcopy or snapshot and state its array status", snapshotInfoLabel},
+		NamespaceSnapshots:            {"Number of VolumeSnapshots of the namespace with an array snapshot", namespaceLabel},
+		NamespaceSnapshotCapacity:     {"Provisioned capacity of the array snapshots of the VolumeSnapshots of the namespace (byte)", namespaceLabel},
+		NamespaceSnapshotUsedCapacity: {"Capacity the array snapshots of the VolumeSnapshots of the namespace take in the pools (byte)", namespaceLabel},
+	}
+)
+
+// SnapshotContentInfo is a VolumeSnapshotContent of the block CSI driver and
+// its VolumeSnapshot.
+type SnapshotContentInfo struct {
+	Name           string
+	Namespace      string
+	VolumeSnapshot string
+}
+
+// snapshotContents finds the VolumeSnapshotContent of an array snapshot by the
+// volume UID in the snapshot handle, or by the VolumeSnapshot UID in the names.
+type snapshotContents struct {
+	byUID    map[string]SnapshotContentInfo
+	byHandle map[string]SnapshotContentInfo
+}
+
+type snapshotMetrics struct {
+	content     SnapshotContentInfo
+	name        string
+	source      string
+	pool        string
+	kind        string
+	state       string
+	capacity    float64
+	hasCapacity bool
+	used        float64
+	hasUsed     bool
+	progress    float64
+	hasCopy     bool
+	dependent   bool
+}
+
+type namespaceSnapshots struct {
+	count       float64
+	capacity    float64
+	hasCapacity bool
+	used        float64
+	hasUsed     bool
+}
+
+func (f *PerfCollector) initSnapshotDescs() {
+	for metricName, metricLabel := range snapshotMetricsMap {
+		f.volumeDescriptors[metricName] = prometheus.NewDesc(
+			metricName,
+			metricLabel.Name, metricLabel.Labels, nil,
+		)
+	}
+}
+
+func newSnapshotContents(contents []unstructured.Unstructured) *snapshotContents {
+	index := &snapshotContents{byUID: map[string]SnapshotContentInfo{}, byHandle: map[string]SnapshotContentInfo{}}
+	for _, content := range contents {
+		if csiDriver, _, _ := unstructured.NestedString(content.Object, "spec", "driver"); csiDriver != driver.CSIProvisioner {
+			continue
+		}
+		info := SnapshotContentInfo{Name: content.GetName()}
+		info.Namespace, _, _ = unstructured.NestedString(content.Object, "spec", "volumeSnapshotRef", "namespace")
+		info.VolumeSnapshot, _, _ = unstructured.NestedString(content.Object, "spec", "volumeSnapshotRef", "name")
+
+		if strings.HasPrefix(info.Name, SnapshotContentNamePrefix) {
+			index.byUID[strings.ToLower(strings.TrimPrefix(info.Name, SnapshotContentNamePrefix))] = info
+		}
+		handle, _, _ := unstructured.NestedString(content.Object, "status", "snapshotHandle")
+		if handle == "" {
+			// Pre-provisioned contents only have the handle in the spec
+			handle, _, _ = unstructured.NestedString(content.Object, "spec", "source", "snapshotHandle")
+		}
+		if handle != "" {
+			index.byHandle[volumeHandleUID(handle)] = info
+		}
+	}
+	return index
+}
+
+func (c *snapshotContents) len() int {
+	if c == nil {
+		return 0
+	}
+	return len(c.byUID) + len(c.byHandle)
+}
+
+// find returns the VolumeSnapshotContent of the array snapshot named name, the
+// volume UID is empty for the snapshots of lsvolumesnapshot.
+func (c *snapshotContents) find(name string, volumeUID string) (SnapshotContentInfo, bool) {
+	if content, ok := c.byHandle[strings.ToUpper(volumeUID)]; ok && volumeUID != "" {
+		return content, true
+	}
+	if match := csiSnapshotNamePattern.FindStringSubmatch(name); match != nil {
+		content, ok := c.byUID[strings.ToLower(match[2])]
+		return content, ok
+	}
+	return SnapshotContentInfo{}, false
+}
+
+// getSnapshotContents returns the VolumeSnapshotContents of the block CSI
+// driver, nil if they can't be listed.
+func getSnapshotContents(ctx context.Context, cluster *clusterResources, manager *driver.DriverManager) *snapshotContents {
+	contents, err := cluster.volumeSnapshotContents(ctx, manager)
+	if err != nil {
+		logger := logging.WithSystem(manager.GetSubsystemName())
+		if meta.IsNoMatchError(err) {
+			logger.V(logging.ScrapeLevel).Info("Snapshot CRDs aren't installed, skip the snapshots")
+		} else {
+			logger.Error(err, "list volume snapshot contents failed, skip the snapshots")
+		}
+		return nil
+	}
+	return newSnapshotContents(contents)
+}
+
+// getVolumeSnapshots returns the snapshots of lsvolumesnapshot, nil before
+// the code level has them.
+func getVolumeSnapshots(ctx context.Context, fsRestClient *rest.FSRestClient, skipped skippedMetrics) rest.VolumeSnapshots {
+	if !fsRestClient.Capabilities().Has(rest.CommandLsvolumesnapshot) {
+		return nil
+	}
+	snapshots, err := fsRestClient.Lsvolumesnapshot(ctx)
+	if err != nil && !skipped.permissionDenied(err) {
+		logging.WithSystem(fsRestClient.DriverManager.GetSubsystemName()).Error(err, "get volume snapshots failed")
+	}
+	return snapshots
+}
+
+// getSnapshots maps the array snapshots to the VolumeSnapshots. The FlashCopy
+// target volumes take the progress of their mapping, and their used capacity
+// from volumeCopies if it isn't nil. The snapshots of lsvolumesnapshot always
+// depend on their source volume, and take its pool.
+func getSnapshots(volumes rest.Volumes, snapshots rest.VolumeSnapshots, fcmaps rest.FCMaps, contents *snapshotContents,
+	volumeCopies map[string]map[string]string) []snapshotMetrics {
+	volumesById := map[string]map[string]string{}
+	for _, volume := range volumes {
+		volumesById[volume[VolumeIdKey]] = volume
+	}
+	fcmapsByTarget := map[string]map[string]string{}
+	for _, fcmap := range fcmaps {
+		if _, ok := fcmapsByTarget[fcmap[FCMapTargetIdKey]]; !ok {
+			fcmapsByTarget[fcmap[FCMapTargetIdKey]] = fcmap
+		}
+	}
+
+	var result []snapshotMetrics
+	for _, volume := range volumes {
+		content, ok := contents.find(volume[VolumeNameKey], volume[VolumeUIDKey])
+		if !ok {
+			continue
+		}
+		snapshot := snapshotMetrics{
+			content: content,
+			name:    volume[VolumeNameKey],
+			pool:    volume[MdiskGroupNameKey],
+			kind:    SnapshotTypeFlashCopy,
+		}
+		if capacity, err := volumeCapacityValue(volume, CapacityKey); err == nil {
+			snapshot.capacity, snapshot.hasCapacity = capacity, true
+		}
+		if volumeCopies != nil {
+			if capacity, err := getVolumeCapacity(volume, volumeCopies[volume[VolumeIdKey]]); err == nil {
+				snapshot.used, snapshot.hasUsed = capacity.Stored, true
+			}
+		}
+		if fcmap, ok := fcmapsByTarget[volume[VolumeIdKey]]; ok {
+			snapshot.source = fcmap[FCMapSourceNameKey]
+			if source, ok := volumesById[fcmap[FCMapSourceIdKey]]; ok {
+				snapshot.source = source[VolumeNameKey]
+			}
+			snapshot.state = fcmap[FCMapStatusKey]
+			if progress, err := strconv.ParseFloat(fcmap[FCMapProgressKey], 64); err == nil {
+				snapshot.progress, snapshot.hasCopy = progress/100, true
+				snapshot.dependent = progress < 100
+			}
+		}
+		result = append(result, snapshot)
+	}
+
+	for _, volumeSnapshot := range snapshots {
+		content, ok := contents.find(volumeSnapshot[SnapshotNameKey], "")
+		if !ok {
+			continue
+		}
+		snapshot := snapshotMetrics{
+			content:   content,
+			name:      volumeSnapshot[SnapshotNameKey],
+			kind:      SnapshotTypeSnapshot,
+			state:     volumeSnapshot[SnapshotStateKey],
+			dependent: true,
+		}
+		if source, ok := volumesById[volumeSnapshot[SnapshotVolumeIdKey]]; ok {
+			snapshot.source = source[VolumeNameKey]
+			snapshot.pool = source[MdiskGroupNameKey]
+			if capacity, err := volumeCapacityValue(source, CapacityKey); err == nil {
+				snapshot.capacity, snapshot.hasCapacity = capacity, true
+			}
+		}
+		if volumeSnapshot[SnapshotProvisionedKey] != "" {
+			capacity, err := volumeCapacityValue(volumeSnapshot, SnapshotProvisionedKey)
+			snapshot.capacity, snapshot.hasCapacity = capacity, err == nil
+		}
+		if volumeSnapshot[SnapshotWrittenKey] != "" {
+			if used, err := volumeCapacityValue(volumeSnapshot, SnapshotWrittenKey); err == nil {
+				snapshot.used, snapshot.hasUsed = used, true
+			}
+		}
+		result = append(result, snapshot)
+	}
+	return result
+}
+
+// getFCMaps returns the FlashCopy mappings, nil if the code level doesn't
+// have lsfcmap or it fails.
+func getFCMaps(ctx context.Context, fsRestClient *rest.FSRestClient, skipped skippedMetrics) rest.FCMaps {
+	if !fsRestClient.Capabilities().Has(rest.CommandLsfcmap) {
+		return nil
+	}
+	fcmaps, err := fsRestClient.Lsfcmap(ctx)
+	if err != nil && !skipped.permissionDenied(err) {
+		logging.WithSystem(fsRestClient.DriverManager.GetSubsystemName()).Error(err, "get flash copy mappings failed")
+	}
+	return fcmaps
+}
+
+// collectSnapshotMetrics reports the array snapshots of the VolumeSnapshots,
+// and sums their capacity per namespace. Snapshots without a
+// VolumeSnapshotContent of the block CSI driver aren't reported.
+func (f *PerfCollector) collectSnapshotMetrics(ch chan<- prometheus.Metric, systemName string, volumes rest.Volumes,
+	snapshots rest.VolumeSnapshots, fcmaps rest.FCMaps, contents *snapshotContents, volumeCopies map[string]map[string]string) {
+	namespaces := map[string]*namespaceSnapshots{}
+	for _, snapshot := range getSnapshots(volumes, snapshots, fcmaps, contents, volumeCopies) {
+		labels := []string{systemName, snapshot.content.Namespace, snapshot.content.VolumeSnapshot, snapshot.content.Name,
+			snapshot.name, snapshot.source, snapshot.pool}
+		ch <- prometheus.MustNewConstMetric(f.volumeDescriptors[SnapshotInfo], prometheus.GaugeValue, 1,
+			append(labels, snapshot.kind, snapshot.state)...)
+		if snapshot.hasCapacity {
+			ch <- prometheus.MustNewConstMetric(f.volumeDescriptors[SnapshotCapacity], prometheus.GaugeValue, snapshot.capacity, labels...)
+		}
+		if snapshot.hasUsed {
+			ch <- prometheus.MustNewConstMetric(f.volumeDescriptors[SnapshotUsedCapacity], prometheus.GaugeValue, snapshot.used, labels...)
+		}
+		if snapshot.hasCopy {
+			ch <- prometheus.MustNewConstMetric(f.volumeDescriptors[SnapshotCopyProgress], prometheus.GaugeValue, snapshot.progress, labels...)
+		}
+		if snapshot.hasCopy || snapshot.kind == SnapshotTypeSnapshot {
+			dependent := 0.0
+			if snapshot.dependent {
+				dependent = 1
+			}
+			ch <- prometheus.MustNewConstMetric(f.volumeDescriptors[SnapshotDependent], prometheus.GaugeValue, dependent, labels...)
+		}
+
+		if snapshot.content.Namespace == "" {
+			continue
+		}
+		total, ok := namespaces[snapshot.content.Namespace]
+		if !ok {
+			total = &namespaceSnapshots{hasCapacity: true, hasUsed: true}
+			namespaces[snapshot.content.Namespace] = total
+		}
+		total.count++
+		total.capacity += snapshot.capacity
+		total.hasCapacity = total.hasCapacity && snapshot.hasCapacity
+		total.used += snapshot.used
+		total.hasUsed = total.hasUsed && snapshot.hasUsed
+	}
+
+	var names []string
+	for name := range namespaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		total := namespaces[name]
+		ch <- prometheus.MustNewConstMetric(f.volumeDescriptors[NamespaceSnapshots], prometheus.GaugeValue, total.count, systemName, name)
+		// The sums would be short without the capacity of each snapshot
+		if total.hasCapacity {
+			ch <- prometheus.MustNewConstMetric(f.volumeDescriptors[NamespaceSnapshotCapacity], prometheus.GaugeValue, total.capacity, systemName, name)
+		}
+		if total.hasUsed {
+			ch <- prometheus.MustNewConstMetric(f.volumeDescriptors[NamespaceSnapshotUsedCapacity], prometheus.GaugeValue, total.used, systemName, name)
+		}
+	}
+}
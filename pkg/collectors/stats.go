@@ -0,0 +1,164 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collectors
+
+import (
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Column names of lssystemstats, lsnodestats and lsnodecanisterstats
+const (
+	StatNameKey     = "stat_name"
+	StatCurrentKey  = "stat_current"
+	StatPeakKey     = "stat_peak"
+	StatPeakTimeKey = "stat_peak_time"
+
+	// stat_peak_time is YYMMDDHHMMSS in the system time
+	statPeakTimeLayout = "060102150405"
+
+	// Suffix of the peak metrics
+	peakSuffix     = "_peak"
+	peakTimeSuffix = "_peak_timestamp_seconds"
+)
+
+// Stat units
+const (
+	statUnitMB      = 1024 * 1024
+	statUnitMs      = 0.001
+	statUnitPercent = 0.01
+	statUnitNone    = 1
+)
+
+// statDef maps a statistic to the metric name without the prefix, and the
+// factor converting it to the base unit.
+type statDef struct {
+	Metric string
+	Help   string
+	Factor float64
+}
+
+// Statistics reported by lssystemstats and lsnodestats. New statistics only
+// need a row here.
+var statsTable = map[string]statDef{
+	VdiskReadBW:       {"rd_bytes", "read throughput bytes/s", statUnitMB},
+	VdiskWriteBW:      {"wr_bytes", "write throughput bytes/s", statUnitMB},
+	VdiskReadIOPS:     {"rd_iops", "read IOPS", statUnitNone},
+	VdiskWriteIOPS:    {"wr_iops", "write IOPS", statUnitNone},
+	VdiskLatency:      {"latency_seconds", "average latency seconds", statUnitMs},
+	VdiskReadLatency:  {"rd_latency_seconds", "read latency seconds", statUnitMs},
+	VdiskWriteLatency: {"wr_latency_seconds", "write latency seconds", statUnitMs},
+	"vdisk_mb":        {"total_bytes", "read and write throughput bytes/s", statUnitMB},
+	"vdisk_io":        {"total_iops", "read and write IOPS", statUnitNone},
+
+	"cpu_pc":             {"cpu_utilization_ratio", "CPU utilization ratio", statUnitPercent},
+	"compression_cpu_pc": {"compression_cpu_utilization_ratio", "compression CPU utilization ratio", statUnitPercent},
+	"write_cache_pc":     {"write_cache_fullness_ratio", "write cache fullness ratio", statUnitPercent},
+	"total_cache_pc":     {"total_cache_fullness_ratio", "total cache fullness ratio", statUnitPercent},
+
+	"fc_mb":          {"fc_bytes", "fibre channel throughput bytes/s", statUnitMB},
+	"fc_io":          {"fc_iops", "fibre channel IOPS", statUnitNone},
+	"sas_mb":         {"sas_bytes", "SAS throughput bytes/s", statUnitMB},
+	"sas_io":         {"sas_iops", "SAS IOPS", statUnitNone},
+	"iscsi_mb":       {"iscsi_bytes", "iSCSI throughput bytes/s", statUnitMB},
+	"iscsi_io":       {"iscsi_iops", "iSCSI IOPS", statUnitNone},
+	"iser_mb":        {"iser_bytes", "iSER throughput bytes/s", statUnitMB},
+	"iser_io":        {"iser_iops", "iSER IOPS", statUnitNone},
+	"iplink_mb":      {"iplink_bytes", "IP replication throughput bytes/s", statUnitMB},
+	"iplink_io":      {"iplink_iops", "IP replication IOPS", statUnitNone},
+	"iplink_comp_mb": {"iplink_compressed_bytes", "IP replication compressed throughput bytes/s", statUnitMB},
+
+	"mdisk_mb":   {"mdisk_bytes", "mdisk read and write throughput bytes/s", statUnitMB},
+	"mdisk_io":   {"mdisk_iops", "mdisk read and write IOPS", statUnitNone},
+	"mdisk_ms":   {"mdisk_latency_seconds", "mdisk average latency seconds", statUnitMs},
+	"mdisk_r_mb": {"mdisk_rd_bytes", "mdisk read throughput bytes/s", statUnitMB},
+	"mdisk_r_io": {"mdisk_rd_iops", "mdisk read IOPS", statUnitNone},
+	"mdisk_r_ms": {"mdisk_rd_latency_seconds", "mdisk read latency seconds", statUnitMs},
+	"mdisk_w_mb": {"mdisk_wr_bytes", "mdisk write throughput bytes/s", statUnitMB},
+	"mdisk_w_io": {"mdisk_wr_iops", "mdisk write IOPS", statUnitNone},
+	"mdisk_w_ms": {"mdisk_wr_latency_seconds", "mdisk write latency seconds", statUnitMs},
+
+	"drive_mb":   {"drive_bytes", "drive read and write throughput bytes/s", statUnitMB},
+	"drive_io":   {"drive_iops", "drive read and write IOPS", statUnitNone},
+	"drive_ms":   {"drive_latency_seconds", "drive average latency seconds", statUnitMs},
+	"drive_r_mb": {"drive_rd_bytes", "drive read throughput bytes/s", statUnitMB},
+	"drive_r_io": {"drive_rd_iops", "drive read IOPS", statUnitNone},
+	"drive_r_ms": {"drive_rd_latency_seconds", "drive read latency seconds", statUnitMs},
+	"drive_w_mb": {"drive_wr_bytes", "drive write throughput bytes/s", statUnitMB},
+	"drive_w_io": {"drive_wr_iops", "drive write IOPS", statUnitNone},
+	"drive_w_ms": {"drive_wr_latency_seconds", "drive write latency seconds", statUnitMs},
+
+	"cloud_up_mb":   {"cloud_up_bytes", "cloud upload throughput bytes/s", statUnitMB},
+	"cloud_up_ms":   {"cloud_up_latency_seconds", "cloud upload latency seconds", statUnitMs},
+	"cloud_down_mb": {"cloud_down_bytes", "cloud download throughput bytes/s", statUnitMB},
+	"cloud_down_ms": {"cloud_down_latency_seconds", "cloud download latency seconds", statUnitMs},
+
+	"power_w": {"power_watts", "power consumption watts", statUnitNone},
+	"temp_c":  {"temperature_celsius", "temperature celsius", statUnitNone},
+}
+
+// statsMetricsMap returns the current, peak and peak time metrics of the stats table.
+func statsMetricsMap(prefix string, helpPrefix string, labels []string) map[string]MetricLabel {
+	metricsMap := map[string]MetricLabel{}
+	for _, def := range statsTable {
+		name := prefix + def.Metric
+		metricsMap[name] = MetricLabel{helpPrefix + def.Help, labels}
+		metricsMap[name+peakSuffix] = MetricLabel{helpPrefix + def.Help + ", peak of the last 5 minutes", labels}
+		metricsMap[name+peakTimeSuffix] = MetricLabel{helpPrefix + def.Help + ", time of the peak", labels}
+	}
+	return metricsMap
+}
+
+// statsMetricNames returns the current value metrics of the stats table, the peaks
+// are left out as they come from the same row.
+func statsMetricNames(prefix string) []string {
+	var names []string
+	for _, def := range statsTable {
+		names = append(names, prefix+def.Metric)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// statValue holds a converted row of the stats commands.
+type statValue struct {
+	Current  float64
+	HasPeak  bool
+	Peak     float64
+	PeakTime float64
+}
+
+// parseStat converts a row to the base unit. The peak is optional, its time is 0
+// if unknown. The peak time is in the time zone of the system.
+func parseStat(def statDef, row map[string]string, location *time.Location) (statValue, error) {
+	var value statValue
+	current, err := strconv.ParseFloat(row[StatCurrentKey], 64)
+	if err != nil {
+		return value, err
+	}
+	value.Current = current * def.Factor
+
+	if peak, err := strconv.ParseFloat(row[StatPeakKey], 64); err == nil {
+		value.HasPeak = true
+		value.Peak = peak * def.Factor
+	}
+	if peakTime, err := time.ParseInLocation(statPeakTimeLayout, row[StatPeakTimeKey], location); err == nil {
+		value.PeakTime = float64(peakTime.Unix())
+	}
+	return value, nil
+}
@@ -17,13 +17,14 @@
 package collectors
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
 
 	"github.com/prometheus/client_golang/prometheus"
-	log "k8s.io/klog"
 
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/logging"
 	"github.com/IBM/ibm-storage-odf-block-driver/pkg/rest"
 )
 
@@ -59,6 +60,9 @@ const (
 	SystemPhysicalTotalCapacity = "flashsystem_subsystem_physical_total_capacity_bytes"
 	SystemPhysicalFreeCapacity  = "flashsystem_subsystem_physical_free_capacity_bytes"
 	SystemPhysicalUsedCapacity  = "flashsystem_subsystem_physical_used_capacity_bytes"
+
+	SystemMetricPrefix = "flashsystem_subsystem_"
+	SystemStat         = "flashsystem_subsystem_stat"
 )
 
 var (
@@ -74,26 +78,8 @@ var (
 		SystemResponse: {"System response", subsystemMetadataLabel},
 	}
 
-	perfMetricsMap = map[string]MetricLabel{
-		SystemReadIOPS:     {"overall performance - read IOPS", subsystemCommonLabel},
-		SystemWriteIOPS:    {"overall performance - write IOPS", subsystemCommonLabel},
-		SystemReadBytes:    {"overall performance - read throughput bytes/s", subsystemCommonLabel},
-		SystemWriteBytes:   {"overall performance - write throughput bytes/s", subsystemCommonLabel},
-		SystemLatency:      {"overall performance - average latency seconds", subsystemCommonLabel},
-		SystemReadLatency:  {"overall performance - read latency seconds", subsystemCommonLabel},
-		SystemWriteLatency: {"overall performance - write latency seconds", subsystemCommonLabel},
-	}
-
-	// Raw metrics names to system metrics name map
-	rawMetricsMap = map[string]string{
-		VdiskReadBW:       SystemReadBytes,
-		VdiskWriteBW:      SystemWriteBytes,
-		VdiskReadIOPS:     SystemReadIOPS,
-		VdiskWriteIOPS:    SystemWriteIOPS,
-		VdiskLatency:      SystemLatency,
-		VdiskReadLatency:  SystemReadLatency,
-		VdiskWriteLatency: SystemWriteLatency,
-	}
+	// Metrics of the stats table, and the stats missing in the table
+	perfMetricsMap = systemPerfMetricsMap()
 
 	// StorageSystemMetricsMap defines mapping
 	StorageSystemMetricsMap = map[string]MetricLabel{
@@ -101,19 +87,15 @@ var (
 		SystemPhysicalFreeCapacity:  {"System physical free capacity (byte)", subsystemCommonLabel},
 		SystemPhysicalUsedCapacity:  {"System physical used capacity (byte)", subsystemCommonLabel},
 	}
-
-	// Unit conversion for raw metrics
-	unitConvertMap = map[string]float64{
-		VdiskReadBW:       1024 * 1024,
-		VdiskWriteBW:      1024 * 1024,
-		VdiskReadIOPS:     1,
-		VdiskWriteIOPS:    1,
-		VdiskLatency:      0.001,
-		VdiskReadLatency:  0.001,
-		VdiskWriteLatency: 0.001,
-	}
 )
 
+func systemPerfMetricsMap() map[string]MetricLabel {
+	metricsMap := statsMetricsMap(SystemMetricPrefix, "overall performance - ", subsystemCommonLabel)
+	metricsMap[SystemStat] = MetricLabel{"overall performance - statistic without a dedicated metric, in the unit of lssystemstats",
+		[]string{"subsystem_name", "stat"}}
+	return metricsMap
+}
+
 type SystemInfo struct {
 	Name              string
 	Vendor            string
@@ -151,9 +133,11 @@ func (f *PerfCollector) initSubsystemDescs() {
 			metricLabel.Name, metricLabel.Labels, nil,
 		)
 	}
+	f.initSavingsDescs()
 }
 
-func (f *PerfCollector) collectSystemMetrics(ch chan<- prometheus.Metric, fsRestClient *rest.FSRestClient, poolsInfoList []PoolInfo) bool {
+func (f *PerfCollector) collectSystemMetrics(ctx context.Context, ch chan<- prometheus.Metric, fsRestClient *rest.FSRestClient, poolsInfoList []PoolInfo,
+	nodes rest.Nodes, skipped skippedMetrics) bool {
 
 	// timer := prometheus.NewTimer(f.scrapeDuration)
 	// defer timer.ObserveDuration()
@@ -170,15 +154,19 @@ func (f *PerfCollector) collectSystemMetrics(ch chan<- prometheus.Metric, fsRest
 	// Subsystem name is from CR
 	systemName.Name = manager.GetSubsystemName()
 	systemInfo.Name = manager.GetSubsystemName()
+	logger := manager.Logger()
 
 	// Get flash system results
-	statsResults, err = fsRestClient.Lssystemstats()
+	statsResults, err = fsRestClient.Lssystemstats(ctx)
+	if skipped.permissionDenied(err) {
+		err = nil
+	}
 	if err == nil {
-		sysInfoResults, err = fsRestClient.Lssystem()
+		sysInfoResults, err = fsRestClient.Lssystem(ctx)
 	}
 	if err != nil {
 		newSystemMetrics(ch, f.sysInfoDescriptors[SystemResponse], 0, &systemInfo)
-		log.Error("fail to get system stats")
+		logger.Error(err, "fail to get system stats")
 		return false
 	} else {
 		newSystemMetrics(ch, f.sysInfoDescriptors[SystemResponse], 1, &systemInfo)
@@ -198,50 +186,55 @@ func (f *PerfCollector) collectSystemMetrics(ch chan<- prometheus.Metric, fsRest
 	systemInfo.isInternalStorage = isAllInternalStorage(poolsInfoList)
 	newSystemMetrics(ch, f.sysInfoDescriptors[SystemMetadata], 0, &systemInfo)
 
-	f.createSystemPhysicalCapacityMetrics(ch, sysInfoResults, systemName, poolsInfoList)
+	if !skipped.has(SystemPhysicalTotalCapacity) {
+		f.createSystemPhysicalCapacityMetrics(ch, sysInfoResults, systemName, poolsInfoList)
+	}
+	if !skipped.has(SystemEfficiencySavings) {
+		f.createSystemSavingsMetrics(ch, systemName, poolsInfoList)
+	}
 
 	// Determine the health 0 = OK, 1 = warning, 2 = error
-	bReady, err := fsRestClient.CheckFlashsystemClusterState()
-	status := 0.0
-	if err != nil || !bReady {
-		status = 1
+	if !skipped.has(SystemHealth) {
+		// A system without the node list is a warning
+		status := HealthWarning
+		if len(nodes) > 0 {
+			status = systemHealth(nodes)
+		}
+		newPerfMetrics(ch, f.sysInfoDescriptors[SystemHealth], status, &systemName)
 	}
-	newPerfMetrics(ch, f.sysInfoDescriptors[SystemHealth], status, &systemName)
 
 	// Parse statsResults
+	location := fsRestClient.Location()
 	for _, m := range statsResults {
-		metricName, ok := m["stat_name"]
+		statName, ok := m[StatNameKey]
 		if !ok {
-			log.Warningf("no stat_name in metric response: %v", m)
+			logger.Info("no stat_name in metric response", "stat", m)
 			continue
 		}
 
-		// Get metric descriptor name from rawMetricsMap
-		metricDescName, ok := rawMetricsMap[metricName]
+		def, ok := statsTable[statName]
 		if !ok {
-			// log.Warningf("Not interested metric for %s", metricName)
+			// Keep the stats unknown to the table, in their raw unit
+			if value, err := strconv.ParseFloat(m[StatCurrentKey], 64); err == nil {
+				ch <- prometheus.MustNewConstMetric(f.sysPerfDescriptors[SystemStat], prometheus.GaugeValue, value, systemName.Name, statName)
+			}
 			continue
 		}
 
-		// Get metric descriptor from sysPerfDescriptors
-		metricDesc, ok := f.sysPerfDescriptors[metricDescName]
-		if !ok {
-			log.Errorf("metric mapping wrong: %s", metricName)
-			continue
-		}
-
-		metricValue, err := strconv.ParseFloat(m["stat_current"], 64)
+		value, err := parseStat(def, m, location)
 		if err != nil {
-			log.Errorf("fail to convert metric %s from string %s to float", metricName, m["stat_current"])
+			logger.Error(err, "fail to convert metric to float", "stat", statName, "value", m[StatCurrentKey])
 			continue
 		}
 
-		convertFactor, ok := unitConvertMap[metricName]
-		if ok {
-			metricValue *= convertFactor
+		metricName := SystemMetricPrefix + def.Metric
+		newPerfMetrics(ch, f.sysPerfDescriptors[metricName], value.Current, &systemName)
+		if value.HasPeak {
+			newPerfMetrics(ch, f.sysPerfDescriptors[metricName+peakSuffix], value.Peak, &systemName)
+		}
+		if value.PeakTime > 0 {
+			newPerfMetrics(ch, f.sysPerfDescriptors[metricName+peakTimeSuffix], value.PeakTime, &systemName)
 		}
-
-		newPerfMetrics(ch, metricDesc, metricValue, &systemName)
 	}
 
 	return true
@@ -249,29 +242,30 @@ func (f *PerfCollector) collectSystemMetrics(ch chan<- prometheus.Metric, fsRest
 
 func (f *PerfCollector) createSystemPhysicalCapacityMetrics(ch chan<- prometheus.Metric, sysInfoResults rest.StorageSystem,
 	systemName SystemName, poolsInfoList []PoolInfo) {
+	logger := logging.WithSystem(systemName.Name)
 	// [lssystem]: physical_capacity
 	physicalTotalCapacity, err := strconv.ParseFloat(sysInfoResults[PhysicalTotalCapacityKey].(string), 64)
 	if err != nil {
-		log.Errorf("get system physical total capacity failed: %s", err)
+		logger.Error(err, "get system physical total capacity failed")
 		return
 	}
 	// [lssystem]: physical_free_capacity
 	physicalUsableCapacity, err := strconv.ParseFloat(sysInfoResults[PhysicalFreeCapacityKey].(string), 64)
 	if err != nil {
-		log.Errorf("get system physical usable capacity failed: %s", err)
+		logger.Error(err, "get system physical usable capacity failed")
 		return
 	}
 	physicalReclaimableCapacity, err := calcSystemReclaimableCapacity(poolsInfoList)
 	//physicalReclaimableCapacity, err := strconv.ParseFloat(sysInfoResults[ReclaimableCapacityKey].(string), 64)
 	if err != nil {
-		log.Errorf("get system physical reclaimable capacity failed: %s", err)
+		logger.Error(err, "get system physical reclaimable capacity failed")
 		return
 	}
 	physicalUsedCapacity := physicalTotalCapacity - physicalUsableCapacity - physicalReclaimableCapacity
 
 	physicalFreeCapacity := physicalTotalCapacity - physicalUsedCapacity
 	// used = total - free
-	log.Infof("system capacity total: %f, free: %f, used: %f", physicalTotalCapacity, physicalFreeCapacity, physicalUsedCapacity)
+	logger.V(logging.DetailLevel).Info("system capacity", "total", physicalTotalCapacity, "free", physicalFreeCapacity, "used", physicalUsedCapacity)
 
 	newSystemCapacityMetrics(ch, f.sysCapacityDescriptors[SystemPhysicalTotalCapacity], physicalTotalCapacity, &systemName)
 	newSystemCapacityMetrics(ch, f.sysCapacityDescriptors[SystemPhysicalUsedCapacity], physicalUsedCapacity, &systemName)
@@ -292,7 +286,7 @@ func calcSystemReclaimableCapacity(poolsInfoList []PoolInfo) (float64, error) {
 	for _, currentPool := range poolsInfoList {
 		poolReclaimable, err := GetPoolReclaimablePhysicalCapacity(currentPool)
 		if err != nil {
-			log.Errorf("get pool reclaimable physical capacity failed: %v", err)
+			poolLogger(currentPool).Error(err, "get pool reclaimable physical capacity failed")
 			return InvalidVal, err
 		}
 		totalSystemReclaimable += poolReclaimable
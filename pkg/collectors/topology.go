@@ -0,0 +1,264 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collectors
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/logging"
+	clientmanagers "github.com/IBM/ibm-storage-odf-block-driver/pkg/managers"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/rest"
+)
+
+const (
+	// Metric name shown outside
+	SystemTopology             = "flashsystem_subsystem_topology"
+	SiteNodeCount              = "flashsystem_site_node_count"
+	SiteOnlineNodeCount        = "flashsystem_site_online_node_count"
+	SiteHealth                 = "flashsystem_site_health"
+	QuorumStatus               = "flashsystem_quorum_status"
+	HyperSwapRelationshipState = "flashsystem_hyperswap_relationship_state"
+
+	// Interested keys of lsnode, lsquorum and lsrcrelationship
+	SiteIdKey            = "site_id"
+	QuorumIndexKey       = "quorum_index"
+	QuorumStatusKey      = "status"
+	QuorumNameKey        = "name"
+	QuorumActiveKey      = "active"
+	QuorumObjectTypeKey  = "object_type"
+	RCNameKey            = "name"
+	RCStateKey           = "state"
+	RCPrimaryKey         = "primary"
+	RCCopyTypeKey        = "copy_type"
+	RCConsistencyGrpKey  = "consistency_group_name"
+	RCCopyTypeHyperSwap  = "activeactive"
+	RCStateSynchronized  = "consistent_synchronized"
+	RCStateInconsistent  = "inconsistent_"
+	QuorumStatusOnline   = "online"
+	QuorumStatusExcluded = "excluded"
+)
+
+var (
+	topologyLabel     = []string{"subsystem_name", "topology"}
+	siteLabel         = []string{"subsystem_name", "site_id", "site_name"}
+	quorumLabel       = []string{"subsystem_name", "quorum_index", "object_type", "object_name", "site_name", "active"}
+	relationshipLabel = []string{"subsystem_name", "relationship_name", "consistency_group", "primary", "state"}
+
+	topologyMetricsMap = map[string]MetricLabel{
+		SystemTopology:             {"System topology, standard, stretched or hyperswap", topologyLabel},
+		SiteNodeCount:              {"Number of nodes in the site", siteLabel},
+		SiteOnlineNodeCount:        {"Number of online nodes in the site", siteLabel},
+		SiteHealth:                 {"Site health, 0 = all nodes online, 1 = some nodes offline, 2 = site lost", siteLabel},
+		QuorumStatus:               {"Quorum device status, 0 = online, 1 = excluded, 2 = offline", quorumLabel},
+		HyperSwapRelationshipState: {"HyperSwap relationship state, 0 = synchronized, 1 = not synchronized, 2 = inconsistent", relationshipLabel},
+	}
+)
+
+type siteState struct {
+	id          string
+	name        string
+	nodeCount   int
+	onlineCount int
+}
+
+func (f *PerfCollector) initTopologyDescs() {
+	f.topologyDescriptors = make(map[string]*prometheus.Desc)
+
+	for metricName, metricLabel := range topologyMetricsMap {
+		f.topologyDescriptors[metricName] = prometheus.NewDesc(
+			metricName,
+			metricLabel.Name, metricLabel.Labels, nil,
+		)
+	}
+}
+
+// getSiteStates groups the nodes by site, nodes without a site are left out.
+func getSiteStates(nodes rest.Nodes) []siteState {
+	sites := map[string]*siteState{}
+	for _, node := range nodes {
+		siteId := node[SiteIdKey]
+		if siteId == "" {
+			continue
+		}
+		state, ok := sites[siteId]
+		if !ok {
+			state = &siteState{id: siteId, name: node[SiteNameKey]}
+			sites[siteId] = state
+		}
+		state.nodeCount++
+		if rest.IsNodeHealthy(node[NodeStatusKey]) {
+			state.onlineCount++
+		}
+	}
+
+	var states []siteState
+	for _, state := range sites {
+		states = append(states, *state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].id < states[j].id })
+	return states
+}
+
+func siteHealth(state siteState) float64 {
+	switch {
+	case state.onlineCount == 0:
+		return HealthError
+	case state.onlineCount < state.nodeCount:
+		return HealthWarning
+	}
+	return HealthOK
+}
+
+// lostSites returns the sites without an online node while another site still
+// serves IO. When all sites are down the system is offline, not a lost site.
+func lostSites(states []siteState) []string {
+	var lost []string
+	serving := false
+	for _, state := range states {
+		if state.onlineCount == 0 {
+			name := state.name
+			if name == "" {
+				name = state.id
+			}
+			lost = append(lost, name)
+		} else {
+			serving = true
+		}
+	}
+	if !serving {
+		return nil
+	}
+	return lost
+}
+
+func quorumStatusValue(status string) float64 {
+	switch status {
+	case QuorumStatusOnline:
+		return HealthOK
+	case QuorumStatusExcluded:
+		return HealthWarning
+	}
+	return HealthError
+}
+
+func relationshipStateValue(state string) float64 {
+	switch {
+	case state == RCStateSynchronized:
+		return HealthOK
+	case strings.HasPrefix(state, RCStateInconsistent):
+		return HealthError
+	}
+	return HealthWarning
+}
+
+// collectTopologyMetrics collects the site, quorum and HyperSwap metrics of
+// stretched and HyperSwap systems. Standard systems only report the topology.
+func (f *PerfCollector) collectTopologyMetrics(ctx context.Context, ch chan<- prometheus.Metric, fsRestClient *rest.FSRestClient, nodes rest.Nodes,
+	nodesErr error, skipped skippedMetrics) {
+	systemName := fsRestClient.DriverManager.GetSubsystemName()
+	topology := fsRestClient.Topology()
+	logger := logging.WithSystem(systemName)
+
+	ch <- prometheus.MustNewConstMetric(f.topologyDescriptors[SystemTopology], prometheus.GaugeValue, 1, systemName, topology)
+	if topology == rest.TopologyStandard {
+		// A standard system has no sites to lose
+		if err := clientmanagers.UpdateSiteCondition(ctx, fsRestClient.DriverManager, nil); err != nil {
+			logger.Error(err, "update site condition failed")
+		}
+		return
+	}
+
+	if nodesErr == nil {
+		states := getSiteStates(nodes)
+		for _, state := range states {
+			newSiteMetrics(ch, f.topologyDescriptors[SiteNodeCount], float64(state.nodeCount), systemName, state)
+			newSiteMetrics(ch, f.topologyDescriptors[SiteOnlineNodeCount], float64(state.onlineCount), systemName, state)
+			newSiteMetrics(ch, f.topologyDescriptors[SiteHealth], siteHealth(state), systemName, state)
+		}
+
+		lost := lostSites(states)
+		if len(lost) > 0 {
+			logger.Info("Site lost, IO continues on the remaining site", "sites", lost)
+		}
+		if err := clientmanagers.UpdateSiteCondition(ctx, fsRestClient.DriverManager, lost); err != nil {
+			logger.Error(err, "update site condition failed")
+		}
+	}
+
+	if !skipped.has(QuorumStatus) {
+		quorums, err := fsRestClient.Lsquorum(ctx)
+		if err != nil {
+			if !skipped.permissionDenied(err) {
+				logger.Error(err, "get quorum failed")
+			}
+		} else {
+			for _, quorum := range quorums {
+				ch <- prometheus.MustNewConstMetric(
+					f.topologyDescriptors[QuorumStatus],
+					prometheus.GaugeValue,
+					quorumStatusValue(quorum[QuorumStatusKey]),
+					systemName,
+					quorum[QuorumIndexKey],
+					quorum[QuorumObjectTypeKey],
+					quorum[QuorumNameKey],
+					quorum[SiteNameKey],
+					quorum[QuorumActiveKey],
+				)
+			}
+		}
+	}
+
+	if topology == rest.TopologyHyperSwap && !skipped.has(HyperSwapRelationshipState) {
+		relationships, err := fsRestClient.Lsrcrelationship(ctx)
+		if err != nil {
+			if !skipped.permissionDenied(err) {
+				logger.Error(err, "get remote copy relationships failed")
+			}
+			return
+		}
+		for _, relationship := range relationships {
+			if relationship[RCCopyTypeKey] != RCCopyTypeHyperSwap {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(
+				f.topologyDescriptors[HyperSwapRelationshipState],
+				prometheus.GaugeValue,
+				relationshipStateValue(relationship[RCStateKey]),
+				systemName,
+				relationship[RCNameKey],
+				relationship[RCConsistencyGrpKey],
+				relationship[RCPrimaryKey],
+				relationship[RCStateKey],
+			)
+		}
+	}
+}
+
+func newSiteMetrics(ch chan<- prometheus.Metric, desc *prometheus.Desc, value float64, systemName string, state siteState) {
+	ch <- prometheus.MustNewConstMetric(
+		desc,
+		prometheus.GaugeValue,
+		value,
+		systemName,
+		state.id,
+		state.name,
+	)
+}
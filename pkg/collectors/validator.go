@@ -0,0 +1,136 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collectors
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/driver"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/logging"
+	clientmanagers "github.com/IBM/ibm-storage-odf-block-driver/pkg/managers"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/rest"
+)
+
+const (
+	// Metric name shown outside
+	StorageClassMismatch = "flashsystem_storageclass_parameter_mismatch"
+
+	// Storage class parameters of the block CSI driver
+	SCPoolParam            = "pool"
+	SCSpaceEfficiencyParam = "SpaceEfficiency"
+	SCBySystemIdParam      = "by_system_id"
+
+	// Space efficiency values
+	SpaceEfficiencyThick           = "thick"
+	SpaceEfficiencyThin            = "thin"
+	SpaceEfficiencyCompressed      = "compressed"
+	SpaceEfficiencyDedupThin       = "dedup_thin"
+	SpaceEfficiencyDedupCompressed = "dedup_compressed"
+	SpaceEfficiencyDeduplicated    = "deduplicated"
+
+	// Mismatch reasons
+	MismatchPool              = "pool_mismatch"
+	MismatchCompression       = "compression_not_supported"
+	MismatchDeduplication     = "deduplication_not_supported"
+	MismatchInvalidEfficiency = "invalid_space_efficiency"
+)
+
+var (
+	storageClassMismatchLabel = []string{"subsystem_name", "storageclass", "pool_name", "reason"}
+
+	validatorMetricsMap = map[string]MetricLabel{
+		StorageClassMismatch: {"Storage class parameter which the pool can't provide", storageClassMismatchLabel},
+	}
+)
+
+func (f *PerfCollector) initValidatorDescs() {
+	for metricName, metricLabel := range validatorMetricsMap {
+		f.poolDescriptors[metricName] = prometheus.NewDesc(
+			metricName,
+			metricLabel.Name, metricLabel.Labels, nil,
+		)
+	}
+}
+
+// validateStorageClass compares the storage class parameters with the pool
+// attributes, and returns the reasons of the mismatches.
+func validateStorageClass(params map[string]string, pool PoolInfo) []string {
+	var reasons []string
+	if poolParam := params[SCPoolParam]; poolParam != "" && params[SCBySystemIdParam] == "" && poolParam != pool.PoolName {
+		reasons = append(reasons, MismatchPool)
+	}
+
+	drpool := isDataReductionPool(pool)
+	switch strings.ToLower(params[SCSpaceEfficiencyParam]) {
+	case "", SpaceEfficiencyThick, SpaceEfficiencyThin:
+	case SpaceEfficiencyCompressed:
+		if !drpool {
+			reasons = append(reasons, MismatchCompression)
+		}
+	case SpaceEfficiencyDedupThin, SpaceEfficiencyDedupCompressed, SpaceEfficiencyDeduplicated:
+		if !drpool || !pool.Capabilities.Has(rest.FeatureDeduplication) {
+			reasons = append(reasons, MismatchDeduplication)
+		}
+	default:
+		reasons = append(reasons, MismatchInvalidEfficiency)
+	}
+	return reasons
+}
+
+// validateStorageClasses checks the storage classes of the pool map against the
+// pools found on the system. Missing pools are reported by the pool metrics.
+func (f *PerfCollector) validateStorageClasses(ctx context.Context, ch chan<- prometheus.Metric, cluster *clusterResources, manager *driver.DriverManager,
+	poolsInfoList []PoolInfo) {
+	pools := map[string]PoolInfo{}
+	for _, pool := range poolsInfoList {
+		pools[pool.PoolName] = pool
+	}
+
+	mismatches := map[string][]string{}
+	for sc, poolName := range manager.GetSCPoolMap() {
+		pool, found := pools[poolName]
+		if !found {
+			continue
+		}
+		storageClass, err := cluster.storageClass(ctx, manager, sc)
+		if err != nil {
+			manager.Logger().Error(err, "get storage class failed, skip its validation", "storageClass", sc)
+			continue
+		}
+
+		reasons := validateStorageClass(storageClass.Parameters, pool)
+		if len(reasons) == 0 {
+			continue
+		}
+		sort.Strings(reasons)
+		mismatches[sc] = reasons
+		manager.Logger().V(logging.ScrapeLevel).Info("Storage class parameters don't match the pool", "storageClass", sc,
+			"pool", poolName, "reasons", reasons)
+		for _, reason := range reasons {
+			ch <- prometheus.MustNewConstMetric(f.poolDescriptors[StorageClassMismatch], prometheus.GaugeValue, 1,
+				manager.GetSubsystemName(), sc, poolName, reason)
+		}
+	}
+
+	if err := clientmanagers.UpdateStorageClassCondition(ctx, manager, mismatches); err != nil {
+		manager.Logger().Error(err, "update storage class condition failed")
+	}
+}
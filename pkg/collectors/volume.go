@@ -0,0 +1,381 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/driver"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/logging"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/rest"
+)
+
+const (
+	// Metric name shown outside
+	PVCCapacity                = "flashsystem_pvc_capacity_bytes"
+	PVCUsedCapacity            = "flashsystem_pvc_used_capacity_bytes"
+	PVCStoredCapacity          = "flashsystem_pvc_stored_capacity_bytes"
+	StorageClassCapacity       = "flashsystem_storageclass_capacity_bytes"
+	StorageClassUsedCapacity   = "flashsystem_storageclass_used_capacity_bytes"
+	StorageClassStoredCapacity = "flashsystem_storageclass_stored_capacity_bytes"
+	NamespaceCapacity          = "flashsystem_namespace_capacity_bytes"
+	NamespaceUsedCapacity      = "flashsystem_namespace_used_capacity_bytes"
+	NamespaceStoredCapacity    = "flashsystem_namespace_stored_capacity_bytes"
+
+	// Interested keys of lsvdisk and lssevdiskcopy
+	VolumeIdKey               = "id"
+	VolumeNameKey             = "name"
+	VolumeUIDKey              = "vdisk_UID"
+	CopyVolumeIdKey           = "vdisk_id"
+	UsedCapacityKey           = "used_capacity"
+	UncompressedUsedKey       = "uncompressed_used_capacity"
+	VolumeUsedBeforeReduceKey = "used_capacity_before_reduction"
+)
+
+var (
+	pvcLabel = []string{
+		"subsystem_name",
+		"namespace",
+		"persistentvolumeclaim",
+		"persistentvolume",
+		"storageclass",
+		"volume_name",
+		"pool_name",
+	}
+	storageClassCapacityLabel = []string{"subsystem_name", "storageclass"}
+	namespaceLabel            = []string{"subsystem_name", "namespace"}
+
+	volumeMetricsMap = map[string]MetricLabel{
+		PVCCapacity:                {"Provisioned capacity of the volume of the persistent volume (byte)", pvcLabel},
+		PVCUsedCapacity:            {"Capacity written to the volume of the persistent volume (byte)", pvcLabel},
+		PVCStoredCapacity:          {"Capacity the volume of the persistent volume takes in the pool after data reduction (byte)", pvcLabel},
+		StorageClassCapacity:       {"Provisioned capacity of the persistent volumes of the storage class (byte)", storageClassCapacityLabel},
+		StorageClassUsedCapacity:   {"Capacity written to the persistent volumes of the storage class (byte)", storageClassCapacityLabel},
+		StorageClassStoredCapacity: {"Capacity the persistent volumes of the storage class take after data reduction (byte)", storageClassCapacityLabel},
+		NamespaceCapacity:          {"Provisioned capacity of the persistent volume claims of the namespace (byte)", namespaceLabel},
+		NamespaceUsedCapacity:      {"Capacity written to the persistent volume claims of the namespace (byte)", namespaceLabel},
+		NamespaceStoredCapacity:    {"Capacity the persistent volume claims of the namespace take after data reduction (byte)", namespaceLabel},
+	}
+)
+
+// PVInfo is the persistent volume of an array volume, Namespace and Claim are
+// empty once the claim is deleted.
+type PVInfo struct {
+	Name         string
+	Namespace    string
+	Claim        string
+	StorageClass string
+}
+
+type VolumeInfo struct {
+	SystemName string
+	Name       string
+	PoolName   string
+	PV         PVInfo
+}
+
+// VolumeCapacity of a volume, Used is the written capacity and Stored is the
+// capacity allocated in the pool after thin provisioning and data reduction.
+type VolumeCapacity struct {
+	Provisioned float64
+	Used        float64
+	Stored      float64
+}
+
+func (c *VolumeCapacity) add(other VolumeCapacity) {
+	c.Provisioned += other.Provisioned
+	c.Used += other.Used
+	c.Stored += other.Stored
+}
+
+func (f *PerfCollector) initVolumeDescs() {
+	f.volumeDescriptors = make(map[string]*prometheus.Desc)
+
+	for metricName, metricLabel := range volumeMetricsMap {
+		f.volumeDescriptors[metricName] = prometheus.NewDesc(
+			metricName,
+			metricLabel.Name, metricLabel.Labels, nil,
+		)
+	}
+
+	for metricName, metricLabel := range volumePerfMetricsMap {
+		f.volumeDescriptors[metricName] = prometheus.NewDesc(
+			metricName,
+			metricLabel.Name, metricLabel.Labels, nil,
+		)
+	}
+}
+
+// volumeHandleUID returns the volume UID of a CSI volume handle, such as
+// SVC:12;60050768108101C7C0000000000000A2 or SVC:60050768108101C7C0000000000000A2.
+func volumeHandleUID(handle string) string {
+	if i := strings.LastIndexAny(handle, ";:"); i >= 0 {
+		handle = handle[i+1:]
+	}
+	return strings.ToUpper(handle)
+}
+
+// getCSIPersistentVolumes maps the volume UID to the persistent volumes
+// provisioned by the block CSI driver.
+func getCSIPersistentVolumes(ctx context.Context, cluster *clusterResources, mgr *driver.DriverManager) (map[string]PVInfo, error) {
+	pvList, err := cluster.persistentVolumes(ctx, mgr)
+	if err != nil {
+		return nil, err
+	}
+
+	pvs := map[string]PVInfo{}
+	for _, pv := range pvList {
+		csi := pv.Spec.CSI
+		if csi == nil || csi.Driver != driver.CSIProvisioner {
+			continue
+		}
+		pvInfo := PVInfo{Name: pv.Name, StorageClass: pv.Spec.StorageClassName}
+		if claim := pv.Spec.ClaimRef; claim != nil {
+			pvInfo.Namespace = claim.Namespace
+			pvInfo.Claim = claim.Name
+		}
+		pvs[volumeHandleUID(csi.VolumeHandle)] = pvInfo
+	}
+	return pvs, nil
+}
+
+func volumeCapacityValue(volume map[string]string, key string) (float64, error) {
+	value := volume[key]
+	if value == "" {
+		return 0, nil
+	}
+	capacity, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return InvalidVal, fmt.Errorf("get %s failed: %w", key, err)
+	}
+	return capacity, nil
+}
+
+// getVolumeCapacity returns the capacity of a volume, seCopy is its thin
+// provisioned or compressed copy, nil for a fully allocated volume.
+func getVolumeCapacity(volume map[string]string, seCopy map[string]string) (VolumeCapacity, error) {
+	provisioned, err := volumeCapacityValue(volume, CapacityKey)
+	if err != nil {
+		return VolumeCapacity{}, err
+	}
+	if seCopy == nil {
+		return VolumeCapacity{Provisioned: provisioned, Used: provisioned, Stored: provisioned}, nil
+	}
+
+	stored, err := volumeCapacityValue(seCopy, UsedCapacityKey)
+	if err != nil {
+		return VolumeCapacity{}, err
+	}
+	// The written capacity before data reduction, older code levels only know it for compressed copies
+	used := stored
+	for _, key := range []string{VolumeUsedBeforeReduceKey, UncompressedUsedKey} {
+		if seCopy[key] != "" {
+			if used, err = volumeCapacityValue(seCopy, key); err != nil {
+				return VolumeCapacity{}, err
+			}
+			break
+		}
+	}
+	return VolumeCapacity{Provisioned: provisioned, Used: used, Stored: stored}, nil
+}
+
+// getVolumeCopies maps the volume id to its first thin provisioned or compressed copy.
+func getVolumeCopies(copies rest.VolumeCopies) map[string]map[string]string {
+	volumeCopies := map[string]map[string]string{}
+	for _, seCopy := range copies {
+		if _, ok := volumeCopies[seCopy[CopyVolumeIdKey]]; !ok {
+			volumeCopies[seCopy[CopyVolumeIdKey]] = seCopy
+		}
+	}
+	return volumeCopies
+}
+
+// collectVolumeMetrics reports the capacity and performance of the volumes of
+// the persistent volumes, the snapshots of the VolumeSnapshots, the orphaned
+// volumes, and the performance and noisy neighbors of the pools. Other volumes
+// without a persistent volume aren't reported. It returns the volumes and the
+// FlashCopy mappings it listed, for the operations of the pools.
+func (f *PerfCollector) collectVolumeMetrics(ctx context.Context, ch chan<- prometheus.Metric, cluster *clusterResources, fsRestClient *rest.FSRestClient, poolsInfoList []PoolInfo,
+	skipped skippedMetrics) (rest.Volumes, rest.FCMaps) {
+	systemName := fsRestClient.DriverManager.GetSubsystemName()
+	logger := logging.WithSystem(systemName)
+
+	pvs, pvsErr := getCSIPersistentVolumes(ctx, cluster, fsRestClient.DriverManager)
+	if pvsErr != nil {
+		// The pool performance doesn't need the persistent volumes
+		logger.Error(pvsErr, "list persistent volumes failed")
+	}
+	if len(pvs) == 0 && len(poolsInfoList) == 0 {
+		return nil, nil
+	}
+
+	volumes, err := fsRestClient.Lsvdisk(ctx)
+	if err != nil {
+		if !skipped.permissionDenied(err) {
+			logger.Error(err, "get volumes failed")
+		}
+		return nil, nil
+	}
+
+	var pvVolumes rest.Volumes
+	volumeInfos := map[string]VolumeInfo{}
+	for _, volume := range volumes {
+		pv, ok := pvs[strings.ToUpper(volume[VolumeUIDKey])]
+		if !ok {
+			continue
+		}
+		pvVolumes = append(pvVolumes, volume)
+		volumeInfos[volume[VolumeIdKey]] = VolumeInfo{
+			SystemName: systemName,
+			Name:       volume[VolumeNameKey],
+			PoolName:   volume[MdiskGroupNameKey],
+			PV:         pv,
+		}
+	}
+
+	// The snapshots are only listed if they can be mapped to the VolumeSnapshotContents
+	var snapshots rest.VolumeSnapshots
+	contents := getSnapshotContents(ctx, cluster, fsRestClient.DriverManager)
+	if contents != nil {
+		snapshots = getVolumeSnapshots(ctx, fsRestClient, skipped)
+	}
+
+	var volumeCopies map[string]map[string]string
+	pvcCapacityEnabled := len(pvVolumes) > 0 && !skipped.has(PVCCapacity)
+	if pvcCapacityEnabled || contents.len() > 0 {
+		copies, err := fsRestClient.Lssevdiskcopy(ctx)
+		if err != nil {
+			if !skipped.permissionDenied(err) {
+				logger.Error(err, "get volume copies failed")
+			}
+		} else {
+			volumeCopies = getVolumeCopies(copies)
+		}
+	}
+
+	if pvcCapacityEnabled && volumeCopies != nil {
+		f.collectVolumeCapacityMetrics(ch, systemName, pvVolumes, volumeInfos, volumeCopies)
+	}
+	// The mappings are the FlashCopy snapshots, and the background copies of the pools
+	var fcmaps rest.FCMaps
+	if contents.len() > 0 || len(poolsInfoList) > 0 {
+		fcmaps = getFCMaps(ctx, fsRestClient, skipped)
+	}
+	if pvsErr == nil {
+		f.collectOrphanMetrics(ctx, ch, cluster, fsRestClient, volumes, snapshots, fcmaps, pvs, contents, poolsInfoList)
+	}
+	if contents.len() > 0 {
+		f.collectSnapshotMetrics(ch, systemName, volumes, snapshots, fcmaps, contents, volumeCopies)
+	}
+
+	pvcPerfEnabled := VolumeStats().Enabled && len(pvVolumes) > 0
+	if !pvcPerfEnabled && len(poolsInfoList) == 0 {
+		return volumes, fcmaps
+	}
+	volumesPerf := f.getVolumePerf(ctx, fsRestClient, skipped)
+	if volumesPerf == nil {
+		return volumes, fcmaps
+	}
+	if pvcPerfEnabled {
+		f.createVolumePerfMetrics(ch, volumesPerf, volumeInfos)
+	}
+	var copies copyPools
+	if len(poolsInfoList) > 0 && len(volumesPerf) > 0 {
+		copies = getCopyPools(ctx, fsRestClient, volumes, skipped)
+	}
+	f.createPoolPerfMetrics(ch, systemName, volumes, volumesPerf, copies, poolsInfoList)
+	f.createNoisyNeighborMetrics(ch, systemName, volumes, volumesPerf, copies, volumeInfos, poolsInfoList)
+	return volumes, fcmaps
+}
+
+// collectVolumeCapacityMetrics reports the capacity of the volumes, and sums it
+// up per storage class and namespace.
+func (f *PerfCollector) collectVolumeCapacityMetrics(ch chan<- prometheus.Metric, systemName string, volumes rest.Volumes,
+	volumeInfos map[string]VolumeInfo, volumeCopies map[string]map[string]string) {
+	logger := logging.WithSystem(systemName)
+
+	storageClasses := map[string]*VolumeCapacity{}
+	namespaces := map[string]*VolumeCapacity{}
+	for _, volume := range volumes {
+		volumeInfo := volumeInfos[volume[VolumeIdKey]]
+		capacity, err := getVolumeCapacity(volume, volumeCopies[volume[VolumeIdKey]])
+		if err != nil {
+			logger.Error(err, "get volume capacity failed", "volume", volumeInfo.Name)
+			continue
+		}
+		newPVCMetrics(ch, f.volumeDescriptors[PVCCapacity], capacity.Provisioned, &volumeInfo)
+		newPVCMetrics(ch, f.volumeDescriptors[PVCUsedCapacity], capacity.Used, &volumeInfo)
+		newPVCMetrics(ch, f.volumeDescriptors[PVCStoredCapacity], capacity.Stored, &volumeInfo)
+
+		addVolumeCapacity(storageClasses, volumeInfo.PV.StorageClass, capacity)
+		addVolumeCapacity(namespaces, volumeInfo.PV.Namespace, capacity)
+	}
+
+	f.newVolumeRollupMetrics(ch, systemName, storageClasses, StorageClassCapacity, StorageClassUsedCapacity, StorageClassStoredCapacity)
+	f.newVolumeRollupMetrics(ch, systemName, namespaces, NamespaceCapacity, NamespaceUsedCapacity, NamespaceStoredCapacity)
+}
+
+// addVolumeCapacity sums up the capacity per storage class or namespace, the
+// volumes without one are left out.
+func addVolumeCapacity(rollup map[string]*VolumeCapacity, name string, capacity VolumeCapacity) {
+	if name == "" {
+		return
+	}
+	total, ok := rollup[name]
+	if !ok {
+		total = &VolumeCapacity{}
+		rollup[name] = total
+	}
+	total.add(capacity)
+}
+
+func (f *PerfCollector) newVolumeRollupMetrics(ch chan<- prometheus.Metric, systemName string, rollup map[string]*VolumeCapacity,
+	provisionedMetric string, usedMetric string, storedMetric string) {
+	var names []string
+	for name := range rollup {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		capacity := rollup[name]
+		ch <- prometheus.MustNewConstMetric(f.volumeDescriptors[provisionedMetric], prometheus.GaugeValue, capacity.Provisioned, systemName, name)
+		ch <- prometheus.MustNewConstMetric(f.volumeDescriptors[usedMetric], prometheus.GaugeValue, capacity.Used, systemName, name)
+		ch <- prometheus.MustNewConstMetric(f.volumeDescriptors[storedMetric], prometheus.GaugeValue, capacity.Stored, systemName, name)
+	}
+}
+
+func newPVCMetrics(ch chan<- prometheus.Metric, desc *prometheus.Desc, value float64, info *VolumeInfo) {
+	ch <- prometheus.MustNewConstMetric(
+		desc,
+		prometheus.GaugeValue,
+		value,
+		info.SystemName,
+		info.PV.Namespace,
+		info.PV.Claim,
+		info.PV.Name,
+		info.PV.StorageClass,
+		info.Name,
+		info.PoolName,
+	)
+}
@@ -0,0 +1,149 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collectors
+
+import (
+	"context"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/config"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/iostats"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/logging"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/rest"
+)
+
+const (
+	// Metric name shown outside
+	PVCReadIOPS     = "flashsystem_pvc_rd_iops"
+	PVCWriteIOPS    = "flashsystem_pvc_wr_iops"
+	PVCReadBytes    = "flashsystem_pvc_rd_bytes"
+	PVCWriteBytes   = "flashsystem_pvc_wr_bytes"
+	PVCReadLatency  = "flashsystem_pvc_rd_latency_seconds"
+	PVCWriteLatency = "flashsystem_pvc_wr_latency_seconds"
+)
+
+var (
+	volumePerfMetricsMap = map[string]MetricLabel{
+		PVCReadIOPS:     {"volume performance - read IOPS", pvcLabel},
+		PVCWriteIOPS:    {"volume performance - write IOPS", pvcLabel},
+		PVCReadBytes:    {"volume performance - read throughput bytes/s", pvcLabel},
+		PVCWriteBytes:   {"volume performance - write throughput bytes/s", pvcLabel},
+		PVCReadLatency:  {"volume performance - read latency seconds", pvcLabel},
+		PVCWriteLatency: {"volume performance - write latency seconds", pvcLabel},
+	}
+)
+
+// VolumeStats limits the volume performance metrics, for easy mock
+var VolumeStats = func() config.VolumeStatsConfig {
+	return config.Get().VolumeStats
+}
+
+type pvcPerf struct {
+	info VolumeInfo
+	perf *iostats.IOPerf
+}
+
+// volumeStatsTracker returns the statistics files of the system, kept between scrapes.
+func (f *PerfCollector) volumeStatsTracker(systemName string) *iostats.Tracker {
+	f.volumeStatsLock.Lock()
+	defer f.volumeStatsLock.Unlock()
+
+	if f.volumeStats == nil {
+		f.volumeStats = map[string]*iostats.Tracker{}
+	}
+	tracker, ok := f.volumeStats[systemName]
+	if !ok {
+		tracker = iostats.NewTracker(iostats.VolumeFilePrefix)
+		f.volumeStats[systemName] = tracker
+	}
+	return tracker
+}
+
+// selectVolumePerf keeps the volumes of the allowed namespaces, and the TopN
+// volumes with the most IOPS of them.
+func selectVolumePerf(perfs []pvcPerf, cfg config.VolumeStatsConfig) []pvcPerf {
+	selected := perfs
+	if len(cfg.Namespaces) > 0 {
+		allowed := map[string]bool{}
+		for _, namespace := range cfg.Namespaces {
+			allowed[namespace] = true
+		}
+		selected = nil
+		for _, perf := range perfs {
+			if allowed[perf.info.PV.Namespace] {
+				selected = append(selected, perf)
+			}
+		}
+	}
+
+	sort.Slice(selected, func(i, j int) bool {
+		a, b := selected[i].perf, selected[j].perf
+		if a.TotalIOPS() != b.TotalIOPS() {
+			return a.TotalIOPS() > b.TotalIOPS()
+		}
+		if a.TotalBytes() != b.TotalBytes() {
+			return a.TotalBytes() > b.TotalBytes()
+		}
+		return selected[i].info.Name < selected[j].info.Name
+	})
+	if cfg.TopN > 0 && len(selected) > cfg.TopN {
+		selected = selected[:cfg.TopN]
+	}
+	return selected
+}
+
+// getVolumePerf returns the performance of the volumes over the last
+// statistics interval keyed by the volume id, from the volume statistics files
+// of the nodes. It returns nil if the files can't be read.
+func (f *PerfCollector) getVolumePerf(ctx context.Context, fsRestClient *rest.FSRestClient, skipped skippedMetrics) map[string]*iostats.IOPerf {
+	logger := logging.WithSystem(fsRestClient.DriverManager.GetSubsystemName())
+
+	tracker := f.volumeStatsTracker(fsRestClient.DriverManager.GetSubsystemName())
+	if err := tracker.Update(ctx, fsRestClient); err != nil {
+		if !skipped.permissionDenied(err) {
+			logger.Error(err, "get volume statistics failed")
+		}
+		return nil
+	}
+	volumesPerf, err := tracker.Volumes()
+	if err != nil {
+		logger.Error(err, "get volume performance failed")
+		return nil
+	}
+	return volumesPerf
+}
+
+func (f *PerfCollector) createVolumePerfMetrics(ch chan<- prometheus.Metric, volumesPerf map[string]*iostats.IOPerf,
+	volumeInfos map[string]VolumeInfo) {
+	var perfs []pvcPerf
+	for id, perf := range volumesPerf {
+		if info, ok := volumeInfos[id]; ok {
+			perfs = append(perfs, pvcPerf{info: info, perf: perf})
+		}
+	}
+
+	for _, perf := range selectVolumePerf(perfs, VolumeStats()) {
+		newPVCMetrics(ch, f.volumeDescriptors[PVCReadIOPS], perf.perf.ReadIOPS, &perf.info)
+		newPVCMetrics(ch, f.volumeDescriptors[PVCWriteIOPS], perf.perf.WriteIOPS, &perf.info)
+		newPVCMetrics(ch, f.volumeDescriptors[PVCReadBytes], perf.perf.ReadBytes, &perf.info)
+		newPVCMetrics(ch, f.volumeDescriptors[PVCWriteBytes], perf.perf.WriteBytes, &perf.info)
+		newPVCMetrics(ch, f.volumeDescriptors[PVCReadLatency], perf.perf.ReadLatency, &perf.info)
+		newPVCMetrics(ch, f.volumeDescriptors[PVCWriteLatency], perf.perf.WriteLatency, &perf.info)
+	}
+}
@@ -0,0 +1,285 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/logging"
+)
+
+const (
+	DefaultConfigFile           = "/etc/ibm-storage-odf-block-driver/config.yaml"
+	DefaultPort                 = 9100
+	DefaultRestPort             = 7443
+	DefaultHTTPTimeout          = time.Second * 15
+	DefaultFailedEventThreshold = time.Minute * 2 // 2 minutes
+	DefaultRetryCount           = 2
+	DefaultMinimumVersion       = "8.3.1"
+	DefaultTracingSampleRatio   = 1.0
+	DefaultVolumeStatsTopN      = 100
+	DefaultVolumeStatsPoolTopN  = 5
+
+	// How often the mounted config file is checked for changes
+	ReloadInterval = time.Second * 10
+)
+
+// Trace exporters
+const (
+	TracingExporterNone   = "none"
+	TracingExporterOTLP   = "otlp"
+	TracingExporterStdout = "stdout"
+)
+
+var versionPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+){0,3}$`)
+
+// ExporterConfig is the runtime configuration of the exporter. It is read from
+// the mounted ConfigMap file, command line flags override the file values.
+type ExporterConfig struct {
+	Port                 int               `json:"port"`
+	RestPort             int               `json:"restPort"`
+	HTTPTimeout          metav1.Duration   `json:"httpTimeout"`
+	FailedEventThreshold metav1.Duration   `json:"failedEventThreshold"`
+	RetryCount           int               `json:"retryCount"`
+	MinimumVersion       string            `json:"minimumVersion"`
+	InventoryMode        bool              `json:"inventoryMode"`
+	VolumeStats          VolumeStatsConfig `json:"volumeStats"`
+	Tracing              TracingConfig     `json:"tracing"`
+}
+
+// VolumeStatsConfig limits the per volume performance metrics. Only the
+// volumes of the namespaces are exported if Namespaces isn't empty, and only
+// the TopN busiest volumes if TopN isn't 0. PoolTopN is the number of
+// volumes of the noisy neighbor report of each pool, 0 disables the report.
+type VolumeStatsConfig struct {
+	Enabled    bool     `json:"enabled"`
+	Namespaces []string `json:"namespaces"`
+	TopN       int      `json:"topN"`
+	PoolTopN   int      `json:"poolTopN"`
+}
+
+// TracingConfig selects where the OpenTelemetry spans are exported. The OTLP
+// endpoint falls back to the OTEL_EXPORTER_OTLP_ENDPOINT environment variable.
+type TracingConfig struct {
+	Exporter    string  `json:"exporter"`
+	Endpoint    string  `json:"endpoint"`
+	Insecure    bool    `json:"insecure"`
+	SampleRatio float64 `json:"sampleRatio"`
+}
+
+type ChangeHandler func(oldConfig, newConfig ExporterConfig)
+
+var (
+	lock     sync.RWMutex
+	current  = Default()
+	handlers []ChangeHandler
+
+	configFile  = DefaultConfigFile
+	lastContent []byte
+)
+
+func Default() ExporterConfig {
+	return ExporterConfig{
+		Port:                 DefaultPort,
+		RestPort:             DefaultRestPort,
+		HTTPTimeout:          metav1.Duration{Duration: DefaultHTTPTimeout},
+		FailedEventThreshold: metav1.Duration{Duration: DefaultFailedEventThreshold},
+		RetryCount:           DefaultRetryCount,
+		MinimumVersion:       DefaultMinimumVersion,
+		VolumeStats: VolumeStatsConfig{
+			TopN:     DefaultVolumeStatsTopN,
+			PoolTopN: DefaultVolumeStatsPoolTopN,
+		},
+		Tracing: TracingConfig{
+			Exporter:    TracingExporterNone,
+			SampleRatio: DefaultTracingSampleRatio,
+		},
+	}
+}
+
+func (c ExporterConfig) Validate() error {
+	var errs []string
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Sprintf("port %d is out of range", c.Port))
+	}
+	if c.RestPort < 1 || c.RestPort > 65535 {
+		errs = append(errs, fmt.Sprintf("restPort %d is out of range", c.RestPort))
+	}
+	if c.HTTPTimeout.Duration <= 0 {
+		errs = append(errs, fmt.Sprintf("httpTimeout must be positive, got %s", c.HTTPTimeout.Duration))
+	}
+	if c.FailedEventThreshold.Duration <= 0 {
+		errs = append(errs, fmt.Sprintf("failedEventThreshold must be positive, got %s", c.FailedEventThreshold.Duration))
+	}
+	if c.RetryCount < 1 {
+		errs = append(errs, fmt.Sprintf("retryCount must be at least 1, got %d", c.RetryCount))
+	}
+	if !versionPattern.MatchString(c.MinimumVersion) {
+		errs = append(errs, fmt.Sprintf("minimumVersion %q isn't a valid code level", c.MinimumVersion))
+	}
+	if c.VolumeStats.TopN < 0 {
+		errs = append(errs, fmt.Sprintf("volumeStats topN must not be negative, got %d", c.VolumeStats.TopN))
+	}
+	if c.VolumeStats.PoolTopN < 0 {
+		errs = append(errs, fmt.Sprintf("volumeStats poolTopN must not be negative, got %d", c.VolumeStats.PoolTopN))
+	}
+	switch c.Tracing.Exporter {
+	case TracingExporterNone, TracingExporterOTLP, TracingExporterStdout:
+	default:
+		errs = append(errs, fmt.Sprintf("tracing exporter %q isn't supported", c.Tracing.Exporter))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, fmt.Sprintf("tracing sampleRatio must be between 0 and 1, got %v", c.Tracing.SampleRatio))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Get returns the effective configuration. Defaults are returned before Init.
+func Get() ExporterConfig {
+	lock.RLock()
+	defer lock.RUnlock()
+	return current
+}
+
+// OnChange registers a handler which is called after a reload changed the configuration.
+func OnChange(handler ChangeHandler) {
+	lock.Lock()
+	defer lock.Unlock()
+	handlers = append(handlers, handler)
+}
+
+// Init loads the configuration file and flags for the first time.
+func Init() error {
+	content, err := readConfigFile(configFile)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := build(content)
+	if err != nil {
+		return err
+	}
+
+	lock.Lock()
+	current = cfg
+	lastContent = content
+	lock.Unlock()
+
+	logging.Info("Effective exporter config", "config", cfg.String())
+	return nil
+}
+
+// Watch polls the configuration file and applies changes until stopCh is closed.
+// A mounted ConfigMap is updated in place by kubelet, so no restart is needed.
+func Watch(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			if err := reload(); err != nil {
+				logging.Error(err, "Reload exporter config failed, keep the current config")
+			}
+		}
+	}
+}
+
+func reload() error {
+	content, err := readConfigFile(configFile)
+	if err != nil {
+		return err
+	}
+
+	lock.RLock()
+	unchanged := string(content) == string(lastContent)
+	lock.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	cfg, err := build(content)
+	if err != nil {
+		return err
+	}
+
+	lock.Lock()
+	oldCfg := current
+	current = cfg
+	lastContent = content
+	changeHandlers := append([]ChangeHandler{}, handlers...)
+	lock.Unlock()
+
+	logging.Info("Exporter config reloaded", "config", cfg.String())
+	if !reflect.DeepEqual(oldCfg, cfg) {
+		for _, handler := range changeHandlers {
+			handler(oldCfg, cfg)
+		}
+	}
+	return nil
+}
+
+func build(content []byte) (ExporterConfig, error) {
+	cfg := Default()
+	if len(content) > 0 {
+		if err := yaml.UnmarshalStrict(content, &cfg); err != nil {
+			return ExporterConfig{}, fmt.Errorf("parse config file %s failed: %v", configFile, err)
+		}
+	}
+	applyFlags(&cfg)
+
+	if err := cfg.Validate(); err != nil {
+		return ExporterConfig{}, fmt.Errorf("invalid exporter config: %v", err)
+	}
+	return cfg, nil
+}
+
+// A missing file isn't an error, the ConfigMap is optional.
+func readConfigFile(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return content, nil
+}
+
+func (c ExporterConfig) String() string {
+	return fmt.Sprintf("port=%d restPort=%d httpTimeout=%s failedEventThreshold=%s retryCount=%d minimumVersion=%s "+
+		"inventoryMode=%t volumeStats.enabled=%t volumeStats.namespaces=%s volumeStats.topN=%d volumeStats.poolTopN=%d tracing.exporter=%s tracing.endpoint=%s tracing.sampleRatio=%v",
+		c.Port, c.RestPort, c.HTTPTimeout.Duration, c.FailedEventThreshold.Duration, c.RetryCount, c.MinimumVersion,
+		c.InventoryMode, c.VolumeStats.Enabled, strings.Join(c.VolumeStats.Namespaces, ","), c.VolumeStats.TopN, c.VolumeStats.PoolTopN, c.Tracing.Exporter, c.Tracing.Endpoint, c.Tracing.SampleRatio)
+}
@@ -0,0 +1,145 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("write config file failed: %v", err)
+	}
+	return path
+}
+
+func TestInit(t *testing.T) {
+	t.Run("missing file uses defaults", func(t *testing.T) {
+		configFile = filepath.Join(t.TempDir(), "not-exist.yaml")
+		if err := Init(); err != nil {
+			t.Fatalf("Init should not fail for missing file: %v", err)
+		}
+		if !reflect.DeepEqual(Get(), Default()) {
+			t.Errorf("expected default config, got %s", Get())
+		}
+	})
+
+	t.Run("file overrides defaults", func(t *testing.T) {
+		configFile = writeConfigFile(t, "port: 9200\nhttpTimeout: 30s\nminimumVersion: 8.4.0\n")
+		if err := Init(); err != nil {
+			t.Fatalf("Init failed: %v", err)
+		}
+		cfg := Get()
+		if cfg.Port != 9200 || cfg.HTTPTimeout.Duration != 30*time.Second || cfg.MinimumVersion != "8.4.0" {
+			t.Errorf("unexpected config %s", cfg)
+		}
+		if cfg.RestPort != DefaultRestPort || cfg.RetryCount != DefaultRetryCount {
+			t.Errorf("unset values should keep defaults, got %s", cfg)
+		}
+	})
+
+	t.Run("volume stats keep unset defaults", func(t *testing.T) {
+		configFile = writeConfigFile(t, "volumeStats:\n  namespaces: [app, db]\n")
+		if err := Init(); err != nil {
+			t.Fatalf("Init failed: %v", err)
+		}
+		volumeStats := Get().VolumeStats
+		if volumeStats.Enabled || volumeStats.TopN != DefaultVolumeStatsTopN || volumeStats.PoolTopN != DefaultVolumeStatsPoolTopN ||
+			!reflect.DeepEqual(volumeStats.Namespaces, []string{"app", "db"}) {
+			t.Errorf("unexpected volume stats config %+v", volumeStats)
+		}
+	})
+
+	t.Run("invalid file is rejected", func(t *testing.T) {
+		configFile = writeConfigFile(t, "port: 0\nretryCount: 0\n")
+		if err := Init(); err == nil {
+			t.Errorf("Init should fail for invalid config")
+		}
+	})
+
+	t.Run("unknown field is rejected", func(t *testing.T) {
+		configFile = writeConfigFile(t, "prot: 9200\n")
+		if err := Init(); err == nil {
+			t.Errorf("Init should fail for unknown field")
+		}
+	})
+}
+
+func TestFlagsOverrideFile(t *testing.T) {
+	defer func() { flagSet = nil }()
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	BindFlags(fs)
+	path := writeConfigFile(t, "port: 9200\nrestPort: 8443\n")
+	if err := fs.Parse([]string{"--config-file", path, "--port", "9300"}); err != nil {
+		t.Fatalf("parse flags failed: %v", err)
+	}
+
+	if err := Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	cfg := Get()
+	if cfg.Port != 9300 {
+		t.Errorf("flag should override file port, got %d", cfg.Port)
+	}
+	if cfg.RestPort != 8443 {
+		t.Errorf("file rest port should be kept, got %d", cfg.RestPort)
+	}
+}
+
+func TestReload(t *testing.T) {
+	configFile = writeConfigFile(t, "port: 9200\n")
+	if err := Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	var changed []ExporterConfig
+	handlers = nil
+	OnChange(func(oldConfig, newConfig ExporterConfig) {
+		changed = append(changed, newConfig)
+	})
+
+	if err := reload(); err != nil || len(changed) != 0 {
+		t.Fatalf("unchanged file should not notify, err: %v", err)
+	}
+
+	if err := os.WriteFile(configFile, []byte("port: 9200\nretryCount: 3\n"), 0600); err != nil {
+		t.Fatalf("write config file failed: %v", err)
+	}
+	if err := reload(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if len(changed) != 1 || changed[0].RetryCount != 3 || Get().RetryCount != 3 {
+		t.Errorf("reload should apply the new retry count, got %s", Get())
+	}
+
+	if err := os.WriteFile(configFile, []byte("retryCount: -1\n"), 0600); err != nil {
+		t.Fatalf("write config file failed: %v", err)
+	}
+	if err := reload(); err == nil {
+		t.Errorf("reload should fail for invalid config")
+	}
+	if Get().RetryCount != 3 {
+		t.Errorf("invalid config should keep the current config, got %s", Get())
+	}
+}
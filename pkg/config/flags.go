@@ -0,0 +1,99 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"flag"
+)
+
+// Flag names
+const (
+	FlagConfigFile           = "config-file"
+	FlagPort                 = "port"
+	FlagRestPort             = "rest-port"
+	FlagHTTPTimeout          = "http-timeout"
+	FlagFailedEventThreshold = "failed-event-threshold"
+	FlagRetryCount           = "retry-count"
+	FlagMinimumVersion       = "minimum-version"
+	FlagInventoryMode        = "inventory-mode"
+	FlagVolumeStats          = "volume-stats"
+	FlagVolumeStatsTopN      = "volume-stats-top-n"
+	FlagVolumeStatsPoolTopN  = "volume-stats-pool-top-n"
+	FlagTracingExporter      = "tracing-exporter"
+	FlagTracingEndpoint      = "tracing-endpoint"
+)
+
+var (
+	flagSet    *flag.FlagSet
+	flagValues = Default()
+)
+
+// BindFlags registers the config flags. Only the flags set explicitly on the
+// command line override the values of the config file.
+func BindFlags(fs *flag.FlagSet) {
+	flagSet = fs
+	fs.StringVar(&configFile, FlagConfigFile, DefaultConfigFile, "Path of the exporter config file, usually mounted from a ConfigMap")
+	fs.IntVar(&flagValues.Port, FlagPort, DefaultPort, "Port of the metrics http server")
+	fs.IntVar(&flagValues.RestPort, FlagRestPort, DefaultRestPort, "Port of the flash system rest server")
+	fs.DurationVar(&flagValues.HTTPTimeout.Duration, FlagHTTPTimeout, DefaultHTTPTimeout, "Timeout of the requests to the flash system rest server")
+	fs.DurationVar(&flagValues.FailedEventThreshold.Duration, FlagFailedEventThreshold, DefaultFailedEventThreshold,
+		"How long authentication keeps failing before a warning event is sent")
+	fs.IntVar(&flagValues.RetryCount, FlagRetryCount, DefaultRetryCount, "Number of attempts of a flash system rest request")
+	fs.StringVar(&flagValues.MinimumVersion, FlagMinimumVersion, DefaultMinimumVersion, "Minimum supported flash system code level")
+	fs.BoolVar(&flagValues.InventoryMode, FlagInventoryMode, false, "Export the metrics of all pools, not only the pools used by storage classes")
+	fs.BoolVar(&flagValues.VolumeStats.Enabled, FlagVolumeStats, false, "Export the performance of the volumes of the persistent volumes")
+	fs.IntVar(&flagValues.VolumeStats.TopN, FlagVolumeStatsTopN, DefaultVolumeStatsTopN, "Maximum number of volumes with performance metrics, 0 for no limit")
+	fs.IntVar(&flagValues.VolumeStats.PoolTopN, FlagVolumeStatsPoolTopN, DefaultVolumeStatsPoolTopN,
+		"Number of volumes of the noisy neighbor report of each pool, 0 disables the report")
+	fs.StringVar(&flagValues.Tracing.Exporter, FlagTracingExporter, TracingExporterNone, "Trace exporter, none, otlp or stdout")
+	fs.StringVar(&flagValues.Tracing.Endpoint, FlagTracingEndpoint, "", "OTLP http endpoint (host:port) of the trace collector")
+}
+
+func applyFlags(cfg *ExporterConfig) {
+	if flagSet == nil || !flagSet.Parsed() {
+		return
+	}
+
+	flagSet.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case FlagPort:
+			cfg.Port = flagValues.Port
+		case FlagRestPort:
+			cfg.RestPort = flagValues.RestPort
+		case FlagHTTPTimeout:
+			cfg.HTTPTimeout = flagValues.HTTPTimeout
+		case FlagFailedEventThreshold:
+			cfg.FailedEventThreshold = flagValues.FailedEventThreshold
+		case FlagRetryCount:
+			cfg.RetryCount = flagValues.RetryCount
+		case FlagMinimumVersion:
+			cfg.MinimumVersion = flagValues.MinimumVersion
+		case FlagInventoryMode:
+			cfg.InventoryMode = flagValues.InventoryMode
+		case FlagVolumeStats:
+			cfg.VolumeStats.Enabled = flagValues.VolumeStats.Enabled
+		case FlagVolumeStatsTopN:
+			cfg.VolumeStats.TopN = flagValues.VolumeStats.TopN
+		case FlagVolumeStatsPoolTopN:
+			cfg.VolumeStats.PoolTopN = flagValues.VolumeStats.PoolTopN
+		case FlagTracingExporter:
+			cfg.Tracing.Exporter = flagValues.Tracing.Exporter
+		case FlagTracingEndpoint:
+			cfg.Tracing.Endpoint = flagValues.Tracing.Endpoint
+		}
+	})
+}
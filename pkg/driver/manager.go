@@ -20,43 +20,86 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"sync"
 	"time"
 
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
-	log "k8s.io/klog"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/logging"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/tracing"
 	operatorapi "github.com/IBM/ibm-storage-odf-operator/api/v1alpha1"
 	conditionutil "github.com/IBM/ibm-storage-odf-operator/controllers/util"
 	operutil "github.com/IBM/ibm-storage-odf-operator/controllers/util"
 )
 
+// Warning conditions, true while the problem lasts
+const (
+	MetricsIncomplete   operatorapi.ConditionType = "MetricsIncomplete"
+	SiteLost            operatorapi.ConditionType = "SiteLost"
+	PoolNotFound        operatorapi.ConditionType = "PoolNotFound"
+	StorageClassInvalid operatorapi.ConditionType = "StorageClassInvalid"
+)
+
 // Reason
 const (
-	AuthFailure        = "AuthFailure"
-	AuthSuccess        = "AuthSuccess"
-	VersionCheckFailed = "VersionCheckFailed"
-	RoleCheckFailed    = "RoleCheckFailed"
-	RestFailure        = "RestFailure"
-	ClusterNotOnline   = "ClusterNotOnline"
+	AuthFailure         = "AuthFailure"
+	AuthSuccess         = "AuthSuccess"
+	VersionCheckFailed  = "VersionCheckFailed"
+	RoleCheckFailed     = "RoleCheckFailed"
+	RestFailure         = "RestFailure"
+	ClusterNotOnline    = "ClusterNotOnline"
+	PermissionDenied    = "PermissionDenied"
+	MetricsComplete     = "MetricsComplete"
+	SiteOffline         = "SiteOffline"
+	SitesOnline         = "SitesOnline"
+	PoolMissing         = "PoolMissing"
+	PoolsFound          = "PoolsFound"
+	ParameterMismatch   = "ParameterMismatch"
+	StorageClassesValid = "StorageClassesValid"
 )
 
 // Message
 const (
 	AuthFailureMessage     = "Authentication to flash system rest server failed"
 	AuthSuccessMessage     = "Authentication to flash system rest server succeed"
-	VersionCheckErrMessage = "Flash system code level too low, need >= 8.3.1"
-	RoleCheckErrMessage    = "User role need to be Administrator, SecurityAdmin or RestrictedAdmin"
+	VersionCheckErrMessage = "Flash system code level too low, need >= %s"
+	RoleCheckErrMessage    = "User role need to be Monitor, Administrator, SecurityAdmin or RestrictedAdmin"
 	RestErrorMessage       = "Rest server hit unexpected error"
 	ClusterErrMessage      = "Flash system cluster is not online"
 	ExporterReadyMessage   = "Flash system exporter is ready"
+
+	PermissionDeniedMessage    = "User role %s isn't permitted to run %s, the metrics which need them are skipped"
+	MetricsCompleteMessage     = "All metrics are collected"
+	SiteOfflineMessage         = "Site %s has no online node, IO continues on the remaining site"
+	SitesOnlineMessage         = "All sites have online nodes"
+	PoolMissingMessage         = "Pools used by storage classes aren't found: %s"
+	PoolsFoundMessage          = "All pools used by storage classes are found"
+	ParameterMismatchMessage   = "Storage class parameters don't match the pool: %s"
+	StorageClassesValidMessage = "All storage class parameters match their pools"
 )
 
 const INIT_POOL_ID = -1
 
+// Provisioner of the storage classes in the pool map
+const CSIProvisioner = "block.csi.ibm.com"
+
+// VolumeSnapshotContentListKind is read unstructured, the snapshot CRDs aren't in the scheme
+var VolumeSnapshotContentListKind = schema.GroupVersionKind{
+	Group:   "snapshot.storage.k8s.io",
+	Version: "v1",
+	Kind:    "VolumeSnapshotContentList",
+}
+
 var K8SClient client.Client = nil
 
 type DriverManager struct {
@@ -66,14 +109,21 @@ type DriverManager struct {
 	ready      bool
 	scPoolMap  map[string]string
 	secretName string
+
+	// Last reason and message of the warning conditions, to skip unchanged
+	// updates. Guarded by warningsLock, the scrapes may run concurrently.
+	warnings map[operatorapi.ConditionType]string
 }
 
+// warningsLock guards the warnings of all managers, the managers are copied by value
+var warningsLock sync.Mutex
+
 func NewManager(scheme *runtime.Scheme, namespace string, fscName string, fscScSecretMap operutil.FlashSystemClusterMapContent) (DriverManager, error) {
 	var manager DriverManager
 
 	k8sClient, err := getK8sClient(scheme)
 	if err != nil {
-		log.Errorf("fail to create k8s client, error: %v", err)
+		logging.Error(err, "fail to create k8s client", logging.SystemKey, fscName)
 		return DriverManager{}, err
 	}
 
@@ -82,6 +132,7 @@ func NewManager(scheme *runtime.Scheme, namespace string, fscName string, fscScS
 	manager.namespace = namespace
 	manager.scPoolMap = fscScSecretMap.ScPoolMap
 	manager.secretName = fscScSecretMap.Secret
+	manager.warnings = map[operatorapi.ConditionType]string{}
 	manager.Ready()
 
 	return manager, nil
@@ -96,6 +147,11 @@ func (d *DriverManager) GetClient() client.Client {
 	return d.Client
 }
 
+// Logger returns a logger with the flash system name on every line.
+func (d *DriverManager) Logger() logr.Logger {
+	return logging.WithSystem(d.SystemName)
+}
+
 func (d *DriverManager) GetSubsystemName() string {
 	// CR Name is the subsystem name
 	return d.SystemName
@@ -128,6 +184,15 @@ func (d *DriverManager) UpdatePoolMap(scPool map[string]string) {
 	}
 }
 
+// GetSCPoolMap returns a copy of the storage class to pool map.
+func (d *DriverManager) GetSCPoolMap() map[string]string {
+	scPool := make(map[string]string, len(d.scPoolMap))
+	for sc, pool := range d.scPoolMap {
+		scPool[sc] = pool
+	}
+	return scPool
+}
+
 func (d *DriverManager) GetPoolNames() map[string]int {
 	poolNames := map[string]int{}
 	for _, pool := range d.scPoolMap {
@@ -137,19 +202,28 @@ func (d *DriverManager) GetPoolNames() map[string]int {
 	return poolNames
 }
 
-func (d *DriverManager) UpdateCondition(conditionType operatorapi.ConditionType, ready bool, reason string, message string) error {
+func (d *DriverManager) UpdateCondition(ctx context.Context, conditionType operatorapi.ConditionType, ready bool, reason string, message string) error {
 	k8sclient := d.Client
 
-	fscluster, err := d.GetFlashSystemClusterCR()
+	ctx, span := tracing.Start(ctx, "UpdateCondition", trace.WithAttributes(
+		attribute.String(tracing.SystemKey, d.SystemName),
+		attribute.String(tracing.ConditionKey, string(conditionType)),
+		attribute.Bool("ready", ready),
+	))
+	defer span.End()
+
+	fscluster, err := d.GetFlashSystemClusterCR(ctx)
 	if err != nil {
-		log.Errorf("Get flash system CR failed: %v", err)
+		d.Logger().Error(err, "Get flash system CR failed")
+		tracing.RecordError(span, err)
 		return err
 	}
 
 	isStatusUpdated := (ready && conditionutil.IsStatusConditionTrue(fscluster.Status.Conditions, conditionType)) ||
 		(!ready && conditionutil.IsStatusConditionFalse(fscluster.Status.Conditions, conditionType))
 	if isStatusUpdated {
-		log.Infof("existing FlashSystemCluster status is expected with no change")
+		d.Logger().V(logging.ScrapeLevel).Info("existing FlashSystemCluster status is expected with no change", "condition", conditionType)
+		span.SetAttributes(attribute.Bool("updated", false))
 		return nil
 	}
 
@@ -162,10 +236,10 @@ func (d *DriverManager) UpdateCondition(conditionType operatorapi.ConditionType,
 			Message: message,
 		})
 		if operatorapi.ExporterReady == conditionType {
-			_ = d.SendK8sEvent(corev1.EventTypeNormal, fmt.Sprintf("%v", conditionType), ExporterReadyMessage)
+			_ = d.SendK8sEvent(ctx, corev1.EventTypeNormal, fmt.Sprintf("%v", conditionType), ExporterReadyMessage)
 		}
 	} else {
-		log.Infof("Set error condition, reason: %s, message: %s", reason, message)
+		d.Logger().Info("Set error condition", "condition", conditionType, "reason", reason, "message", message)
 		conditionutil.SetStatusCondition(&fscluster.Status.Conditions, operatorapi.Condition{
 			Type:    conditionType,
 			Status:  corev1.ConditionFalse,
@@ -173,22 +247,97 @@ func (d *DriverManager) UpdateCondition(conditionType operatorapi.ConditionType,
 			Message: message,
 		})
 
-		_ = d.SendK8sEvent(corev1.EventTypeWarning, reason, message)
+		_ = d.SendK8sEvent(ctx, corev1.EventTypeWarning, reason, message)
 	}
 
-	err = k8sclient.Status().Update(context.TODO(), fscluster)
+	span.SetAttributes(attribute.Bool("updated", true))
+	err = k8sclient.Status().Update(ctx, fscluster)
 	if err != nil {
-		log.Errorf("Fail to update FlashSystemCluster CR, error: %s", err)
+		d.Logger().Error(err, "Fail to update FlashSystemCluster CR")
+		tracing.RecordError(span, err)
 		return err
 	}
 
 	return nil
 }
 
-func (d *DriverManager) SendK8sEvent(eventtype, reason, message string) error {
-	fscluster, err := d.GetFlashSystemClusterCR()
+func (d *DriverManager) warningState(conditionType operatorapi.ConditionType) string {
+	warningsLock.Lock()
+	defer warningsLock.Unlock()
+	return d.warnings[conditionType]
+}
+
+func (d *DriverManager) setWarningState(conditionType operatorapi.ConditionType, state string) {
+	warningsLock.Lock()
+	defer warningsLock.Unlock()
+	if d.warnings == nil {
+		d.warnings = map[operatorapi.ConditionType]string{}
+	}
+	d.warnings[conditionType] = state
+}
+
+// UpdateWarningCondition sets the condition to true with a warning event while the
+// problem is active, and clears it with a normal event once it is resolved.
+func (d *DriverManager) UpdateWarningCondition(ctx context.Context, conditionType operatorapi.ConditionType, active bool, reason string, message string) error {
+	state := fmt.Sprintf("%t/%s/%s", active, reason, message)
+	if d.warningState(conditionType) == state {
+		return nil
+	}
+
+	ctx, span := tracing.Start(ctx, "UpdateWarningCondition", trace.WithAttributes(
+		attribute.String(tracing.SystemKey, d.SystemName),
+		attribute.String(tracing.ConditionKey, string(conditionType)),
+		attribute.Bool("active", active),
+	))
+	defer span.End()
+
+	fscluster, err := d.GetFlashSystemClusterCR(ctx)
 	if err != nil {
-		log.Errorf("Get flash system CR failed: %v", err)
+		tracing.RecordError(span, err)
+		return err
+	}
+
+	existing := conditionutil.FindStatusCondition(fscluster.Status.Conditions, conditionType)
+	if !active && (existing == nil || existing.Status == corev1.ConditionFalse) {
+		d.setWarningState(conditionType, state)
+		return nil
+	}
+	if active && existing != nil && existing.Status == corev1.ConditionTrue && existing.Reason == reason && existing.Message == message {
+		d.setWarningState(conditionType, state)
+		return nil
+	}
+
+	status := corev1.ConditionFalse
+	if active {
+		status = corev1.ConditionTrue
+	}
+	conditionutil.SetStatusCondition(&fscluster.Status.Conditions, operatorapi.Condition{
+		Type:    conditionType,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	})
+	if err = d.Client.Status().Update(ctx, fscluster); err != nil {
+		d.Logger().Error(err, "Fail to update FlashSystemCluster CR")
+		tracing.RecordError(span, err)
+		return err
+	}
+	d.setWarningState(conditionType, state)
+
+	if active {
+		d.Logger().Info("Set warning condition", "condition", conditionType, "reason", reason, "message", message)
+		_ = d.SendK8sEvent(ctx, corev1.EventTypeWarning, reason, message)
+	} else {
+		d.Logger().Info("Clear warning condition", "condition", conditionType, "reason", reason)
+		_ = d.SendK8sEvent(ctx, corev1.EventTypeNormal, reason, message)
+	}
+	return nil
+}
+
+func (d *DriverManager) SendK8sEvent(ctx context.Context, eventtype, reason, message string) error {
+	fscluster, err := d.GetFlashSystemClusterCR(ctx)
+	if err != nil {
+		d.Logger().Error(err, "Get flash system CR failed")
 		return err
 	}
 
@@ -215,17 +364,17 @@ func (d *DriverManager) SendK8sEvent(eventtype, reason, message string) error {
 		Type:           eventtype,
 	}
 
-	err = d.Client.Create(context.TODO(), evt)
+	err = d.Client.Create(ctx, evt)
 	if err != nil {
-		log.Errorf("failed to SendK8sEvent reason: %s, message: %s, error: \n %v\n", reason, message, err)
+		d.Logger().Error(err, "failed to SendK8sEvent", "reason", reason, "message", message)
 	}
 	return err
 }
 
-func (d *DriverManager) GetFlashSystemClusterCR() (*operatorapi.FlashSystemCluster, error) {
+func (d *DriverManager) GetFlashSystemClusterCR(ctx context.Context) (*operatorapi.FlashSystemCluster, error) {
 	fscluster := operatorapi.FlashSystemCluster{}
 	err := d.Client.Get(
-		context.TODO(),
+		ctx,
 		client.ObjectKey{
 			Namespace: d.namespace,
 			Name:      d.SystemName,
@@ -233,12 +382,40 @@ func (d *DriverManager) GetFlashSystemClusterCR() (*operatorapi.FlashSystemClust
 		&fscluster,
 	)
 	if err != nil {
-		log.Errorf("Fail to get FlashSystemCluster CR %s, error: %v", d.SystemName, err)
+		d.Logger().Error(err, "Fail to get FlashSystemCluster CR")
 		return nil, err
 	}
 	return &fscluster, nil
 }
 
+func (d *DriverManager) GetStorageClass(ctx context.Context, name string) (*storagev1.StorageClass, error) {
+	storageClass := storagev1.StorageClass{}
+	if err := d.Client.Get(ctx, client.ObjectKey{Name: name}, &storageClass); err != nil {
+		return nil, err
+	}
+	return &storageClass, nil
+}
+
+// ListPersistentVolumes returns the persistent volumes of the cluster, of all the CSI drivers.
+func (d *DriverManager) ListPersistentVolumes(ctx context.Context) ([]corev1.PersistentVolume, error) {
+	pvList := corev1.PersistentVolumeList{}
+	if err := d.Client.List(ctx, &pvList); err != nil {
+		return nil, err
+	}
+	return pvList.Items, nil
+}
+
+// ListVolumeSnapshotContents returns the VolumeSnapshotContents of the cluster,
+// of all the CSI drivers. It fails if the snapshot CRDs aren't installed.
+func (d *DriverManager) ListVolumeSnapshotContents(ctx context.Context) ([]unstructured.Unstructured, error) {
+	contentList := unstructured.UnstructuredList{}
+	contentList.SetGroupVersionKind(VolumeSnapshotContentListKind)
+	if err := d.Client.List(ctx, &contentList); err != nil {
+		return nil, err
+	}
+	return contentList.Items, nil
+}
+
 func getK8sClient(scheme *runtime.Scheme) (client.Client, error) {
 	if K8SClient != nil {
 		return K8SClient, nil
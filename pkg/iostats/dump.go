@@ -0,0 +1,228 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package iostats parses the statistics files the flash system dumps to
+// /dumps/iostats every statistics interval, and turns the cumulative counters
+// of two files of a node into rates.
+package iostats
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Directory of the statistics files on the config node
+	DumpPrefix = "/dumps/iostats"
+
+	// Statistics files are named <prefix><node>_<yymmdd>_<hhmmss>
+	VolumeFilePrefix = "Nv_stats_"
+	MDiskFilePrefix  = "Nm_stats_"
+	DriveFilePrefix  = "Nd_stats_"
+	NodeFilePrefix   = "Nn_stats_"
+
+	// Elements of the statistics, drives are reported as mdsk elements too
+	ElementVolume = "vdsk"
+	ElementMDisk  = "mdsk"
+	ElementDrive  = "mdsk"
+	ElementCPU    = "cpu"
+
+	// Attributes naming the objects
+	IndexAttr = "idx"
+	IdAttr    = "id"
+
+	timestampLayout = "2006-01-02 15:04:05"
+)
+
+// Object is an element of a statistics file, Counters has its numeric attributes.
+type Object struct {
+	Type     string
+	Id       string
+	Name     string
+	Counters map[string]float64
+}
+
+// Dump is a statistics file of a node.
+type Dump struct {
+	Node      string
+	Contains  string
+	Timestamp time.Time
+	Objects   map[string]Object
+}
+
+// Interval is the growth of the counters between two files of a node.
+type Interval struct {
+	Node     string
+	Duration time.Duration
+	Objects  map[string]Object
+}
+
+// ObjectKey identifies an object in a file, by its index or its id if it has no index.
+func ObjectKey(elementType string, id string) string {
+	return elementType + "/" + id
+}
+
+// ParseDump parses a statistics file of any kind.
+func ParseDump(r io.Reader) (*Dump, error) {
+	decoder := xml.NewDecoder(r)
+	var dump *Dump
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse statistics failed: %w", err)
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			depth++
+			attrs := map[string]string{}
+			for _, attr := range element.Attr {
+				attrs[attr.Name.Local] = attr.Value
+			}
+			switch depth {
+			case 1:
+				if dump, err = newDump(attrs); err != nil {
+					return nil, err
+				}
+			case 2:
+				object := newObject(element.Name.Local, attrs)
+				dump.Objects[ObjectKey(object.Type, object.Id)] = object
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+
+	if dump == nil {
+		return nil, fmt.Errorf("parse statistics failed: no statistics")
+	}
+	return dump, nil
+}
+
+func newDump(attrs map[string]string) (*Dump, error) {
+	timestamp := attrs["timestamp_utc"]
+	if timestamp == "" {
+		timestamp = attrs["timestamp"]
+	}
+	parsedTime, err := time.Parse(timestampLayout, timestamp)
+	if err != nil {
+		return nil, fmt.Errorf("parse statistics timestamp failed: %w", err)
+	}
+	return &Dump{Node: attrs[IdAttr], Contains: attrs["contains"], Timestamp: parsedTime, Objects: map[string]Object{}}, nil
+}
+
+func newObject(elementType string, attrs map[string]string) Object {
+	object := Object{Type: elementType, Id: attrs[IndexAttr], Name: attrs[IdAttr], Counters: map[string]float64{}}
+	if object.Id == "" {
+		object.Id = object.Name
+	}
+	for name, value := range attrs {
+		if name == IndexAttr || name == IdAttr {
+			continue
+		}
+		if counter, err := strconv.ParseFloat(value, 64); err == nil {
+			object.Counters[name] = counter
+		}
+	}
+	return object
+}
+
+// Delta returns the growth of the counters from prev to cur. Objects which are
+// new, renamed, or have a counter going back as after a node restart are left out.
+func Delta(prev *Dump, cur *Dump) (*Interval, error) {
+	duration := cur.Timestamp.Sub(prev.Timestamp)
+	if duration <= 0 {
+		return nil, fmt.Errorf("statistics of node %s aren't newer than %s", cur.Node, prev.Timestamp)
+	}
+
+	interval := &Interval{Node: cur.Node, Duration: duration, Objects: map[string]Object{}}
+	for key, object := range cur.Objects {
+		prevObject, ok := prev.Objects[key]
+		if !ok || prevObject.Name != object.Name {
+			continue
+		}
+		delta := Object{Type: object.Type, Id: object.Id, Name: object.Name, Counters: map[string]float64{}}
+		valid := true
+		for name, value := range object.Counters {
+			prevValue, ok := prevObject.Counters[name]
+			if !ok {
+				continue
+			}
+			if value < prevValue {
+				valid = false
+				break
+			}
+			delta.Counters[name] = value - prevValue
+		}
+		if valid {
+			interval.Objects[key] = delta
+		}
+	}
+	return interval, nil
+}
+
+// Rate returns the growth of a counter per second.
+func (i *Interval) Rate(object Object, counter string) float64 {
+	return object.Counters[counter] / i.Duration.Seconds()
+}
+
+// NewestFiles returns the newest file with the prefix of each node.
+func NewestFiles(filenames []string, prefix string) map[string]string {
+	newest := map[string]string{}
+	stamps := map[string]string{}
+	for _, filename := range filenames {
+		node, stamp, ok := splitFilename(filename, prefix)
+		if !ok {
+			continue
+		}
+		if stamp > stamps[node] {
+			stamps[node] = stamp
+			newest[node] = filename
+		}
+	}
+	return newest
+}
+
+func splitFilename(filename string, prefix string) (node string, stamp string, ok bool) {
+	if !strings.HasPrefix(filename, prefix) {
+		return "", "", false
+	}
+	parts := strings.Split(strings.TrimPrefix(filename, prefix), "_")
+	if len(parts) < 3 {
+		return "", "", false
+	}
+	n := len(parts)
+	return strings.Join(parts[:n-2], "_"), parts[n-2] + parts[n-1], true
+}
+
+// sortedNodes returns the node names of a file map, sorted.
+func sortedNodes(files map[string]string) []string {
+	var nodes []string
+	for node := range files {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
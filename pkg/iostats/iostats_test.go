@@ -0,0 +1,244 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package iostats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	drivermanager "github.com/IBM/ibm-storage-odf-block-driver/pkg/driver"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/rest"
+)
+
+func statsFile(node string, timestamp string, contains string, elements string) string {
+	return `<?xml version="1.0" encoding="utf-8" ?>
+<diskStatsColl xmlns="http://ibm.com/storage/management/performance/api/2005/08/vDiskStats"
+ scope="node" id="` + node + `" cluster="cluster1" timestamp="` + timestamp + `" contains="` + contains + `" sizeUnits="512B" timeUnits="msec">
+` + elements + `
+</diskStatsColl>`
+}
+
+func parseDump(t *testing.T, content string) *Dump {
+	dump, err := ParseDump(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("parse dump failed: %v", err)
+	}
+	return dump
+}
+
+func delta(t *testing.T, prev string, cur string) *Interval {
+	interval, err := Delta(parseDump(t, prev), parseDump(t, cur))
+	if err != nil {
+		t.Fatalf("delta failed: %v", err)
+	}
+	return interval
+}
+
+func assertFloat(t *testing.T, name string, expected float64, actual float64) {
+	if math.Abs(expected-actual) > 1e-9 {
+		t.Errorf("%s expected %v, got %v", name, expected, actual)
+	}
+}
+
+func TestParseDump(t *testing.T) {
+	dump := parseDump(t, statsFile("node1", "2021-06-04 16:18:07", "virtualDiskStats",
+		`<vdsk idx="0" id="vol0" ro="100" wo="200" rb="2048" wb="4096" rl="50" wl="80" rlw="3000" wlw="4000"/>`))
+	if dump.Node != "node1" || dump.Contains != "virtualDiskStats" || dump.Timestamp.Format(timestampLayout) != "2021-06-04 16:18:07" {
+		t.Errorf("unexpected dump header %s %s %s", dump.Node, dump.Contains, dump.Timestamp)
+	}
+	expected := Object{Type: ElementVolume, Id: "0", Name: "vol0", Counters: map[string]float64{
+		"ro": 100, "wo": 200, "rb": 2048, "wb": 4096, "rl": 50, "wl": 80, "rlw": 3000, "wlw": 4000}}
+	if !reflect.DeepEqual(dump.Objects[ObjectKey(ElementVolume, "0")], expected) {
+		t.Errorf("expected %+v, got %+v", expected, dump.Objects[ObjectKey(ElementVolume, "0")])
+	}
+
+	// Node files have elements without an index, and text attributes
+	dump = parseDump(t, statsFile("node1", "2021-06-04 16:18:07", "nodeStats", `
+		<cpu busy="1000" comp="10" system="5"/>
+		<port id="1" type="FC" wwpn="0x500507680b2174a8" hbt="4096" hbr="2048"/>
+		<node id="node2" cluster="cluster1" ro="5" wo="6"><extra x="1"/></node>`))
+	if _, ok := dump.Objects[ObjectKey(ElementCPU, "")]; !ok {
+		t.Errorf("cpu element missing")
+	}
+	port := dump.Objects[ObjectKey("port", "1")]
+	if port.Counters["hbt"] != 4096 {
+		t.Errorf("unexpected port %+v", port)
+	}
+	if _, ok := port.Counters["wwpn"]; ok {
+		t.Errorf("hex wwpn shouldn't be a counter")
+	}
+	if len(dump.Objects) != 3 {
+		t.Errorf("nested elements should be left out, got %d objects", len(dump.Objects))
+	}
+
+	for _, content := range []string{`<diskStatsColl timestamp="yesterday"/>`, ``, `<diskStatsColl`} {
+		if _, err := ParseDump(strings.NewReader(content)); err == nil {
+			t.Errorf("parse %q should fail", content)
+		}
+	}
+}
+
+func TestDelta(t *testing.T) {
+	prev := statsFile("node1", "2021-06-04 16:00:00", "virtualDiskStats", `
+		<vdsk idx="0" id="vol0" ro="100" wo="200"/>
+		<vdsk idx="1" id="vol1" ro="500" wo="0"/>
+		<vdsk idx="2" id="vol2" ro="10" wo="0"/>`)
+	cur := statsFile("node1", "2021-06-04 16:01:00", "virtualDiskStats", `
+		<vdsk idx="0" id="vol0" ro="700" wo="1400"/>
+		<vdsk idx="1" id="vol1" ro="10" wo="0"/>
+		<vdsk idx="2" id="vol2-renamed" ro="20" wo="0"/>
+		<vdsk idx="3" id="vol3" ro="10" wo="0"/>`)
+
+	interval := delta(t, prev, cur)
+	// vol1 was reset, vol2 renamed and vol3 is new
+	if len(interval.Objects) != 1 || interval.Duration.Seconds() != 60 {
+		t.Fatalf("only vol0 should have an interval of 60s, got %d objects in %s", len(interval.Objects), interval.Duration)
+	}
+	vol0 := interval.Objects[ObjectKey(ElementVolume, "0")]
+	assertFloat(t, "read ops rate", 10, interval.Rate(vol0, "ro"))
+	assertFloat(t, "write ops rate", 20, interval.Rate(vol0, "wo"))
+
+	if _, err := Delta(parseDump(t, cur), parseDump(t, prev)); err == nil {
+		t.Errorf("older dump should fail")
+	}
+}
+
+func TestVolumeRates(t *testing.T) {
+	interval1 := delta(t,
+		statsFile("node1", "2021-06-04 16:00:00", "virtualDiskStats", `<vdsk idx="0" id="vol0" ro="100" wo="200" rb="2048" wb="4096" rl="50" wl="80"/>`),
+		statsFile("node1", "2021-06-04 16:01:00", "virtualDiskStats", `<vdsk idx="0" id="vol0" ro="700" wo="1400" rb="1230848" wb="2461696" rl="650" wl="2480"/>`))
+	interval2 := delta(t,
+		statsFile("node2", "2021-06-04 16:00:00", "virtualDiskStats", `<vdsk idx="0" id="vol0" ro="0" wo="0" rb="0" wb="0" rl="0" wl="0"/>`),
+		statsFile("node2", "2021-06-04 16:00:30", "virtualDiskStats", `<vdsk idx="0" id="vol0" ro="300" wo="0" rb="614400" wb="0" rl="1500" wl="0"/>`))
+
+	perf := VolumeRates([]*Interval{interval1, interval2})
+	vol0, ok := perf["0"]
+	if !ok || len(perf) != 1 || vol0.Name != "vol0" {
+		t.Fatalf("expected vol0, got %v", perf)
+	}
+	// node1: 600 reads and 1200 writes in 60s, node2: 300 reads in 30s
+	assertFloat(t, "ReadIOPS", 20, vol0.ReadIOPS)
+	assertFloat(t, "WriteIOPS", 20, vol0.WriteIOPS)
+	assertFloat(t, "ReadBytes", 1228800*512/60.0+614400*512/30.0, vol0.ReadBytes)
+	assertFloat(t, "WriteBytes", 2457600*512/60.0, vol0.WriteBytes)
+	assertFloat(t, "ReadLatency", 2100.0/900/1000, vol0.ReadLatency)
+	assertFloat(t, "WriteLatency", 2400.0/1200/1000, vol0.WriteLatency)
+}
+
+func TestMDiskRates(t *testing.T) {
+	interval := delta(t,
+		statsFile("node1", "2021-06-04 16:00:00", "managedDiskStats", `<mdsk idx="3" id="mdisk3" ro="0" wo="0" rb="0" wb="0" re="0" we="0" rq="0" wq="0"/>`),
+		statsFile("node1", "2021-06-04 16:00:10", "managedDiskStats", `<mdsk idx="3" id="mdisk3" ro="100" wo="50" rb="800" wb="400" re="200" we="25" rq="900" wq="900"/>`))
+
+	mdisk3 := MDiskRates([]*Interval{interval})["3"]
+	assertFloat(t, "ReadIOPS", 10, mdisk3.ReadIOPS)
+	assertFloat(t, "WriteBytes", 400*512/10.0, mdisk3.WriteBytes)
+	// The external response time, without the queue time
+	assertFloat(t, "ReadLatency", 0.002, mdisk3.ReadLatency)
+	assertFloat(t, "WriteLatency", 0.0005, mdisk3.WriteLatency)
+}
+
+func TestNodeRates(t *testing.T) {
+	interval := delta(t,
+		statsFile("node1", "2021-06-04 16:00:00", "nodeStats", `<cpu busy="1000" comp="0"/>`),
+		statsFile("node1", "2021-06-04 16:00:10", "nodeStats", `<cpu busy="16000" comp="2000"/>`))
+
+	expected := map[string]NodePerf{"node1": {Node: "node1", CPUBusy: 1.5, CompressionCPUBusy: 0.2}}
+	if perf := NodeRates([]*Interval{interval}); !reflect.DeepEqual(perf, expected) {
+		t.Errorf("expected %+v, got %+v", expected, perf)
+	}
+}
+
+func TestNewestFiles(t *testing.T) {
+	files := []string{
+		"Nv_stats_78N10WD-1_210604_161807",
+		"Nv_stats_78N10WD-1_210604_163307",
+		"Nv_stats_78N10WD-1_210603_235959",
+		"Nv_stats_78N10WD-2_210604_161810",
+		"Nm_stats_78N10WD-1_210604_170000",
+		"Nv_stats_broken",
+	}
+	expected := map[string]string{
+		"78N10WD-1": "Nv_stats_78N10WD-1_210604_163307",
+		"78N10WD-2": "Nv_stats_78N10WD-2_210604_161810",
+	}
+	if newest := NewestFiles(files, VolumeFilePrefix); !reflect.DeepEqual(newest, expected) {
+		t.Errorf("expected %v, got %v", expected, newest)
+	}
+}
+
+func TestTracker(t *testing.T) {
+	files := map[string]string{
+		"Nv_stats_node1_210604_160000": statsFile("node1", "2021-06-04 16:00:00", "virtualDiskStats", `<vdsk idx="0" id="vol0" ro="0" wo="0"/>`),
+		"Nn_stats_node1_210604_160000": statsFile("node1", "2021-06-04 16:00:00", "nodeStats", `<cpu busy="0" comp="0"/>`),
+	}
+	var downloads []string
+	poster := func(req *http.Request, c *rest.FSRestClient) ([]byte, int, error) {
+		switch fmt.Sprintf("%v", req.URL) {
+		case "/lsdumps":
+			var dumps []string
+			for name := range files {
+				dumps = append(dumps, fmt.Sprintf(`{"id":"%d","filename":"%s"}`, len(dumps), name))
+			}
+			return []byte("[" + strings.Join(dumps, ",") + "]"), 200, nil
+		case "/download":
+			var request map[string]string
+			if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+				return nil, 500, err
+			}
+			downloads = append(downloads, request["filename"])
+			return []byte(files[request["filename"]]), 200, nil
+		}
+		return nil, 404, nil
+	}
+	client := &rest.FSRestClient{PostRequester: rest.NewRequester(poster), DriverManager: &drivermanager.DriverManager{SystemName: "FS-system-name"}}
+
+	// Mdisk files aren't tracked
+	tracker := NewTracker(VolumeFilePrefix, NodeFilePrefix)
+	if err := tracker.Update(context.Background(), client); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if volumes, err := tracker.Volumes(); err != nil || len(volumes) != 0 {
+		t.Errorf("no rates expected after the first files, got %v %v", volumes, err)
+	}
+
+	files["Nv_stats_node1_210604_160100"] = statsFile("node1", "2021-06-04 16:01:00", "virtualDiskStats", `<vdsk idx="0" id="vol0" ro="600" wo="60"/>`)
+	files["Nm_stats_node1_210604_160100"] = statsFile("node1", "2021-06-04 16:01:00", "managedDiskStats", `<mdsk idx="0" id="mdisk0" ro="600"/>`)
+	for i := 0; i < 2; i++ {
+		if err := tracker.Update(context.Background(), client); err != nil {
+			t.Fatalf("update failed: %v", err)
+		}
+	}
+
+	expected := []string{"Nv_stats_node1_210604_160000", "Nn_stats_node1_210604_160000", "Nv_stats_node1_210604_160100"}
+	if !reflect.DeepEqual(downloads, expected) {
+		t.Errorf("only new files should be downloaded, got %v", downloads)
+	}
+	volumes, err := tracker.Volumes()
+	if err != nil || volumes["0"] == nil || volumes["0"].ReadIOPS != 10 || volumes["0"].WriteIOPS != 1 {
+		t.Errorf("unexpected volume rates %v %v", volumes, err)
+	}
+	if nodes, err := tracker.Nodes(); err != nil || len(nodes) != 0 {
+		t.Errorf("node file didn't change, no rates expected, got %v %v", nodes, err)
+	}
+}
@@ -0,0 +1,152 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package iostats
+
+// Counters count blocks of 512 bytes, and latencies in milliseconds
+const blockSize = 512
+
+// ioCounters names the counters of an element with read and write statistics.
+type ioCounters struct {
+	readOps      string
+	writeOps     string
+	readBlocks   string
+	writeBlocks  string
+	readLatency  string
+	writeLatency string
+}
+
+var (
+	// Volumes report the cumulative response time to the hosts
+	volumeCounters = ioCounters{"ro", "wo", "rb", "wb", "rl", "wl"}
+
+	// MDisks and drives report the cumulative external response time
+	diskCounters = ioCounters{"ro", "wo", "rb", "wb", "re", "we"}
+)
+
+// IOPerf is the performance of a volume, mdisk or drive over the last
+// interval, summed over the nodes. Throughput is in bytes/s and latency in seconds.
+type IOPerf struct {
+	Id           string
+	Name         string
+	ReadIOPS     float64
+	WriteIOPS    float64
+	ReadBytes    float64
+	WriteBytes   float64
+	ReadLatency  float64
+	WriteLatency float64
+
+	// Operations and latencies of the interval, to average the latency over nodes
+	readOps      float64
+	writeOps     float64
+	readLatency  float64
+	writeLatency float64
+}
+
+// TotalIOPS is the read and write IOPS.
+func (p IOPerf) TotalIOPS() float64 {
+	return p.ReadIOPS + p.WriteIOPS
+}
+
+// TotalBytes is the read and write throughput.
+func (p IOPerf) TotalBytes() float64 {
+	return p.ReadBytes + p.WriteBytes
+}
+
+// add adds the growth of the counters of a node over the interval.
+func (p *IOPerf) add(interval *Interval, delta Object, counters ioCounters) {
+	p.ReadIOPS += interval.Rate(delta, counters.readOps)
+	p.WriteIOPS += interval.Rate(delta, counters.writeOps)
+	p.ReadBytes += interval.Rate(delta, counters.readBlocks) * blockSize
+	p.WriteBytes += interval.Rate(delta, counters.writeBlocks) * blockSize
+
+	p.readOps += delta.Counters[counters.readOps]
+	p.writeOps += delta.Counters[counters.writeOps]
+	p.readLatency += delta.Counters[counters.readLatency]
+	p.writeLatency += delta.Counters[counters.writeLatency]
+	p.ReadLatency = averageLatency(p.readLatency, p.readOps)
+	p.WriteLatency = averageLatency(p.writeLatency, p.writeOps)
+}
+
+// averageLatency converts the latency in milliseconds summed over ops to seconds per op.
+func averageLatency(latency float64, ops float64) float64 {
+	if ops == 0 {
+		return 0
+	}
+	return latency / ops / 1000
+}
+
+// ioRates sums the performance of the elements over the intervals of the
+// nodes, keyed by the element index.
+func ioRates(intervals []*Interval, elementType string, counters ioCounters) map[string]*IOPerf {
+	perf := map[string]*IOPerf{}
+	for _, interval := range intervals {
+		for _, delta := range interval.Objects {
+			if delta.Type != elementType {
+				continue
+			}
+			objectPerf, ok := perf[delta.Id]
+			if !ok {
+				objectPerf = &IOPerf{Id: delta.Id, Name: delta.Name}
+				perf[delta.Id] = objectPerf
+			}
+			objectPerf.add(interval, delta, counters)
+		}
+	}
+	return perf
+}
+
+// VolumeRates returns the performance of the volumes keyed by the volume id.
+func VolumeRates(intervals []*Interval) map[string]*IOPerf {
+	return ioRates(intervals, ElementVolume, volumeCounters)
+}
+
+// MDiskRates returns the performance of the mdisks keyed by the mdisk id.
+func MDiskRates(intervals []*Interval) map[string]*IOPerf {
+	return ioRates(intervals, ElementMDisk, diskCounters)
+}
+
+// DriveRates returns the performance of the drives keyed by the drive id.
+func DriveRates(intervals []*Interval) map[string]*IOPerf {
+	return ioRates(intervals, ElementDrive, diskCounters)
+}
+
+// NodePerf is the performance of a node over the last interval.
+type NodePerf struct {
+	Node string
+	// Busy time of the CPU cores per second, 1 is a fully busy core
+	CPUBusy float64
+	// Busy time of the compression CPU per second
+	CompressionCPUBusy float64
+}
+
+// NodeRates returns the performance of the nodes keyed by the node name.
+func NodeRates(intervals []*Interval) map[string]NodePerf {
+	perf := map[string]NodePerf{}
+	for _, interval := range intervals {
+		cpu, ok := interval.Objects[ObjectKey(ElementCPU, "")]
+		if !ok {
+			continue
+		}
+		// busy and comp are in milliseconds
+		perf[interval.Node] = NodePerf{
+			Node:               interval.Node,
+			CPUBusy:            interval.Rate(cpu, "busy") / 1000,
+			CompressionCPUBusy: interval.Rate(cpu, "comp") / 1000,
+		}
+	}
+	return perf
+}
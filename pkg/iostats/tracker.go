@@ -0,0 +1,172 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package iostats
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/rest"
+)
+
+// Column of lsdumps
+const DumpFilenameKey = "filename"
+
+type nodeDumps struct {
+	file string
+	prev *Dump
+	cur  *Dump
+}
+
+// Tracker keeps the two newest statistics files of each node of a system, for
+// each of its file prefixes. Only the files which are new since the last
+// update are downloaded.
+type Tracker struct {
+	lock     sync.Mutex
+	prefixes []string
+	files    map[string]map[string]*nodeDumps
+}
+
+func NewTracker(prefixes ...string) *Tracker {
+	files := map[string]map[string]*nodeDumps{}
+	for _, prefix := range prefixes {
+		files[prefix] = map[string]*nodeDumps{}
+	}
+	return &Tracker{prefixes: prefixes, files: files}
+}
+
+// Update downloads the newest statistics file of each node and prefix, if it
+// changed since the last update.
+func (t *Tracker) Update(ctx context.Context, fsRestClient *rest.FSRestClient) error {
+	dumps, err := fsRestClient.Lsdumps(ctx, DumpPrefix)
+	if err != nil {
+		return err
+	}
+	var filenames []string
+	for _, dump := range dumps {
+		filenames = append(filenames, dump[DumpFilenameKey])
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, prefix := range t.prefixes {
+		if err := t.updatePrefix(ctx, fsRestClient, prefix, NewestFiles(filenames, prefix)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Tracker) updatePrefix(ctx context.Context, fsRestClient *rest.FSRestClient, prefix string, newest map[string]string) error {
+	nodes := t.files[prefix]
+
+	// Nodes removed from the system have no files any more
+	for node := range nodes {
+		if _, ok := newest[node]; !ok {
+			delete(nodes, node)
+		}
+	}
+
+	for _, node := range sortedNodes(newest) {
+		file := newest[node]
+		dumps, ok := nodes[node]
+		if ok && dumps.file == file {
+			continue
+		}
+
+		content, err := fsRestClient.Download(ctx, DumpPrefix, file)
+		if err != nil {
+			return err
+		}
+		dump, err := ParseDump(bytes.NewReader(content))
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+
+		if !ok {
+			dumps = &nodeDumps{}
+			nodes[node] = dumps
+		}
+		dumps.file = file
+		// A file which isn't newer than the current one gives no interval
+		if dumps.cur != nil && !dump.Timestamp.After(dumps.cur.Timestamp) {
+			continue
+		}
+		dumps.prev = dumps.cur
+		dumps.cur = dump
+	}
+	return nil
+}
+
+// Intervals returns the last interval of each node with two files of the prefix.
+func (t *Tracker) Intervals(prefix string) ([]*Interval, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var intervals []*Interval
+	for _, dumps := range t.files[prefix] {
+		if dumps.prev == nil {
+			continue
+		}
+		interval, err := Delta(dumps.prev, dumps.cur)
+		if err != nil {
+			return nil, err
+		}
+		intervals = append(intervals, interval)
+	}
+	return intervals, nil
+}
+
+// Volumes returns the performance of the volumes over the last interval keyed
+// by the volume id, empty until the nodes have two files.
+func (t *Tracker) Volumes() (map[string]*IOPerf, error) {
+	intervals, err := t.Intervals(VolumeFilePrefix)
+	if err != nil {
+		return nil, err
+	}
+	return VolumeRates(intervals), nil
+}
+
+// MDisks returns the performance of the mdisks over the last interval keyed by the mdisk id.
+func (t *Tracker) MDisks() (map[string]*IOPerf, error) {
+	intervals, err := t.Intervals(MDiskFilePrefix)
+	if err != nil {
+		return nil, err
+	}
+	return MDiskRates(intervals), nil
+}
+
+// Drives returns the performance of the drives over the last interval keyed by the drive id.
+func (t *Tracker) Drives() (map[string]*IOPerf, error) {
+	intervals, err := t.Intervals(DriveFilePrefix)
+	if err != nil {
+		return nil, err
+	}
+	return DriveRates(intervals), nil
+}
+
+// Nodes returns the performance of the nodes over the last interval keyed by the node name.
+func (t *Tracker) Nodes() (map[string]NodePerf, error) {
+	intervals, err := t.Intervals(NodeFilePrefix)
+	if err != nil {
+		return nil, err
+	}
+	return NodeRates(intervals), nil
+}
@@ -0,0 +1,133 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logging
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	klogv2 "k8s.io/klog/v2"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Verbosity levels. Lifecycle events (start, config and state changes,
+// failures) are logged at level 0.
+const (
+	// Summary of each scrape, one line per system and REST command
+	ScrapeLevel = 1
+	// Values computed for each pool, node and disk during a scrape
+	DetailLevel = 2
+)
+
+// Log formats
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Keys of the common key-value context
+const (
+	SystemKey  = "system"
+	PoolKey    = "pool"
+	CommandKey = "command"
+)
+
+var (
+	lock   sync.RWMutex
+	logger = newLogger(FormatJSON, 0)
+
+	logFormat = FormatJSON
+	verbosity = 0
+)
+
+// BindFlags registers the log flags.
+func BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&logFormat, "log-format", FormatJSON, "Log format, json or text")
+	fs.IntVar(&verbosity, "v", 0, "Log verbosity, 1 logs each scrape, 2 logs the collected values")
+}
+
+// Init builds the logger from the flags. Kubernetes client and
+// controller-runtime logs are sent to the same logger.
+func Init() error {
+	if logFormat != FormatJSON && logFormat != FormatText {
+		return fmt.Errorf("unsupported log format %q", logFormat)
+	}
+	if verbosity < 0 {
+		return fmt.Errorf("log verbosity must not be negative, got %d", verbosity)
+	}
+
+	l := newLogger(logFormat, verbosity)
+	lock.Lock()
+	logger = l
+	lock.Unlock()
+
+	klogv2.SetLogger(l)
+	ctrllog.SetLogger(l)
+	return nil
+}
+
+func newLogger(format string, v int) logr.Logger {
+	opts := funcr.Options{
+		LogTimestamp:    true,
+		TimestampFormat: "2006-01-02T15:04:05.000Z07:00",
+		Verbosity:       v,
+	}
+
+	var l logr.Logger
+	if format == FormatText {
+		l = funcr.New(func(prefix, args string) {
+			if prefix != "" {
+				_, _ = fmt.Fprintf(os.Stderr, "%s: %s\n", prefix, args)
+			} else {
+				_, _ = fmt.Fprintln(os.Stderr, args)
+			}
+		}, opts)
+	} else {
+		l = funcr.NewJSON(func(obj string) {
+			_, _ = fmt.Fprintln(os.Stderr, obj)
+		}, opts)
+	}
+	return logr.New(&redactSink{sink: l.GetSink()})
+}
+
+// Logger returns the root logger.
+func Logger() logr.Logger {
+	lock.RLock()
+	defer lock.RUnlock()
+	return logger
+}
+
+// WithSystem returns a logger with the flash system name on every line.
+func WithSystem(systemName string) logr.Logger {
+	return Logger().WithValues(SystemKey, systemName)
+}
+
+func V(level int) logr.Logger {
+	return Logger().V(level)
+}
+
+func Info(msg string, keysAndValues ...interface{}) {
+	Logger().WithCallDepth(1).Info(msg, keysAndValues...)
+}
+
+func Error(err error, msg string, keysAndValues ...interface{}) {
+	Logger().WithCallDepth(1).Error(err, msg, keysAndValues...)
+}
@@ -0,0 +1,176 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logging
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+)
+
+const Redacted = "<redacted>"
+
+// Secrets shorter than this are only redacted from values which are the
+// whole secret, not replaced in free text to avoid masking unrelated words.
+const minSecretLength = 4
+
+var sensitiveKeys = []string{"password", "passwd", "token", "secret", "credential", "authorization"}
+
+var (
+	secretLock sync.RWMutex
+	secrets    = map[string]struct{}{}
+)
+
+// RegisterSecret makes sure the value never shows up in a log line, in the
+// message, in any value or in an error text. A secret shorter than
+// minSecretLength is only redacted from the values which are the secret.
+func RegisterSecret(secret string) {
+	if secret == "" {
+		return
+	}
+	secretLock.Lock()
+	defer secretLock.Unlock()
+	secrets[secret] = struct{}{}
+}
+
+// ForgetSecret removes a value which is no longer in use, e.g. an expired token.
+func ForgetSecret(secret string) {
+	secretLock.Lock()
+	defer secretLock.Unlock()
+	delete(secrets, secret)
+}
+
+func isSensitiveKey(key string) bool {
+	lower := strings.ToLower(key)
+	for _, k := range sensitiveKeys {
+		if strings.Contains(lower, k) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactString(s string) string {
+	secretLock.RLock()
+	defer secretLock.RUnlock()
+	for secret := range secrets {
+		if s == secret {
+			return Redacted
+		}
+		if len(secret) >= minSecretLength && strings.Contains(s, secret) {
+			s = strings.ReplaceAll(s, secret, Redacted)
+		}
+	}
+	return s
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return redactString(v)
+	case error:
+		return redactString(v.Error())
+	case fmt.Stringer:
+		return redactString(v.String())
+	}
+
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return value
+	}
+
+	// Maps, slices and structs keep their structure unless a secret is inside
+	s := fmt.Sprintf("%+v", value)
+	if redacted := redactString(s); redacted != s {
+		return redacted
+	}
+	return value
+}
+
+func redactKeysAndValues(keysAndValues []interface{}) []interface{} {
+	out := make([]interface{}, len(keysAndValues))
+	for i := 0; i < len(keysAndValues); i += 2 {
+		out[i] = keysAndValues[i]
+		if i+1 >= len(keysAndValues) {
+			break
+		}
+		if key, ok := keysAndValues[i].(string); ok && isSensitiveKey(key) {
+			out[i+1] = Redacted
+		} else {
+			out[i+1] = redactValue(keysAndValues[i+1])
+		}
+	}
+	return out
+}
+
+// redactSink wraps the real sink and removes credentials and tokens from all
+// log lines before they are rendered.
+type redactSink struct {
+	sink logr.LogSink
+}
+
+var _ logr.LogSink = &redactSink{}
+var _ logr.CallDepthLogSink = &redactSink{}
+
+func (r *redactSink) Init(info logr.RuntimeInfo) {
+	// One more frame for the wrapper
+	info.CallDepth++
+	r.sink.Init(info)
+}
+
+func (r *redactSink) Enabled(level int) bool {
+	return r.sink.Enabled(level)
+}
+
+func (r *redactSink) Info(level int, msg string, keysAndValues ...interface{}) {
+	r.sink.Info(level, redactString(msg), redactKeysAndValues(keysAndValues)...)
+}
+
+func (r *redactSink) Error(err error, msg string, keysAndValues ...interface{}) {
+	if err != nil {
+		err = redactedError(redactString(err.Error()))
+	}
+	r.sink.Error(err, redactString(msg), redactKeysAndValues(keysAndValues)...)
+}
+
+func (r *redactSink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	return &redactSink{sink: r.sink.WithValues(redactKeysAndValues(keysAndValues)...)}
+}
+
+func (r *redactSink) WithName(name string) logr.LogSink {
+	return &redactSink{sink: r.sink.WithName(name)}
+}
+
+func (r *redactSink) WithCallDepth(depth int) logr.LogSink {
+	if withDepth, ok := r.sink.(logr.CallDepthLogSink); ok {
+		return &redactSink{sink: withDepth.WithCallDepth(depth)}
+	}
+	return r
+}
+
+type redactedError string
+
+func (e redactedError) Error() string {
+	return string(e)
+}
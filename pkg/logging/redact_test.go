@@ -0,0 +1,86 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logging
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+)
+
+func newTestLogger(out *[]string) logr.Logger {
+	l := funcr.NewJSON(func(obj string) {
+		*out = append(*out, obj)
+	}, funcr.Options{})
+	return logr.New(&redactSink{sink: l.GetSink()})
+}
+
+func TestRedaction(t *testing.T) {
+	var lines []string
+	logger := newTestLogger(&lines)
+
+	RegisterSecret("s3cr3t-password")
+	RegisterSecret("abc123-token")
+	defer ForgetSecret("s3cr3t-password")
+	defer ForgetSecret("abc123-token")
+
+	logger.WithValues(SystemKey, "fs1").Info("login with s3cr3t-password", "password", "anything", "response", map[string]string{"token": "abc123-token"})
+	logger.Error(errors.New("token isn't valid: abc123-token"), "request failed", "X-Auth-Token", "abc123-token", "status", 401)
+
+	all := strings.Join(lines, "\n")
+	for _, secret := range []string{"s3cr3t-password", "abc123-token", "anything"} {
+		if strings.Contains(all, secret) {
+			t.Errorf("secret %q should be redacted:\n%s", secret, all)
+		}
+	}
+	for _, kept := range []string{`"system":"fs1"`, `"status":401`, "request failed"} {
+		if !strings.Contains(all, kept) {
+			t.Errorf("%q should be kept:\n%s", kept, all)
+		}
+	}
+}
+
+func TestForgetSecret(t *testing.T) {
+	var lines []string
+	logger := newTestLogger(&lines)
+
+	RegisterSecret("old-token-value")
+	ForgetSecret("old-token-value")
+	RegisterSecret("abc")
+	defer ForgetSecret("abc")
+
+	logger.Info("old-token-value abc")
+	if !strings.Contains(lines[0], "old-token-value abc") {
+		t.Errorf("forgotten values and short secrets in free text should not be redacted: %s", lines[0])
+	}
+}
+
+func TestShortSecret(t *testing.T) {
+	var lines []string
+	logger := newTestLogger(&lines)
+
+	RegisterSecret("pw")
+	defer ForgetSecret("pw")
+
+	logger.Info("pw", "user", "pw", "path", "/pw/upload")
+	if strings.Contains(lines[0], `"pw"`) || !strings.Contains(lines[0], `"/pw/upload"`) {
+		t.Errorf("a short secret should be redacted from the values which are the secret only: %s", lines[0])
+	}
+}
@@ -19,14 +19,22 @@ package managers
 import (
 	"context"
 	"fmt"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/config"
 	drivermanager "github.com/IBM/ibm-storage-odf-block-driver/pkg/driver"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/logging"
 	"github.com/IBM/ibm-storage-odf-block-driver/pkg/rest"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/tracing"
 	operatorapi "github.com/IBM/ibm-storage-odf-operator/api/v1alpha1"
 	operutil "github.com/IBM/ibm-storage-odf-operator/controllers/util"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
-	log "k8s.io/klog"
+	"sort"
+	"strings"
 )
 
 const (
@@ -37,72 +45,90 @@ const (
 
 var Scheme = runtime.NewScheme()
 
-func GetManagers(namespace string, currentSystems map[string]*rest.FSRestClient) (map[string]*rest.FSRestClient, error) {
+func GetManagers(ctx context.Context, namespace string, currentSystems map[string]*rest.FSRestClient) (map[string]*rest.FSRestClient, error) {
 	var newSystems = make(map[string]*rest.FSRestClient)
 
+	ctx, span := tracing.Start(ctx, "GetManagers")
+	defer span.End()
+
 	fscMap, err := GetFscMap()
 	if err != nil {
-		log.Errorf("Read pool configmap failed, error: %v", err)
+		logging.Error(err, "Read pool configmap failed")
+		tracing.RecordError(span, err)
 		return nil, err
 	} else {
-		log.Infof("Read pool configmap %v", fscMap)
+		logging.V(logging.ScrapeLevel).Info("Read pool configmap", "systems", len(fscMap))
 	}
 
 	for fscName, fscScSecretMap := range fscMap {
-		if _, exist := currentSystems[fscName]; exist {
-			log.Infof("Using existing manager for %s", fscName)
-
-			restConfig, secretErr := GetStorageCredentials(currentSystems[fscName].DriverManager)
-			if secretErr != nil {
-				log.Error(secretErr)
-				continue
-			}
-			if authErr := currentSystems[fscName].UpdateCredentials(restConfig); authErr != nil {
-				log.Errorf("Failed to update FlashSystem credentials, error: %v", authErr)
-				continue
-			}
-			if err = CheckRestClientState(currentSystems[fscName], *currentSystems[fscName].DriverManager, nil); err != nil {
-				log.Errorf("Failed to check existing manager state, error: %v", err)
-				continue
-			}
-
-			currentSystems[fscName].DriverManager.UpdatePoolMap(fscScSecretMap.ScPoolMap)
-			newSystems[fscName] = currentSystems[fscName]
-		} else {
-			log.Infof("Create new manager for %s", fscName)
-			mgr, mgrErr := drivermanager.NewManager(Scheme, namespace, fscName, fscScSecretMap)
-			if mgrErr != nil {
-				log.Errorf("Initialize manager failed, error: %v", mgrErr)
-				continue
-			}
-
-			_, fscErr := mgr.GetFlashSystemClusterCR()
-			if fscErr != nil {
-				log.Errorf("Fail to get FlashSystemCluster CR, error: %v", fscErr)
-				continue
-			}
-
-			restConfig, SecretErr := GetStorageCredentials(&mgr)
-			if SecretErr != nil {
-				log.Errorf("Fail to get FlashSystemCluster secret, error: %v", SecretErr)
-				continue
-			}
-
-			restClient, restErr := newSystems[fscName].NewFSRestClient(restConfig, &mgr)
-			if err = CheckRestClientState(restClient, mgr, restErr); err != nil {
-				continue
-			}
-
+		systemCtx, systemSpan := tracing.Start(ctx, "GetManager", trace.WithAttributes(attribute.String(tracing.SystemKey, fscName)))
+		if restClient := getManager(systemCtx, namespace, fscName, fscScSecretMap, currentSystems); restClient != nil {
 			newSystems[fscName] = restClient
 		}
+		systemSpan.End()
 	}
+	span.SetAttributes(attribute.Int("systems", len(newSystems)))
 
 	return newSystems, nil
 }
 
-var GetStorageCredentials = func(d *drivermanager.DriverManager) (rest.Config, error) {
+// getManager returns the rest client of a flash system, nil if the system isn't ready.
+func getManager(ctx context.Context, namespace string, fscName string, fscScSecretMap operutil.FlashSystemClusterMapContent,
+	currentSystems map[string]*rest.FSRestClient) *rest.FSRestClient {
+	logger := logging.WithSystem(fscName)
+
+	if restClient, exist := currentSystems[fscName]; exist {
+		logger.V(logging.ScrapeLevel).Info("Using existing manager")
+
+		restConfig, secretErr := GetStorageCredentials(ctx, restClient.DriverManager)
+		if secretErr != nil {
+			logger.Error(secretErr, "Fail to get FlashSystemCluster secret")
+			return nil
+		}
+		restClient.UpdateConfig(config.Get())
+		if authErr := restClient.UpdateCredentials(ctx, restConfig); authErr != nil {
+			logger.Error(authErr, "Failed to update FlashSystem credentials")
+			return nil
+		}
+		if err := CheckRestClientState(ctx, restClient, *restClient.DriverManager, nil); err != nil {
+			logger.Error(err, "Failed to check existing manager state")
+			return nil
+		}
+
+		restClient.DriverManager.UpdatePoolMap(fscScSecretMap.ScPoolMap)
+		return restClient
+	}
+
+	logger.Info("Create new manager")
+	mgr, mgrErr := drivermanager.NewManager(Scheme, namespace, fscName, fscScSecretMap)
+	if mgrErr != nil {
+		logger.Error(mgrErr, "Initialize manager failed")
+		return nil
+	}
+
+	_, fscErr := mgr.GetFlashSystemClusterCR(ctx)
+	if fscErr != nil {
+		logger.Error(fscErr, "Fail to get FlashSystemCluster CR")
+		return nil
+	}
+
+	restConfig, SecretErr := GetStorageCredentials(ctx, &mgr)
+	if SecretErr != nil {
+		logger.Error(SecretErr, "Fail to get FlashSystemCluster secret")
+		return nil
+	}
+
+	restClient, restErr := new(rest.FSRestClient).NewFSRestClient(ctx, restConfig, &mgr)
+	if err := CheckRestClientState(ctx, restClient, mgr, restErr); err != nil {
+		return nil
+	}
+
+	return restClient
+}
+
+var GetStorageCredentials = func(ctx context.Context, d *drivermanager.DriverManager) (rest.Config, error) {
 	secret := &corev1.Secret{}
-	err := d.Client.Get(context.TODO(),
+	err := d.Client.Get(ctx,
 		types.NamespacedName{
 			Namespace: d.GetNamespaceName(),
 			Name:      d.GetSecretName()},
@@ -124,42 +150,110 @@ var GetFscMap = func() (map[string]operutil.FlashSystemClusterMapContent, error)
 	return operutil.ReadPoolConfigMapFile()
 }
 
-var CheckRestClientState = func(restClient *rest.FSRestClient, mgr drivermanager.DriverManager, err error) error {
+var CheckRestClientState = func(ctx context.Context, restClient *rest.FSRestClient, mgr drivermanager.DriverManager, err error) error {
 	if err != nil {
-		var _ = mgr.UpdateCondition(operatorapi.ExporterReady, false, drivermanager.AuthFailure, drivermanager.AuthFailureMessage)
-		log.Errorf("Fail to initialize rest client for %s, error: %s", mgr.GetSubsystemName(), err)
+		var _ = mgr.UpdateCondition(ctx, operatorapi.ExporterReady, false, drivermanager.AuthFailure, drivermanager.AuthFailureMessage)
+		mgr.Logger().Error(err, "Fail to initialize rest client")
 		return err
 	}
 
 	var valid bool
-	valid, err = restClient.CheckVersion()
+	valid, err = restClient.CheckVersion(ctx)
 	if err != nil {
-		log.Errorf("Flash system version check hit error: %s", err)
-		var _ = mgr.UpdateCondition(operatorapi.ExporterReady, false, drivermanager.RestFailure, drivermanager.RestErrorMessage)
+		mgr.Logger().Error(err, "Flash system version check hit error")
+		var _ = mgr.UpdateCondition(ctx, operatorapi.ExporterReady, false, drivermanager.RestFailure, drivermanager.RestErrorMessage)
 		return err
 	} else if !valid {
-		log.Error("Flash system version invalid")
-		var _ = mgr.UpdateCondition(operatorapi.ExporterReady, false, drivermanager.VersionCheckFailed, drivermanager.VersionCheckErrMessage)
+		mgr.Logger().Info("Flash system version invalid", "minimumVersion", config.Get().MinimumVersion)
+		var _ = mgr.UpdateCondition(ctx, operatorapi.ExporterReady, false, drivermanager.VersionCheckFailed,
+			fmt.Sprintf(drivermanager.VersionCheckErrMessage, config.Get().MinimumVersion))
 		return fmt.Errorf("flash system version invalid")
 	}
 
 	// Print the user role in log.
-	valid, err = restClient.CheckUserRole()
+	valid, err = restClient.CheckUserRole(ctx)
 	if err != nil {
-		log.Errorf("Flash system user role check hit errors: %s", err)
-		var _ = mgr.UpdateCondition(operatorapi.ExporterReady, false, drivermanager.RestFailure, drivermanager.RestErrorMessage)
+		mgr.Logger().Error(err, "Flash system user role check hit errors")
+		var _ = mgr.UpdateCondition(ctx, operatorapi.ExporterReady, false, drivermanager.RestFailure, drivermanager.RestErrorMessage)
 		return err
 	} else if !valid {
-		log.Error("Flash system user role invalid")
-		var _ = mgr.UpdateCondition(operatorapi.ExporterReady, false, drivermanager.RoleCheckFailed, drivermanager.RoleCheckErrMessage)
+		mgr.Logger().Info("Flash system user role invalid")
+		var _ = mgr.UpdateCondition(ctx, operatorapi.ExporterReady, false, drivermanager.RoleCheckFailed, drivermanager.RoleCheckErrMessage)
 		return fmt.Errorf("flash system user role invalid")
 	}
 
+	deniedCommands := restClient.DeniedCommands()
+	if len(deniedCommands) > 0 {
+		var _ = mgr.UpdateWarningCondition(ctx, drivermanager.MetricsIncomplete, true, drivermanager.PermissionDenied,
+			fmt.Sprintf(drivermanager.PermissionDeniedMessage, restClient.UserRole(), strings.Join(deniedCommands, ", ")))
+	} else {
+		var _ = mgr.UpdateWarningCondition(ctx, drivermanager.MetricsIncomplete, false, drivermanager.MetricsComplete, drivermanager.MetricsCompleteMessage)
+	}
+
 	// Update ready condition
 	{
-		var _ = mgr.UpdateCondition(operatorapi.ExporterReady, true, "", "")
-		var _ = mgr.UpdateCondition(operatorapi.StorageClusterReady, true, "", "")
-		log.Info("Exporter check done, ready to serve")
+		var _ = mgr.UpdateCondition(ctx, operatorapi.ExporterReady, true, "", "")
+		var _ = mgr.UpdateCondition(ctx, operatorapi.StorageClusterReady, true, "", "")
+		mgr.Logger().V(logging.ScrapeLevel).Info("Exporter check done, ready to serve")
 		return nil
 	}
 }
+
+// UpdateSiteCondition sets the SiteLost warning condition while a site of a
+// stretched or HyperSwap system has no online node.
+var UpdateSiteCondition = func(ctx context.Context, mgr *drivermanager.DriverManager, lostSites []string) error {
+	if len(lostSites) > 0 {
+		return mgr.UpdateWarningCondition(ctx, drivermanager.SiteLost, true, drivermanager.SiteOffline,
+			fmt.Sprintf(drivermanager.SiteOfflineMessage, strings.Join(lostSites, ", ")))
+	}
+	return mgr.UpdateWarningCondition(ctx, drivermanager.SiteLost, false, drivermanager.SitesOnline, drivermanager.SitesOnlineMessage)
+}
+
+// UpdatePoolCondition sets the PoolNotFound warning condition while pools used
+// by storage classes are missing on the system. missingPools maps the pool to
+// its storage classes.
+var UpdatePoolCondition = func(ctx context.Context, mgr *drivermanager.DriverManager, missingPools map[string][]string) error {
+	if len(missingPools) == 0 {
+		return mgr.UpdateWarningCondition(ctx, drivermanager.PoolNotFound, false, drivermanager.PoolsFound, drivermanager.PoolsFoundMessage)
+	}
+
+	var pools []string
+	for pool, scNames := range missingPools {
+		sorted := append([]string{}, scNames...)
+		sort.Strings(sorted)
+		pools = append(pools, fmt.Sprintf("%s (storage classes %s)", pool, strings.Join(sorted, ", ")))
+	}
+	sort.Strings(pools)
+	return mgr.UpdateWarningCondition(ctx, drivermanager.PoolNotFound, true, drivermanager.PoolMissing,
+		fmt.Sprintf(drivermanager.PoolMissingMessage, strings.Join(pools, ", ")))
+}
+
+var GetStorageClass = func(ctx context.Context, mgr *drivermanager.DriverManager, name string) (*storagev1.StorageClass, error) {
+	return mgr.GetStorageClass(ctx, name)
+}
+
+var ListPersistentVolumes = func(ctx context.Context, mgr *drivermanager.DriverManager) ([]corev1.PersistentVolume, error) {
+	return mgr.ListPersistentVolumes(ctx)
+}
+
+var ListVolumeSnapshotContents = func(ctx context.Context, mgr *drivermanager.DriverManager) ([]unstructured.Unstructured, error) {
+	return mgr.ListVolumeSnapshotContents(ctx)
+}
+
+// UpdateStorageClassCondition sets the StorageClassInvalid warning condition
+// while storage class parameters don't match their pool. mismatches maps the
+// storage class to the reasons.
+var UpdateStorageClassCondition = func(ctx context.Context, mgr *drivermanager.DriverManager, mismatches map[string][]string) error {
+	if len(mismatches) == 0 {
+		return mgr.UpdateWarningCondition(ctx, drivermanager.StorageClassInvalid, false, drivermanager.StorageClassesValid,
+			drivermanager.StorageClassesValidMessage)
+	}
+
+	var storageClasses []string
+	for sc, reasons := range mismatches {
+		storageClasses = append(storageClasses, fmt.Sprintf("%s (%s)", sc, strings.Join(reasons, ", ")))
+	}
+	sort.Strings(storageClasses)
+	return mgr.UpdateWarningCondition(ctx, drivermanager.StorageClassInvalid, true, drivermanager.ParameterMismatch,
+		fmt.Sprintf(drivermanager.ParameterMismatchMessage, strings.Join(storageClasses, ", ")))
+}
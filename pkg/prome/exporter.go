@@ -17,45 +17,118 @@
 package prome
 
 import (
+	"context"
+	"fmt"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	log "k8s.io/klog"
 
 	collector "github.com/IBM/ibm-storage-odf-block-driver/pkg/collectors"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/config"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/logging"
 	"github.com/IBM/ibm-storage-odf-block-driver/pkg/rest"
 )
 
+// shutdownTimeout bounds how long the scrapes in flight are waited for when
+// the http server is restarted on a new port.
+const shutdownTimeout = 30 * time.Second
+
 func RunExporter(restClients map[string]*rest.FSRestClient, namespace string) {
 	c, err := collector.NewPerfCollector(restClients, namespace)
 	if err != nil {
-		log.Warningf("NewFSPerfCollector fails, err:%s", err)
+		logging.Error(err, "NewFSPerfCollector fails")
 	}
 
 	// Use custom registry to remove default go metrics
 	r := prometheus.NewRegistry()
 	r.MustRegister(c)
 	handler := promhttp.HandlerFor(r, promhttp.HandlerOpts{})
-	http.Handle("/metrics", handler)
-
-	// prometheus.MustRegister(c)
-	// http.Handle("/metrics", promhttp.Handler())
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", handler)
+	mux.HandleFunc(collector.NoisyNeighborsPath, c.ServeNoisyNeighbors)
+	mux.HandleFunc(collector.OrphansPath, c.ServeOrphans)
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		var _, _ = w.Write([]byte(`<html>
             <head><title>Prometheus Exporter</title></head>
             <body>
             <h1>FlashSystem Overall Perf Prometheus Exporter </h1>
             <p><a href="/metrics">Metrics</a></p>
+            <p><a href="/noisyneighbors">Noisy neighbors</a></p>
+            <p><a href="/orphans">Orphaned volumes</a></p>
             </body>
             </html>`))
 	})
 
-	log.Info("Beginning to serve on port :9100")
-	// #nosec
-	if err = http.ListenAndServe(":9100", nil); err != nil { //#nosec G114
-		log.Error(err, "failed to start http server")
+	// Restart the http server when the port is changed by a config reload, only
+	// the latest port is kept while the server is still opening the previous one
+	portChanged := make(chan int, 1)
+	config.OnChange(func(oldConfig, newConfig config.ExporterConfig) {
+		if oldConfig.Port == newConfig.Port {
+			return
+		}
+		select {
+		case <-portChanged:
+		default:
+		}
+		select {
+		case portChanged <- newConfig.Port:
+		default:
+		}
+	})
+
+	port := config.Get().Port
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		logging.Error(err, "failed to start http server", "port", port)
 		panic(err)
 	}
+	for {
+		server := &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		serveErr := make(chan error, 1)
+		go func(listener net.Listener) {
+			serveErr <- server.Serve(listener)
+		}(listener)
+
+		logging.Info("Beginning to serve", "port", port)
+		listener = nextListener(port, portChanged, serveErr)
+		port = listener.Addr().(*net.TCPAddr).Port
+		logging.Info("Exporter port changed, restart http server", "port", port)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		if err = server.Shutdown(shutdownCtx); err != nil {
+			logging.Error(err, "failed to stop http server, close its connections")
+			_ = server.Close()
+		}
+		cancel()
+		<-serveErr
+	}
+}
+
+// nextListener waits for a port change, and returns the listener of the new
+// port. The server keeps serving on the old port while the new port can't be
+// opened.
+func nextListener(port int, portChanged <-chan int, serveErr <-chan error) net.Listener {
+	for {
+		select {
+		case err := <-serveErr:
+			logging.Error(err, "http server failed", "port", port)
+			panic(err)
+		case newPort := <-portChanged:
+			if newPort == port {
+				continue
+			}
+			listener, err := net.Listen("tcp", fmt.Sprintf(":%d", newPort))
+			if err != nil {
+				logging.Error(err, "failed to open the new exporter port, keep serving on the old port", "port", newPort, "oldPort", port)
+				continue
+			}
+			return listener
+		}
+	}
 }
@@ -0,0 +1,174 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"sort"
+)
+
+type CapabilityKind string
+
+const (
+	CapabilityCommand CapabilityKind = "command"
+	CapabilityField   CapabilityKind = "field"
+	CapabilityFeature CapabilityKind = "feature"
+)
+
+// Commands
+const (
+	CommandLssystemstats         = "lssystemstats"
+	CommandLsnodestats           = "lsnodestats"
+	CommandLsnodecanisterstats   = "lsnodecanisterstats"
+	CommandLsquorum              = "lsquorum"
+	CommandLsrcrelationship      = "lsrcrelationship"
+	CommandLsvdisk               = "lsvdisk"
+	CommandLssevdiskcopy         = "lssevdiskcopy"
+	CommandLsdumps               = "lsdumps"
+	CommandDownload              = "download"
+	CommandLsfcmap               = "lsfcmap"
+	CommandLsvolumesnapshot      = "lsvolumesnapshot"
+	CommandLspartition           = "lspartition"
+	CommandLsmigrate             = "lsmigrate"
+	CommandLsvdiskcopy           = "lsvdiskcopy"
+	CommandLsvdisksyncprogress   = "lsvdisksyncprogress"
+	CommandLsarraysyncprogress   = "lsarraysyncprogress"
+	CommandLsarraymemberprogress = "lsarraymemberprogress"
+	CommandLsarray               = "lsarray"
+	CommandLsarraymember         = "lsarraymember"
+	CommandLsdrive               = "lsdrive"
+)
+
+// Fields, named as <command>.<field>
+const (
+	FieldMDiskEffectiveUsedCapacity = "lsmdisk.effective_used_capacity"
+	FieldPoolReclaimableCapacity    = "lsmdiskgrp.reclaimable_capacity"
+	FieldPoolPhysicalCapacity       = "lsmdiskgrp.physical_capacity"
+	FieldPoolUsedBeforeReduction    = "lsmdiskgrp.used_capacity_before_reduction"
+	FieldPoolDedupSaving            = "lsmdiskgrp.deduplication_capacity_saving"
+	FieldSystemPhysicalCapacity     = "lssystem.physical_capacity"
+)
+
+// Features
+const (
+	FeatureDataReductionPool = "data_reduction_pool"
+	FeatureDeduplication     = "deduplication"
+	FeatureFCMCompression    = "fcm_compression"
+	FeatureSnapshots         = "snapshots"
+	FeaturePartitions        = "storage_partitions"
+	FeatureHyperSwap         = "hyperswap"
+	FeatureDistributedRAID   = "distributed_raid"
+)
+
+type Capability struct {
+	Name       string
+	Kind       CapabilityKind
+	MinVersion string
+}
+
+// CapabilityMatrix lists the Storage Virtualize code level which introduced
+// each command, field and feature the exporter depends on.
+var CapabilityMatrix = []Capability{
+	{CommandLssystemstats, CapabilityCommand, "7.2"},
+	{CommandLsnodestats, CapabilityCommand, "7.2"},
+	{CommandLsnodecanisterstats, CapabilityCommand, "7.2"},
+	{CommandLsquorum, CapabilityCommand, "7.2"},
+	{CommandLsrcrelationship, CapabilityCommand, "7.2"},
+	{CommandLsvdisk, CapabilityCommand, "7.2"},
+	{CommandLssevdiskcopy, CapabilityCommand, "7.2"},
+	{CommandLsdumps, CapabilityCommand, "7.2"},
+	{CommandLsfcmap, CapabilityCommand, "7.2"},
+	{CommandLsvolumesnapshot, CapabilityCommand, "8.5.2"},
+	{CommandLspartition, CapabilityCommand, "8.6.1"},
+	{CommandLsmigrate, CapabilityCommand, "7.2"},
+	{CommandLsvdiskcopy, CapabilityCommand, "7.2"},
+	{CommandLsvdisksyncprogress, CapabilityCommand, "7.2"},
+	{CommandLsarraysyncprogress, CapabilityCommand, "7.2"},
+	{CommandLsarraymemberprogress, CapabilityCommand, "7.2"},
+	{CommandLsarray, CapabilityCommand, "7.2"},
+	{CommandLsarraymember, CapabilityCommand, "7.2"},
+	{CommandLsdrive, CapabilityCommand, "7.2"},
+
+	{FieldPoolReclaimableCapacity, CapabilityField, "8.1.2"},
+	{FieldPoolDedupSaving, CapabilityField, "8.1.2"},
+	{FieldPoolUsedBeforeReduction, CapabilityField, "8.1.3"},
+	{FieldSystemPhysicalCapacity, CapabilityField, "8.1.3"},
+	{FieldPoolPhysicalCapacity, CapabilityField, "8.2.1"},
+	{FieldMDiskEffectiveUsedCapacity, CapabilityField, "8.2.1"},
+
+	{FeatureDataReductionPool, CapabilityFeature, "8.1.2"},
+	{FeatureDeduplication, CapabilityFeature, "8.1.2"},
+	{FeatureFCMCompression, CapabilityFeature, "8.2.1"},
+	{FeatureSnapshots, CapabilityFeature, "8.5.2"},
+	{FeaturePartitions, CapabilityFeature, "8.6.1"},
+	{FeatureHyperSwap, CapabilityFeature, "7.5"},
+	{FeatureDistributedRAID, CapabilityFeature, "7.6"},
+}
+
+// Capabilities of a flash system, derived from its code level
+type Capabilities struct {
+	CodeLevel string
+	supported map[string]bool
+}
+
+func CapabilitiesForCodeLevel(codeLevel string) Capabilities {
+	caps := Capabilities{CodeLevel: codeLevel, supported: map[string]bool{}}
+	for _, capability := range CapabilityMatrix {
+		caps.supported[capability.Name] = CompareVersion(codeLevel, capability.MinVersion) >= 0
+	}
+	return caps
+}
+
+// Known returns false before the code level is detected.
+func (c Capabilities) Known() bool {
+	return c.supported != nil
+}
+
+// Has returns whether the capability is available. Everything is assumed to be
+// available before the code level is detected, and names missing in the
+// matrix aren't gated.
+func (c Capabilities) Has(name string) bool {
+	if !c.Known() {
+		return true
+	}
+	supported, ok := c.supported[name]
+	return !ok || supported
+}
+
+// Supported returns the names of the available capabilities, sorted.
+func (c Capabilities) Supported() []string {
+	var names []string
+	for name, supported := range c.supported {
+		if supported {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CompareVersion compares two code levels such as 8.4.0.2, the result is -1, 0 or 1.
+func CompareVersion(a, b string) int {
+	na := normalizeVersion(a, 2, 4)
+	nb := normalizeVersion(b, 2, 4)
+	switch {
+	case na < nb:
+		return -1
+	case na > nb:
+		return 1
+	}
+	return 0
+}
@@ -18,6 +18,7 @@ package rest
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
@@ -26,12 +27,18 @@ import (
 	"net"
 	"net/http"
 	"reflect"
+	"sync"
 	"time"
 
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/config"
 	drivermanager "github.com/IBM/ibm-storage-odf-block-driver/pkg/driver"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/logging"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/tracing"
 
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
-	log "k8s.io/klog"
 )
 
 type Config struct {
@@ -40,10 +47,6 @@ type Config struct {
 	Password string
 }
 
-const (
-	FailedEventThreshold = time.Minute * 2 // 2 minutes
-)
-
 type FSRestClient struct {
 	Client        *http.Client
 	RestConfig    Config
@@ -52,8 +55,22 @@ type FSRestClient struct {
 	DriverManager *drivermanager.DriverManager
 	PostRequester *Requester
 
+	// lock guards BaseURL, Client and token, a config reload replaces them
+	// while other scrapes send requests
+	lock sync.RWMutex
+
 	failedTime time.Time
 	bNotified  bool
+	restPort   int
+
+	// systemLock guards the system settings and the denied commands, the
+	// scrapes of several Prometheus replicas update them concurrently
+	systemLock     sync.RWMutex
+	capabilities   Capabilities
+	topology       string
+	location       *time.Location
+	userRole       string
+	deniedCommands map[string]time.Time
 }
 
 // For easy mock the request response
@@ -67,7 +84,7 @@ func NewRequester(p Poster) *Requester {
 	return &Requester{poster: p}
 }
 
-func (c *FSRestClient) NewFSRestClient(config Config, driverManager *drivermanager.DriverManager) (*FSRestClient, error) {
+func (c *FSRestClient) NewFSRestClient(ctx context.Context, restConfig Config, driverManager *drivermanager.DriverManager) (*FSRestClient, error) {
 	tr := &http.Transport{
 		// #nosec
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
@@ -78,41 +95,92 @@ func (c *FSRestClient) NewFSRestClient(config Config, driverManager *drivermanag
 		MaxIdleConnsPerHost: 1024,
 	}
 
+	exporterConfig := config.Get()
 	client := &http.Client{
-		Timeout:   time.Second * 15,
+		Timeout:   exporterConfig.HTTPTimeout.Duration,
 		Transport: tr,
 	}
 
 	cl := &FSRestClient{
 		Client:        client,
-		BaseURL:       fmt.Sprintf("https://%s:7443/rest", config.Host),
-		RestConfig:    config,
+		BaseURL:       buildBaseURL(restConfig.Host, exporterConfig.RestPort),
+		RestConfig:    restConfig,
 		token:         nil,
 		DriverManager: driverManager,
 		PostRequester: NewRequester(doRequest),
+		restPort:      exporterConfig.RestPort,
 	}
 
-	if err := cl.authenticate(); err != nil {
+	if err := cl.authenticate(ctx); err != nil {
 		return nil, err
 	}
 
 	return cl, nil
 }
 
+func buildBaseURL(host string, port int) string {
+	return fmt.Sprintf("https://%s:%d/rest", host, port)
+}
+
+// endpoint returns the base URL of the rest server and the http client.
+func (c *FSRestClient) endpoint() (string, *http.Client) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.BaseURL, c.Client
+}
+
+func (c *FSRestClient) getToken() *string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.token
+}
+
+func (c *FSRestClient) setToken(token *string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.token = token
+}
+
+// logger returns a logger with the flash system name on every line.
+func (c *FSRestClient) logger() logr.Logger {
+	if c.DriverManager != nil {
+		return c.DriverManager.Logger()
+	}
+	return logging.Logger()
+}
+
+func (c *FSRestClient) startSpan(ctx context.Context, spanName string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if c.DriverManager != nil {
+		attrs = append(attrs, attribute.String(tracing.SystemKey, c.DriverManager.SystemName))
+	}
+	return tracing.Start(ctx, spanName, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
 type authenResult map[string]interface{}
 
-func (c *FSRestClient) authenticate() error {
-	if !c.bNotified && !c.failedTime.Equal(time.Time{}) && time.Since(c.failedTime) > FailedEventThreshold {
+func (c *FSRestClient) authenticate(ctx context.Context) (err error) {
+	ctx, span := c.startSpan(ctx, "rest auth")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	if !c.bNotified && !c.failedTime.Equal(time.Time{}) && time.Since(c.failedTime) > config.Get().FailedEventThreshold.Duration {
 		mgr := c.DriverManager
 		if mgr != nil {
-			if err := mgr.SendK8sEvent(corev1.EventTypeWarning, drivermanager.AuthFailure, drivermanager.AuthFailureMessage); err == nil {
+			if err := mgr.SendK8sEvent(ctx, corev1.EventTypeWarning, drivermanager.AuthFailure, drivermanager.AuthFailureMessage); err == nil {
 				c.bNotified = true
 			}
 		}
 	}
 
-	c.token = nil
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/%s", c.BaseURL, "auth"), nil)
+	if token := c.getToken(); token != nil {
+		logging.ForgetSecret(*token)
+	}
+	c.setToken(nil)
+	logging.RegisterSecret(c.RestConfig.Password)
+	baseURL, client := c.endpoint()
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/%s", baseURL, "auth"), nil)
 	if err != nil {
 		if c.failedTime.Equal(time.Time{}) {
 			c.failedTime = time.Now()
@@ -125,7 +193,7 @@ func (c *FSRestClient) authenticate() error {
 
 	req.Header.Set("Connection", "keep-alive")
 
-	resp, err := c.Client.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		if c.failedTime.Equal(time.Time{}) {
 			c.failedTime = time.Now()
@@ -133,6 +201,7 @@ func (c *FSRestClient) authenticate() error {
 		return err
 	}
 
+	span.SetAttributes(attribute.Int(tracing.StatusCodeKey, resp.StatusCode))
 	if resp.StatusCode != 200 {
 		if c.failedTime.Equal(time.Time{}) {
 			c.failedTime = time.Now()
@@ -164,7 +233,8 @@ func (c *FSRestClient) authenticate() error {
 		if c.failedTime.Equal(time.Time{}) {
 			c.failedTime = time.Now()
 		}
-		return fmt.Errorf("token isn't included, %v", out)
+		// Never echo the response, it may contain credentials
+		return errors.New("token isn't included in the authentication response")
 	}
 
 	tokenType := reflect.TypeOf(token).Kind()
@@ -172,16 +242,18 @@ func (c *FSRestClient) authenticate() error {
 		if c.failedTime.Equal(time.Time{}) {
 			c.failedTime = time.Now()
 		}
-		return fmt.Errorf("token type isn't string, %v, %s", token, tokenType)
+		return fmt.Errorf("token type isn't string, %s", tokenType)
 	}
 
 	tokenStr := token.(string)
-	c.token = &tokenStr
+	logging.RegisterSecret(tokenStr)
+	c.setToken(&tokenStr)
+	c.logger().Info("Authenticated to flash system rest server")
 
 	if c.bNotified {
 		mgr := c.DriverManager
 		if mgr != nil {
-			if err = mgr.SendK8sEvent(corev1.EventTypeNormal, drivermanager.AuthSuccess, drivermanager.AuthSuccessMessage); err == nil {
+			if err = mgr.SendK8sEvent(ctx, corev1.EventTypeNormal, drivermanager.AuthSuccess, drivermanager.AuthSuccessMessage); err == nil {
 				c.bNotified = false
 			}
 		}
@@ -191,35 +263,81 @@ func (c *FSRestClient) authenticate() error {
 	return nil
 }
 
-func (c *FSRestClient) retryDo(url string, jsonStr string) ([]byte, error) {
+// retryDo posts the command, a rest path such as lsmdisk/12, to the rest server.
+func (c *FSRestClient) retryDo(ctx context.Context, command string, jsonStr string) (body []byte, err error) {
+	baseURL, _ := c.endpoint()
+	url := baseURL + "/" + command
+	logger := c.logger().WithValues(logging.CommandKey, command)
+
+	ctx, span := c.startSpan(ctx, "rest "+command, attribute.String(tracing.CommandKey, command))
+	attempt := 0
+	statusCode := 0
+	defer func() {
+		span.SetAttributes(
+			attribute.Int(tracing.AttemptsKey, attempt),
+			attribute.Int(tracing.StatusCodeKey, statusCode),
+			attribute.Int(tracing.ResponseBytesKey, len(body)),
+		)
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	if !c.IsPermitted(command) {
+		return nil, &PermissionError{Command: commandName(command), Role: c.UserRole()}
+	}
+
 	var reqBody io.Reader = nil
 	if len(jsonStr) > 0 {
 		reqBody = bytes.NewBufferString(jsonStr)
 	}
-	req, err := http.NewRequest("POST", url, reqBody)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, reqBody)
 	if reqBody != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
 	if err != nil {
-		log.Errorf("Create request error for url: %s", url)
+		logger.Error(err, "Create request error")
 		return nil, err
 	}
-	body, statusCode, err := c.PostRequester.poster(req, c)
+	post := func() {
+		attempt++
+		body, statusCode, err = c.PostRequester.poster(req, c)
+		span.AddEvent("attempt", trace.WithAttributes(
+			attribute.Int(tracing.AttemptKey, attempt),
+			attribute.Int(tracing.StatusCodeKey, statusCode),
+			attribute.Int(tracing.ResponseBytesKey, len(body)),
+		))
+	}
+	post()
 
-	retryCnt := 2
-	for i := 0; i < retryCnt-1; i++ {
+	retryCnt := config.Get().RetryCount
+	reauthenticated := false
+	for i := 0; ; i++ {
 		if len(body) > 0 && statusCode >= http.StatusOK && statusCode < http.StatusBadRequest {
+			logger.V(logging.ScrapeLevel).Info("Http request done", "status", statusCode, "attempt", i+1, "bytes", len(body))
 			return body, err
 		}
+		// An expired token may be forbidden too, so a forbidden request is
+		// retried once with a fresh token whatever the retry count
+		forbidden := statusCode == http.StatusForbidden
+		if (forbidden && reauthenticated) || (!forbidden && i >= retryCnt-1) {
+			break
+		}
 
 		// Sometimes got the 'Invalid token error'.
 		// Set the token to nil to do reauthentication
-		c.token = nil
-		body, statusCode, err = c.PostRequester.poster(req, c)
+		c.setToken(nil)
+		reauthenticated = true
+		post()
+	}
+
+	if statusCode == http.StatusForbidden {
+		// The token is fresh, the user role isn't permitted to run the command
+		c.denyCommand(commandName(command))
+		return nil, &PermissionError{Command: commandName(command), Role: c.UserRole()}
 	}
 
 	if statusCode >= http.StatusBadRequest {
-		log.Errorf("Http request path %s response code is: %d after retry %d times", req.URL.Path, statusCode, retryCnt)
+		logger.Info("Http request failed after retry", "path", req.URL.Path, "status", statusCode, "attempts", retryCnt)
 		if err == nil {
 			err = errors.New("POST Request " + req.URL.Path + " error.")
 		}
@@ -233,16 +351,21 @@ func doRequest(req *http.Request, c *FSRestClient) ([]byte, int, error) {
 		return nil, http.StatusBadRequest, errors.New("invalid parameter, abort")
 	}
 
-	if c.token == nil {
-		if err := c.authenticate(); err != nil {
-			log.Errorf("fails to authenticate rest server, err:%v", err)
+	token := c.getToken()
+	if token == nil {
+		if err := c.authenticate(req.Context()); err != nil {
+			c.logger().Error(err, "fails to authenticate rest server")
 			return nil, http.StatusUnauthorized, err
 		}
+		if token = c.getToken(); token == nil {
+			return nil, http.StatusUnauthorized, errors.New("token was reset during the authentication")
+		}
 	}
 
-	req.Header.Set("X-Auth-Token", *c.token)
+	req.Header.Set("X-Auth-Token", *token)
 
-	resp, err := c.Client.Do(req)
+	_, client := c.endpoint()
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, http.StatusUnauthorized, err
 	}
@@ -255,16 +378,16 @@ func doRequest(req *http.Request, c *FSRestClient) ([]byte, int, error) {
 
 type StorageSystem map[string]interface{}
 
-func (c *FSRestClient) Lssystem() (StorageSystem, error) {
+func (c *FSRestClient) Lssystem(ctx context.Context) (StorageSystem, error) {
 	jsonStr := `{"gui":true,"bytes":true}`
-	body, err := c.retryDo(fmt.Sprintf("%s/%s", c.BaseURL, "lssystem"), jsonStr)
+	body, err := c.retryDo(ctx, "lssystem", jsonStr)
 	if err != nil {
 		return nil, err
 	}
 
 	var storagesystem StorageSystem
 	if err = json.Unmarshal(body, &storagesystem); err != nil {
-		log.Errorf("Lssystem err %v, body %s", err, body)
+		c.logger().Error(err, "Unmarshal response failed", logging.CommandKey, "lssystem", "body", string(body))
 		return nil, err
 	}
 
@@ -273,15 +396,15 @@ func (c *FSRestClient) Lssystem() (StorageSystem, error) {
 
 type Nodes []map[string]string
 
-func (c *FSRestClient) Lsnode() (Nodes, error) {
-	body, err := c.retryDo(fmt.Sprintf("%s/%s", c.BaseURL, "lsnode"), "")
+func (c *FSRestClient) Lsnode(ctx context.Context) (Nodes, error) {
+	body, err := c.retryDo(ctx, "lsnode", "")
 	if err != nil {
 		return nil, err
 	}
 
 	var nodes Nodes
 	if err = json.Unmarshal(body, &nodes); err != nil {
-		log.Errorf("Lsnode err %v, body %s", err, body)
+		c.logger().Error(err, "Unmarshal response failed", logging.CommandKey, "lsnode", "body", string(body))
 		return nil, err
 	}
 
@@ -290,32 +413,337 @@ func (c *FSRestClient) Lsnode() (Nodes, error) {
 
 type SystemStats []map[string]string
 
-func (c *FSRestClient) Lssystemstats() (SystemStats, error) {
-	body, err := c.retryDo(fmt.Sprintf("%s/%s", c.BaseURL, "lssystemstats"), "")
+func (c *FSRestClient) Lssystemstats(ctx context.Context) (SystemStats, error) {
+	body, err := c.retryDo(ctx, "lssystemstats", "")
 	if err != nil {
 		return nil, err
 	}
 
 	var stats SystemStats
 	if err = json.Unmarshal(body, &stats); err != nil {
-		log.Errorf("lssystemstats err %v, body %s", err, body)
+		c.logger().Error(err, "Unmarshal response failed", logging.CommandKey, "lssystemstats", "body", string(body))
 		return nil, err
 	}
 
 	return stats, nil
 }
 
+// Node stats, result of lsnodestats and lsnodecanisterstats
+type NodeStats []map[string]string
+
+func (c *FSRestClient) Lsnodestats(ctx context.Context) (NodeStats, error) {
+	return c.lsNodeStats(ctx, CommandLsnodestats)
+}
+
+func (c *FSRestClient) Lsnodecanisterstats(ctx context.Context) (NodeStats, error) {
+	return c.lsNodeStats(ctx, CommandLsnodecanisterstats)
+}
+
+func (c *FSRestClient) lsNodeStats(ctx context.Context, command string) (NodeStats, error) {
+	body, err := c.retryDo(ctx, command, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var stats NodeStats
+	if err = json.Unmarshal(body, &stats); err != nil {
+		c.logger().Error(err, "Unmarshal response failed", logging.CommandKey, command, "body", string(body))
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+type Quorums []map[string]string
+
+func (c *FSRestClient) Lsquorum(ctx context.Context) (Quorums, error) {
+	body, err := c.retryDo(ctx, CommandLsquorum, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var quorums Quorums
+	if err = json.Unmarshal(body, &quorums); err != nil {
+		c.logger().Error(err, "Unmarshal response failed", logging.CommandKey, CommandLsquorum, "body", string(body))
+		return nil, err
+	}
+
+	return quorums, nil
+}
+
+// Remote copy relationships, HyperSwap volumes have the activeactive copy type
+type RCRelationships []map[string]string
+
+func (c *FSRestClient) Lsrcrelationship(ctx context.Context) (RCRelationships, error) {
+	body, err := c.retryDo(ctx, CommandLsrcrelationship, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var relationships RCRelationships
+	if err = json.Unmarshal(body, &relationships); err != nil {
+		c.logger().Error(err, "Unmarshal response failed", logging.CommandKey, CommandLsrcrelationship, "body", string(body))
+		return nil, err
+	}
+
+	return relationships, nil
+}
+
+// Volume list, result of lsvdisk
+type Volumes []map[string]string
+
+func (c *FSRestClient) Lsvdisk(ctx context.Context) (Volumes, error) {
+	jsonStr := `{"bytes":true}`
+	body, err := c.retryDo(ctx, CommandLsvdisk, jsonStr)
+	if err != nil {
+		return nil, err
+	}
+
+	var volumes Volumes
+	if err = json.Unmarshal(body, &volumes); err != nil {
+		c.logger().Error(err, "Unmarshal response failed", logging.CommandKey, CommandLsvdisk, "body", string(body))
+		return nil, err
+	}
+
+	return volumes, nil
+}
+
+// Thin provisioned and compressed volume copies, result of lssevdiskcopy
+type VolumeCopies []map[string]string
+
+func (c *FSRestClient) Lssevdiskcopy(ctx context.Context) (VolumeCopies, error) {
+	jsonStr := `{"bytes":true}`
+	body, err := c.retryDo(ctx, CommandLssevdiskcopy, jsonStr)
+	if err != nil {
+		return nil, err
+	}
+
+	var copies VolumeCopies
+	if err = json.Unmarshal(body, &copies); err != nil {
+		c.logger().Error(err, "Unmarshal response failed", logging.CommandKey, CommandLssevdiskcopy, "body", string(body))
+		return nil, err
+	}
+
+	return copies, nil
+}
+
+// FlashCopy mappings, result of lsfcmap
+type FCMaps []map[string]string
+
+func (c *FSRestClient) Lsfcmap(ctx context.Context) (FCMaps, error) {
+	body, err := c.retryDo(ctx, CommandLsfcmap, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var fcmaps FCMaps
+	if err = json.Unmarshal(body, &fcmaps); err != nil {
+		c.logger().Error(err, "Unmarshal response failed", logging.CommandKey, CommandLsfcmap, "body", string(body))
+		return nil, err
+	}
+
+	return fcmaps, nil
+}
+
+// Progress of the background operations, result of lsmigrate,
+// lsvdisksyncprogress, lsarraysyncprogress and lsarraymemberprogress
+type Operations []map[string]string
+
+func (c *FSRestClient) Lsmigrate(ctx context.Context) (Operations, error) {
+	return c.listOperations(ctx, CommandLsmigrate)
+}
+
+func (c *FSRestClient) Lsvdisksyncprogress(ctx context.Context) (Operations, error) {
+	return c.listOperations(ctx, CommandLsvdisksyncprogress)
+}
+
+func (c *FSRestClient) Lsarraysyncprogress(ctx context.Context) (Operations, error) {
+	return c.listOperations(ctx, CommandLsarraysyncprogress)
+}
+
+func (c *FSRestClient) Lsarraymemberprogress(ctx context.Context) (Operations, error) {
+	return c.listOperations(ctx, CommandLsarraymemberprogress)
+}
+
+func (c *FSRestClient) listOperations(ctx context.Context, command string) (Operations, error) {
+	body, err := c.retryDo(ctx, command, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var operations Operations
+	if err = json.Unmarshal(body, &operations); err != nil {
+		c.logger().Error(err, "Unmarshal response failed", logging.CommandKey, command, "body", string(body))
+		return nil, err
+	}
+
+	return operations, nil
+}
+
+// All copies of the volumes, result of lsvdiskcopy
+func (c *FSRestClient) Lsvdiskcopy(ctx context.Context) (VolumeCopies, error) {
+	jsonStr := `{"bytes":true}`
+	body, err := c.retryDo(ctx, CommandLsvdiskcopy, jsonStr)
+	if err != nil {
+		return nil, err
+	}
+
+	var copies VolumeCopies
+	if err = json.Unmarshal(body, &copies); err != nil {
+		c.logger().Error(err, "Unmarshal response failed", logging.CommandKey, CommandLsvdiskcopy, "body", string(body))
+		return nil, err
+	}
+
+	return copies, nil
+}
+
+// Snapshots of the volumes, result of lsvolumesnapshot
+type VolumeSnapshots []map[string]string
+
+func (c *FSRestClient) Lsvolumesnapshot(ctx context.Context) (VolumeSnapshots, error) {
+	jsonStr := `{"bytes":true}`
+	body, err := c.retryDo(ctx, CommandLsvolumesnapshot, jsonStr)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots VolumeSnapshots
+	if err = json.Unmarshal(body, &snapshots); err != nil {
+		c.logger().Error(err, "Unmarshal response failed", logging.CommandKey, CommandLsvolumesnapshot, "body", string(body))
+		return nil, err
+	}
+
+	return snapshots, nil
+}
+
+// RAID arrays, result of lsarray
+type Arrays []map[string]string
+
+func (c *FSRestClient) Lsarray(ctx context.Context) (Arrays, error) {
+	jsonStr := `{"bytes":true}`
+	body, err := c.retryDo(ctx, CommandLsarray, jsonStr)
+	if err != nil {
+		return nil, err
+	}
+
+	var arrays Arrays
+	if err = json.Unmarshal(body, &arrays); err != nil {
+		c.logger().Error(err, "Unmarshal response failed", logging.CommandKey, CommandLsarray, "body", string(body))
+		return nil, err
+	}
+
+	return arrays, nil
+}
+
+// LsSingleArray returns the detailed view of an array, which has the rebuild
+// areas of a distributed array.
+func (c *FSRestClient) LsSingleArray(ctx context.Context, arrayID string) (map[string]string, error) {
+	jsonStr := `{"bytes":true}`
+	body, err := c.retryDo(ctx, CommandLsarray+"/"+arrayID, jsonStr)
+	if err != nil {
+		return nil, err
+	}
+
+	var array map[string]string
+	if err = json.Unmarshal(body, &array); err != nil {
+		c.logger().Error(err, "Unmarshal response failed", logging.CommandKey, CommandLsarray, "array", arrayID, "body", string(body))
+		return nil, err
+	}
+
+	return array, nil
+}
+
+// Members of the arrays, result of lsarraymember
+type ArrayMembers []map[string]string
+
+func (c *FSRestClient) Lsarraymember(ctx context.Context) (ArrayMembers, error) {
+	body, err := c.retryDo(ctx, CommandLsarraymember, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var members ArrayMembers
+	if err = json.Unmarshal(body, &members); err != nil {
+		c.logger().Error(err, "Unmarshal response failed", logging.CommandKey, CommandLsarraymember, "body", string(body))
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// Drives, result of lsdrive
+type Drives []map[string]string
+
+func (c *FSRestClient) Lsdrive(ctx context.Context) (Drives, error) {
+	jsonStr := `{"bytes":true}`
+	body, err := c.retryDo(ctx, CommandLsdrive, jsonStr)
+	if err != nil {
+		return nil, err
+	}
+
+	var drives Drives
+	if err = json.Unmarshal(body, &drives); err != nil {
+		c.logger().Error(err, "Unmarshal response failed", logging.CommandKey, CommandLsdrive, "body", string(body))
+		return nil, err
+	}
+
+	return drives, nil
+}
+
+// LsSingleDrive returns the detailed view of a drive, which has the firmware
+// level, the write endurance and the capacity of a FlashCore Module.
+func (c *FSRestClient) LsSingleDrive(ctx context.Context, driveID string) (map[string]string, error) {
+	jsonStr := `{"bytes":true}`
+	body, err := c.retryDo(ctx, CommandLsdrive+"/"+driveID, jsonStr)
+	if err != nil {
+		return nil, err
+	}
+
+	var drive map[string]string
+	if err = json.Unmarshal(body, &drive); err != nil {
+		c.logger().Error(err, "Unmarshal response failed", logging.CommandKey, CommandLsdrive, "drive", driveID, "body", string(body))
+		return nil, err
+	}
+
+	return drive, nil
+}
+
+// Dump files of a directory such as /dumps/iostats, result of lsdumps
+type Dumps []map[string]string
+
+func (c *FSRestClient) Lsdumps(ctx context.Context, prefix string) (Dumps, error) {
+	jsonStr := fmt.Sprintf(`{"prefix":%q}`, prefix)
+	body, err := c.retryDo(ctx, CommandLsdumps, jsonStr)
+	if err != nil {
+		return nil, err
+	}
+
+	var dumps Dumps
+	if err = json.Unmarshal(body, &dumps); err != nil {
+		c.logger().Error(err, "Unmarshal response failed", logging.CommandKey, CommandLsdumps, "body", string(body))
+		return nil, err
+	}
+
+	return dumps, nil
+}
+
+// Download returns the content of a dump file of the config node.
+func (c *FSRestClient) Download(ctx context.Context, prefix string, filename string) ([]byte, error) {
+	jsonStr := fmt.Sprintf(`{"prefix":%q,"filename":%q}`, prefix, filename)
+	return c.retryDo(ctx, CommandDownload, jsonStr)
+}
+
 type Users []map[string]interface{}
 
-func (c *FSRestClient) Lscurrentuser() (Users, error) {
-	body, err := c.retryDo(fmt.Sprintf("%s/%s", c.BaseURL, "lscurrentuser"), "")
+func (c *FSRestClient) Lscurrentuser(ctx context.Context) (Users, error) {
+	body, err := c.retryDo(ctx, "lscurrentuser", "")
 	if err != nil {
 		return nil, err
 	}
 
 	var users Users
 	if err = json.Unmarshal(body, &users); err != nil {
-		log.Errorf("Lscurrentuser err %v, body %s", err, body)
+		c.logger().Error(err, "Unmarshal response failed", logging.CommandKey, "lscurrentuser", "body", string(body))
 		return nil, err
 	}
 
@@ -325,16 +753,16 @@ func (c *FSRestClient) Lscurrentuser() (Users, error) {
 // Pool list, result of lsmdiskgrp
 type PoolList []map[string]interface{}
 
-func (c *FSRestClient) Lsmdiskgrp() (PoolList, error) {
+func (c *FSRestClient) Lsmdiskgrp(ctx context.Context) (PoolList, error) {
 	jsonStr := `{"gui":true,"bytes":true}`
-	body, err := c.retryDo(fmt.Sprintf("%s/%s", c.BaseURL, "lsmdiskgrp"), jsonStr)
+	body, err := c.retryDo(ctx, "lsmdiskgrp", jsonStr)
 	if err != nil {
 		return nil, err
 	}
 
 	var stats PoolList
 	if err = json.Unmarshal(body, &stats); err != nil {
-		log.Errorf("Lsmdiskgrp err %v, body %s", err, body)
+		c.logger().Error(err, "Unmarshal response failed", logging.CommandKey, "lsmdiskgrp", "body", string(body))
 		return nil, err
 	}
 
@@ -343,16 +771,16 @@ func (c *FSRestClient) Lsmdiskgrp() (PoolList, error) {
 
 type MDisksList []map[string]interface{}
 
-func (c *FSRestClient) LsAllMDisk() (MDisksList, error) {
+func (c *FSRestClient) LsAllMDisk(ctx context.Context) (MDisksList, error) {
 	jsonStr := `{"gui":true,"bytes":true}`
-	body, err := c.retryDo(fmt.Sprintf("%s/%s", c.BaseURL, "lsmdisk"), jsonStr)
+	body, err := c.retryDo(ctx, "lsmdisk", jsonStr)
 	if err != nil {
 		return nil, err
 	}
 
 	var stats MDisksList
 	if err = json.Unmarshal(body, &stats); err != nil {
-		log.Errorf("Lsmdisk for list err %v, body %s", err, body)
+		c.logger().Error(err, "Unmarshal response failed", logging.CommandKey, "lsmdisk", "body", string(body))
 		return nil, err
 	}
 
@@ -361,30 +789,52 @@ func (c *FSRestClient) LsAllMDisk() (MDisksList, error) {
 
 type SingleMDiskInfo map[string]interface{}
 
-func (c *FSRestClient) LsSingleMDisk(diskID int) (SingleMDiskInfo, error) {
+func (c *FSRestClient) LsSingleMDisk(ctx context.Context, diskID int) (SingleMDiskInfo, error) {
 	jsonStr := `{"gui":true,"bytes":true}`
-	body, err := c.retryDo(fmt.Sprintf("%s/%s/%d", c.BaseURL, "lsmdisk", diskID), jsonStr)
+	body, err := c.retryDo(ctx, fmt.Sprintf("lsmdisk/%d", diskID), jsonStr)
 	if err != nil {
 		return nil, err
 	}
 
 	var stats SingleMDiskInfo
 	if err = json.Unmarshal(body, &stats); err != nil {
-		log.Errorf("Lsmdisk for single disk err %v, body %s", err, body)
+		c.logger().Error(err, "Unmarshal response failed", logging.CommandKey, "lsmdisk", "mdisk", diskID, "body", string(body))
 		return nil, err
 	}
 
 	return stats, nil
 }
 
-func (c *FSRestClient) UpdateCredentials(newConfig Config) error {
+func (c *FSRestClient) UpdateCredentials(ctx context.Context, newConfig Config) error {
 	if !reflect.DeepEqual(newConfig, c.RestConfig) {
 		c.RestConfig = newConfig
-		if err := c.authenticate(); err != nil {
-			log.Errorf("Failed to authenticate rest server, err:%v", err)
+		if err := c.authenticate(ctx); err != nil {
+			c.logger().Error(err, "Failed to authenticate rest server")
 			return err
 		}
 	}
 	return nil
 
 }
+
+// UpdateConfig applies a reloaded exporter config to the existing client.
+// Clients not created by NewFSRestClient keep their BaseURL.
+func (c *FSRestClient) UpdateConfig(exporterConfig config.ExporterConfig) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.Client != nil && c.Client.Timeout != exporterConfig.HTTPTimeout.Duration {
+		c.logger().Info("Update rest client timeout", "timeout", exporterConfig.HTTPTimeout.Duration.String())
+		// The requests in flight keep the client they were sent with
+		client := *c.Client
+		client.Timeout = exporterConfig.HTTPTimeout.Duration
+		c.Client = &client
+	}
+
+	if c.restPort != 0 && c.restPort != exporterConfig.RestPort {
+		c.logger().Info("Update rest server port", "port", exporterConfig.RestPort)
+		c.restPort = exporterConfig.RestPort
+		c.BaseURL = buildBaseURL(c.RestConfig.Host, c.restPort)
+		c.token = nil
+	}
+}
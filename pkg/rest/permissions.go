@@ -0,0 +1,108 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A denied command is retried after this interval, the role of the user may be changed meanwhile
+const PermissionRecheckInterval = time.Minute * 10
+
+// PermissionError is returned when the user role isn't permitted to run the command
+type PermissionError struct {
+	Command string
+	Role    string
+}
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("user role %s isn't permitted to run %s", e.Role, e.Command)
+}
+
+func IsPermissionDenied(err error) bool {
+	var permissionErr *PermissionError
+	return errors.As(err, &permissionErr)
+}
+
+// commandName returns the command of a rest path such as lsmdisk/12.
+func commandName(path string) string {
+	return strings.SplitN(path, "/", 2)[0]
+}
+
+// IsPermitted returns false if the command was denied within PermissionRecheckInterval.
+func (c *FSRestClient) IsPermitted(command string) bool {
+	c.systemLock.RLock()
+	defer c.systemLock.RUnlock()
+	return c.isPermitted(commandName(command))
+}
+
+func (c *FSRestClient) isPermitted(command string) bool {
+	deniedTime, denied := c.deniedCommands[command]
+	return !denied || time.Since(deniedTime) > PermissionRecheckInterval
+}
+
+func (c *FSRestClient) denyCommand(command string) {
+	c.systemLock.Lock()
+	defer c.systemLock.Unlock()
+
+	if c.deniedCommands == nil {
+		c.deniedCommands = map[string]time.Time{}
+	}
+	if _, denied := c.deniedCommands[command]; !denied {
+		c.logger().Info("Command isn't permitted for the user role, skip it", "command", command, "role", c.userRole)
+	}
+	c.deniedCommands[command] = time.Now()
+}
+
+// DeniedCommands returns the commands the user isn't permitted to run, sorted.
+func (c *FSRestClient) DeniedCommands() []string {
+	c.systemLock.RLock()
+	defer c.systemLock.RUnlock()
+
+	var commands []string
+	for command := range c.deniedCommands {
+		if !c.isPermitted(command) {
+			commands = append(commands, command)
+		}
+	}
+	sort.Strings(commands)
+	return commands
+}
+
+// UserRole returns the role found by the last CheckUserRole.
+func (c *FSRestClient) UserRole() string {
+	c.systemLock.RLock()
+	defer c.systemLock.RUnlock()
+	return c.userRole
+}
+
+func (c *FSRestClient) setUserRole(role string) {
+	c.systemLock.Lock()
+	defer c.systemLock.Unlock()
+
+	if role != c.userRole {
+		if c.userRole != "" {
+			c.logger().Info("User role changed, recheck the permitted commands", "role", role, "previousRole", c.userRole)
+		}
+		c.userRole = role
+		c.deniedCommands = nil
+	}
+}
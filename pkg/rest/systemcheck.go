@@ -17,40 +17,114 @@
 package rest
 
 import (
+	"context"
 	"fmt"
 	"strings"
+	"time"
 
-	log "k8s.io/klog"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/config"
 )
 
 const (
-	VersionKey   = "code_level"
-	UserRoleKey  = "role"
-	ValidVersion = "8.3.1"
+	VersionKey  = "code_level"
+	TopologyKey = "topology"
+	TimeZoneKey = "time_zone"
+	UserRoleKey = "role"
 )
 
-func (c *FSRestClient) CheckVersion() (bool, error) {
-	systeminfo, err := c.Lssystem()
+// System topologies of lssystem
+const (
+	TopologyStandard  = "standard"
+	TopologyStretched = "stretched"
+	TopologyHyperSwap = "hyperswap"
+)
+
+func (c *FSRestClient) CheckVersion(ctx context.Context) (bool, error) {
+	systeminfo, err := c.Lssystem(ctx)
 	if err != nil {
-		log.Errorf("get flash system version error: %v", err)
+		c.logger().Error(err, "get flash system version error")
 		return false, err
 	}
 
 	version := systeminfo[VersionKey].(string)
 	versions := strings.Split(version, " ")
-	// Compare
-	validversion := normalizeVersion(ValidVersion, 2, 4)
-	systemversion := normalizeVersion(versions[0], 2, 4)
+	topology, _ := systeminfo[TopologyKey].(string)
+	if topology == "" {
+		topology = TopologyStandard
+	}
+	c.updateSystem(versions[0], topology, systemLocation(systeminfo))
 
-	bValid := systemversion >= validversion
+	// Compare
+	minVersion := config.Get().MinimumVersion
+	bValid := CompareVersion(versions[0], minVersion) >= 0
 	if !bValid {
-		log.Errorf("Unsupported version %s. Supported version above than %s", version, ValidVersion)
+		c.logger().Info("Unsupported version", "version", version, "minimumVersion", minVersion)
 	}
 	return bValid, nil
 }
 
-func (c *FSRestClient) CheckUserRole() (bool, error) {
-	userinfo, err := c.Lscurrentuser()
+// updateSystem keeps the capabilities of the code level, the topology and the
+// time zone of the system.
+func (c *FSRestClient) updateSystem(codeLevel string, topology string, location *time.Location) {
+	c.systemLock.Lock()
+	defer c.systemLock.Unlock()
+
+	if codeLevel != c.capabilities.CodeLevel {
+		c.capabilities = CapabilitiesForCodeLevel(codeLevel)
+		c.logger().Info("Detected flash system capabilities", "version", codeLevel, "capabilities", c.capabilities.Supported())
+	}
+	if topology != c.topology {
+		c.topology = topology
+		c.logger().Info("Detected flash system topology", "topology", topology)
+	}
+	c.location = location
+}
+
+// Capabilities returns the capabilities detected by the last CheckVersion.
+func (c *FSRestClient) Capabilities() Capabilities {
+	c.systemLock.RLock()
+	defer c.systemLock.RUnlock()
+	return c.capabilities
+}
+
+// Topology returns the system topology detected by the last CheckVersion.
+func (c *FSRestClient) Topology() string {
+	c.systemLock.RLock()
+	defer c.systemLock.RUnlock()
+	if c.topology == "" {
+		return TopologyStandard
+	}
+	return c.topology
+}
+
+// Location returns the time zone of the system detected by the last
+// CheckVersion, the times of the system commands are in this zone.
+func (c *FSRestClient) Location() *time.Location {
+	c.systemLock.RLock()
+	defer c.systemLock.RUnlock()
+	if c.location == nil {
+		return time.UTC
+	}
+	return c.location
+}
+
+// systemLocation returns the time zone of lssystem, such as "522 UTC" or
+// "415 Europe/London", UTC if it isn't known.
+func systemLocation(systeminfo StorageSystem) *time.Location {
+	timeZone, _ := systeminfo[TimeZoneKey].(string)
+	fields := strings.Fields(timeZone)
+	if len(fields) == 0 {
+		return time.UTC
+	}
+	location, err := time.LoadLocation(fields[len(fields)-1])
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+func (c *FSRestClient) CheckUserRole(ctx context.Context) (bool, error) {
+	userinfo, err := c.Lscurrentuser(ctx)
 	if err != nil {
 		return false, err
 	}
@@ -58,17 +132,24 @@ func (c *FSRestClient) CheckUserRole() (bool, error) {
 	for _, info := range userinfo {
 		role, bHas := info[UserRoleKey]
 		if bHas {
-			switch role {
-			case "Administrator", "SecurityAdmin", "RestrictedAdmin":
+			roleName := fmt.Sprintf("%v", role)
+			c.setUserRole(roleName)
+			switch roleName {
+			case "Monitor", "Administrator", "SecurityAdmin", "RestrictedAdmin":
 				return true, nil
 			}
-			log.Infof("The current user role is %v.", role)
+			c.logger().Info("The current user role isn't supported", "role", role)
 		}
 	}
 	return false, nil
 }
 
 func (c *FSRestClient) isHealth(status string) bool {
+	return IsNodeHealthy(status)
+}
+
+// IsNodeHealthy returns whether the node status of lsnode is healthy.
+func IsNodeHealthy(status string) bool {
 	switch status {
 	case "starting", "service", "pending", "offline", "flushing", "deleting", "adding":
 		return false
@@ -76,8 +157,8 @@ func (c *FSRestClient) isHealth(status string) bool {
 	return true
 }
 
-func (c *FSRestClient) CheckFlashsystemClusterState() (bool, error) {
-	nodes, err := c.Lsnode()
+func (c *FSRestClient) CheckFlashsystemClusterState(ctx context.Context) (bool, error) {
+	nodes, err := c.Lsnode(ctx)
 	if err != nil {
 		return false, err
 	}
@@ -85,7 +166,7 @@ func (c *FSRestClient) CheckFlashsystemClusterState() (bool, error) {
 	iogrps := map[string]int{}
 	for _, node := range nodes {
 		if !c.isHealth(node["status"]) {
-			log.Infof("The node %s id %s status %s is unhealthy.", node["name"], node["id"], node["status"])
+			c.logger().Info("The node is unhealthy", "node", node["name"], "nodeId", node["id"], "status", node["status"])
 			return false, nil
 		}
 		iogrps[node["IO_group_name"]]++
@@ -94,7 +175,7 @@ func (c *FSRestClient) CheckFlashsystemClusterState() (bool, error) {
 	// Check grpName io_grp0-3 to ensure the node_count is 1, in not HA mode
 	for grpName, nodeCnt := range iogrps {
 		if nodeCnt == 1 && strings.HasPrefix(grpName, "io_grp") {
-			log.Infof("The iogrp %s node count is 1.", grpName)
+			c.logger().Info("The iogrp node count is 1", "iogrp", grpName)
 			return false, nil
 		}
 	}
@@ -17,9 +17,21 @@
 package rest
 
 import (
+	"context"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/config"
 	drivermanager "github.com/IBM/ibm-storage-odf-block-driver/pkg/driver"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"net/http"
+	"sync"
 	"testing"
+	"time"
 )
 
 var body string
@@ -40,7 +52,7 @@ func TestNormalizeVersion(t *testing.T) {
 	// Happy path
 	t.Run("Check valid version", func(t *testing.T) {
 		body = `{"code_level": "8.4.0.2 (build 152.23.2102111856000)"}`
-		valid, err := c.CheckVersion()
+		valid, err := c.CheckVersion(context.Background())
 		if err != nil || !valid {
 			t.Errorf("Check version should return true.")
 		}
@@ -49,13 +61,26 @@ func TestNormalizeVersion(t *testing.T) {
 	// Unhappy path
 	t.Run("Check invalid Version", func(t *testing.T) {
 		body = `{"code_level": "8.1.0.2 (build 152.23.2102111856000)"}`
-		valid, _ := c.CheckVersion()
+		valid, _ := c.CheckVersion(context.Background())
 		if valid {
 			t.Errorf("Check version should return false.")
 		}
 	})
 }
 
+func TestLocation(t *testing.T) {
+	body = `{"code_level": "8.4.0.2 (build 152.23.2102111856000)", "time_zone": "522 UTC"}`
+	if _, err := c.CheckVersion(context.Background()); err != nil || c.Location() != time.UTC {
+		t.Errorf("Location should be UTC, got %v", c.Location())
+	}
+
+	// Unknown time zones fall back to UTC
+	body = `{"code_level": "8.4.0.2 (build 152.23.2102111856000)", "time_zone": "999 Unknown/Zone"}`
+	if _, err := c.CheckVersion(context.Background()); err != nil || c.Location() != time.UTC {
+		t.Errorf("Location should fall back to UTC, got %v", c.Location())
+	}
+}
+
 func TestIsHealth(t *testing.T) {
 	// Happy path
 	t.Run("health check state", func(t *testing.T) {
@@ -78,7 +103,7 @@ func TestUserRole(t *testing.T) {
 
 	t.Run("Check User Administrator", func(t *testing.T) {
 		body = `[{"name":"u1"},{"role":"Administrator"},{"owner_id":""}]`
-		valid, _ := c.CheckUserRole()
+		valid, _ := c.CheckUserRole(context.Background())
 		if !valid {
 			t.Errorf("Check user role should return true for role Administrator.")
 		}
@@ -86,7 +111,7 @@ func TestUserRole(t *testing.T) {
 
 	t.Run("Check User SecurityAdmin", func(t *testing.T) {
 		body = `[{"name":"u1"},{"role":"SecurityAdmin"},{"owner_id":""}]`
-		valid, _ := c.CheckUserRole()
+		valid, _ := c.CheckUserRole(context.Background())
 		if !valid {
 			t.Errorf("Check user role should return true role  SecurityAdmin.")
 		}
@@ -94,7 +119,7 @@ func TestUserRole(t *testing.T) {
 
 	t.Run("Check User RestrictedAdmin", func(t *testing.T) {
 		body = `[{"name":"u1"},{"role":"RestrictedAdmin"},{"owner_id":""}]`
-		valid, _ := c.CheckUserRole()
+		valid, _ := c.CheckUserRole(context.Background())
 		if !valid {
 			t.Errorf("Check user role should return true for role RestrictedAdmin.")
 		}
@@ -102,13 +127,107 @@ func TestUserRole(t *testing.T) {
 
 	t.Run("Check User Monitor", func(t *testing.T) {
 		body = `[{"name":"u1"},{"role":"Monitor"},{"owner_id":""}]`
-		valid, _ := c.CheckUserRole()
+		valid, _ := c.CheckUserRole(context.Background())
+		if !valid || c.UserRole() != "Monitor" {
+			t.Errorf("Check user role should return true for role Monitor.")
+		}
+	})
+
+	t.Run("Check User VasaProvider", func(t *testing.T) {
+		body = `[{"name":"u1"},{"role":"VasaProvider"},{"owner_id":""}]`
+		valid, _ := c.CheckUserRole(context.Background())
 		if valid {
-			t.Errorf("Check user role should return false for role Monitor.")
+			t.Errorf("Check user role should return false for role VasaProvider.")
+		}
+	})
+}
+
+func TestPermissionDenied(t *testing.T) {
+	calls := 0
+	cl := FSRestClient{BaseURL: "https://my-url/rest", userRole: "Monitor", PostRequester: &Requester{
+		poster: func(req *http.Request, c *FSRestClient) ([]byte, int, error) {
+			calls++
+			return []byte(`CMMVC7205E The command failed because it is not supported.`), http.StatusForbidden, nil
+		},
+	}}
+
+	t.Run("Deny the command on forbidden response", func(t *testing.T) {
+		_, err := cl.retryDo(context.Background(), "lsdumps/iostats", "")
+		if !IsPermissionDenied(err) || calls != 2 {
+			t.Errorf("retryDo should return permission error after one retry with a fresh token, got %v after %d calls", err, calls)
+		}
+		if cl.IsPermitted("lsdumps") || len(cl.DeniedCommands()) != 1 || cl.DeniedCommands()[0] != "lsdumps" {
+			t.Errorf("lsdumps should be denied, got %v", cl.DeniedCommands())
+		}
+	})
+
+	t.Run("Skip the denied command", func(t *testing.T) {
+		_, err := cl.retryDo(context.Background(), "lsdumps", "")
+		if !IsPermissionDenied(err) || calls != 2 {
+			t.Errorf("denied command shouldn't be sent again, got %d calls", calls)
+		}
+	})
+
+	t.Run("Recheck after role change", func(t *testing.T) {
+		cl.setUserRole("Administrator")
+		if !cl.IsPermitted("lsdumps") {
+			t.Errorf("denied commands should be reset after role change")
 		}
 	})
 }
 
+func TestForbiddenExpiredToken(t *testing.T) {
+	calls := 0
+	cl := FSRestClient{BaseURL: "https://my-url/rest", userRole: "Monitor", PostRequester: &Requester{
+		poster: func(req *http.Request, c *FSRestClient) ([]byte, int, error) {
+			calls++
+			if calls == 1 {
+				return []byte(`CMMVC7205E The command failed because it is not supported.`), http.StatusForbidden, nil
+			}
+			return []byte(`[]`), http.StatusOK, nil
+		},
+	}}
+
+	body, err := cl.retryDo(context.Background(), "lsdumps", "")
+	if err != nil || string(body) != "[]" || calls != 2 {
+		t.Errorf("retryDo should succeed with a fresh token, got %v after %d calls", err, calls)
+	}
+	if !cl.IsPermitted("lsdumps") {
+		t.Errorf("lsdumps shouldn't be denied when the fresh token is permitted")
+	}
+}
+
+func TestConcurrentPermissions(t *testing.T) {
+	cl := &FSRestClient{BaseURL: "https://my-url/rest", userRole: "Monitor", PostRequester: &Requester{
+		poster: func(req *http.Request, c *FSRestClient) ([]byte, int, error) {
+			if req.URL.Path == "/rest/lssystem" {
+				return []byte(`{"code_level":"8.5.0.0 (build 157.12.2203111203000)","topology":"hyperswap","time_zone":"522 UTC"}`), 200, nil
+			}
+			return []byte(`CMMVC7205E The command failed because it is not supported.`), http.StatusForbidden, nil
+		},
+	}}
+
+	// Run with -race, the scrapes of two Prometheus replicas run concurrently
+	var wg sync.WaitGroup
+	for _, command := range []string{"lsdumps", "lsnode", "lsarray", "lsdrive"} {
+		wg.Add(1)
+		go func(command string) {
+			defer wg.Done()
+			_, _ = cl.retryDo(context.Background(), command, "")
+			_, _ = cl.CheckVersion(context.Background())
+			_ = cl.DeniedCommands()
+			_ = cl.Capabilities()
+			_ = cl.Topology()
+			_ = cl.Location()
+		}(command)
+	}
+	wg.Wait()
+
+	if denied := cl.DeniedCommands(); len(denied) != 4 || cl.Topology() != TopologyHyperSwap {
+		t.Errorf("expected the 4 commands denied on a hyperswap system, got %v %s", denied, cl.Topology())
+	}
+}
+
 func TestCheckFlashsystemClusterState(t *testing.T) {
 	n1 := `{"name":"node1","id":"1","status":"online","IO_group_name":"io_grp0"}`
 	n2 := `{"name":"node2","id":"2","status":"online","IO_group_name":"io_grp0"}`
@@ -118,7 +237,7 @@ func TestCheckFlashsystemClusterState(t *testing.T) {
 
 	t.Run("Check cluster state: node online, iogrp health", func(t *testing.T) {
 		body = "[" + n1 + "," + n2 + "]"
-		valid, _ := c.CheckFlashsystemClusterState()
+		valid, _ := c.CheckFlashsystemClusterState(context.Background())
 		if !valid {
 			t.Errorf("CheckFlashsystemClusterState should return true for node online and iogrp health.")
 		}
@@ -126,7 +245,7 @@ func TestCheckFlashsystemClusterState(t *testing.T) {
 
 	t.Run("Check cluster state: node ofline, iogrp health", func(t *testing.T) {
 		body = "[" + n1 + "," + n2 + "," + n3 + "," + n4 + "]"
-		valid, _ := c.CheckFlashsystemClusterState()
+		valid, _ := c.CheckFlashsystemClusterState(context.Background())
 		if valid {
 			t.Errorf("CheckFlashsystemClusterState should return false for node online and iogrp health.")
 		}
@@ -134,7 +253,7 @@ func TestCheckFlashsystemClusterState(t *testing.T) {
 
 	t.Run("Check cluster state: node online, iogrp Unhealth", func(t *testing.T) {
 		body = "[" + n1 + "," + n2 + "," + n5 + "]"
-		valid, _ := c.CheckFlashsystemClusterState()
+		valid, _ := c.CheckFlashsystemClusterState(context.Background())
 		if valid {
 			t.Errorf("CheckFlashsystemClusterState should return false for node online and iogrp Unhealth.")
 		}
@@ -145,7 +264,7 @@ func TestLssystem(t *testing.T) {
 	// Happy path
 	t.Run("run successful lssystem", func(t *testing.T) {
 		body = `{"id": "0000020420E0E8DC", "name": "fab3p-159-c", "location": "local"}`
-		_, err := c.Lssystem()
+		_, err := c.Lssystem(context.Background())
 		if err != nil {
 			t.Errorf("lssystem check should return without error")
 		}
@@ -154,7 +273,7 @@ func TestLssystem(t *testing.T) {
 	// unhappy path
 	t.Run("run failed lssystem", func(t *testing.T) {
 		body = ``
-		_, err := c.Lssystem()
+		_, err := c.Lssystem(context.Background())
 		if err == nil {
 			t.Errorf("lssystem check should return error ")
 		}
@@ -165,7 +284,7 @@ func TestLsnode(t *testing.T) {
 	// Happy path
 	t.Run("run successful lsnode", func(t *testing.T) {
 		body = `[{"name":"node1", "id":"1", "status":"online", "IO_group_name":"io_grp0"}]`
-		_, err := c.Lsnode()
+		_, err := c.Lsnode(context.Background())
 		if err != nil {
 			t.Errorf("lsnode check should return without error")
 		}
@@ -174,7 +293,7 @@ func TestLsnode(t *testing.T) {
 	// unhappy path
 	t.Run("run failed lsnode", func(t *testing.T) {
 		body = ``
-		_, err := c.Lsnode()
+		_, err := c.Lsnode(context.Background())
 		if err == nil {
 			t.Errorf("lsnode check should return error")
 		}
@@ -185,7 +304,7 @@ func TestLssystemstats(t *testing.T) {
 	// Happy path
 	t.Run("run successful Lssystemstats", func(t *testing.T) {
 		body = `[{"stat_name": "vdisk_r_mb", "stat_current": "5", "stat_peak": "0" ,"stat_peak_time": "210604162102"}]`
-		_, err := c.Lssystemstats()
+		_, err := c.Lssystemstats(context.Background())
 		if err != nil {
 			t.Errorf("Lssystemstats check should return without error")
 		}
@@ -194,7 +313,7 @@ func TestLssystemstats(t *testing.T) {
 	// unhappy path
 	t.Run("run failed Lssystemstats", func(t *testing.T) {
 		body = ``
-		_, err := c.Lssystemstats()
+		_, err := c.Lssystemstats(context.Background())
 		if err == nil {
 			t.Errorf("Lssystemstats check should return error")
 		}
@@ -205,7 +324,7 @@ func TestLscurrentuser(t *testing.T) {
 	// Happy path
 	t.Run("run successful Lscurrentuser", func(t *testing.T) {
 		body = `[{"name": "superuser", "role": "Administrator"}]`
-		_, err := c.Lscurrentuser()
+		_, err := c.Lscurrentuser(context.Background())
 		if err != nil {
 			t.Errorf("Lscurrentuser check should return without error")
 		}
@@ -214,7 +333,7 @@ func TestLscurrentuser(t *testing.T) {
 	// unhappy path
 	t.Run("run failed Lscurrentuser", func(t *testing.T) {
 		body = ``
-		_, err := c.Lscurrentuser()
+		_, err := c.Lscurrentuser(context.Background())
 		if err == nil {
 			t.Errorf("Lscurrentuser check should return error")
 		}
@@ -225,7 +344,7 @@ func TestLsmdiskgrp(t *testing.T) {
 	// Happy path
 	t.Run("run successful Lsmdiskgrp", func(t *testing.T) {
 		body = `[{"id": "0", "name": "Pool0", "status": "online"}]`
-		_, err := c.Lsmdiskgrp()
+		_, err := c.Lsmdiskgrp(context.Background())
 		if err != nil {
 			t.Errorf("Lsmdiskgrp check should return without error")
 		}
@@ -234,17 +353,50 @@ func TestLsmdiskgrp(t *testing.T) {
 	// unhappy path
 	t.Run("run failed Lsmdiskgrp", func(t *testing.T) {
 		body = ``
-		_, err := c.Lsmdiskgrp()
+		_, err := c.Lsmdiskgrp(context.Background())
 		if err == nil {
 			t.Errorf("Lsmdiskgrp check should return error")
 		}
 	})
 }
 
+func TestLsdumps(t *testing.T) {
+	var requestBody string
+	cl := FSRestClient{DriverManager: &manager1, PostRequester: &Requester{
+		poster: func(req *http.Request, c *FSRestClient) ([]byte, int, error) {
+			content, _ := io.ReadAll(req.Body)
+			requestBody = string(content)
+			return []byte(body), 200, nil
+		},
+	}}
+
+	t.Run("run successful Lsdumps", func(t *testing.T) {
+		body = `[{"id":"0","filename":"Nv_stats_node1_210604_161807"}]`
+		dumps, err := cl.Lsdumps(context.Background(), "/dumps/iostats")
+		if err != nil || len(dumps) != 1 || dumps[0]["filename"] != "Nv_stats_node1_210604_161807" {
+			t.Errorf("Lsdumps should return the files, got %v %v", dumps, err)
+		}
+		if requestBody != `{"prefix":"/dumps/iostats"}` {
+			t.Errorf("unexpected request %s", requestBody)
+		}
+	})
+
+	t.Run("run successful Download", func(t *testing.T) {
+		body = `<diskStatsColl/>`
+		content, err := cl.Download(context.Background(), "/dumps/iostats", "Nv_stats_node1_210604_161807")
+		if err != nil || string(content) != body {
+			t.Errorf("Download should return the file, got %s %v", content, err)
+		}
+		if requestBody != `{"prefix":"/dumps/iostats","filename":"Nv_stats_node1_210604_161807"}` {
+			t.Errorf("unexpected request %s", requestBody)
+		}
+	})
+}
+
 func TestNewFSRestClient(t *testing.T) {
 	// unHappy path
 	t.Run("run successful NewFSRestClient", func(t *testing.T) {
-		_, err := c.NewFSRestClient(config1, &manager1)
+		_, err := c.NewFSRestClient(context.Background(), config1, &manager1)
 		if err == nil {
 			t.Errorf("NewFSRestClient check should return with error")
 		}
@@ -255,9 +407,103 @@ func TestRetryDo(t *testing.T) {
 	// Happy path
 	t.Run("run successful retryDo", func(t *testing.T) {
 		body = `{"id": "0000020420E0E8DC", "name": "fab3p-159-c", "location": "local"}`
-		_, err := c.retryDo("https://my-url", "lssystem")
+		_, err := c.retryDo(context.Background(), "lssystem", "")
 		if err != nil {
 			t.Errorf("retryDo check should return without error")
 		}
 	})
 }
+
+func TestRetryDoSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	t.Run("record span of rest command", func(t *testing.T) {
+		body = `{"id": "0000020420E0E8DC", "name": "fab3p-159-c", "location": "local"}`
+		cl := &FSRestClient{BaseURL: "https://my-url/rest", PostRequester: c.PostRequester}
+		if _, err := cl.retryDo(context.Background(), "lssystem", ""); err != nil {
+			t.Errorf("retryDo check should return without error")
+		}
+
+		spans := recorder.Ended()
+		if len(spans) != 1 || spans[0].Name() != "rest lssystem" {
+			t.Fatalf("retryDo should record one span for lssystem, got %d", len(spans))
+		}
+		attrs := map[attribute.Key]attribute.Value{}
+		for _, kv := range spans[0].Attributes() {
+			attrs[kv.Key] = kv.Value
+		}
+		if attrs[tracing.StatusCodeKey].AsInt64() != http.StatusOK || attrs[tracing.AttemptsKey].AsInt64() != 1 ||
+			attrs[tracing.ResponseBytesKey].AsInt64() != int64(len(body)) {
+			t.Errorf("unexpected span attributes %v", attrs)
+		}
+	})
+}
+
+func TestCapabilities(t *testing.T) {
+	t.Run("Detect capabilities on check version", func(t *testing.T) {
+		body = `{"code_level": "8.4.0.2 (build 152.23.2102111856000)"}`
+		if _, err := c.CheckVersion(context.Background()); err != nil {
+			t.Fatalf("Check version should return without error")
+		}
+		caps := c.Capabilities()
+		if caps.CodeLevel != "8.4.0.2" || !caps.Has(FeatureDataReductionPool) || !caps.Has(FieldMDiskEffectiveUsedCapacity) {
+			t.Errorf("8.4.0.2 should support data reduction pools and FCM fields")
+		}
+		if caps.Has(FeatureSnapshots) || caps.Has(FeaturePartitions) {
+			t.Errorf("8.4.0.2 shouldn't support snapshots or partitions")
+		}
+	})
+
+	t.Run("Check capabilities of old code level", func(t *testing.T) {
+		caps := CapabilitiesForCodeLevel("8.1.0.1")
+		if caps.Has(FeatureDataReductionPool) || caps.Has(FieldPoolReclaimableCapacity) || !caps.Has(CommandLssystemstats) {
+			t.Errorf("unexpected capabilities of 8.1.0.1: %v", caps.Supported())
+		}
+	})
+
+	t.Run("Assume all capabilities before detection", func(t *testing.T) {
+		if !(Capabilities{}).Has(FeaturePartitions) {
+			t.Errorf("undetected capabilities should assume the capability is available")
+		}
+	})
+
+	t.Run("Compare code levels", func(t *testing.T) {
+		if CompareVersion("8.6.10", "8.6.9") != 1 || CompareVersion("8.5", "8.5.0.0") != 0 || CompareVersion("8.3.1", "8.4") != -1 {
+			t.Errorf("CompareVersion returned wrong result")
+		}
+	})
+}
+
+func TestUpdateConfig(t *testing.T) {
+	token := "token"
+	client := &http.Client{Timeout: time.Second}
+	cl := &FSRestClient{BaseURL: buildBaseURL("FS-Host", 7443), RestConfig: Config{Host: "FS-Host"}, Client: client, restPort: 7443, token: &token,
+		PostRequester: &Requester{poster: func(req *http.Request, c *FSRestClient) ([]byte, int, error) {
+			return []byte(`{}`), 200, nil
+		}}}
+
+	exporterConfig := config.Default()
+	exporterConfig.RestPort = 8443
+	exporterConfig.HTTPTimeout = metav1.Duration{Duration: time.Minute}
+
+	// Run with -race, the reload changes the client while requests are sent
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = cl.retryDo(context.Background(), "lssystem", "")
+		}()
+	}
+	cl.UpdateConfig(exporterConfig)
+	wg.Wait()
+
+	if cl.BaseURL != "https://FS-Host:8443/rest" || cl.token != nil {
+		t.Errorf("expected the new rest port and no token, got %s %v", cl.BaseURL, cl.token)
+	}
+	if cl.Client.Timeout != time.Minute || client.Timeout != time.Second {
+		t.Errorf("expected a new client with the new timeout, got %v %v", cl.Client.Timeout, client.Timeout)
+	}
+}
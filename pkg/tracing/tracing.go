@@ -0,0 +1,186 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/config"
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/logging"
+)
+
+const (
+	TracerName  = "github.com/IBM/ibm-storage-odf-block-driver"
+	ServiceName = "ibm-storage-odf-block-driver"
+
+	shutdownTimeout = 5 * time.Second
+)
+
+// Span attribute keys
+const (
+	SystemKey        = "flashsystem.name"
+	PoolKey          = "flashsystem.pool"
+	CommandKey       = "flashsystem.rest.command"
+	AttemptKey       = "flashsystem.rest.attempt"
+	AttemptsKey      = "flashsystem.rest.attempts"
+	ResponseBytesKey = "flashsystem.rest.response_bytes"
+	StatusCodeKey    = "http.status_code"
+	ConditionKey     = "k8s.condition.type"
+)
+
+var (
+	lock     sync.Mutex
+	provider *sdktrace.TracerProvider
+)
+
+// Init installs the global tracer provider and replaces it when the tracing
+// config is changed by a reload.
+func Init(cfg config.TracingConfig) error {
+	if err := apply(cfg); err != nil {
+		return err
+	}
+
+	config.OnChange(func(oldConfig, newConfig config.ExporterConfig) {
+		if oldConfig.Tracing != newConfig.Tracing {
+			if err := apply(newConfig.Tracing); err != nil {
+				logging.Error(err, "Apply tracing config failed")
+			}
+		}
+	})
+	return nil
+}
+
+func apply(cfg config.TracingConfig) error {
+	tp, err := newProvider(cfg)
+	if err != nil {
+		return err
+	}
+
+	lock.Lock()
+	oldProvider := provider
+	provider = tp
+	lock.Unlock()
+
+	if tp != nil {
+		otel.SetTracerProvider(tp)
+	} else {
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	}
+	logging.Info("Tracing configured", "exporter", cfg.Exporter, "endpoint", cfg.Endpoint)
+
+	if oldProvider != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err = oldProvider.Shutdown(ctx); err != nil {
+			logging.Error(err, "Shutdown previous tracer provider failed")
+		}
+	}
+	return nil
+}
+
+func newProvider(cfg config.TracingConfig) (*sdktrace.TracerProvider, error) {
+	exporter, err := newExporter(cfg)
+	if err != nil || exporter == nil {
+		return nil, err
+	}
+
+	res := resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(ServiceName))
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(newSampler(cfg.SampleRatio)),
+	), nil
+}
+
+// newExporter returns the span exporter of the config, nil if tracing is disabled.
+func newExporter(cfg config.TracingConfig) (sdktrace.SpanExporter, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch cfg.Exporter {
+	case config.TracingExporterNone, "":
+		return nil, nil
+	case config.TracingExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case config.TracingExporterOTLP:
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(context.Background(), opts...)
+	default:
+		return nil, fmt.Errorf("unsupported trace exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create %s trace exporter failed: %w", cfg.Exporter, err)
+	}
+	return exporter, nil
+}
+
+// newSampler samples the ratio of the collection cycles, the spans of a
+// sampled cycle are all kept.
+func newSampler(ratio float64) sdktrace.Sampler {
+	return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))
+}
+
+// Shutdown flushes the pending spans.
+func Shutdown(ctx context.Context) error {
+	lock.Lock()
+	tp := provider
+	provider = nil
+	lock.Unlock()
+
+	if tp == nil {
+		return nil
+	}
+	return tp.Shutdown(ctx)
+}
+
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// Start starts a span with the tracer of the driver.
+func Start(ctx context.Context, spanName string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return Tracer().Start(ctx, spanName, opts...)
+}
+
+// RecordError marks the span failed.
+func RecordError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
@@ -0,0 +1,123 @@
+/**
+ * Copyright contributors to the ibm-storage-odf-block-driver project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/IBM/ibm-storage-odf-block-driver/pkg/config"
+)
+
+func TestNewExporter(t *testing.T) {
+	t.Run("none disables tracing", func(t *testing.T) {
+		for _, name := range []string{config.TracingExporterNone, ""} {
+			exporter, err := newExporter(config.TracingConfig{Exporter: name})
+			if err != nil || exporter != nil {
+				t.Errorf("expected no exporter for %q, got %v, %v", name, exporter, err)
+			}
+		}
+	})
+
+	t.Run("stdout", func(t *testing.T) {
+		exporter, err := newExporter(config.TracingConfig{Exporter: config.TracingExporterStdout})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, ok := exporter.(*stdouttrace.Exporter); !ok {
+			t.Errorf("expected the stdout exporter, got %T", exporter)
+		}
+	})
+
+	t.Run("otlp", func(t *testing.T) {
+		exporter, err := newExporter(config.TracingConfig{Exporter: config.TracingExporterOTLP, Endpoint: "localhost:4318", Insecure: true})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, ok := exporter.(*stdouttrace.Exporter); ok || exporter == nil {
+			t.Errorf("expected the otlp exporter, got %T", exporter)
+		}
+		_ = exporter.Shutdown(context.Background())
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		if _, err := newExporter(config.TracingConfig{Exporter: "jaeger"}); err == nil {
+			t.Error("expected an error for an unsupported exporter")
+		}
+	})
+}
+
+func TestNewSampler(t *testing.T) {
+	traceID := trace.TraceID{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	sample := func(ratio float64, parent trace.SpanContext) sdktrace.SamplingDecision {
+		return newSampler(ratio).ShouldSample(sdktrace.SamplingParameters{
+			ParentContext: trace.ContextWithSpanContext(context.Background(), parent),
+			TraceID:       traceID,
+			Name:          "Collect",
+		}).Decision
+	}
+
+	if decision := sample(1, trace.SpanContext{}); decision != sdktrace.RecordAndSample {
+		t.Errorf("expected a root span to be sampled with ratio 1, got %v", decision)
+	}
+	if decision := sample(0, trace.SpanContext{}); decision != sdktrace.Drop {
+		t.Errorf("expected a root span to be dropped with ratio 0, got %v", decision)
+	}
+
+	// The spans of a sampled collection cycle are kept whatever the ratio
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+	})
+	if decision := sample(0, parent); decision != sdktrace.RecordAndSample {
+		t.Errorf("expected the child of a sampled span to be sampled, got %v", decision)
+	}
+	unsampled := parent.WithTraceFlags(0)
+	if decision := sample(1, unsampled); decision != sdktrace.Drop {
+		t.Errorf("expected the child of a dropped span to be dropped, got %v", decision)
+	}
+}
+
+func TestApply(t *testing.T) {
+	defer func() { _ = Shutdown(context.Background()) }()
+
+	if err := apply(config.TracingConfig{Exporter: config.TracingExporterStdout, SampleRatio: 0}); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if _, span := Start(context.Background(), "Collect"); span.IsRecording() {
+		t.Error("expected the span to be dropped with ratio 0")
+	}
+
+	if err := apply(config.TracingConfig{Exporter: config.TracingExporterNone}); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if _, span := Start(context.Background(), "Collect"); span.IsRecording() {
+		t.Error("expected no span without an exporter")
+	}
+	if provider != nil {
+		t.Error("expected the previous provider to be replaced")
+	}
+
+	if err := apply(config.TracingConfig{Exporter: "jaeger"}); err == nil {
+		t.Error("expected an error for an unsupported exporter")
+	}
+}